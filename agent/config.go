@@ -30,4 +30,10 @@ type Config struct {
 	Keepalive   uint
 	Links       map[string]string `json:",omitempty"`
 	PidFile     string
+	// Optional listen address, e.g. 127.0.0.1:9104, for Prometheus to scrape
+	// metrics collected by mm at /metrics.
+	PrometheusAddress string `json:",omitempty"`
+	// Summarize MySQL and the system natively instead of running pt-mysql-summary
+	// and pt-summary. Native summaries don't have Raw output.
+	NativeSummary bool `json:",omitempty"`
 }
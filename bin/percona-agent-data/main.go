@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/data"
 	"github.com/percona/percona-agent/mm"
 	"github.com/percona/percona-agent/qan"
 	"io/ioutil"
@@ -42,16 +43,16 @@ func main() {
 			fmt.Println(err)
 			continue
 		}
-		data := &proto.Data{}
-		if err := json.Unmarshal(content, data); err != nil {
+		protoData := &proto.Data{}
+		if err := json.Unmarshal(content, protoData); err != nil {
 			fmt.Println(err)
 			continue
 		}
-		fmt.Printf("Ts: %s Hostname: %s Service: %s\n", data.Created, data.Hostname, data.Service)
+		fmt.Printf("Ts: %s Hostname: %s Service: %s Encoding: %s\n", protoData.Created, protoData.Hostname, protoData.Service, protoData.ContentEncoding)
 
 		if strings.Contains(file, "mm_") {
 			report := &mm.Report{}
-			if err := json.Unmarshal(data.Data, report); err != nil {
+			if err := data.Decode(protoData.ContentEncoding, protoData.Data, report); err != nil {
 				fmt.Println(err)
 				continue
 			}
@@ -59,7 +60,7 @@ func main() {
 			fmt.Println(string(bytes))
 		} else if strings.Contains(file, "qan_") {
 			report := &qan.Report{}
-			if err := json.Unmarshal(data.Data, report); err != nil {
+			if err := data.Decode(protoData.ContentEncoding, protoData.Data, report); err != nil {
 				fmt.Println(err)
 				continue
 			}
@@ -54,7 +54,7 @@ func (i *Installer) writeConfigs(configs []proto.AgentConfig) error {
 	for _, config := range configs {
 		name := config.InternalService
 		switch name {
-		case "agent", "log", "data", "qan":
+		case "agent", "log", "data":
 		default:
 			name += fmt.Sprintf("-%s-%d", config.ExternalService.Service, config.ExternalService.InstanceId)
 		}
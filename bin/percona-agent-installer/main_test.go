@@ -254,7 +254,7 @@ func (s *MainTestSuite) TestDefaultInstall(t *C) {
 			fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			"qan.conf",
+			fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -333,7 +333,7 @@ func (s *MainTestSuite) TestNonInteractiveInstallWithJustCredentialDetailsFlags(
 			fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			"qan.conf",
+			fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -438,7 +438,7 @@ func (s *MainTestSuite) TestNonInteractiveInstallWithFlagCreateMySQLUserFalse(t
 			fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			"qan.conf",
+			fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -597,7 +597,7 @@ func (s *MainTestSuite) TestInstall(t *C) {
 			fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			"qan.conf",
+			fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -744,7 +744,7 @@ func (s *MainTestSuite) TestInstallWorksWithExistingMySQLInstanceAndInstanceIsUp
 			fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			"qan.conf",
+			fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -927,7 +927,7 @@ func (s *MainTestSuite) TestInstallWithFlagCreateAgentFalse(t *C) {
 			//fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			//fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			//"qan.conf",
+			//fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			//fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -1005,7 +1005,7 @@ func (s *MainTestSuite) TestInstallWithFlagOldPasswordsTrue(t *C) {
 			fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			"qan.conf",
+			fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -1080,7 +1080,7 @@ func (s *MainTestSuite) TestInstallWithFlagApiKey(t *C) {
 			fmt.Sprintf("mm-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("mm-server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("mysql-%d.conf", s.mysqlInstance.Id),
-			"qan.conf",
+			fmt.Sprintf("qan-mysql-%d.conf", s.mysqlInstance.Id),
 			fmt.Sprintf("server-%d.conf", s.serverInstance.Id),
 			fmt.Sprintf("sysconfig-mysql-%d.conf", s.mysqlInstance.Id),
 		},
@@ -1286,7 +1286,7 @@ func (s *MainTestSuite) expectDefaultQanConfig(t *C) {
 	}
 
 	gotConfig := qan.Config{}
-	if err := pct.Basedir.ReadConfig("qan", &gotConfig); err != nil {
+	if err := pct.Basedir.ReadConfig(fmt.Sprintf("qan-mysql-%d", s.mysqlInstance.Id), &gotConfig); err != nil {
 		t.Errorf("Read qan config: %s", err)
 	}
 
@@ -45,7 +45,9 @@ import (
 	pctCmd "github.com/percona/percona-agent/pct/cmd"
 	"github.com/percona/percona-agent/qan"
 	qanFactory "github.com/percona/percona-agent/qan/factory"
+	"github.com/percona/percona-agent/qan/pcap"
 	"github.com/percona/percona-agent/qan/perfschema"
+	"github.com/percona/percona-agent/qan/pgstat"
 	"github.com/percona/percona-agent/qan/slowlog"
 	"github.com/percona/percona-agent/query"
 	"github.com/percona/percona-agent/sysconfig"
@@ -287,6 +289,14 @@ func run() error {
 		itManager.Repo(),
 		mrm,
 	)
+	if agentConfig.PrometheusAddress != "" {
+		exporter := mm.NewExporter(pct.NewLogger(logChan, "mm-prometheus"))
+		if err := exporter.Start(agentConfig.PrometheusAddress); err != nil {
+			return fmt.Errorf("Error starting Prometheus exporter: %s\n", err)
+		}
+		defer exporter.Stop()
+		mmManager.SetExporter(exporter)
+	}
 	if err := mmManager.Start(); err != nil {
 		return fmt.Errorf("Error starting mm manager: %s\n", err)
 	}
@@ -330,9 +340,12 @@ func run() error {
 			qanFactory.NewRealIntervalIterFactory(logChan),
 			slowlog.NewRealWorkerFactory(logChan),
 			perfschema.NewRealWorkerFactory(logChan),
+			pcap.NewRealWorkerFactory(logChan, dataManager.Spooler()),
+			pgstat.NewRealWorkerFactory(logChan),
 			dataManager.Spooler(),
 			clock,
 		),
+		slowlog.NewBackfiller(logChan, dataManager.Spooler()),
 	)
 
 	if err := qanManager.Start(); err != nil {
@@ -351,6 +364,7 @@ func run() error {
 		pct.NewLogger(logChan, "sysinfo-mysql"),
 		itManager.Repo(),
 	)
+	mysqlSysinfoService.Native = agentConfig.NativeSummary
 	if err := sysinfoManager.RegisterService("MySQLSummary", mysqlSysinfoService); err != nil {
 		return fmt.Errorf("Error registering Mysql Sysinfo service: %s\n", err)
 	}
@@ -359,6 +373,7 @@ func run() error {
 	systemSysinfoService := systemSysinfo.NewSystem(
 		pct.NewLogger(logChan, "sysinfo-system"),
 	)
+	systemSysinfoService.Native = agentConfig.NativeSummary
 	if err := sysinfoManager.RegisterService("SystemSummary", systemSysinfoService); err != nil {
 		return fmt.Errorf("Error registering System Sysinfo service: %s\n", err)
 	}
@@ -34,4 +34,13 @@ type Config struct {
 	SendInterval uint
 	Blackhole    bool // don't send if true
 	Limits       proto.DataSpoolLimits
+	// Where to send data: "api" (default), "dir" to write files in SinkDir,
+	// or "http" to POST files to SinkURL.
+	Sink          string `json:",omitempty"`
+	SinkDir       string `json:",omitempty"`
+	SinkFileSize  int64  `json:",omitempty"` // rotate at this size, default 100 MiB
+	SinkFileCount uint   `json:",omitempty"` // keep this many files, 0 = all
+	SinkURL       string `json:",omitempty"`
+	SinkBatchSize uint   `json:",omitempty"` // POST this many files at once, default 1
+	SinkRetries   uint   `json:",omitempty"` // retry failed POST, default 2
 }
@@ -21,11 +21,15 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -530,7 +534,7 @@ func (s *SenderTestSuite) TestSendData(t *C) {
 	spool.FilesOut = []string{"slow001.json"}
 	spool.DataOut = map[string][]byte{"slow001.json": slow001}
 
-	sender := data.NewSender(s.logger, s.client)
+	sender := data.NewSender(s.logger, data.NewApiSink(s.client))
 
 	err = sender.Start(spool, s.tickerChan, 5, false)
 	if err != nil {
@@ -580,7 +584,7 @@ func (s *SenderTestSuite) TestBlackhole(t *C) {
 	spool.FilesOut = []string{"slow001.json"}
 	spool.DataOut = map[string][]byte{"slow001.json": slow001}
 
-	sender := data.NewSender(s.logger, s.client)
+	sender := data.NewSender(s.logger, data.NewApiSink(s.client))
 
 	err = sender.Start(spool, s.tickerChan, 5, true) // <- true = enable blackhole
 	if err != nil {
@@ -613,7 +617,7 @@ func (s *SenderTestSuite) TestSendEmptyFile(t *C) {
 	spool.DataOut = map[string][]byte{"empty.json": []byte{}}
 
 	// Start the sender.
-	sender := data.NewSender(s.logger, s.client)
+	sender := data.NewSender(s.logger, data.NewApiSink(s.client))
 	err := sender.Start(spool, s.tickerChan, 5, false)
 	t.Assert(err, IsNil)
 
@@ -637,7 +641,7 @@ func (s *SenderTestSuite) TestConnectErrors(t *C) {
 	spool.FilesOut = []string{"slow001.json"}
 	spool.DataOut = map[string][]byte{"slow001.json": []byte("...")}
 
-	sender := data.NewSender(s.logger, s.client)
+	sender := data.NewSender(s.logger, data.NewApiSink(s.client))
 
 	err := sender.Start(spool, s.tickerChan, 60, false)
 	t.Assert(err, IsNil)
@@ -691,7 +695,7 @@ func (s *SenderTestSuite) TestRecvErrors(t *C) {
 	spool.FilesOut = []string{"slow001.json"}
 	spool.DataOut = map[string][]byte{"slow001.json": []byte("...")}
 
-	sender := data.NewSender(s.logger, s.client)
+	sender := data.NewSender(s.logger, data.NewApiSink(s.client))
 
 	err := sender.Start(spool, s.tickerChan, 60, false)
 	t.Assert(err, IsNil)
@@ -762,7 +766,7 @@ func (s *SenderTestSuite) Test500Error(t *C) {
 		"file3": []byte("file3"),
 	}
 
-	sender := data.NewSender(s.logger, s.client)
+	sender := data.NewSender(s.logger, data.NewApiSink(s.client))
 	err := sender.Start(spool, s.tickerChan, 5, false)
 	t.Assert(err, IsNil)
 
@@ -815,7 +819,7 @@ func (s *SenderTestSuite) TestBadFiles(t *C) {
 		"file3": []byte("file3"),
 	}
 
-	sender := data.NewSender(s.logger, s.client)
+	sender := data.NewSender(s.logger, data.NewApiSink(s.client))
 	err := sender.Start(spool, s.tickerChan, 5, false)
 	t.Assert(err, IsNil)
 
@@ -855,6 +859,268 @@ func (s *SenderTestSuite) TestBadFiles(t *C) {
 	t.Check(len(spool.RejectedFiles), Equals, 0)
 }
 
+/////////////////////////////////////////////////////////////////////////////
+// DirSink test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type DirSinkTestSuite struct {
+	dir string
+}
+
+var _ = Suite(&DirSinkTestSuite{})
+
+func (s *DirSinkTestSuite) SetUpTest(t *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("/tmp", "percona-agent-data-sink-test")
+	t.Assert(err, IsNil)
+}
+
+func (s *DirSinkTestSuite) TearDownTest(t *C) {
+	if err := os.RemoveAll(s.dir); err != nil {
+		t.Error(err)
+	}
+}
+
+func (s *DirSinkTestSuite) readLines(t *C, file string) []string {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, file))
+	t.Assert(err, IsNil)
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// --------------------------------------------------------------------------
+
+func (s *DirSinkTestSuite) TestSend(t *C) {
+	sink := data.NewDirSink(s.dir, 0, 0)
+
+	_, err := sink.Send([]byte("{}"), 1)
+	t.Check(err, NotNil) // not connected
+
+	err = sink.Connect()
+	t.Assert(err, IsNil)
+
+	d1 := proto.Data{Service: "qan", Data: []byte("1")}
+	d1Bytes, _ := json.Marshal(d1)
+	resp, err := sink.Send(d1Bytes, 1)
+	t.Assert(err, IsNil)
+	t.Check(resp.Code, Equals, uint(200))
+
+	// Data is compacted to one line.
+	resp, err = sink.Send([]byte("{\n  \"Service\": \"mm\"\n}"), 1)
+	t.Assert(err, IsNil)
+	t.Check(resp.Code, Equals, uint(200))
+
+	// Bad data is rejected like the API rejects it.
+	resp, err = sink.Send([]byte("not json"), 1)
+	t.Assert(err, IsNil)
+	t.Check(resp.Code, Equals, uint(400))
+
+	err = sink.Disconnect()
+	t.Assert(err, IsNil)
+
+	files, err := filepath.Glob(filepath.Join(s.dir, data.SINK_FILE_PREFIX+"*"+data.SINK_FILE_SUFFIX))
+	t.Assert(err, IsNil)
+	t.Assert(files, HasLen, 1)
+	lines := s.readLines(t, filepath.Base(files[0]))
+	t.Assert(lines, HasLen, 2)
+	got := proto.Data{}
+	err = json.Unmarshal([]byte(lines[0]), &got)
+	t.Assert(err, IsNil)
+	t.Check(got.Service, Equals, "qan")
+	t.Check(got.Data, DeepEquals, []byte("1"))
+	t.Check(lines[1], Equals, `{"Service":"mm"}`)
+
+	// Reconnecting appends to the newest file because it's not full.
+	err = sink.Connect()
+	t.Assert(err, IsNil)
+	_, err = sink.Send([]byte(`{"Service":"log"}`), 1)
+	t.Assert(err, IsNil)
+	sink.Disconnect()
+	t.Check(s.readLines(t, filepath.Base(files[0])), HasLen, 3)
+}
+
+func (s *DirSinkTestSuite) TestRotate(t *C) {
+	line := []byte(`{"Service":"qan"}`) // 17 bytes + newline
+	// Two lines per file, keep two files.
+	sink := data.NewDirSink(s.dir, int64(len(line)+1)*2, 2)
+
+	err := sink.Connect()
+	t.Assert(err, IsNil)
+	for i := 0; i < 7; i++ {
+		resp, err := sink.Send(line, 1)
+		t.Assert(err, IsNil)
+		t.Assert(resp.Code, Equals, uint(200))
+	}
+	sink.Disconnect()
+
+	// 7 lines = 4 files (2, 2, 2, 1) but only the newest 2 are kept.
+	files, err := filepath.Glob(filepath.Join(s.dir, data.SINK_FILE_PREFIX+"*"))
+	t.Assert(err, IsNil)
+	t.Assert(files, HasLen, 2)
+	t.Check(s.readLines(t, filepath.Base(files[0])), HasLen, 2)
+	t.Check(s.readLines(t, filepath.Base(files[1])), HasLen, 1)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// HttpSink test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type httpReq struct {
+	contentType     string
+	contentEncoding string
+	body            string
+}
+
+type HttpSinkTestSuite struct {
+	logChan    chan *proto.LogEntry
+	logger     *pct.Logger
+	tickerChan chan time.Time
+	server     *httptest.Server
+	reqChan    chan httpReq
+	codes      []int // returned in order, then 200
+}
+
+var _ = Suite(&HttpSinkTestSuite{})
+
+func (s *HttpSinkTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 100)
+	s.logger = pct.NewLogger(s.logChan, "data_test")
+	s.tickerChan = make(chan time.Time, 1)
+	s.reqChan = make(chan httpReq, 10)
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			g, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			body = g
+		}
+		content, _ := ioutil.ReadAll(body)
+		s.reqChan <- httpReq{
+			contentType:     r.Header.Get("Content-Type"),
+			contentEncoding: r.Header.Get("Content-Encoding"),
+			body:            string(content),
+		}
+		code := 200
+		if len(s.codes) > 0 {
+			code = s.codes[0]
+			s.codes = s.codes[1:]
+		} else if strings.Contains(string(content), "bad") {
+			code = 400
+		}
+		w.WriteHeader(code)
+		if code >= 400 {
+			fmt.Fprint(w, "error ", code)
+		}
+	}))
+}
+
+func (s *HttpSinkTestSuite) TearDownSuite(t *C) {
+	s.server.Close()
+}
+
+func (s *HttpSinkTestSuite) SetUpTest(t *C) {
+	s.codes = nil
+	for len(s.reqChan) > 0 {
+		<-s.reqChan
+	}
+}
+
+func (s *HttpSinkTestSuite) waitReqs(t *C, n int) []httpReq {
+	reqs := []httpReq{}
+	for i := 0; i < n; i++ {
+		select {
+		case r := <-s.reqChan:
+			reqs = append(reqs, r)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Got %d of %d requests", len(reqs), n)
+		}
+	}
+	return reqs
+}
+
+// --------------------------------------------------------------------------
+
+func (s *HttpSinkTestSuite) TestSend(t *C) {
+	sink := data.NewHttpSink(s.server.URL, "gzip", 1, 0)
+	err := sink.Connect()
+	t.Assert(err, IsNil)
+
+	resp, err := sink.Send([]byte(`{"Service":"qan"}`), 5)
+	t.Assert(err, IsNil)
+	t.Check(resp.Code, Equals, uint(200))
+	t.Check(resp.Error, Equals, "")
+
+	resp, err = sink.Send([]byte(`{"Service":"bad"}`), 5)
+	t.Assert(err, IsNil)
+	t.Check(resp.Code, Equals, uint(400))
+	t.Check(resp.Error, Equals, "error 400")
+
+	sink.Disconnect()
+
+	reqs := s.waitReqs(t, 2)
+	t.Check(reqs[0], Equals, httpReq{"application/json", "gzip", `{"Service":"qan"}`})
+	t.Check(reqs[1], Equals, httpReq{"application/json", "gzip", `{"Service":"bad"}`})
+}
+
+func (s *HttpSinkTestSuite) TestRetry(t *C) {
+	// 5xx errors are retried, 4xx are not.
+	s.codes = []int{503, 200}
+	sink := data.NewHttpSink(s.server.URL, "", 1, 2)
+	resp, err := sink.Send([]byte(`{"Service":"qan"}`), 5)
+	t.Assert(err, IsNil)
+	t.Check(resp.Code, Equals, uint(200))
+	reqs := s.waitReqs(t, 2)
+	t.Check(reqs[1], Equals, httpReq{"application/json", "", `{"Service":"qan"}`})
+
+	// No more retries returns the last error.
+	s.codes = []int{500, 502}
+	sink = data.NewHttpSink(s.server.URL, "", 1, 1)
+	resp, err = sink.Send([]byte(`{"Service":"qan"}`), 5)
+	t.Assert(err, IsNil)
+	t.Check(resp.Code, Equals, uint(502))
+	s.waitReqs(t, 2)
+
+	// Failed requests return the error.
+	sink = data.NewHttpSink("http://127.0.0.1:1/", "", 1, 0)
+	_, err = sink.Send([]byte(`{"Service":"qan"}`), 5)
+	t.Check(err, NotNil)
+}
+
+func (s *HttpSinkTestSuite) TestSenderBatch(t *C) {
+	spool := mock.NewSpooler(nil)
+	spool.FilesOut = []string{"file1", "file2", "file3"}
+	spool.DataOut = map[string][]byte{
+		"file1": []byte(`{"Service":"qan"}`),
+		"file2": []byte(`{"Service":"bad"}`),
+		"file3": []byte(`{"Service":"mm"}`),
+	}
+
+	sink := data.NewHttpSink(s.server.URL, "gzip", 2, 0)
+	sender := data.NewSender(s.logger, sink)
+	err := sender.Start(spool, s.tickerChan, 5, false)
+	t.Assert(err, IsNil)
+
+	s.tickerChan <- time.Now()
+
+	// The first batch is rejected because file2 is bad, so its files are
+	// sent one by one, then the last, partial batch is sent.
+	reqs := s.waitReqs(t, 4)
+	err = sender.Stop()
+	t.Assert(err, IsNil)
+
+	t.Check(reqs, DeepEquals, []httpReq{
+		{"application/x-ndjson", "gzip", "{\"Service\":\"qan\"}\n{\"Service\":\"bad\"}\n"},
+		{"application/x-ndjson", "gzip", "{\"Service\":\"qan\"}\n"},
+		{"application/x-ndjson", "gzip", "{\"Service\":\"bad\"}\n"},
+		{"application/x-ndjson", "gzip", "{\"Service\":\"mm\"}\n"},
+	})
+
+	// All files are sent or rejected, so they're removed.
+	t.Check(spool.DataOut, HasLen, 0)
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Manager test suite
 /////////////////////////////////////////////////////////////////////////////
@@ -20,7 +20,9 @@ package data
 import (
 	"encoding/json"
 	"errors"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -115,7 +117,7 @@ func (m *Manager) Start() error {
 	m.status.Update("data", "Starting sender")
 	sender := NewSender(
 		pct.NewLogger(m.logger.LogChan(), "data-sender"),
-		m.client,
+		m.makeSink(config, sz),
 	)
 	if err := sender.Start(m.spooler, time.Tick(time.Duration(config.SendInterval)*time.Second), config.SendInterval, config.Blackhole); err != nil {
 		return err
@@ -200,10 +202,42 @@ func (m *Manager) Sender() *Sender {
 }
 
 func (m *Manager) validateConfig(config *Config) error {
-	if config.Encoding != "" && config.Encoding != "gzip" {
+	if config.Encoding != "" && config.Encoding != "gzip" && config.Encoding != "msgpack" {
 		return errors.New("Invalid data encoding: " + config.Encoding)
 	}
 
+	switch config.Sink {
+	case "", SINK_API:
+	case SINK_DIR:
+		if config.SinkDir == "" {
+			return errors.New("SinkDir must be set if Sink is " + SINK_DIR)
+		}
+		if !filepath.IsAbs(config.SinkDir) {
+			return errors.New("SinkDir must be an absolute path: " + config.SinkDir)
+		}
+		if config.SinkFileSize < 0 {
+			return errors.New("SinkFileSize must be >= 0")
+		} else if config.SinkFileSize == 0 {
+			config.SinkFileSize = DEFAULT_SINK_FILE_SIZE
+		}
+	case SINK_HTTP:
+		u, err := url.Parse(config.SinkURL)
+		if err != nil {
+			return errors.New("Invalid SinkURL: " + err.Error())
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("SinkURL must be http:// or https://: " + config.SinkURL)
+		}
+		if config.SinkBatchSize == 0 {
+			config.SinkBatchSize = 1
+		}
+		if config.SinkRetries == 0 {
+			config.SinkRetries = DEFAULT_SINK_RETRIES
+		}
+	default:
+		return errors.New("Invalid data sink: " + config.Sink)
+	}
+
 	if config.SendInterval < 0 {
 		return errors.New("SendInterval must be > 0")
 	} else if config.SendInterval > 3600 {
@@ -249,7 +283,41 @@ func (m *Manager) handleSetConfig(cmd *proto.Cmd) (interface{}, []error) {
 	 * Data sender
 	 */
 
-	if newConfig.SendInterval != finalConfig.SendInterval {
+	sinkChanged := newConfig.Sink != finalConfig.Sink ||
+		newConfig.SinkDir != finalConfig.SinkDir ||
+		newConfig.SinkFileSize != finalConfig.SinkFileSize ||
+		newConfig.SinkFileCount != finalConfig.SinkFileCount ||
+		newConfig.SinkURL != finalConfig.SinkURL ||
+		newConfig.SinkBatchSize != finalConfig.SinkBatchSize ||
+		newConfig.SinkRetries != finalConfig.SinkRetries ||
+		(newConfig.Sink == SINK_HTTP && newConfig.Encoding != finalConfig.Encoding)
+	if sinkChanged {
+		sz, err := makeSerializer(newConfig.Encoding)
+		if err != nil {
+			return nil, []error{err}
+		}
+		// The sink is set when the sender is created, so replace the sender.
+		m.sender.Stop()
+		sender := NewSender(
+			pct.NewLogger(m.logger.LogChan(), "data-sender"),
+			m.makeSink(newConfig, sz),
+		)
+		if err := sender.Start(m.spooler, time.Tick(time.Duration(newConfig.SendInterval)*time.Second), newConfig.SendInterval, newConfig.Blackhole); err != nil {
+			errs = append(errs, err)
+			// Restart the old sender so data is still sent.
+			m.sender.Start(m.spooler, time.Tick(time.Duration(finalConfig.SendInterval)*time.Second), finalConfig.SendInterval, finalConfig.Blackhole)
+		} else {
+			m.sender = sender
+			finalConfig.SendInterval = newConfig.SendInterval
+			finalConfig.Sink = newConfig.Sink
+			finalConfig.SinkDir = newConfig.SinkDir
+			finalConfig.SinkFileSize = newConfig.SinkFileSize
+			finalConfig.SinkFileCount = newConfig.SinkFileCount
+			finalConfig.SinkURL = newConfig.SinkURL
+			finalConfig.SinkBatchSize = newConfig.SinkBatchSize
+			finalConfig.SinkRetries = newConfig.SinkRetries
+		}
+	} else if newConfig.SendInterval != finalConfig.SendInterval {
 		m.sender.Stop()
 		if err := m.sender.Start(m.spooler, time.Tick(time.Duration(newConfig.SendInterval)*time.Second), newConfig.SendInterval, newConfig.Blackhole); err != nil {
 			errs = append(errs, err)
@@ -285,12 +353,25 @@ func (m *Manager) handleSetConfig(cmd *proto.Cmd) (interface{}, []error) {
 	return m.config, errs
 }
 
+func (m *Manager) makeSink(config *Config, sz Serializer) Sink {
+	switch config.Sink {
+	case SINK_DIR:
+		return NewDirSink(config.SinkDir, config.SinkFileSize, config.SinkFileCount)
+	case SINK_HTTP:
+		return NewHttpSink(config.SinkURL, sz.Encoding(), int(config.SinkBatchSize), config.SinkRetries)
+	default:
+		return NewApiSink(m.client)
+	}
+}
+
 func makeSerializer(encoding string) (Serializer, error) {
 	switch encoding {
 	case "":
 		return NewJsonSerializer(), nil
 	case "gzip":
 		return NewJsonGzipSerializer(), nil
+	case "msgpack":
+		return NewMsgpackSerializer(), nil
 	default:
 		return nil, errors.New("Unknown encoding: " + encoding)
 	}
@@ -0,0 +1,579 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package data
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/**
+ * A minimal MessagePack (http://msgpack.org) encoder and decoder. Values are
+ * encoded like encoding/json encodes them: structs are maps keyed on field
+ * name, json struct tags (name, omitempty, "-") are honored, embedded structs
+ * are flattened, and types which implement encoding.TextMarshaler (e.g.
+ * time.Time) or json.Marshaler are encoded as text or as their JSON value.
+ * So a msgpack report decodes to the same document as a JSON report, and
+ * non-Go consumers can use any msgpack library.
+ */
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+var ErrMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var (
+	msgpackFieldsMux   = &sync.RWMutex{}
+	msgpackFieldsCache = make(map[reflect.Type][]msgpackField)
+)
+
+// MarshalMsgpack returns the msgpack encoding of v.
+func MarshalMsgpack(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := encodeMsgpack(buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalMsgpack decodes msgpack data into generic values: nil, bool,
+// int64 (uint64 if greater than math.MaxInt64), float64, string, []byte,
+// []interface{}, and map[string]interface{}. Map keys which are not strings
+// are formatted as strings, like JSON object keys.
+func UnmarshalMsgpack(data []byte) (interface{}, error) {
+	d := &msgpackDecoder{data: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d bytes of extra data", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+// --------------------------------------------------------------------------
+// Encoder
+// --------------------------------------------------------------------------
+
+func encodeMsgpack(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+
+	// Like encoding/json, marshaler methods take precedence.
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if t.Implements(jsonMarshalerType) {
+			b, err := v.Interface().(json.Marshaler).MarshalJSON()
+			if err != nil {
+				return err
+			}
+			var generic interface{}
+			if err := json.Unmarshal(b, &generic); err != nil {
+				return err
+			}
+			return encodeMsgpack(buf, reflect.ValueOf(generic))
+		}
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeMsgpackString(buf, string(b))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeMsgpackUint(buf, v.Uint())
+	case reflect.Float32:
+		buf.WriteByte(0xca)
+		writeBigEndian(buf, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		buf.WriteByte(0xcb)
+		writeBigEndian(buf, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		writeMsgpackString(buf, v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		return encodeMsgpack(buf, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			writeMsgpackBin(buf, v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		n := v.Len()
+		writeMsgpackHeader(buf, n, 0x90, 16, 0xdc, 0xdd)
+		for i := 0; i < n; i++ {
+			if err := encodeMsgpack(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		keys := v.MapKeys()
+		writeMsgpackHeader(buf, len(keys), 0x80, 16, 0xde, 0xdf)
+		for _, k := range keys {
+			if err := encodeMsgpack(buf, k); err != nil {
+				return err
+			}
+			if err := encodeMsgpack(buf, v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		// Count fields first because the map header has the number of fields.
+		fields := msgpackFields(t)
+		n := 0
+		for _, f := range fields {
+			if fv, ok := fieldByIndex(v, f.index); ok && !(f.omitEmpty && isEmptyValue(fv)) {
+				n++
+			}
+		}
+		writeMsgpackHeader(buf, n, 0x80, 16, 0xde, 0xdf)
+		for _, f := range fields {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			writeMsgpackString(buf, f.name)
+			if err := encodeMsgpack(buf, fv); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type: %s", t)
+	}
+	return nil
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i)) // negative fixint
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		writeBigEndian(buf, uint64(i), 2)
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		writeBigEndian(buf, uint64(i), 4)
+	default:
+		buf.WriteByte(0xd3)
+		writeBigEndian(buf, uint64(i), 8)
+	}
+}
+
+func writeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u)) // positive fixint
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		writeBigEndian(buf, u, 2)
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		writeBigEndian(buf, u, 4)
+	default:
+		buf.WriteByte(0xcf)
+		writeBigEndian(buf, u, 8)
+	}
+}
+
+func writeMsgpackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(0xdb)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+	buf.WriteString(s)
+}
+
+func writeMsgpackBin(buf *bytes.Buffer, b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xc4)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(0xc6)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+	buf.Write(b)
+}
+
+// writeBigEndian writes the low n bytes of u, most significant first.
+// It's like binary.Write but doesn't allocate.
+func writeBigEndian(buf *bytes.Buffer, u uint64, n uint) {
+	for i := n; i > 0; i-- {
+		buf.WriteByte(byte(u >> (8 * (i - 1))))
+	}
+}
+
+// writeMsgpackHeader writes an array or map header: the fix type if n is
+// less than fixMax, else the 16 or 32 bit type.
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, t16, t32 byte) {
+	switch {
+	case n < fixMax:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(t16)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(t32)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+}
+
+// msgpackFields returns the fields of struct type t that encoding/json
+// would encode, in the same order.
+func msgpackFields(t reflect.Type) []msgpackField {
+	msgpackFieldsMux.RLock()
+	fields, ok := msgpackFieldsCache[t]
+	msgpackFieldsMux.RUnlock()
+	if ok {
+		return fields
+	}
+
+	// Like encoding/json, a field hides fields with the same name in
+	// embedded structs, i.e. the shallowest field wins.
+	type candidate struct {
+		msgpackField
+		depth int
+	}
+	candidates := []candidate{}
+	depth := make(map[string]int)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts := tag, ""
+			if n := strings.Index(tag, ","); n >= 0 {
+				name, opts = tag[:n], tag[n+1:]
+			}
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			fieldIndex := append(append([]int{}, index...), i)
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, fieldIndex) // flatten embedded struct
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue // unexported
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			if d, ok := depth[name]; !ok || len(fieldIndex) < d {
+				depth[name] = len(fieldIndex)
+			}
+			candidates = append(candidates, candidate{
+				msgpackField: msgpackField{
+					name:      name,
+					index:     fieldIndex,
+					omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+				},
+				depth: len(fieldIndex),
+			})
+		}
+	}
+	walk(t, nil)
+
+	fields = []msgpackField{}
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if c.depth > depth[c.name] || seen[c.name] {
+			continue
+		}
+		seen[c.name] = true
+		fields = append(fields, c.msgpackField)
+	}
+
+	msgpackFieldsMux.Lock()
+	msgpackFieldsCache[t] = fields
+	msgpackFieldsMux.Unlock()
+	return fields
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but returns false instead
+// of panicking if an embedded struct pointer is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// --------------------------------------------------------------------------
+// Decoder
+// --------------------------------------------------------------------------
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, ErrMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return d.object(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return u, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		u, err := d.uint(n)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend.
+		shift := uint(64 - 8*n)
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(u))), nil
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(u), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%x at offset %d", c, d.pos-1)
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) array(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, ErrMsgpackShort // each value is at least 1 byte
+	}
+	a := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) object(n int) (interface{}, error) {
+	if 2*n > len(d.data)-d.pos {
+		return nil, ErrMsgpackShort
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := k.(string); ok {
+			m[s] = v
+		} else {
+			m[fmt.Sprint(k)] = v
+		}
+	}
+	return m, nil
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/pct"
+	"strings"
 	"time"
 )
 
@@ -31,7 +32,7 @@ const (
 
 type Sender struct {
 	logger *pct.Logger
-	client pct.WebsocketClient
+	sink   Sink
 	// --
 	spool      Spooler
 	tickerChan <-chan time.Time
@@ -44,10 +45,10 @@ type Sender struct {
 	dailyStats *SenderStats
 }
 
-func NewSender(logger *pct.Logger, client pct.WebsocketClient) *Sender {
+func NewSender(logger *pct.Logger, sink Sink) *Sender {
 	s := &Sender{
 		logger:     logger,
-		client:     client,
+		sink:       sink,
 		sync:       pct.NewSyncChan(),
 		status:     pct.NewStatus([]string{"data-sender", "data-sender-last", "data-sender-1d"}),
 		lastStats:  NewSenderStats(0),
@@ -76,7 +77,7 @@ func (s *Sender) Stop() error {
 }
 
 func (s *Sender) Status() map[string]string {
-	return s.status.Merge(s.client.Status())
+	return s.status.Merge(s.sink.Status())
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -120,7 +121,7 @@ func (s *Sender) send() {
 		sent.End = time.Now()
 
 		s.status.Update("data-sender", "Disconnecting")
-		s.client.DisconnectOnce()
+		s.sink.Disconnect()
 
 		// Stats for this run.
 		s.lastStats.Sent(sent)
@@ -151,15 +152,15 @@ func (s *Sender) send() {
 			return
 		}
 
-		// Connect to API, or retry.
+		// Connect to sink, or retry.
 		s.status.Update("data-sender", "Connecting")
 		s.logger.Debug("send:connecting")
 		if sent.Errs > 0 {
 			time.Sleep(CONNECT_ERROR_WAIT * time.Second)
 		}
-		if err := s.client.ConnectOnce(10); err != nil {
+		if err := s.sink.Connect(); err != nil {
 			sent.Errs++
-			s.logger.Warn("Cannot connect to API: ", err)
+			s.logger.Warn("Cannot connect: ", err)
 			continue // retry
 		}
 		s.logger.Debug("send:connected")
@@ -168,7 +169,7 @@ func (s *Sender) send() {
 		if err := s.sendAllFiles(startTime, &sent); err != nil {
 			sent.Errs++
 			s.logger.Warn(err)
-			s.client.DisconnectOnce()
+			s.sink.Disconnect()
 			continue // error sending files, re-connect and try again
 		}
 		return // success or API error, either way, stop sending
@@ -178,6 +179,16 @@ func (s *Sender) send() {
 func (s *Sender) sendAllFiles(startTime time.Time, sent *SentInfo) error {
 	s.status.Update("data-sender", "Running")
 	defer s.spool.CancelFiles()
+
+	// Sinks which can send several files at once get files in batches,
+	// else files are sent one by one.
+	batchSize := 1
+	if bs, ok := s.sink.(BatchSink); ok && bs.BatchSize() > 1 {
+		batchSize = bs.BatchSize()
+	}
+	files := make([]string, 0, batchSize)
+	batch := make([][]byte, 0, batchSize)
+
 	for file := range s.spool.Files() {
 		s.logger.Debug("send:" + file)
 
@@ -208,45 +219,91 @@ func (s *Sender) sendAllFiles(startTime time.Time, sent *SentInfo) error {
 			continue // next file
 		}
 
-		// todo: number/time/rate limit so we dont DDoS API
-		s.status.Update("data-sender", "Sending "+file)
-		t0 := time.Now()
-		if err := s.client.SendBytes(data, s.timeout); err != nil {
-			return fmt.Errorf("Sending %s: %s", file, err)
+		files = append(files, file)
+		batch = append(batch, data)
+		if len(files) < batchSize {
+			continue // batch not full yet
 		}
-		sent.SendTime += time.Now().Sub(t0).Seconds()
-		sent.Bytes += uint64(len(data))
 
-		s.status.Update("data-sender", "Waiting for API to ack "+file)
-		resp := &proto.Response{}
-		if err := s.client.Recv(resp, 5); err != nil {
-			return fmt.Errorf("Waiting for API to ack %s: %s", file, err)
+		stop, err := s.sendFiles(files, batch, sent)
+		if err != nil || stop {
+			return err
 		}
-		s.logger.Debug(fmt.Sprintf("send:resp:%+v", resp.Code))
+		files = files[0:0]
+		batch = batch[0:0]
+	}
 
-		switch {
-		case resp.Code >= 500:
-			// API had problem, try sending files again later.
-			sent.ApiErrs++
-			return nil // don't warn about API errors
-		case resp.Code >= 400:
-			// File is bad, remove it.
-			s.status.Update("data-sender", "Removing "+file)
-			s.spool.Remove(file)
-			s.logger.Warn(fmt.Sprintf("Removed %s because API returned %d: %s", file, resp.Code, resp.Error))
-			sent.Files++
-			sent.BadFiles++
-		case resp.Code >= 300:
-			// This shouldn't happen.
-			return fmt.Errorf("Recieved unhandled response code from API: %d: %s", resp.Code, resp.Error)
-		case resp.Code >= 200:
+	// Last, partial batch.
+	if len(files) > 0 {
+		if _, err := s.sendFiles(files, batch, sent); err != nil {
+			return err
+		}
+	}
+
+	return nil // success
+}
+
+// sendFiles sends the files and removes them from the spool if the sink
+// accepts or rejects them. It returns true if the sink had an error and
+// no more files should be sent until next time.
+func (s *Sender) sendFiles(files []string, batch [][]byte, sent *SentInfo) (bool, error) {
+	// todo: number/time/rate limit so we dont DDoS API
+	var resp *proto.Response
+	var err error
+	nBytes := 0
+	for _, data := range batch {
+		nBytes += len(data)
+	}
+	t0 := time.Now()
+	if len(files) == 1 {
+		s.status.Update("data-sender", "Sending "+files[0])
+		resp, err = s.sink.Send(batch[0], s.timeout)
+	} else {
+		s.status.Update("data-sender", fmt.Sprintf("Sending %d files: %s to %s", len(files), files[0], files[len(files)-1]))
+		resp, err = s.sink.(BatchSink).SendBatch(batch, s.timeout)
+	}
+	if err != nil {
+		return false, fmt.Errorf("Sending %s: %s", strings.Join(files, ", "), err)
+	}
+	sent.SendTime += time.Now().Sub(t0).Seconds()
+	sent.Bytes += uint64(nBytes)
+	s.logger.Debug(fmt.Sprintf("send:resp:%+v", resp.Code))
+
+	switch {
+	case resp.Code >= 500:
+		// API had problem, try sending files again later.
+		sent.ApiErrs++
+		return true, nil // don't warn about API errors
+	case resp.Code >= 400:
+		if len(files) > 1 {
+			// One bad file rejects the whole batch, so send the files
+			// one by one to remove only the bad files.
+			for i := range files {
+				stop, err := s.sendFiles(files[i:i+1], batch[i:i+1], sent)
+				if err != nil || stop {
+					return stop, err
+				}
+			}
+			return false, nil
+		}
+		// File is bad, remove it.
+		s.status.Update("data-sender", "Removing "+files[0])
+		s.spool.Remove(files[0])
+		s.logger.Warn(fmt.Sprintf("Removed %s because API returned %d: %s", files[0], resp.Code, resp.Error))
+		sent.Files++
+		sent.BadFiles++
+	case resp.Code >= 300:
+		// This shouldn't happen.
+		return false, fmt.Errorf("Recieved unhandled response code from API: %d: %s", resp.Code, resp.Error)
+	case resp.Code >= 200:
+		for _, file := range files {
 			s.status.Update("data-sender", "Removing "+file)
 			s.spool.Remove(file)
 			sent.Files++
-		default:
-			// This shouldn't happen.
-			return fmt.Errorf("Recieved unknown response code from API: %d: %s", resp.Code, resp.Error)
 		}
+	default:
+		// This shouldn't happen.
+		return false, fmt.Errorf("Recieved unknown response code from API: %d: %s", resp.Code, resp.Error)
 	}
-	return nil // success
+	return false, nil
 }
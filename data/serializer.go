@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 )
 
 type Serializer interface {
@@ -88,3 +89,59 @@ func (s *JsonSerializer) Encoding() string {
 func (s *JsonSerializer) Concurrent() bool {
 	return true
 }
+
+// --------------------------------------------------------------------------
+
+// MsgpackSerializer encodes data as MessagePack, which is smaller than JSON
+// and faster to encode than gzip'ed JSON. See msgpack.go.
+type MsgpackSerializer struct {
+}
+
+func NewMsgpackSerializer() *MsgpackSerializer {
+	s := &MsgpackSerializer{}
+	return s
+}
+
+func (s *MsgpackSerializer) ToBytes(data interface{}) ([]byte, error) {
+	return MarshalMsgpack(data)
+}
+
+func (s *MsgpackSerializer) Encoding() string {
+	return "msgpack"
+}
+
+func (s *MsgpackSerializer) Concurrent() bool {
+	return true
+}
+
+// --------------------------------------------------------------------------
+
+// Decode decodes data serialized with the given encoding, i.e. proto.Data.Data
+// and proto.Data.ContentEncoding, into v.
+func Decode(encoding string, data []byte, v interface{}) error {
+	switch encoding {
+	case "":
+		return json.Unmarshal(data, v)
+	case "gzip":
+		g, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer g.Close()
+		return json.NewDecoder(g).Decode(v)
+	case "msgpack":
+		// Msgpack decodes to the same generic document as JSON, so convert
+		// it to JSON to decode into v.
+		generic, err := UnmarshalMsgpack(data)
+		if err != nil {
+			return err
+		}
+		jsonBytes, err := json.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(jsonBytes, v)
+	default:
+		return errors.New("Unknown encoding: " + encoding)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package data_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/data"
+	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/qan"
+	. "gopkg.in/check.v1"
+)
+
+type SerializerTestSuite struct {
+}
+
+var _ = Suite(&SerializerTestSuite{})
+
+type embedded struct {
+	A int
+	B string
+}
+
+type msgpackTest struct {
+	embedded
+	B      string // hides embedded.B
+	C      []byte
+	D      map[string]uint64
+	E      *embedded
+	F      float32
+	G      float64
+	H      []int64 `json:"h"`
+	I      bool    `json:",omitempty"`
+	J      string  `json:"-"`
+	Ts     time.Time
+	hidden int
+}
+
+func (s *SerializerTestSuite) TestMsgpack(t *C) {
+	v := msgpackTest{
+		embedded: embedded{A: -1, B: "hidden"},
+		B:        "b",
+		C:        []byte{0, 1, 2},
+		D:        map[string]uint64{"zero": 0, "big": 1 << 40},
+		F:        0.5,
+		G:        -1.25,
+		H:        []int64{0, 127, 128, -32, -33, -129, 65536, -2147483649},
+		J:        "skipped",
+		Ts:       time.Date(2015, 5, 19, 1, 2, 3, 0, time.UTC),
+		hidden:   1,
+	}
+	bytes, err := data.MarshalMsgpack(v)
+	t.Assert(err, IsNil)
+
+	// A few exact encodings: map header, "A", -1, ...
+	t.Check(bytes[0], Equals, byte(0x80|9)) // fixmap, I and J not encoded
+	t.Check(bytes[1:3], DeepEquals, []byte{0xa1, 'A'})
+	t.Check(bytes[3], Equals, byte(0xff)) // negative fixint -1
+
+	got, err := data.UnmarshalMsgpack(bytes)
+	t.Assert(err, IsNil)
+	t.Check(got, DeepEquals, map[string]interface{}{
+		"A":  int64(-1),
+		"B":  "b",
+		"C":  []byte{0, 1, 2},
+		"D":  map[string]interface{}{"zero": int64(0), "big": int64(1 << 40)},
+		"E":  nil,
+		"F":  float64(0.5),
+		"G":  float64(-1.25),
+		"h":  []interface{}{int64(0), int64(127), int64(128), int64(-32), int64(-33), int64(-129), int64(65536), int64(-2147483649)},
+		"Ts": "2015-05-19T01:02:03Z",
+	})
+
+	// Truncated data is an error, not a panic.
+	for i := 0; i < len(bytes); i++ {
+		_, err := data.UnmarshalMsgpack(bytes[0:i])
+		t.Check(err, NotNil)
+	}
+}
+
+func (s *SerializerTestSuite) TestDecode(t *C) {
+	// The same report serialized with every encoding decodes to the same report.
+	report := qanReport(t, 10)
+	expect, err := json.Marshal(report)
+	t.Assert(err, IsNil)
+
+	serializers := []data.Serializer{
+		data.NewJsonSerializer(),
+		data.NewJsonGzipSerializer(),
+		data.NewMsgpackSerializer(),
+	}
+	for _, sz := range serializers {
+		bytes, err := sz.ToBytes(report)
+		t.Assert(err, IsNil)
+		got := &qan.Report{}
+		err = data.Decode(sz.Encoding(), bytes, got)
+		t.Assert(err, IsNil)
+		gotJson, _ := json.Marshal(got)
+		t.Check(string(gotJson), Equals, string(expect), Commentf("encoding %s", sz.Encoding()))
+	}
+
+	err = data.Decode("foo", []byte("{}"), &qan.Report{})
+	t.Check(err, NotNil)
+}
+
+// --------------------------------------------------------------------------
+// Benchmarks
+// --------------------------------------------------------------------------
+
+// qanReport returns a report with n classes like the ones in slow011.json.
+func qanReport(t interface {
+	Fatal(...interface{})
+}, n int) *qan.Report {
+	content, err := ioutil.ReadFile(sample + "slow011.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &qan.Report{}
+	if err := json.Unmarshal(content, report); err != nil {
+		t.Fatal(err)
+	}
+	report.ServiceInstance = proto.ServiceInstance{Service: "mysql", InstanceId: 1}
+	report.StartTs = time.Date(2015, 5, 19, 1, 0, 0, 0, time.UTC)
+	report.EndTs = report.StartTs.Add(time.Minute)
+	classes := report.Class
+	report.Class = report.Class[0:0]
+	for i := 0; i < n; i++ {
+		class := *classes[i%len(classes)]
+		class.Id = fmt.Sprintf("%016X", i)
+		report.Class = append(report.Class, &class)
+	}
+	return report
+}
+
+// mmReport returns a report for MySQL and OS instances with n metrics each.
+func mmReport(n int) *mm.Report {
+	report := &mm.Report{
+		Ts:       time.Date(2015, 5, 19, 1, 0, 0, 0, time.UTC),
+		Duration: 60,
+	}
+	for _, service := range []string{"mysql", "os"} {
+		is := &mm.InstanceStats{
+			ServiceInstance: proto.ServiceInstance{Service: service, InstanceId: 1},
+			Stats:           make(map[string]*mm.Stats),
+		}
+		for i := 0; i < n; i++ {
+			v := float64(i)
+			is.Stats[fmt.Sprintf("%s/status/Metric_%d", service, i)] = &mm.Stats{
+				Cnt:   60,
+				Min:   v,
+				Pct5:  v + 0.05,
+				Avg:   v + 0.5,
+				Med:   v + 0.5,
+				Pct95: v + 0.95,
+				Max:   v + 1,
+			}
+		}
+		report.Stats = append(report.Stats, is)
+	}
+	return report
+}
+
+func benchmarkSerializer(b *testing.B, sz data.Serializer, report interface{}) {
+	bytes, err := sz.ToBytes(report)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(bytes)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sz.ToBytes(report); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQanReportJson(b *testing.B) {
+	benchmarkSerializer(b, data.NewJsonSerializer(), qanReport(b, 500))
+}
+
+func BenchmarkQanReportJsonGzip(b *testing.B) {
+	benchmarkSerializer(b, data.NewJsonGzipSerializer(), qanReport(b, 500))
+}
+
+func BenchmarkQanReportMsgpack(b *testing.B) {
+	benchmarkSerializer(b, data.NewMsgpackSerializer(), qanReport(b, 500))
+}
+
+func BenchmarkMmReportJson(b *testing.B) {
+	benchmarkSerializer(b, data.NewJsonSerializer(), mmReport(500))
+}
+
+func BenchmarkMmReportJsonGzip(b *testing.B) {
+	benchmarkSerializer(b, data.NewJsonGzipSerializer(), mmReport(500))
+}
+
+func BenchmarkMmReportMsgpack(b *testing.B) {
+	benchmarkSerializer(b, data.NewMsgpackSerializer(), mmReport(500))
+}
@@ -0,0 +1,397 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/pct"
+)
+
+const (
+	SINK_API  = "api" // default
+	SINK_DIR  = "dir"
+	SINK_HTTP = "http"
+)
+
+const (
+	DEFAULT_SINK_FILE_SIZE = 1024 * 1024 * 100 // 100 MiB
+	SINK_FILE_PREFIX       = "percona-agent-"
+	SINK_FILE_SUFFIX       = ".ndjson"
+)
+
+const (
+	DEFAULT_SINK_RETRIES = 2
+	SINK_RETRY_WAIT      = 1 // seconds, doubled after each retry
+	MAX_SINK_ERROR_SIZE  = 1024
+)
+
+// A Sink is where the Sender sends spooled data, one proto.Data per call to
+// Send. The Sender connects before sending files and disconnects after.
+// The Response Code determines what the Sender does with the file: 2xx
+// removes it, 4xx removes it as a bad file, and 5xx keeps it to try again.
+type Sink interface {
+	Connect() error
+	Disconnect() error
+	Send(data []byte, timeout uint) (*proto.Response, error)
+	Status() map[string]string
+}
+
+// A BatchSink can send several files at once. The Response applies to all
+// files in the batch.
+type BatchSink interface {
+	Sink
+	BatchSize() int
+	SendBatch(data [][]byte, timeout uint) (*proto.Response, error)
+}
+
+// --------------------------------------------------------------------------
+
+// ApiSink sends data to the API through a websocket and waits for the API
+// to ack each send.
+type ApiSink struct {
+	client pct.WebsocketClient
+}
+
+func NewApiSink(client pct.WebsocketClient) *ApiSink {
+	s := &ApiSink{
+		client: client,
+	}
+	return s
+}
+
+func (s *ApiSink) Connect() error {
+	return s.client.ConnectOnce(10)
+}
+
+func (s *ApiSink) Disconnect() error {
+	return s.client.DisconnectOnce()
+}
+
+func (s *ApiSink) Send(data []byte, timeout uint) (*proto.Response, error) {
+	if err := s.client.SendBytes(data, timeout); err != nil {
+		return nil, err
+	}
+	resp := &proto.Response{}
+	if err := s.client.Recv(resp, 5); err != nil {
+		return nil, fmt.Errorf("Waiting for API to ack: %s", err)
+	}
+	return resp, nil
+}
+
+func (s *ApiSink) Status() map[string]string {
+	return s.client.Status()
+}
+
+// --------------------------------------------------------------------------
+
+// DirSink appends data to newline-delimited JSON files in a local directory,
+// one proto.Data per line, for hosts which cannot connect to the API. The
+// current file is named percona-agent-<UTC timestamp>.ndjson. A new file is
+// started when the current file reaches maxSize bytes, and the oldest files
+// are removed when there are more than maxFiles (0 keeps all files).
+type DirSink struct {
+	dir      string
+	maxSize  int64
+	maxFiles uint
+	// --
+	mux    *sync.Mutex
+	file   *os.File
+	size   int64
+	status *pct.Status
+}
+
+func NewDirSink(dir string, maxSize int64, maxFiles uint) *DirSink {
+	if maxSize <= 0 {
+		maxSize = DEFAULT_SINK_FILE_SIZE
+	}
+	s := &DirSink{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		// --
+		mux:    &sync.Mutex{},
+		status: pct.NewStatus([]string{"data-sink"}),
+	}
+	s.status.Update("data-sink", "Disconnected")
+	return s
+}
+
+func (s *DirSink) Connect() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.file != nil {
+		return nil
+	}
+	if err := pct.MakeDir(s.dir); err != nil {
+		return err
+	}
+	// Append to the newest file if it's not full, else start a new file.
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	if n := len(files); n > 0 {
+		file := filepath.Join(s.dir, files[n-1])
+		if fi, err := os.Stat(file); err == nil && fi.Size() < s.maxSize {
+			return s.open(file, fi.Size())
+		}
+	}
+	return s.rotate()
+}
+
+func (s *DirSink) Disconnect() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	s.status.Update("data-sink", "Disconnected")
+	return err
+}
+
+func (s *DirSink) Send(data []byte, timeout uint) (*proto.Response, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.file == nil {
+		return nil, fmt.Errorf("Not connected")
+	}
+
+	// Spool files are single-line JSON, but compact it to be sure the data
+	// is valid JSON and one line. Like the API, reject bad data.
+	line := &bytes.Buffer{}
+	if err := json.Compact(line, data); err != nil {
+		return &proto.Response{Code: 400, Error: err.Error()}, nil
+	}
+	line.WriteByte('\n')
+
+	if s.size > 0 && s.size+int64(line.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := s.file.Write(line.Bytes())
+	s.size += int64(n)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Response{Code: 200}, nil
+}
+
+func (s *DirSink) Status() map[string]string {
+	return s.status.All()
+}
+
+// --------------------------------------------------------------------------
+
+// rotate closes the current file, if any, starts a new one, and removes the
+// oldest files if there are too many. Caller must lock mux.
+func (s *DirSink) rotate() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	name := SINK_FILE_PREFIX + time.Now().UTC().Format("20060102-150405.000000000") + SINK_FILE_SUFFIX
+	if err := s.open(filepath.Join(s.dir, name), 0); err != nil {
+		return err
+	}
+
+	if s.maxFiles > 0 {
+		files, err := s.files()
+		if err != nil {
+			return err
+		}
+		for len(files) > int(s.maxFiles) {
+			os.Remove(filepath.Join(s.dir, files[0]))
+			files = files[1:]
+		}
+	}
+	return nil
+}
+
+// Caller must lock mux.
+func (s *DirSink) open(file string, size int64) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.size = size
+	s.status.Update("data-sink", "Writing "+file)
+	return nil
+}
+
+// files returns the names of sink files in dir, oldest first. The UTC
+// timestamp in the name makes lexical order chronological.
+func (s *DirSink) files() ([]string, error) {
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, SINK_FILE_PREFIX) && strings.HasSuffix(name, SINK_FILE_SUFFIX) {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// --------------------------------------------------------------------------
+
+// HttpSink POSTs data to a URL. If batchSize is greater than 1, up to that
+// many proto.Data are POSTed at once as newline-delimited JSON, else each is
+// POSTed as JSON. If encoding is "gzip", the body is gzip'ed. The HTTP status
+// code is the Response Code, so the endpoint accepts data with 2xx, rejects
+// bad data with 4xx, and returns 5xx to have it sent again later. Requests
+// which fail or return 5xx are retried, waiting a little longer each time.
+type HttpSink struct {
+	url       string
+	encoding  string
+	batchSize int
+	retries   uint
+	// --
+	transport *http.Transport
+	status    *pct.Status
+}
+
+func NewHttpSink(url, encoding string, batchSize int, retries uint) *HttpSink {
+	s := &HttpSink{
+		url:       url,
+		encoding:  encoding,
+		batchSize: batchSize,
+		retries:   retries,
+		// --
+		transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		status:    pct.NewStatus([]string{"data-sink"}),
+	}
+	s.status.Update("data-sink", "Idle")
+	return s
+}
+
+func (s *HttpSink) Connect() error {
+	// Connections are made as needed by the transport.
+	return nil
+}
+
+func (s *HttpSink) Disconnect() error {
+	s.transport.CloseIdleConnections()
+	return nil
+}
+
+func (s *HttpSink) Send(data []byte, timeout uint) (*proto.Response, error) {
+	return s.SendBatch([][]byte{data}, timeout)
+}
+
+func (s *HttpSink) BatchSize() int {
+	return s.batchSize
+}
+
+func (s *HttpSink) SendBatch(data [][]byte, timeout uint) (*proto.Response, error) {
+	body := &bytes.Buffer{}
+	var w io.Writer = body
+	var g *gzip.Writer
+	if s.encoding == "gzip" {
+		g = gzip.NewWriter(body)
+		w = g
+	}
+	contentType := "application/json"
+	if s.batchSize > 1 {
+		contentType = "application/x-ndjson"
+		for _, d := range data {
+			w.Write(bytes.TrimRight(d, "\n"))
+			w.Write([]byte{'\n'})
+		}
+	} else {
+		for _, d := range data {
+			w.Write(d)
+		}
+	}
+	if g != nil {
+		if err := g.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{
+		Transport: s.transport,
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+	wait := time.Duration(SINK_RETRY_WAIT) * time.Second
+	for try := uint(0); ; try++ {
+		s.status.Update("data-sink", fmt.Sprintf("POST %s (try %d)", s.url, try+1))
+		resp, err := s.post(client, contentType, body.Bytes())
+		if (err == nil && resp.Code < 500) || try >= s.retries {
+			s.status.Update("data-sink", "Idle")
+			return resp, err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (s *HttpSink) Status() map[string]string {
+	return s.status.All()
+}
+
+func (s *HttpSink) post(client *http.Client, contentType string, body []byte) (*proto.Response, error) {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.encoding == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	r := &proto.Response{Code: uint(resp.StatusCode)}
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MAX_SINK_ERROR_SIZE))
+		r.Error = strings.TrimSpace(string(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body) // so the connection can be reused
+	return r, nil
+}
@@ -40,13 +40,12 @@ type Manager struct {
 	configDir string
 	api       pct.APIConnector
 	// --
-	status         *pct.Status
-	repo           *Repo
-	stopChan       chan empty
-	mrm            mrms.Monitor
-	mrmChans       map[string]<-chan bool
-	mrmsGlobalChan chan string
-	agentConfig    *agent.Config
+	status      *pct.Status
+	repo        *Repo
+	stopChan    chan empty
+	mrm         mrms.Monitor
+	mrmsChan    chan *mrms.Event
+	agentConfig *agent.Config
 }
 
 func NewManager(logger *pct.Logger, configDir string, api pct.APIConnector, mrm mrms.Monitor) *Manager {
@@ -56,11 +55,10 @@ func NewManager(logger *pct.Logger, configDir string, api pct.APIConnector, mrm
 		configDir: configDir,
 		api:       api,
 		// --
-		status:         pct.NewStatus([]string{"instance", "instance-repo", "instance-mrms"}),
-		repo:           repo,
-		mrm:            mrm,
-		mrmChans:       make(map[string]<-chan bool),
-		mrmsGlobalChan: make(chan string, 100), // monitor up to 100 instances
+		status:   pct.NewStatus([]string{"instance", "instance-repo", "instance-mrms"}),
+		repo:     repo,
+		mrm:      mrm,
+		mrmsChan: make(chan *mrms.Event, 100), // monitor up to 100 instances
 	}
 	return m
 }
@@ -78,14 +76,8 @@ func (m *Manager) Start() error {
 	m.logger.Info("Started")
 	m.status.Update("instance", "Running")
 
-	mrmsGlobalChan, err := m.mrm.GlobalSubscribe()
-	if err != nil {
-		return err
-	}
-
 	for _, instance := range m.GetMySQLInstances() {
-		ch, err := m.mrm.Add(instance.DSN)
-		if err != nil {
+		if err := m.mrm.Subscribe(instance.DSN, m.mrmsChan); err != nil {
 			m.logger.Error("Cannot add instance to the monitor:", err)
 			continue
 		}
@@ -97,10 +89,8 @@ func (m *Manager) Start() error {
 		}
 		m.status.Update("instance", "Updating info "+safeDSN)
 		m.pushInstanceInfo(instance)
-		// Store the channel to be able to remove it from mrms
-		m.mrmChans[instance.DSN] = ch
 	}
-	go m.monitorInstancesRestart(mrmsGlobalChan)
+	go m.monitorInstancesRestart(m.mrmsChan)
 	return nil
 }
 
@@ -137,12 +127,10 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 				m.logger.Error(err)
 				return cmd.Reply(nil, nil)
 			}
-			ch, err := m.mrm.Add(iit.DSN)
-			if err != nil {
+			if err := m.mrm.Subscribe(iit.DSN, m.mrmsChan); err != nil {
 				m.logger.Error(err)
 				return cmd.Reply(nil, nil)
 			}
-			m.mrmChans[iit.DSN] = ch
 
 			safeDSN := mysql.HideDSNPassword(iit.DSN)
 			m.status.Update("instance", "Getting info "+safeDSN)
@@ -169,7 +157,7 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 			if err != nil {
 				m.logger.Error(err)
 			} else {
-				m.mrm.Remove(iit.DSN, m.mrmChans[iit.DSN])
+				m.mrm.Unsubscribe(iit.DSN, m.mrmsChan)
 			}
 		}
 		err := m.repo.Remove(it.Service, it.InstanceId)
@@ -213,6 +201,30 @@ func (m *Manager) handleGetInfo(service string, data []byte) (interface{}, error
 			return nil, err
 		}
 		return it, nil
+	case "postgres":
+		it := &PostgreSQLInstance{}
+		if err := json.Unmarshal(data, it); err != nil {
+			return nil, errors.New("instance.Repo:json.Unmarshal:" + err.Error())
+		}
+		if it.DSN == "" {
+			return nil, fmt.Errorf("PostgreSQL instance DSN is not set")
+		}
+		if err := GetPostgreSQLInfo(it); err != nil {
+			return nil, err
+		}
+		return it, nil
+	case "mongodb":
+		it := &MongoDBInstance{}
+		if err := json.Unmarshal(data, it); err != nil {
+			return nil, errors.New("instance.Repo:json.Unmarshal:" + err.Error())
+		}
+		if it.DSN == "" {
+			return nil, fmt.Errorf("MongoDB instance DSN is not set")
+		}
+		if err := GetMongoDBInfo(it); err != nil {
+			return nil, err
+		}
+		return it, nil
 	default:
 		return nil, fmt.Errorf("Don't know how to get info for %s service", service)
 	}
@@ -267,7 +279,7 @@ func (m *Manager) GetMySQLInstances() []*proto.MySQLInstance {
 	return instances
 }
 
-func (m *Manager) monitorInstancesRestart(ch chan string) {
+func (m *Manager) monitorInstancesRestart(ch chan *mrms.Event) {
 	m.logger.Debug("monitorInstancesRestart:call")
 	defer func() {
 		if err := recover(); err != nil {
@@ -279,18 +291,19 @@ func (m *Manager) monitorInstancesRestart(ch chan string) {
 		m.logger.Debug("monitorInstancesRestart:return")
 	}()
 
-	ch, err := m.mrm.GlobalSubscribe()
-	if err != nil {
-		m.logger.Error(fmt.Sprintf("Failed to get MySQL restart monitor global channel: %s", err))
-		return
-	}
-
 	for {
 		m.status.Update("instance-mrms", "Idle")
 		select {
-		case dsn := <-ch:
+		case e := <-ch:
+			dsn := e.DSN
 			safeDSN := mysql.HideDSNPassword(dsn)
 			m.logger.Debug("mrms:restart:" + safeDSN)
+			if !e.Restarted() {
+				// Hostname, distro, and version only change on restart
+				// or when it's a different server.
+				continue
+			}
+			m.logger.Info(fmt.Sprintf("Updating info %s because of %s", safeDSN, e))
 			m.status.Update("instance-mrms", "Updating "+safeDSN)
 
 			// Get the updated instances list. It should be updated every time since
@@ -54,8 +54,21 @@ func NewRepo(logger *pct.Logger, configDir string, api pct.APIConnector) *Repo {
 	return m
 }
 
-func (r *Repo) Init() error {
+// Services are the proto.ExternalService plus services the API doesn't
+// know about yet.
+var Services = map[string]bool{
+	"postgres": true,
+	"mongodb":  true,
+}
+
+func init() {
 	for service, _ := range proto.ExternalService {
+		Services[service] = true
+	}
+}
+
+func (r *Repo) Init() error {
+	for service, _ := range Services {
 		if err := r.loadInstances(service); err != nil {
 			return fmt.Errorf("%s: %s", service, err)
 		}
@@ -133,6 +146,18 @@ func (r *Repo) add(service string, id uint, data []byte, writeToDisk bool) error
 			return errors.New("instance.Repo:json.Unmarshal:" + err.Error())
 		}
 		info = it
+	case "postgres":
+		it := &PostgreSQLInstance{}
+		if err := json.Unmarshal(data, it); err != nil {
+			return errors.New("instance.Repo:json.Unmarshal:" + err.Error())
+		}
+		info = it
+	case "mongodb":
+		it := &MongoDBInstance{}
+		if err := json.Unmarshal(data, it); err != nil {
+			return errors.New("instance.Repo:json.Unmarshal:" + err.Error())
+		}
+		info = it
 	default:
 		return errors.New(fmt.Sprintf("Invalid service name: %s", service))
 	}
@@ -250,7 +275,7 @@ func (r *Repo) Remove(service string, id uint) error {
 }
 
 func valid(service string, id uint) bool {
-	if _, ok := proto.ExternalService[service]; !ok {
+	if !Services[service] {
 		return false
 	}
 	if id == 0 {
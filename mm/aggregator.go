@@ -32,8 +32,9 @@ type Aggregator struct {
 	collectionChan chan *Collection
 	spool          data.Spooler
 	// --
-	sync    *pct.SyncChan
-	running bool
+	sync     *pct.SyncChan
+	running  bool
+	exporter *Exporter // optional, see Manager.SetExporter()
 }
 
 func NewAggregator(logger *pct.Logger, interval int64, collectionChan chan *Collection, spool data.Spooler) *Aggregator {
@@ -85,6 +86,9 @@ func (a *Aggregator) run() {
 	for {
 		select {
 		case collection := <-a.collectionChan:
+			if a.exporter != nil {
+				a.exporter.Add(collection)
+			}
 			interval := (collection.Ts / a.interval) * a.interval
 			if curInterval == 0 {
 				curInterval = interval
@@ -60,6 +60,7 @@ type Manager struct {
 	status      *pct.Status
 	aggregators map[uint]*Binding
 	mrm         mrms.Monitor
+	exporter    *Exporter
 }
 
 func NewManager(logger *pct.Logger, factory MonitorFactory, clock ticker.Manager, spool data.Spooler, im *instance.Repo, mrm mrms.Monitor) *Manager {
@@ -79,6 +80,12 @@ func NewManager(logger *pct.Logger, factory MonitorFactory, clock ticker.Manager
 	return m
 }
 
+// SetExporter makes aggregators add collections to the Prometheus exporter.
+// It must be called before Start.
+func (m *Manager) SetExporter(exporter *Exporter) {
+	m.exporter = exporter
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Interface
 /////////////////////////////////////////////////////////////////////////////
@@ -187,23 +194,7 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 		tickChan := make(chan time.Time)
 		m.clock.Add(tickChan, mm.Collect, true)
 
-		// We need one aggregator for each unique report interval.  There's usually
-		// just one: 60s.  Remember: report interval != collect interval.  Monitors
-		// can collect at different intervals (typically 1s and 10s), yet all report
-		// at the same 60s interval, or different report intervals.
-		a, ok := m.aggregators[mm.Report]
-		if !ok {
-			// Make new aggregator for this report interval.
-			logger := pct.NewLogger(m.logger.LogChan(), fmt.Sprintf("mm-ag-%d", mm.Report))
-			collectionChan := make(chan *Collection, 5)
-			aggregator := NewAggregator(logger, int64(mm.Report), collectionChan, m.spool)
-			aggregator.Start()
-
-			// Save aggregator for other monitors with same report interval.
-			a = &Binding{aggregator, collectionChan}
-			m.aggregators[mm.Report] = a
-			m.logger.Info("Created", mm.Report, "second aggregator")
-		}
+		a := m.binding(mm.Report)
 
 		// Start the monitor.
 		if err := monitor.Start(tickChan, a.collectionChan); err != nil {
@@ -221,7 +212,7 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 
 		return cmd.Reply(nil) // success
 	case "StopService":
-		_, name, err := m.getMonitorConfig(cmd)
+		mm, name, err := m.getMonitorConfig(cmd)
 		if err != nil {
 			return cmd.Reply(nil, err)
 		}
@@ -243,13 +234,31 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 		m.mux.Lock()
 		delete(m.monitors, name)
 		m.mux.Unlock()
+		if m.exporter != nil {
+			m.exporter.Remove(mm.Service, mm.InstanceId)
+		}
+		return cmd.Reply(nil) // success
+	case "SetConfig":
+		mm, name, err := m.getMonitorConfig(cmd)
+		if err != nil {
+			return cmd.Reply(nil, err)
+		}
+		m.status.UpdateRe("mm", "Setting "+name+" config", cmd)
+		m.logger.Info("Set", name, cmd)
+		m.mux.RLock()
+		oldMonitor, ok := m.monitors[name]
+		m.mux.RUnlock()
+		if !ok {
+			return cmd.Reply(nil, errors.New("Unknown monitor: "+name))
+		}
+		if err := m.setMonitorConfig(name, oldMonitor, mm, cmd.Data); err != nil {
+			return cmd.Reply(nil, err)
+		}
 		return cmd.Reply(nil) // success
 	case "GetConfig":
 		config, errs := m.GetConfig()
 		return cmd.Reply(config, errs...)
 	default:
-		// SetConfig does not work by design.  To re-configure a monitor,
-		// stop it then start it again with the new config.
 		return cmd.Reply(nil, pct.UnknownCmdError{Cmd: cmd.Cmd})
 	}
 }
@@ -309,6 +318,135 @@ func (m *Manager) GetConfig() ([]proto.AgentConfig, []error) {
 	return configs, errs
 }
 
+// binding returns the aggregator binding for the report interval, making it if
+// it doesn't exist yet.
+// @goroutine[0]
+func (m *Manager) binding(report uint) *Binding {
+	// We need one aggregator for each unique report interval.  There's usually
+	// just one: 60s.  Remember: report interval != collect interval.  Monitors
+	// can collect at different intervals (typically 1s and 10s), yet all report
+	// at the same 60s interval, or different report intervals.
+	a, ok := m.aggregators[report]
+	if !ok {
+		// Make new aggregator for this report interval.
+		logger := pct.NewLogger(m.logger.LogChan(), fmt.Sprintf("mm-ag-%d", report))
+		collectionChan := make(chan *Collection, 5)
+		aggregator := NewAggregator(logger, int64(report), collectionChan, m.spool)
+		aggregator.exporter = m.exporter
+		aggregator.Start()
+
+		// Save aggregator for other monitors with same report interval.
+		a = &Binding{aggregator, collectionChan}
+		m.aggregators[report] = a
+		m.logger.Info("Created", report, "second aggregator")
+	}
+	return a
+}
+
+// removeUnusedBindings stops and removes the aggregators that no monitor
+// reports to, e.g. after SetConfig changed the report interval of a monitor.
+// @goroutine[0]
+func (m *Manager) removeUnusedBindings() {
+	inUse := make(map[uint]bool)
+	m.mux.RLock()
+	for name, monitor := range m.monitors {
+		mmConfig := &Config{}
+		bytes, err := json.Marshal(monitor.Config())
+		if err == nil {
+			err = json.Unmarshal(bytes, mmConfig)
+		}
+		if err != nil {
+			// Can't know which aggregator it uses, so keep them all.
+			m.mux.RUnlock()
+			m.logger.Warn("Decode " + name + " config: " + err.Error())
+			return
+		}
+		inUse[mmConfig.Report] = true
+	}
+	m.mux.RUnlock()
+
+	for report, a := range m.aggregators {
+		if inUse[report] {
+			continue
+		}
+		a.aggregator.Stop()
+		delete(m.aggregators, report)
+		m.logger.Info("Removed", report, "second aggregator")
+	}
+}
+
+// setMonitorConfig replaces the running oldMonitor with a monitor made from
+// the new config data.  The aggregators are not restarted, so if the report
+// interval doesn't change, the counter stats for the instance are kept, else
+// the old aggregator is removed if no other monitor uses it.  If the new
+// monitor fails to start, the old config is restored.
+// @goroutine[0]
+func (m *Manager) setMonitorConfig(name string, oldMonitor Monitor, mm *Config, data []byte) error {
+	oldData, err := json.Marshal(oldMonitor.Config())
+	if err != nil {
+		return errors.New("Encode " + name + " config: " + err.Error())
+	}
+	defer m.removeUnusedBindings()
+
+	// Make the new monitor first so a bad config doesn't stop the old monitor.
+	monitor, err := m.factory.Make(mm.Service, mm.InstanceId, data)
+	if err != nil {
+		return errors.New("Factory: " + err.Error())
+	}
+
+	if err := oldMonitor.Stop(); err != nil {
+		return errors.New("Stop " + name + ": " + err.Error())
+	}
+	m.clock.Remove(oldMonitor.TickChan())
+
+	tickChan := make(chan time.Time)
+	m.clock.Add(tickChan, mm.Collect, true)
+	a := m.binding(mm.Report)
+	if err := monitor.Start(tickChan, a.collectionChan); err != nil {
+		m.clock.Remove(tickChan)
+		startErr := errors.New("Start " + name + ": " + err.Error())
+		if err := m.restoreMonitor(name, oldData); err != nil {
+			m.logger.Error("Restore " + name + ": " + err.Error())
+		}
+		return startErr
+	}
+	m.mux.Lock()
+	m.monitors[name] = monitor
+	m.mux.Unlock()
+
+	if err := pct.Basedir.WriteConfig(name, monitor.Config()); err != nil {
+		return errors.New("Write " + name + " config:" + err.Error())
+	}
+	return nil
+}
+
+// restoreMonitor starts a new monitor with the old config data after
+// setMonitorConfig failed to start the new one.
+// @goroutine[0]
+func (m *Manager) restoreMonitor(name string, data []byte) error {
+	mm := &Config{}
+	if err := json.Unmarshal(data, mm); err != nil {
+		return err
+	}
+	monitor, err := m.factory.Make(mm.Service, mm.InstanceId, data)
+	if err != nil {
+		return err
+	}
+	tickChan := make(chan time.Time)
+	m.clock.Add(tickChan, mm.Collect, true)
+	if err := monitor.Start(tickChan, m.binding(mm.Report).collectionChan); err != nil {
+		m.clock.Remove(tickChan)
+		m.mux.Lock()
+		delete(m.monitors, name)
+		m.mux.Unlock()
+		return err
+	}
+	m.mux.Lock()
+	m.monitors[name] = monitor
+	m.mux.Unlock()
+	return nil
+}
+
 func (m *Manager) getMonitorConfig(cmd *proto.Cmd) (*Config, string, error) {
 	/**
 	 * cmd.Data is a monitor-specific config, e.g. mysql.Config.  But monitor-specific
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -911,6 +912,117 @@ func (s *ManagerTestSuite) TestGetConfig(t *C) {
 	}
 }
 
+func (s *ManagerTestSuite) TestSetConfig(t *C) {
+	mrm := mock.NewMrmsMonitor()
+	m := mm.NewManager(s.logger, s.factory, s.clock, s.spool, s.im, mrm)
+	t.Assert(m, NotNil)
+	err := m.Start()
+	t.Assert(err, IsNil)
+	defer m.Stop()
+
+	mmConfig := &mysql.Config{
+		Config: mm.Config{
+			ServiceInstance: proto.ServiceInstance{
+				Service:    "mysql",
+				InstanceId: 1,
+			},
+			Collect: 1,
+			Report:  60,
+		},
+		Status: map[string]string{
+			"threads_connected": "gauge",
+		},
+	}
+	mmConfigData, err := json.Marshal(mmConfig)
+	t.Assert(err, IsNil)
+	s.mysqlMonitor.SetConfig(mmConfig)
+
+	cmd := &proto.Cmd{
+		User:    "daniel",
+		Service: "mm",
+		Cmd:     "StartService",
+		Data:    mmConfigData,
+	}
+	reply := m.Handle(cmd)
+	t.Assert(reply, NotNil)
+	t.Assert(reply.Error, Equals, "")
+
+	/**
+	 * Change the collect and report intervals and the status variables
+	 * without stopping the monitor.
+	 */
+	newConfig := &mysql.Config{
+		Config: mm.Config{
+			ServiceInstance: proto.ServiceInstance{
+				Service:    "mysql",
+				InstanceId: 1,
+			},
+			Collect: 10,
+			Report:  300,
+		},
+		Status: map[string]string{
+			"threads_connected": "gauge",
+			"threads_running":   "gauge",
+		},
+	}
+	newConfigData, err := json.Marshal(newConfig)
+	t.Assert(err, IsNil)
+	s.mysqlMonitor.SetConfig(newConfig)
+
+	cmd = &proto.Cmd{
+		User:    "daniel",
+		Service: "mm",
+		Cmd:     "SetConfig",
+		Data:    newConfigData,
+	}
+	reply = m.Handle(cmd)
+	t.Assert(reply, NotNil)
+	t.Check(reply.Error, Equals, "")
+
+	// The monitor is running again.
+	status := m.Status()
+	t.Check(status["monitor"], Equals, "Running")
+
+	// Its 1s ticker was replaced by a 10s ticker.
+	if ok, diff := test.IsDeeply(s.clock.Added, []uint{1, 10}); !ok {
+		test.Dump(s.clock.Added)
+		t.Errorf("Replace 1s ticker with 10s ticker\n%s", diff)
+	}
+	t.Check(s.clock.Removed, HasLen, 1)
+
+	// Its new config was written to disk.
+	data, err := ioutil.ReadFile(s.configDir + "/mm-mysql-1.conf")
+	t.Check(err, IsNil)
+	gotConfig := &mysql.Config{}
+	err = json.Unmarshal(data, gotConfig)
+	t.Check(err, IsNil)
+	if same, diff := test.IsDeeply(gotConfig, newConfig); !same {
+		test.Dump(gotConfig)
+		t.Error(diff)
+	}
+	t.Check(pct.FileExists(s.configDir+"/mm-mysql-1.conf.tmp"), Equals, false)
+
+	// It's an error to set the config of a monitor that isn't running.
+	serverConfigData, err := json.Marshal(&mm.Config{
+		ServiceInstance: proto.ServiceInstance{
+			Service:    "server",
+			InstanceId: 1,
+		},
+		Collect: 10,
+		Report:  60,
+	})
+	t.Assert(err, IsNil)
+	cmd = &proto.Cmd{
+		User:    "daniel",
+		Service: "mm",
+		Cmd:     "SetConfig",
+		Data:    serverConfigData,
+	}
+	reply = m.Handle(cmd)
+	t.Assert(reply, NotNil)
+	t.Check(reply.Error, Not(Equals), "")
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Stats test suite
 /////////////////////////////////////////////////////////////////////////////
@@ -1031,3 +1143,88 @@ func (s *StatsTestSuite) TestPCT939(t *C) {
 		test.Dump(got)
 	*/
 }
+
+/////////////////////////////////////////////////////////////////////////////
+// Exporter test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type ExporterTestSuite struct {
+	logChan chan *proto.LogEntry
+	logger  *pct.Logger
+}
+
+var _ = Suite(&ExporterTestSuite{})
+
+func (s *ExporterTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 10)
+	s.logger = pct.NewLogger(s.logChan, "mm-prometheus-test")
+}
+
+func (s *ExporterTestSuite) TestPrometheusName(t *C) {
+	t.Check(mm.PrometheusName("mysql/status/Threads_running"), Equals, "mysql_status_threads_running")
+	t.Check(mm.PrometheusName("server/cpu-stats/cpu0/user"), Equals, "server_cpu_stats_cpu0_user")
+	t.Check(mm.PrometheusName("1foo.bar"), Equals, "_foo_bar")
+}
+
+func (s *ExporterTestSuite) TestMetrics(t *C) {
+	e := mm.NewExporter(s.logger)
+	e.Add(&mm.Collection{
+		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 2},
+		Ts:              1,
+		Metrics: []mm.Metric{
+			{Name: "mysql/status/Threads_running", Type: "gauge", Number: 3},
+			{Name: "mysql/status/Questions", Type: "counter", Number: 1000},
+			{Name: "mysql/version", Type: "string", String: "5.6.24"},
+		},
+	})
+	e.Add(&mm.Collection{
+		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 1},
+		Ts:              1,
+		Metrics: []mm.Metric{
+			{Name: "mysql/status/Threads_running", Type: "gauge", Number: 1},
+		},
+	})
+	// Newer value replaces the old value; Questions for instance 2 remains.
+	e.Add(&mm.Collection{
+		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 2},
+		Ts:              2,
+		Metrics: []mm.Metric{
+			{Name: "mysql/status/Threads_running", Type: "gauge", Number: 0.5},
+		},
+	})
+
+	expect := "# TYPE mysql_status_questions counter\n" +
+		"mysql_status_questions{service=\"mysql\",instance_id=\"2\"} 1000\n" +
+		"# TYPE mysql_status_threads_running gauge\n" +
+		"mysql_status_threads_running{service=\"mysql\",instance_id=\"1\"} 1\n" +
+		"mysql_status_threads_running{service=\"mysql\",instance_id=\"2\"} 0.5\n"
+	t.Check(string(e.Metrics()), Equals, expect)
+
+	e.Remove("mysql", 2)
+	expect = "# TYPE mysql_status_threads_running gauge\n" +
+		"mysql_status_threads_running{service=\"mysql\",instance_id=\"1\"} 1\n"
+	t.Check(string(e.Metrics()), Equals, expect)
+}
+
+func (s *ExporterTestSuite) TestServe(t *C) {
+	e := mm.NewExporter(s.logger)
+	e.Add(&mm.Collection{
+		ServiceInstance: proto.ServiceInstance{Service: "server", InstanceId: 1},
+		Ts:              1,
+		Metrics: []mm.Metric{
+			{Name: "server/loadavg/1min", Type: "gauge", Number: 0.25},
+		},
+	})
+	err := e.Start("127.0.0.1:0")
+	t.Assert(err, IsNil)
+	defer e.Stop()
+
+	resp, err := http.Get("http://" + e.Addr() + "/metrics")
+	t.Assert(err, IsNil)
+	defer resp.Body.Close()
+	t.Check(resp.Header.Get("Content-Type"), Equals, mm.PROMETHEUS_CONTENT_TYPE)
+	body, err := ioutil.ReadAll(resp.Body)
+	t.Assert(err, IsNil)
+	t.Check(string(body), Equals, "# TYPE server_loadavg_1min gauge\n"+
+		"server_loadavg_1min{service=\"server\",instance_id=\"1\"} 0.25\n")
+}
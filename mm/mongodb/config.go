@@ -0,0 +1,75 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mongodb
+
+import (
+	"github.com/percona/percona-agent/mm"
+)
+
+type Config struct {
+	mm.Config
+	Stats map[string]string // serverStatus path to collect and its type, e.g. "opcounters/insert": "counter"
+}
+
+// DefaultStats are collected if Config.Stats is empty. Paths that a server
+// doesn't have, e.g. wiredTiger paths on MMAPv1, are ignored.
+var DefaultStats = map[string]string{
+	"opcounters/insert":                                 "counter",
+	"opcounters/query":                                  "counter",
+	"opcounters/update":                                 "counter",
+	"opcounters/delete":                                 "counter",
+	"opcounters/getmore":                                "counter",
+	"opcounters/command":                                "counter",
+	"connections/current":                               "gauge",
+	"connections/available":                             "gauge",
+	"connections/totalCreated":                          "counter",
+	"network/bytesIn":                                   "counter",
+	"network/bytesOut":                                  "counter",
+	"network/numRequests":                               "counter",
+	"mem/resident":                                      "gauge",
+	"mem/virtual":                                       "gauge",
+	"globalLock/currentQueue/readers":                   "gauge",
+	"globalLock/currentQueue/writers":                   "gauge",
+	"globalLock/activeClients/readers":                  "gauge",
+	"globalLock/activeClients/writers":                  "gauge",
+	"locks/Global/acquireCount/r":                       "counter",
+	"locks/Global/acquireCount/w":                       "counter",
+	"locks/Global/acquireCount/R":                       "counter",
+	"locks/Global/acquireCount/W":                       "counter",
+	"locks/Global/acquireWaitCount/r":                   "counter",
+	"locks/Global/acquireWaitCount/w":                   "counter",
+	"locks/Global/timeAcquiringMicros/r":                "counter",
+	"locks/Global/timeAcquiringMicros/w":                "counter",
+	"locks/Database/acquireCount/r":                     "counter",
+	"locks/Database/acquireCount/w":                     "counter",
+	"locks/Database/acquireWaitCount/r":                 "counter",
+	"locks/Database/acquireWaitCount/w":                 "counter",
+	"locks/Database/timeAcquiringMicros/r":              "counter",
+	"locks/Database/timeAcquiringMicros/w":              "counter",
+	"wiredTiger/cache/bytes currently in the cache":     "gauge",
+	"wiredTiger/cache/maximum bytes configured":         "gauge",
+	"wiredTiger/cache/tracked dirty bytes in the cache": "gauge",
+	"wiredTiger/cache/pages read into cache":            "counter",
+	"wiredTiger/cache/pages written from cache":         "counter",
+	"wiredTiger/cache/unmodified pages evicted":         "counter",
+	"wiredTiger/cache/modified pages evicted":           "counter",
+	"wiredTiger/concurrentTransactions/read/out":        "gauge",
+	"wiredTiger/concurrentTransactions/write/out":       "gauge",
+	"wiredTiger/concurrentTransactions/read/available":  "gauge",
+	"wiredTiger/concurrentTransactions/write/available": "gauge",
+}
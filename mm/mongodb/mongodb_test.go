@@ -0,0 +1,151 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mongodb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mm/mongodb"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/test"
+	"github.com/percona/percona-agent/test/mock"
+	. "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct {
+	logChan        chan *proto.LogEntry
+	logger         *pct.Logger
+	tickChan       chan time.Time
+	collectionChan chan *mm.Collection
+	name           string
+}
+
+var _ = Suite(&TestSuite{})
+
+func (s *TestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 10)
+	s.logger = pct.NewLogger(s.logChan, "mm-mongodb-test")
+	s.tickChan = make(chan time.Time)
+	s.collectionChan = make(chan *mm.Collection, 1)
+	s.name = "mm-mongodb-db1"
+}
+
+// Partial serverStatus as decoded by mgo: embedded documents are bson.M and
+// numbers are int, int64 or float64.
+var serverStatus = map[string]interface{}{
+	"host":    "db1:27017",
+	"version": "3.0.4",
+	"opcounters": bson.M{
+		"insert": 10,
+		"query":  int64(200),
+	},
+	"connections": bson.M{
+		"current":   5,
+		"available": 814,
+	},
+	"locks": bson.M{
+		"Global": bson.M{
+			"acquireCount": bson.M{
+				"r": int64(1002),
+				"R": int64(3),
+			},
+		},
+	},
+	"wiredTiger": bson.M{
+		"cache": bson.M{
+			"bytes currently in the cache": float64(4096),
+		},
+	},
+}
+
+var stats = map[string]string{
+	"opcounters/insert":                             "counter",
+	"opcounters/query":                              "counter",
+	"connections/current":                           "gauge",
+	"locks/Global/acquireCount/r":                   "counter",
+	"locks/Global/acquireCount/R":                   "counter",
+	"wiredTiger/cache/bytes currently in the cache": "gauge",
+	"host":                "gauge",   // not numeric
+	"opcounters/foo":      "counter", // not in serverStatus
+	"opcounters/insert/x": "counter", // not a document
+}
+
+// --------------------------------------------------------------------------
+
+func (s *TestSuite) TestServerStatusMetrics(t *C) {
+	got := mongodb.ServerStatusMetrics(serverStatus, stats)
+	expect := []mm.Metric{
+		{Name: "mongodb/connections/current", Type: "gauge", Number: 5},
+		{Name: "mongodb/locks/Global/acquireCount/intent_shared", Type: "counter", Number: 1002},
+		{Name: "mongodb/locks/Global/acquireCount/shared", Type: "counter", Number: 3},
+		{Name: "mongodb/opcounters/insert", Type: "counter", Number: 10},
+		{Name: "mongodb/opcounters/query", Type: "counter", Number: 200},
+		{Name: "mongodb/wiredTiger/cache/bytes_currently_in_the_cache", Type: "gauge", Number: 4096},
+	}
+	t.Check(got, DeepEquals, expect)
+}
+
+func (s *TestSuite) TestStartCollectStop(t *C) {
+	config := &mongodb.Config{
+		Config: mm.Config{
+			ServiceInstance: proto.ServiceInstance{
+				Service:    "mongodb",
+				InstanceId: 1,
+			},
+			Collect: 1,
+			Report:  60,
+		},
+		Stats: stats,
+	}
+	conn := mock.NewNullMongoDB()
+	conn.SetServerStatus(serverStatus)
+
+	m := mongodb.NewMonitor(s.name, config, s.logger, conn)
+	err := m.Start(s.tickChan, s.collectionChan)
+	t.Assert(err, IsNil)
+
+	if ok := test.WaitStatus(5, m, s.name+"-mongodb", "Connected"); !ok {
+		t.Fatal("Monitor is ready")
+	}
+
+	// No tick, no collection.
+	got := test.WaitCollection(s.collectionChan, 0)
+	t.Assert(got, HasLen, 0)
+
+	// Tick and the monitor collects serverStatus metrics.
+	now := time.Now()
+	s.tickChan <- now
+	got = test.WaitCollection(s.collectionChan, 1)
+	t.Assert(got, HasLen, 1)
+	c := got[0]
+	t.Check(c.Service, Equals, "mongodb")
+	t.Check(c.InstanceId, Equals, uint(1))
+	t.Check(c.Ts, Equals, now.UTC().Unix())
+	t.Check(c.Metrics, HasLen, 5)
+
+	err = m.Stop()
+	t.Assert(err, IsNil)
+	t.Check(m.Status()[s.name], Equals, "Stopped")
+}
@@ -0,0 +1,331 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mongodb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mongodb"
+	"github.com/percona/percona-agent/pct"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type Monitor struct {
+	name   string
+	config *Config
+	logger *pct.Logger
+	conn   mongodb.Connector
+	// --
+	tickChan       chan time.Time
+	collectionChan chan *mm.Collection
+	connectedChan  chan bool
+	status         *pct.Status
+	sync           *pct.SyncChan
+	running        bool
+	collectLimit   float64
+}
+
+func NewMonitor(name string, config *Config, logger *pct.Logger, conn mongodb.Connector) *Monitor {
+	if len(config.Stats) == 0 {
+		config.Stats = DefaultStats
+	}
+	m := &Monitor{
+		name:   name,
+		config: config,
+		logger: logger,
+		conn:   conn,
+		// --
+		connectedChan: make(chan bool, 1),
+		status:        pct.NewStatus([]string{name, name + "-mongodb"}),
+		sync:          pct.NewSyncChan(),
+		collectLimit:  float64(config.Collect) * 0.1, // 10% of Collect time
+	}
+	return m
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Interface
+/////////////////////////////////////////////////////////////////////////////
+
+func (m *Monitor) Start(tickChan chan time.Time, collectionChan chan *mm.Collection) error {
+	m.logger.Debug("Start:call")
+	defer m.logger.Debug("Start:return")
+
+	if m.running {
+		return pct.ServiceIsRunningError{m.name}
+	}
+
+	m.tickChan = tickChan
+	m.collectionChan = collectionChan
+
+	go m.run()
+	m.running = true
+	m.logger.Info("Started")
+
+	return nil
+}
+
+func (m *Monitor) Stop() error {
+	m.logger.Debug("Stop:call")
+	defer m.logger.Debug("Stop:return")
+
+	if !m.running {
+		return nil // already stopped
+	}
+
+	// Stop run().  When it returns, it updates status to "Stopped".
+	m.status.Update(m.name, "Stopping")
+	m.sync.Stop()
+	m.sync.Wait()
+
+	m.running = false
+	m.logger.Info("Stopped")
+
+	// Do not update status to "Stopped" here; run() does that on return.
+	return nil
+}
+
+func (m *Monitor) Status() map[string]string {
+	return m.status.All()
+}
+
+func (m *Monitor) TickChan() chan time.Time {
+	return m.tickChan
+}
+
+func (m *Monitor) Config() interface{} {
+	return m.config
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Implementation
+/////////////////////////////////////////////////////////////////////////////
+
+func (m *Monitor) connect(err error) {
+	m.logger.Debug("connect:call")
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("MongoDB connection crashed: ", err)
+		}
+		m.logger.Debug("connect:return")
+	}()
+	// Close/release previous connection, if any.
+	m.conn.Close()
+
+	// Try forever to connect to MongoDB...
+	for {
+		m.logger.Debug("connect:try")
+		if err != nil {
+			m.status.Update(m.name+"-mongodb", fmt.Sprintf("Connecting (%s)", err))
+		} else {
+			m.status.Update(m.name+"-mongodb", "Connecting")
+		}
+		if err = m.conn.Connect(1); err != nil {
+			m.logger.Warn(err)
+			continue
+		}
+		m.logger.Info("Connected")
+		m.status.Update(m.name+"-mongodb", "Connected")
+
+		// Tell run() goroutine that it can try to collect metrics.
+		// If connection is lost, it will call us again.
+		m.connectedChan <- true
+		return
+	}
+}
+
+func (m *Monitor) run() {
+	m.logger.Debug("run:call")
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("MongoDB monitor crashed: ", err)
+		}
+		m.conn.Close()
+		m.status.Update(m.name, "Stopped")
+		m.sync.Done()
+		m.logger.Debug("run:return")
+	}()
+
+	connected := false
+	go m.connect(nil)
+
+	m.status.Update(m.name, "Ready")
+
+	var lastTs int64
+	var lastError string
+	for {
+		t := time.Unix(lastTs, 0)
+		if lastError == "" {
+			m.status.Update(m.name, fmt.Sprintf("Idle (last collected at %s)", pct.TimeString(t)))
+		} else {
+			m.status.Update(m.name, fmt.Sprintf("Idle (last collected at %s, error: %s)", pct.TimeString(t), lastError))
+		}
+
+		select {
+		case now := <-m.tickChan:
+			m.logger.Debug("run:collect:start")
+			if !connected {
+				m.logger.Debug("run:collect:disconnected")
+				lastError = "Not connected to MongoDB"
+				continue
+			}
+
+			m.status.Update(m.name, "Running")
+			c := &mm.Collection{
+				ServiceInstance: proto.ServiceInstance{
+					Service:    m.config.Service,
+					InstanceId: m.config.InstanceId,
+				},
+				Ts:      now.UTC().Unix(),
+				Metrics: []mm.Metric{},
+			}
+
+			// Start timing the collection.  If must take < collectLimit else
+			// it's discarded.
+			start := time.Now()
+
+			m.status.Update(m.name, "Getting serverStatus metrics")
+			status, err := m.conn.ServerStatus()
+			if err != nil {
+				// Like the PostgreSQL monitor, a command error is the only
+				// way to know the connection is lost. Reconnecting is
+				// harmless if it wasn't.
+				m.logger.Warn(err)
+				lastError = err.Error()
+				connected = false
+				go m.connect(err)
+				continue
+			}
+			c.Metrics = ServerStatusMetrics(status, m.config.Stats)
+
+			// Like the MySQL monitor, discard metrics that took too long to
+			// collect because they would cause spikes.
+			diff := time.Now().Sub(start).Seconds()
+			if diff >= m.collectLimit {
+				lastError = fmt.Sprintf("Skipping interval because it took too long to collect: %.2fs >= %.2fs", diff, m.collectLimit)
+				m.logger.Warn(lastError)
+				continue
+			}
+
+			// Send the metrics to an mm.Aggregator.
+			m.status.Update(m.name, "Sending metrics")
+			if len(c.Metrics) > 0 {
+				select {
+				case m.collectionChan <- c:
+					lastTs = c.Ts
+					lastError = ""
+				case <-time.After(500 * time.Millisecond):
+					// lost collection
+					m.logger.Debug("Lost MongoDB metrics; timeout spooling after 500ms")
+					lastError = "Spool timeout"
+				}
+			} else {
+				m.logger.Debug("run:no metrics") // no configured stats in serverStatus
+				lastError = "No metrics"
+			}
+
+			m.logger.Debug("run:collect:stop")
+		case connected = <-m.connectedChan:
+			m.logger.Debug("run:connected:true")
+			m.status.Update(m.name, "Ready")
+		case <-m.sync.StopChan:
+			m.logger.Debug("run:stop")
+			return
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+// serverStatus
+// http://docs.mongodb.org/manual/reference/command/serverStatus/
+// --------------------------------------------------------------------------
+
+// Lock modes in serverStatus locks are r, w, R, and W, which differ only by
+// case, and metric names aren't case-sensitive everywhere, e.g. Prometheus
+// names are lowercase, so the modes are named instead.
+// http://docs.mongodb.org/manual/faq/concurrency/#faq-concurrency-locking
+var lockModes = map[string]string{
+	"r": "intent_shared",
+	"w": "intent_exclusive",
+	"R": "shared",
+	"W": "exclusive",
+}
+
+// ServerStatusMetrics returns a metric for each path in stats that's in the
+// serverStatus output, e.g. opcounters/insert becomes mongodb/opcounters/insert.
+// Spaces in names, which wiredTiger uses, become underscores, and lock modes
+// are named, e.g. locks/Global/acquireCount/r becomes .../intent_shared. Paths
+// that aren't found or aren't numeric are ignored. Metrics are sorted by name.
+func ServerStatusMetrics(status map[string]interface{}, stats map[string]string) []mm.Metric {
+	metrics := []mm.Metric{}
+	for path, metricType := range stats {
+		keys := strings.Split(path, "/")
+		val, ok := lookup(status, keys)
+		if !ok {
+			continue
+		}
+		if keys[0] == "locks" {
+			if mode, ok := lockModes[keys[len(keys)-1]]; ok {
+				keys[len(keys)-1] = mode
+			}
+		}
+		name := "mongodb/" + strings.Replace(strings.Join(keys, "/"), " ", "_", -1)
+		metrics = append(metrics, mm.Metric{name, metricType, val, ""})
+	}
+	sort.Sort(byName(metrics))
+	return metrics
+}
+
+// lookup walks the embedded documents of doc to the value at path.
+func lookup(doc map[string]interface{}, path []string) (float64, bool) {
+	v, ok := doc[path[0]]
+	if !ok {
+		return 0, false
+	}
+	if len(path) > 1 {
+		switch sub := v.(type) {
+		case bson.M: // mgo decodes embedded documents as bson.M
+			return lookup(sub, path[1:])
+		case map[string]interface{}:
+			return lookup(sub, path[1:])
+		}
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+type byName []mm.Metric
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
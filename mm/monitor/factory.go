@@ -20,14 +20,19 @@ package monitor
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/instance"
 	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mm/mongodb"
 	"github.com/percona/percona-agent/mm/mysql"
+	"github.com/percona/percona-agent/mm/postgres"
 	"github.com/percona/percona-agent/mm/system"
+	mongoConn "github.com/percona/percona-agent/mongodb"
 	"github.com/percona/percona-agent/mrms"
 	mysqlConn "github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
+	pgConn "github.com/percona/percona-agent/postgres"
 )
 
 type Factory struct {
@@ -72,22 +77,87 @@ func (f *Factory) Make(service string, instanceId uint, data []byte) (mm.Monitor
 			mysqlConn.NewConnection(mysqlIt.DSN),
 			f.mrm,
 		)
+	case "postgres":
+		// Load the PostgreSQL instance info (DSN, name, etc.).
+		pgIt := &instance.PostgreSQLInstance{}
+		if err := f.ir.Get(service, instanceId, pgIt); err != nil {
+			return nil, err
+		}
+
+		// Parse the PostgreSQL mm config.
+		config := &postgres.Config{}
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+
+		alias := "mm-postgres-" + pgIt.Hostname
+
+		// Make a PostgreSQL metrics monitor.
+		monitor = postgres.NewMonitor(
+			alias,
+			config,
+			pct.NewLogger(f.logChan, alias),
+			pgConn.NewConnection(pgIt.DSN),
+		)
+	case "mongodb":
+		// Load the MongoDB instance info (DSN, name, etc.).
+		mongoIt := &instance.MongoDBInstance{}
+		if err := f.ir.Get(service, instanceId, mongoIt); err != nil {
+			return nil, err
+		}
+
+		// Parse the MongoDB mm config.
+		config := &mongodb.Config{}
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+
+		alias := "mm-mongodb-" + mongoIt.Hostname
+
+		// Make a MongoDB metrics monitor.
+		monitor = mongodb.NewMonitor(
+			alias,
+			config,
+			pct.NewLogger(f.logChan, alias),
+			mongoConn.NewConnection(mongoIt.DSN),
+		)
 	case "server":
 		// Parse the system mm config.
 		config := &system.Config{}
 		if err := json.Unmarshal(data, config); err != nil {
 			return nil, err
 		}
+		if err := system.ValidateConfig(config); err != nil {
+			return nil, fmt.Errorf("Invalid system.Config: %s", err)
+		}
 
 		// Only one system for now, so no SystemInstance and no  "-instanceName" suffix.
 		alias := "mm-system"
 
 		// Make a MySQL metrics monitor.
-		monitor = system.NewMonitor(
+		logger := pct.NewLogger(f.logChan, alias)
+		sysMonitor := system.NewMonitor(
 			alias,
 			config,
-			pct.NewLogger(f.logChan, alias),
+			logger,
 		)
+
+		// Discover the filesystems of MySQL instances on this server.
+		// A removed instance shouldn't stop the system metrics.
+		for _, id := range config.MySQLInstances {
+			mysqlIt := &proto.MySQLInstance{}
+			if err := f.ir.Get("mysql", id, mysqlIt); err != nil {
+				logger.Warn(fmt.Sprintf("Cannot get MySQL instance %d, not monitoring its filesystems: %s", id, err))
+				continue
+			}
+			// A remote MySQL instance's paths aren't on this server.
+			if !mysqlConn.LocalDSN(mysqlIt.DSN) {
+				logger.Info(fmt.Sprintf("MySQL instance %d is not on this server, not monitoring its filesystems", id))
+				continue
+			}
+			sysMonitor.AddMySQL(mysqlConn.NewConnection(mysqlIt.DSN))
+		}
+		monitor = sysMonitor
 	default:
 		return nil, errors.New("Unknown metrics monitor type: " + service)
 	}
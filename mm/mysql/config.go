@@ -26,5 +26,22 @@ type Config struct {
 	Status            map[string]string // SHOW STATUS variables to collect, case-sensitive
 	InnoDB            []string          // SET GLOBAL innodb_monitor_enable="<value>"
 	UserStats         bool              // SET GLOBAL userstat=ON|OFF
-	UserStatsIgnoreDb string
+	UserStatsIgnoreDb string            // also for PerfSchemaTableIO
+	PerfSchemaTableIO bool              // userstat-like table and index metrics from performance_schema, if not UserStats
+	SlaveStatus       bool              // SHOW SLAVE STATUS
+	Heartbeat         *HeartbeatConfig  // pt-heartbeat replication delay, nil to disable
+}
+
+// A HeartbeatConfig enables writing a pt-heartbeat row on a master and reading
+// it on slaves to collect mysql/heartbeat/delay. The monitor writes if MySQL is
+// not read_only and not a slave, else it reads, and it checks again when MRMS
+// reports read_only changed or a different MySQL. Writing requires INSERT and
+// UPDATE on the table, and CREATE if Create is true. Like pt-heartbeat, ts is
+// local time unless UTC is true, so set UTC if pt-heartbeat runs with --utc or
+// the master and slaves are in different time zones.
+type HeartbeatConfig struct {
+	Table    string // db.table, default percona.heartbeat
+	ServerId uint   // server_id of the master to read, default the newest row
+	Create   bool   // CREATE DATABASE and TABLE IF NOT EXISTS before writing
+	UTC      bool   // ts is UTC like pt-heartbeat --utc, else local time
 }
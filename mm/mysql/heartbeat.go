@@ -0,0 +1,193 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mysql"
+)
+
+const DefaultHeartbeatTable = "percona.heartbeat"
+
+// pt-heartbeat ts values are like 2015-06-09T13:21:40.001410. Parsing accepts
+// any number of fractional seconds, or none.
+const heartbeatTsFormat = "2006-01-02T15:04:05.000000"
+
+// CreateHeartbeatTable creates the pt-heartbeat table and its database if
+// they don't exist.
+func CreateHeartbeatTable(conn *sql.DB, table string) error {
+	if db := strings.SplitN(table, ".", 2); len(db) == 2 {
+		if _, err := conn.Exec("CREATE DATABASE IF NOT EXISTS " + db[0]); err != nil {
+			return err
+		}
+	}
+	_, err := conn.Exec("CREATE TABLE IF NOT EXISTS " + table + " (" +
+		" ts                    varchar(26) NOT NULL," +
+		" server_id             int unsigned NOT NULL PRIMARY KEY," +
+		" file                  varchar(255) DEFAULT NULL," +
+		" position              bigint unsigned DEFAULT NULL," +
+		" relay_master_log_file varchar(255) DEFAULT NULL," +
+		" exec_master_log_pos   bigint unsigned DEFAULT NULL" +
+		")")
+	return err
+}
+
+// HeartbeatWriter returns true if MySQL should write heartbeats: it's not
+// read_only and not a slave. A writable slave, e.g. the passive master of a
+// master-master pair, reads heartbeats from the active master.
+func HeartbeatWriter(conn *sql.DB) (bool, error) {
+	var readOnly bool
+	if err := conn.QueryRow("SELECT @@GLOBAL.read_only").Scan(&readOnly); err != nil {
+		return false, err
+	}
+	if readOnly {
+		return false, nil
+	}
+	rows, err := conn.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	isSlave := rows.Next()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	return !isSlave, nil
+}
+
+// WriteHeartbeat writes the heartbeat row for this server like pt-heartbeat
+// --update, with ts in loc: time.UTC like --utc, else time.Local.
+func WriteHeartbeat(conn *sql.DB, table string, now time.Time, loc *time.Location) error {
+	_, err := conn.Exec("INSERT INTO "+table+" (ts, server_id) VALUES (?, @@server_id)"+
+		" ON DUPLICATE KEY UPDATE ts = VALUES(ts)", FormatHeartbeatTs(now, loc))
+	return err
+}
+
+// ReadHeartbeat returns the replication delay in seconds from the heartbeat row
+// of the server_id, or the newest row if serverId is 0, with ts in loc. It
+// returns sql.ErrNoRows if there's no row or no table yet, e.g. before the
+// master writes the first heartbeat.
+func ReadHeartbeat(conn *sql.DB, table string, serverId uint, now time.Time, loc *time.Location) (float64, error) {
+	var ts string
+	var err error
+	if serverId > 0 {
+		err = conn.QueryRow("SELECT ts FROM "+table+" WHERE server_id = ?", serverId).Scan(&ts)
+	} else {
+		err = conn.QueryRow("SELECT ts FROM " + table + " ORDER BY ts DESC LIMIT 1").Scan(&ts)
+	}
+	if mysql.MySQLErrorCode(err) == mysql.ER_NO_SUCH_TABLE {
+		return 0, sql.ErrNoRows
+	}
+	if err != nil {
+		return 0, err
+	}
+	return HeartbeatDelay(ts, now, loc)
+}
+
+func FormatHeartbeatTs(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(heartbeatTsFormat)
+}
+
+// HeartbeatDelay returns the seconds between the heartbeat ts, which is in loc,
+// and now. The delay is never negative: if clocks are out of sync, a slave can
+// appear to be ahead of its master.
+func HeartbeatDelay(ts string, now time.Time, loc *time.Location) (float64, error) {
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", ts, loc)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid heartbeat ts: %s", err)
+	}
+	delay := now.Sub(t).Seconds()
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, nil
+}
+
+// heartbeat writes or reads the heartbeat depending on the role of MySQL,
+// checking the role first if it's not known. Readers add mysql/heartbeat/delay
+// to the collection.
+func (m *Monitor) heartbeat(conn *sql.DB, c *mm.Collection) error {
+	m.logger.Debug("heartbeat:call")
+	defer m.logger.Debug("heartbeat:return")
+
+	m.status.Update(m.name, "Heartbeat")
+
+	hb := m.config.Heartbeat
+	loc := time.Local // pt-heartbeat default
+	if hb.UTC {
+		loc = time.UTC
+	}
+	if !m.heartbeatRoleKnown {
+		writer, err := HeartbeatWriter(conn)
+		if err != nil {
+			return err
+		}
+		m.heartbeatRoleKnown = true
+		m.heartbeatWriter = writer
+		m.heartbeatWriteDenied = false
+		m.heartbeatCreated = false
+		if writer {
+			m.logger.Info("Writing heartbeats to " + hb.Table)
+		} else {
+			m.logger.Info("Reading heartbeats from " + hb.Table)
+		}
+	}
+
+	if !m.heartbeatWriter {
+		delay, err := ReadHeartbeat(conn, hb.Table, hb.ServerId, time.Now(), loc)
+		if err == sql.ErrNoRows {
+			return nil // master hasn't written a heartbeat yet
+		} else if err != nil {
+			return err
+		}
+		c.Metrics = append(c.Metrics, mm.Metric{"mysql/heartbeat/delay", "gauge", delay, ""})
+		return nil
+	}
+
+	if m.heartbeatWriteDenied {
+		return nil // until the role changes
+	}
+	if hb.Create && !m.heartbeatCreated {
+		if err := CreateHeartbeatTable(conn, hb.Table); err != nil {
+			return m.heartbeatWriteError(err)
+		}
+		m.heartbeatCreated = true
+	}
+	if err := WriteHeartbeat(conn, hb.Table, time.Now(), loc); err != nil {
+		return m.heartbeatWriteError(err)
+	}
+	return nil
+}
+
+// heartbeatWriteError stops writing heartbeats if the MySQL user doesn't have
+// the privileges to write them, else it returns the error.
+func (m *Monitor) heartbeatWriteError(err error) error {
+	switch mysql.MySQLErrorCode(err) {
+	case mysql.ER_USER_DENIED, mysql.ER_DBACCESS_DENIED_ERROR, mysql.ER_SPECIFIC_ACCESS_DENIED_ERROR:
+		db := strings.SplitN(m.config.Heartbeat.Table, ".", 2)[0]
+		m.logger.Error(fmt.Sprintf("Cannot write heartbeats: %s. Grant INSERT, UPDATE and CREATE on %s.* to the agent MySQL user.", err, db))
+		m.heartbeatWriteDenied = true
+		return nil
+	}
+	return err
+}
@@ -49,15 +49,23 @@ type Monitor struct {
 	tickChan       chan time.Time
 	collectionChan chan *mm.Collection
 	connectedChan  chan bool
-	restartChan    <-chan bool
+	restartChan    chan *mrms.Event
 	status         *pct.Status
 	sync           *pct.SyncChan
 	running        bool
 	collectLimit   float64
 	mrm            mrms.Monitor
+	// --
+	heartbeatRoleKnown   bool
+	heartbeatWriter      bool
+	heartbeatWriteDenied bool
+	heartbeatCreated     bool
 }
 
 func NewMonitor(name string, config *Config, logger *pct.Logger, conn mysql.Connector, mrm mrms.Monitor) *Monitor {
+	if config.Heartbeat != nil && config.Heartbeat.Table == "" {
+		config.Heartbeat.Table = DefaultHeartbeatTable
+	}
 	m := &Monitor{
 		name:   name,
 		config: config,
@@ -65,7 +73,7 @@ func NewMonitor(name string, config *Config, logger *pct.Logger, conn mysql.Conn
 		conn:   conn,
 		// --
 		connectedChan: make(chan bool, 1),
-		restartChan:   nil,
+		restartChan:   make(chan *mrms.Event, 1),
 		status:        pct.NewStatus([]string{name, name + "-mysql"}),
 		sync:          pct.NewSyncChan(),
 		collectLimit:  float64(config.Collect) * 0.1, // 10% of Collect time
@@ -109,7 +117,7 @@ func (m *Monitor) Stop() error {
 	m.sync.Stop()
 	m.sync.Wait()
 
-	m.mrm.Remove(m.conn.DSN(), m.restartChan)
+	m.mrm.Unsubscribe(m.conn.DSN(), m.restartChan)
 
 	m.running = false
 	m.logger.Info("Stopped")
@@ -165,12 +173,10 @@ func (m *Monitor) connect(err error) {
 		// Tell run() goroutine that it can try to collect metrics.
 		// If connection is lost, it will call us again.
 		m.connectedChan <- true
-		// Add the instance only when we have a connection. Otherwise, mrm.Add will fail
-		if m.restartChan == nil {
-			m.restartChan, err = m.mrm.Add(m.conn.DSN())
-			if err != nil {
-				m.logger.Warn(fmt.Sprintf("Cannot add instance to the restart monitor: %v", err))
-			}
+		// Subscribe only when we have a connection. Otherwise, mrm.Subscribe
+		// will fail. Subscribing again after reconnecting is a no-op.
+		if err := m.mrm.Subscribe(m.conn.DSN(), m.restartChan); err != nil {
+			m.logger.Warn(fmt.Sprintf("Cannot add instance to the restart monitor: %v", err))
 		}
 		return
 	}
@@ -303,6 +309,54 @@ func (m *Monitor) run() {
 				}
 			}
 
+			// The metrics have the same names as userstat metrics, so only one
+			// source is collected. userstat is preferred if both are enabled.
+			if m.config.PerfSchemaTableIO && !m.config.UserStats {
+				// SELECT ... FROM performance_schema.table_io_waits_summary_by_table
+				if err := m.getTablePerfSchemaIO(conn, c, m.config.UserStatsIgnoreDb); err != nil {
+					switch m.collectError(err) {
+					case accessDenied:
+						m.config.PerfSchemaTableIO = false
+					case networkError:
+						connected = false
+						continue
+					}
+				}
+				// SELECT ... FROM performance_schema.table_io_waits_summary_by_index_usage
+				if err := m.getIndexPerfSchemaIO(conn, c, m.config.UserStatsIgnoreDb); err != nil {
+					switch m.collectError(err) {
+					case accessDenied:
+						m.config.PerfSchemaTableIO = false
+					case networkError:
+						connected = false
+						continue
+					}
+				}
+			}
+
+			// SHOW SLAVE STATUS
+			if m.config.SlaveStatus {
+				if err := m.GetSlaveStatusMetrics(conn, c); err != nil {
+					switch m.collectError(err) {
+					case accessDenied:
+						m.config.SlaveStatus = false
+					case networkError:
+						connected = false
+						continue
+					}
+				}
+			}
+
+			// pt-heartbeat
+			if m.config.Heartbeat != nil {
+				if err := m.heartbeat(conn, c); err != nil {
+					if m.collectError(err) == networkError {
+						connected = false
+						continue
+					}
+				}
+			}
+
 			// It is possible that collecting metrics will stall for many
 			// seconds for some reason so even though we issued captures 1 sec in
 			// between, we actually got 5 seconds between results and as such we
@@ -337,8 +391,19 @@ func (m *Monitor) run() {
 		case connected = <-m.connectedChan:
 			m.logger.Debug("run:connected:true")
 			m.status.Update(m.name, "Ready")
-		case <-m.restartChan:
+			m.heartbeatRoleKnown = false // check on first collect
+		case e := <-m.restartChan:
 			m.logger.Debug("run:mysql:restart")
+			if e.Has(mrms.CHANGE_READ_ONLY) || e.Restarted() {
+				// Master demoted, slave promoted, or a different MySQL,
+				// so the heartbeat writer or reader may have changed.
+				m.heartbeatRoleKnown = false
+			}
+			if !e.Restarted() {
+				m.logger.Info("MySQL changed: " + e.String())
+				continue
+			}
+			m.logger.Info("Reconnecting to MySQL because of " + e.String())
 			connected = false
 			go m.connect(fmt.Errorf("Lost connection to MySQL, restarting"))
 		case <-m.sync.StopChan:
@@ -549,11 +614,238 @@ func (m *Monitor) getIndexUserStats(conn *sql.DB, c *mm.Collection, ignoreDb str
 	return nil
 }
 
+// --------------------------------------------------------------------------
+// Performance Schema table and index IO
+// http://dev.mysql.com/doc/refman/5.6/en/table-waits-summary-tables.html
+// --------------------------------------------------------------------------
+
+func (m *Monitor) getTablePerfSchemaIO(conn *sql.DB, c *mm.Collection, ignoreDb string) error {
+	m.logger.Debug("getTablePerfSchemaIO:call")
+	defer m.logger.Debug("getTablePerfSchemaIO:return")
+
+	m.status.Update(m.name, "Getting performance_schema table metrics")
+
+	/**
+	 * Like userstat TABLE_STATISTICS, rows_read is rows fetched and rows_changed
+	 * is rows inserted, updated and deleted. There's no rows_changed_x_indexes.
+	 * Tables without IO are skipped because, unlike userstat, performance_schema
+	 * has a row for every table that has been opened. By default, the mysql,
+	 * information_schema and performance_schema dbs are not instrumented
+	 * (performance_schema.setup_objects).
+	 */
+	sql := "SELECT OBJECT_SCHEMA, OBJECT_NAME, COUNT_FETCH, COUNT_INSERT, COUNT_UPDATE, COUNT_DELETE" +
+		" FROM performance_schema.table_io_waits_summary_by_table" +
+		" WHERE OBJECT_TYPE = 'TABLE' AND COUNT_STAR > 0"
+	if ignoreDb != "" {
+		sql += " AND OBJECT_SCHEMA NOT LIKE '" + ignoreDb + "'"
+	}
+	rows, err := conn.Query(sql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableSchema string
+		var tableName string
+		var rowsFetched int64
+		var rowsInserted int64
+		var rowsUpdated int64
+		var rowsDeleted int64
+		err = rows.Scan(&tableSchema, &tableName, &rowsFetched, &rowsInserted, &rowsUpdated, &rowsDeleted)
+		if err != nil {
+			return err
+		}
+
+		prefix := "mysql/db." + tableSchema + "/t." + tableName + "/"
+		c.Metrics = append(c.Metrics, mm.Metric{prefix + "rows_read", "counter", float64(rowsFetched), ""})
+		c.Metrics = append(c.Metrics, mm.Metric{prefix + "rows_changed", "counter", float64(rowsInserted + rowsUpdated + rowsDeleted), ""})
+		c.Metrics = append(c.Metrics, mm.Metric{prefix + "rows_inserted", "counter", float64(rowsInserted), ""})
+		c.Metrics = append(c.Metrics, mm.Metric{prefix + "rows_updated", "counter", float64(rowsUpdated), ""})
+		c.Metrics = append(c.Metrics, mm.Metric{prefix + "rows_deleted", "counter", float64(rowsDeleted), ""})
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Monitor) getIndexPerfSchemaIO(conn *sql.DB, c *mm.Collection, ignoreDb string) error {
+	m.logger.Debug("getIndexPerfSchemaIO:call")
+	defer m.logger.Debug("getIndexPerfSchemaIO:return")
+
+	m.status.Update(m.name, "Getting performance_schema index metrics")
+
+	/**
+	 * Like userstat INDEX_STATISTICS, rows_read is rows fetched using the index.
+	 * INDEX_NAME is NULL for rows read without an index, i.e. table scans,
+	 * which are counted in the table rows_read.
+	 */
+	sql := "SELECT OBJECT_SCHEMA, OBJECT_NAME, INDEX_NAME, COUNT_FETCH" +
+		" FROM performance_schema.table_io_waits_summary_by_index_usage" +
+		" WHERE OBJECT_TYPE = 'TABLE' AND INDEX_NAME IS NOT NULL AND COUNT_FETCH > 0"
+	if ignoreDb != "" {
+		sql += " AND OBJECT_SCHEMA NOT LIKE '" + ignoreDb + "'"
+	}
+	rows, err := conn.Query(sql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableSchema string
+		var tableName string
+		var indexName string
+		var rowsRead int64
+		err = rows.Scan(&tableSchema, &tableName, &indexName, &rowsRead)
+		if err != nil {
+			return err
+		}
+
+		metricName := "mysql/db." + tableSchema + "/t." + tableName + "/idx." + indexName + "/rows_read"
+		metricValue := float64(rowsRead)
+		c.Metrics = append(c.Metrics, mm.Metric{metricName, "counter", metricValue, ""})
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// SHOW SLAVE STATUS
+// http://dev.mysql.com/doc/refman/5.7/en/show-slave-status.html
+// --------------------------------------------------------------------------
+
+func (m *Monitor) GetSlaveStatusMetrics(conn *sql.DB, c *mm.Collection) error {
+	m.logger.Debug("GetSlaveStatusMetrics:call")
+	defer m.logger.Debug("GetSlaveStatusMetrics:return")
+
+	m.status.Update(m.name, "Getting slave status metrics")
+
+	// Columns vary by version, e.g. Channel_Name in 5.7, so scan them all.
+	// There's one row per replication channel, or none if not a slave.
+	rows, err := conn.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		status := make(map[string]string)
+		for i, column := range columns {
+			if values[i].Valid {
+				status[column] = values[i].String
+			}
+		}
+		c.Metrics = append(c.Metrics, SlaveStatusMetrics(status)...)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SlaveStatusMetrics returns the metrics for one row of SHOW SLAVE STATUS,
+// given as column => value without NULL values, e.g. Seconds_Behind_Master
+// which is NULL when the SQL thread isn't running. Metrics are named like
+// mysql/slave/seconds_behind_master, or mysql/slave/<channel>/... for named
+// multi-source channels.
+func SlaveStatusMetrics(status map[string]string) []mm.Metric {
+	prefix := "mysql/slave/"
+	if channel := status["Channel_Name"]; channel != "" {
+		prefix += channel + "/"
+	}
+
+	metrics := []mm.Metric{}
+	for _, stat := range []struct {
+		column     string
+		metricType string
+	}{
+		{"Seconds_Behind_Master", "gauge"},
+		{"Relay_Log_Space", "gauge"},
+		{"Read_Master_Log_Pos", "counter"},
+		{"Exec_Master_Log_Pos", "counter"},
+	} {
+		val, ok := status[stat.column]
+		if !ok || val == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, mm.Metric{prefix + strings.ToLower(stat.column), stat.metricType, n, ""})
+	}
+
+	// Slave_IO_Running is Yes, No or Connecting; only Yes is running.
+	for _, column := range []string{"Slave_IO_Running", "Slave_SQL_Running"} {
+		val, ok := status[column]
+		if !ok {
+			continue
+		}
+		running := 0.0
+		if val == "Yes" {
+			running = 1
+		}
+		metrics = append(metrics, mm.Metric{prefix + strings.ToLower(column), "gauge", running, ""})
+	}
+
+	// Executed_Gtid_Set is empty if GTIDs are off.
+	if gtidSet := status["Executed_Gtid_Set"]; gtidSet != "" {
+		metrics = append(metrics, mm.Metric{prefix + "executed_gtid_set_size", "counter", float64(GtidSetSize(gtidSet)), ""})
+	}
+
+	return metrics
+}
+
+// GtidSetSize returns the number of transactions in a GTID set like
+// "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11-18,\n2174B383-...:1-3".
+func GtidSetSize(gtidSet string) uint64 {
+	var size uint64
+	for _, uuidSet := range strings.Split(gtidSet, ",") {
+		intervals := strings.Split(strings.TrimSpace(uuidSet), ":")
+		for _, interval := range intervals[1:] { // [0] is the server UUID
+			startEnd := strings.SplitN(interval, "-", 2)
+			start, err := strconv.ParseUint(startEnd[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			end := start
+			if len(startEnd) == 2 {
+				if end, err = strconv.ParseUint(startEnd[1], 10, 64); err != nil || end < start {
+					continue
+				}
+			}
+			size += end - start + 1
+		}
+	}
+	return size
+}
+
 func (m *Monitor) collectError(err error) error {
 	switch {
 	case mysql.MySQLErrorCode(err) == mysql.ER_SPECIFIC_ACCESS_DENIED_ERROR:
 		m.logger.Error(fmt.Sprintf("Cannot collect InnoDB stats: %s", err))
 		return accessDenied
+	case mysql.MySQLErrorCode(err) == mysql.ER_USER_DENIED:
+		// SELECT denied on a table, e.g. performance_schema table IO, so stop
+		// collecting it instead of failing every interval.
+		m.logger.Error(fmt.Sprintf("Cannot collect table metrics: %s", err))
+		return accessDenied
 	}
 	switch err.(type) {
 	case *net.OpError:
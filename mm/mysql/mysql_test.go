@@ -361,6 +361,84 @@ func (s *TestSuite) TestCollectUserstats(t *C) {
 	m.Stop()
 }
 
+func (s *TestSuite) TestCollectPerfSchemaTableIO(t *C) {
+	/**
+	 * performance_schema doesn't instrument the mysql db by default, so make
+	 * a table, and reset the table and index IO stats.
+	 */
+	defer s.db.Exec("DROP DATABASE IF EXISTS percona_agent_test")
+	queries := []string{
+		"DROP DATABASE IF EXISTS percona_agent_test",
+		"CREATE DATABASE percona_agent_test",
+		"CREATE TABLE percona_agent_test.t (id INT NOT NULL PRIMARY KEY, c INT) ENGINE=InnoDB",
+		"INSERT INTO percona_agent_test.t VALUES (1, 1), (2, 2), (3, 3)",
+		"TRUNCATE performance_schema.table_io_waits_summary_by_table",
+		"TRUNCATE performance_schema.table_io_waits_summary_by_index_usage",
+	}
+	for _, q := range queries {
+		if _, err := s.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &mysql.Config{
+		Config: mm.Config{
+			ServiceInstance: proto.ServiceInstance{
+				Service:    "mysql",
+				InstanceId: 1,
+			},
+			Collect: 1,
+			Report:  60,
+		},
+		PerfSchemaTableIO: true,
+	}
+
+	m := mysql.NewMonitor(s.name, config, s.logger, mysqlConn.NewConnection(dsn), s.mrm)
+	if m == nil {
+		t.Fatal("Make new mysql.Monitor")
+	}
+
+	err := m.Start(s.tickChan, s.collectionChan)
+	if err != nil {
+		t.Fatalf("Start monitor without error, got %s", err)
+	}
+
+	if ok := test.WaitStatus(5, m, s.name+"-mysql", "Connected"); !ok {
+		t.Fatal("Monitor is ready")
+	}
+
+	// Read 1 row by PK, and change 2 rows.
+	var c int
+	if err := s.db.QueryRow("SELECT c FROM percona_agent_test.t WHERE id = 2").Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec("UPDATE percona_agent_test.t SET c = 0 WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec("DELETE FROM percona_agent_test.t WHERE id = 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.tickChan <- time.Now()
+	got := test.WaitCollection(s.collectionChan, 1)
+	if len(got) == 0 {
+		t.Fatal("Got a collection after tick")
+	}
+
+	metrics := map[string]float64{}
+	for _, m := range got[0].Metrics {
+		metrics[m.Name] = m.Number
+	}
+	t.Check(metrics["mysql/db.percona_agent_test/t.t/rows_read"] >= 1, Equals, true)
+	t.Check(metrics["mysql/db.percona_agent_test/t.t/rows_changed"], Equals, float64(2))
+	t.Check(metrics["mysql/db.percona_agent_test/t.t/rows_updated"], Equals, float64(1))
+	t.Check(metrics["mysql/db.percona_agent_test/t.t/rows_deleted"], Equals, float64(1))
+	t.Check(metrics["mysql/db.percona_agent_test/t.t/idx.PRIMARY/rows_read"] >= 1, Equals, true)
+
+	// Stop montior, clean up.
+	m.Stop()
+}
+
 // This test is the same as TestCollectInnoDBStats with the only difference that
 // now we are simulating a MySQL disconnection.
 // After a disconnection, we must still be able to collect InnoDB stats
@@ -531,3 +609,161 @@ func (s *TestSuite) TestStartWithInvalidDSN(t *C) {
 	err := m.Start(s.tickChan, s.collectionChan)
 	t.Assert(err, IsNil)
 }
+
+func (s *TestSuite) TestHeartbeat(t *C) {
+	table := "percona_agent_test.heartbeat"
+	defer s.db.Exec("DROP DATABASE IF EXISTS percona_agent_test")
+
+	err := mysql.CreateHeartbeatTable(s.db, table)
+	t.Assert(err, IsNil)
+
+	// No heartbeat yet.
+	_, err = mysql.ReadHeartbeat(s.db, table, 0, time.Now(), time.UTC)
+	t.Check(err, Equals, sql.ErrNoRows)
+
+	// No table yet is the same, not an error every interval.
+	_, err = mysql.ReadHeartbeat(s.db, "percona_agent_test.no_such_table", 0, time.Now(), time.UTC)
+	t.Check(err, Equals, sql.ErrNoRows)
+
+	// The test server isn't read_only or a slave, so it's the writer.
+	writer, err := mysql.HeartbeatWriter(s.db)
+	t.Assert(err, IsNil)
+	t.Check(writer, Equals, true)
+
+	// ts has microsecond precision.
+	now := time.Now().Truncate(time.Microsecond)
+	err = mysql.WriteHeartbeat(s.db, table, now, time.Local)
+	t.Assert(err, IsNil)
+	err = mysql.WriteHeartbeat(s.db, table, now, time.Local) // updates the row
+	t.Assert(err, IsNil)
+
+	var rows int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&rows)
+	t.Assert(err, IsNil)
+	t.Check(rows, Equals, 1)
+
+	delay, err := mysql.ReadHeartbeat(s.db, table, 0, now.Add(1500*time.Millisecond), time.Local)
+	t.Assert(err, IsNil)
+	t.Check(delay, Equals, 1.5)
+
+	var serverId uint
+	err = s.db.QueryRow("SELECT @@server_id").Scan(&serverId)
+	t.Assert(err, IsNil)
+	delay, err = mysql.ReadHeartbeat(s.db, table, serverId, now.Add(1500*time.Millisecond), time.Local)
+	t.Assert(err, IsNil)
+	t.Check(delay, Equals, 1.5)
+	_, err = mysql.ReadHeartbeat(s.db, table, serverId+1, now, time.Local)
+	t.Check(err, Equals, sql.ErrNoRows)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// pt-heartbeat
+/////////////////////////////////////////////////////////////////////////////
+
+type HeartbeatTestSuite struct {
+}
+
+var _ = Suite(&HeartbeatTestSuite{})
+
+func (s *HeartbeatTestSuite) TestHeartbeatDelay(t *C) {
+	ts := time.Date(2015, 6, 9, 13, 21, 40, 1410000, time.UTC)
+	t.Check(mysql.FormatHeartbeatTs(ts, time.UTC), Equals, "2015-06-09T13:21:40.001410")
+
+	// With --utc, local time is converted to UTC.
+	est := time.FixedZone("EST", -5*3600)
+	t.Check(mysql.FormatHeartbeatTs(ts.In(est), time.UTC), Equals, "2015-06-09T13:21:40.001410")
+
+	// Without --utc, pt-heartbeat writes local time.
+	t.Check(mysql.FormatHeartbeatTs(ts, est), Equals, "2015-06-09T08:21:40.001410")
+
+	delay, err := mysql.HeartbeatDelay("2015-06-09T13:21:40.001410", ts.Add(2*time.Second), time.UTC)
+	t.Assert(err, IsNil)
+	t.Check(delay, Equals, 2.0)
+
+	// A local time ts isn't hours off.
+	delay, err = mysql.HeartbeatDelay("2015-06-09T08:21:40.001410", ts.Add(2*time.Second), est)
+	t.Assert(err, IsNil)
+	t.Check(delay, Equals, 2.0)
+
+	// pt-heartbeat without microseconds.
+	delay, err = mysql.HeartbeatDelay("2015-06-09T13:21:40", ts.In(est), time.UTC)
+	t.Assert(err, IsNil)
+	t.Check(delay, Equals, 0.00141)
+
+	// Slave clock behind master clock.
+	delay, err = mysql.HeartbeatDelay("2015-06-09T13:21:42", ts, time.UTC)
+	t.Assert(err, IsNil)
+	t.Check(delay, Equals, 0.0)
+
+	_, err = mysql.HeartbeatDelay("2015-06-09 13:21:40", ts, time.UTC)
+	t.Check(err, NotNil)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// SHOW SLAVE STATUS
+/////////////////////////////////////////////////////////////////////////////
+
+type SlaveStatusTestSuite struct {
+}
+
+var _ = Suite(&SlaveStatusTestSuite{})
+
+func (s *SlaveStatusTestSuite) TestSlaveStatusMetrics(t *C) {
+	// A 5.6 slave, so no Channel_Name.
+	status := map[string]string{
+		"Slave_IO_State":        "Waiting for master to send event",
+		"Master_Log_File":       "mysql-bin.000012",
+		"Read_Master_Log_Pos":   "8820736",
+		"Relay_Log_Space":       "1048913",
+		"Slave_IO_Running":      "Yes",
+		"Slave_SQL_Running":     "Yes",
+		"Exec_Master_Log_Pos":   "8819102",
+		"Seconds_Behind_Master": "3",
+		"Executed_Gtid_Set":     "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:11-18",
+	}
+	got := mysql.SlaveStatusMetrics(status)
+	expect := []mm.Metric{
+		{Name: "mysql/slave/seconds_behind_master", Type: "gauge", Number: 3},
+		{Name: "mysql/slave/relay_log_space", Type: "gauge", Number: 1048913},
+		{Name: "mysql/slave/read_master_log_pos", Type: "counter", Number: 8820736},
+		{Name: "mysql/slave/exec_master_log_pos", Type: "counter", Number: 8819102},
+		{Name: "mysql/slave/slave_io_running", Type: "gauge", Number: 1},
+		{Name: "mysql/slave/slave_sql_running", Type: "gauge", Number: 1},
+		{Name: "mysql/slave/executed_gtid_set_size", Type: "counter", Number: 13},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	// A 5.7 multi-source channel with a stopped SQL thread: Seconds_Behind_Master
+	// is NULL so it's not in the row.
+	status = map[string]string{
+		"Read_Master_Log_Pos": "154",
+		"Relay_Log_Space":     "527",
+		"Slave_IO_Running":    "Connecting",
+		"Slave_SQL_Running":   "No",
+		"Exec_Master_Log_Pos": "154",
+		"Executed_Gtid_Set":   "",
+		"Channel_Name":        "master2",
+	}
+	got = mysql.SlaveStatusMetrics(status)
+	expect = []mm.Metric{
+		{Name: "mysql/slave/master2/relay_log_space", Type: "gauge", Number: 527},
+		{Name: "mysql/slave/master2/read_master_log_pos", Type: "counter", Number: 154},
+		{Name: "mysql/slave/master2/exec_master_log_pos", Type: "counter", Number: 154},
+		{Name: "mysql/slave/master2/slave_io_running", Type: "gauge", Number: 0},
+		{Name: "mysql/slave/master2/slave_sql_running", Type: "gauge", Number: 0},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+}
+
+func (s *SlaveStatusTestSuite) TestGtidSetSize(t *C) {
+	t.Check(mysql.GtidSetSize(""), Equals, uint64(0))
+	t.Check(mysql.GtidSetSize("3e11fa47-71ca-11e1-9e33-c80aa9429562:1"), Equals, uint64(1))
+	t.Check(mysql.GtidSetSize("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:11-18"), Equals, uint64(13))
+	t.Check(mysql.GtidSetSize("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n2174b383-5441-11e8-b90a-c80aa9429562:1-3:7"), Equals, uint64(9))
+}
@@ -0,0 +1,58 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package postgres
+
+import (
+	"github.com/percona/percona-agent/mm"
+)
+
+type Config struct {
+	mm.Config
+	Stats map[string]string // table/column to collect and its type, e.g. "database/xact_commit": "counter"
+}
+
+// DefaultStats are collected if Config.Stats is empty. pg_stat_database
+// columns are summed for all databases.
+var DefaultStats = map[string]string{
+	"database/numbackends":           "gauge",
+	"database/xact_commit":           "counter",
+	"database/xact_rollback":         "counter",
+	"database/blks_read":             "counter",
+	"database/blks_hit":              "counter",
+	"database/tup_returned":          "counter",
+	"database/tup_fetched":           "counter",
+	"database/tup_inserted":          "counter",
+	"database/tup_updated":           "counter",
+	"database/tup_deleted":           "counter",
+	"database/conflicts":             "counter",
+	"database/temp_files":            "counter",
+	"database/temp_bytes":            "counter",
+	"database/deadlocks":             "counter",
+	"database/blk_read_time":         "counter",
+	"database/blk_write_time":        "counter",
+	"bgwriter/checkpoints_timed":     "counter",
+	"bgwriter/checkpoints_req":       "counter",
+	"bgwriter/checkpoint_write_time": "counter",
+	"bgwriter/checkpoint_sync_time":  "counter",
+	"bgwriter/buffers_checkpoint":    "counter",
+	"bgwriter/buffers_clean":         "counter",
+	"bgwriter/maxwritten_clean":      "counter",
+	"bgwriter/buffers_backend":       "counter",
+	"bgwriter/buffers_backend_fsync": "counter",
+	"bgwriter/buffers_alloc":         "counter",
+}
@@ -0,0 +1,346 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mysql"
+	"github.com/percona/percona-agent/pct"
+)
+
+// Tables are the pg_stat_ views collected, without the pg_stat_ prefix.
+var Tables = []string{"database", "bgwriter"}
+
+type Monitor struct {
+	name   string
+	config *Config
+	logger *pct.Logger
+	conn   mysql.Connector // postgres.Connection
+	// --
+	tickChan       chan time.Time
+	collectionChan chan *mm.Collection
+	connectedChan  chan bool
+	status         *pct.Status
+	sync           *pct.SyncChan
+	running        bool
+	collectLimit   float64
+}
+
+func NewMonitor(name string, config *Config, logger *pct.Logger, conn mysql.Connector) *Monitor {
+	if len(config.Stats) == 0 {
+		config.Stats = DefaultStats
+	}
+	m := &Monitor{
+		name:   name,
+		config: config,
+		logger: logger,
+		conn:   conn,
+		// --
+		connectedChan: make(chan bool, 1),
+		status:        pct.NewStatus([]string{name, name + "-postgres"}),
+		sync:          pct.NewSyncChan(),
+		collectLimit:  float64(config.Collect) * 0.1, // 10% of Collect time
+	}
+	return m
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Interface
+/////////////////////////////////////////////////////////////////////////////
+
+func (m *Monitor) Start(tickChan chan time.Time, collectionChan chan *mm.Collection) error {
+	m.logger.Debug("Start:call")
+	defer m.logger.Debug("Start:return")
+
+	if m.running {
+		return pct.ServiceIsRunningError{m.name}
+	}
+
+	m.tickChan = tickChan
+	m.collectionChan = collectionChan
+
+	go m.run()
+	m.running = true
+	m.logger.Info("Started")
+
+	return nil
+}
+
+func (m *Monitor) Stop() error {
+	m.logger.Debug("Stop:call")
+	defer m.logger.Debug("Stop:return")
+
+	if !m.running {
+		return nil // already stopped
+	}
+
+	// Stop run().  When it returns, it updates status to "Stopped".
+	m.status.Update(m.name, "Stopping")
+	m.sync.Stop()
+	m.sync.Wait()
+
+	m.running = false
+	m.logger.Info("Stopped")
+
+	// Do not update status to "Stopped" here; run() does that on return.
+	return nil
+}
+
+func (m *Monitor) Status() map[string]string {
+	return m.status.All()
+}
+
+func (m *Monitor) TickChan() chan time.Time {
+	return m.tickChan
+}
+
+func (m *Monitor) Config() interface{} {
+	return m.config
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Implementation
+/////////////////////////////////////////////////////////////////////////////
+
+func (m *Monitor) connect(err error) {
+	m.logger.Debug("connect:call")
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("PostgreSQL connection crashed: ", err)
+		}
+		m.logger.Debug("connect:return")
+	}()
+	// Close/release previous connection, if any.
+	m.conn.Close()
+
+	// Try forever to connect to PostgreSQL...
+	for {
+		m.logger.Debug("connect:try")
+		if err != nil {
+			m.status.Update(m.name+"-postgres", fmt.Sprintf("Connecting (%s)", err))
+		} else {
+			m.status.Update(m.name+"-postgres", "Connecting")
+		}
+		if err = m.conn.Connect(1); err != nil {
+			m.logger.Warn(err)
+			continue
+		}
+		m.logger.Info("Connected")
+		m.status.Update(m.name+"-postgres", "Connected")
+
+		// Tell run() goroutine that it can try to collect metrics.
+		// If connection is lost, it will call us again.
+		m.connectedChan <- true
+		return
+	}
+}
+
+func (m *Monitor) run() {
+	m.logger.Debug("run:call")
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("PostgreSQL monitor crashed: ", err)
+		}
+		m.conn.Close()
+		m.status.Update(m.name, "Stopped")
+		m.sync.Done()
+		m.logger.Debug("run:return")
+	}()
+
+	connected := false
+	go m.connect(nil)
+
+	m.status.Update(m.name, "Ready")
+
+	var lastTs int64
+	var lastError string
+	for {
+		t := time.Unix(lastTs, 0)
+		if lastError == "" {
+			m.status.Update(m.name, fmt.Sprintf("Idle (last collected at %s)", pct.TimeString(t)))
+		} else {
+			m.status.Update(m.name, fmt.Sprintf("Idle (last collected at %s, error: %s)", pct.TimeString(t), lastError))
+		}
+
+		select {
+		case now := <-m.tickChan:
+			m.logger.Debug("run:collect:start")
+			if !connected {
+				m.logger.Debug("run:collect:disconnected")
+				lastError = "Not connected to PostgreSQL"
+				continue
+			}
+
+			m.status.Update(m.name, "Running")
+			c := &mm.Collection{
+				ServiceInstance: proto.ServiceInstance{
+					Service:    m.config.Service,
+					InstanceId: m.config.InstanceId,
+				},
+				Ts:      now.UTC().Unix(),
+				Metrics: []mm.Metric{},
+			}
+
+			// Start timing the collection.  If must take < collectLimit else
+			// it's discarded.
+			start := time.Now()
+			conn := m.conn.DB()
+
+			// SELECT * FROM pg_stat_database, etc.
+			var err error
+			for _, table := range Tables {
+				if err = m.GetStats(conn, table, c); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				// lib/pq doesn't have a network error type, so a query error
+				// is the only way to know the connection is lost. Reconnecting
+				// is harmless if it wasn't.
+				m.logger.Warn(err)
+				lastError = err.Error()
+				connected = false
+				go m.connect(err)
+				continue
+			}
+
+			// Like the MySQL monitor, discard metrics that took too long to
+			// collect because they would cause spikes.
+			diff := time.Now().Sub(start).Seconds()
+			if diff >= m.collectLimit {
+				lastError = fmt.Sprintf("Skipping interval because it took too long to collect: %.2fs >= %.2fs", diff, m.collectLimit)
+				m.logger.Warn(lastError)
+				continue
+			}
+
+			// Send the metrics to an mm.Aggregator.
+			m.status.Update(m.name, "Sending metrics")
+			if len(c.Metrics) > 0 {
+				select {
+				case m.collectionChan <- c:
+					lastTs = c.Ts
+					lastError = ""
+				case <-time.After(500 * time.Millisecond):
+					// lost collection
+					m.logger.Debug("Lost PostgreSQL metrics; timeout spooling after 500ms")
+					lastError = "Spool timeout"
+				}
+			} else {
+				m.logger.Debug("run:no metrics") // shouldn't happen
+				lastError = "No metrics"
+			}
+
+			m.logger.Debug("run:collect:stop")
+		case connected = <-m.connectedChan:
+			m.logger.Debug("run:connected:true")
+			m.status.Update(m.name, "Ready")
+		case <-m.sync.StopChan:
+			m.logger.Debug("run:stop")
+			return
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+// pg_stat_* views
+// http://www.postgresql.org/docs/9.4/static/monitoring-stats.html
+// --------------------------------------------------------------------------
+
+func (m *Monitor) GetStats(conn *sql.DB, table string, c *mm.Collection) error {
+	m.logger.Debug("GetStats:call:" + table)
+	defer m.logger.Debug("GetStats:return:" + table)
+
+	m.status.Update(m.name, "Getting pg_stat_"+table+" metrics")
+
+	// Columns vary by version, so select all and collect the ones configured.
+	rows, err := conn.Query("SELECT * FROM pg_stat_" + table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := [][]string{}
+	for rows.Next() {
+		row := make([]sql.NullString, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		v := make([]string, len(columns))
+		for i := range row {
+			v[i] = row[i].String // "" if NULL
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	c.Metrics = append(c.Metrics, SumStats(table, columns, values, m.config.Stats)...)
+	return nil
+}
+
+// SumStats returns a metric for each column of the table in stats, e.g.
+// postgres/database/xact_commit, summing the column for all rows. Empty
+// (NULL) and non-numeric values are ignored. Metrics are sorted by name.
+func SumStats(table string, columns []string, rows [][]string, stats map[string]string) []mm.Metric {
+	metrics := []mm.Metric{}
+	for i, column := range columns {
+		metricType, ok := stats[table+"/"+column]
+		if !ok {
+			continue // not collecting this stat
+		}
+		sum := 0.0
+		n := 0
+		for _, row := range rows {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(row[i], 64)
+			if err != nil {
+				continue
+			}
+			sum += v
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		metrics = append(metrics, mm.Metric{"postgres/" + table + "/" + column, metricType, sum, ""})
+	}
+	sort.Sort(byName(metrics))
+	return metrics
+}
+
+type byName []mm.Metric
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
@@ -0,0 +1,59 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mm/postgres"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct {
+}
+
+var _ = Suite(&TestSuite{})
+
+func (s *TestSuite) TestSumStats(t *C) {
+	// Like SELECT datname, numbackends, xact_commit, stats_reset FROM pg_stat_database:
+	columns := []string{"datname", "numbackends", "xact_commit", "stats_reset"}
+	rows := [][]string{
+		{"template0", "0", "0", ""},
+		{"postgres", "1", "100", "2015-05-19 01:00:00+00"},
+		{"app", "5", "2000", ""},
+	}
+	stats := map[string]string{
+		"database/numbackends": "gauge",
+		"database/xact_commit": "counter",
+		"database/stats_reset": "counter", // not a number, so ignored
+	}
+	got := postgres.SumStats("database", columns, rows, stats)
+	t.Check(got, DeepEquals, []mm.Metric{
+		{Name: "postgres/database/numbackends", Type: "gauge", Number: 6},
+		{Name: "postgres/database/xact_commit", Type: "counter", Number: 2100},
+	})
+
+	// Columns not in stats aren't collected.
+	got = postgres.SumStats("bgwriter", []string{"checkpoints_timed", "foo"}, [][]string{{"3", "1"}}, postgres.DefaultStats)
+	t.Check(got, DeepEquals, []mm.Metric{
+		{Name: "postgres/bgwriter/checkpoints_timed", Type: "counter", Number: 3},
+	})
+}
@@ -0,0 +1,211 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/percona/percona-agent/pct"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * The Exporter exposes the latest value of every metric collected by
+ * monitors in the Prometheus text format (version 0.0.4), so metrics can be
+ * scraped locally, e.g. http://127.0.0.1:9104/metrics. Aggregators add each
+ * Collection to the Exporter before aggregating it, so the Exporter has the
+ * raw values: gauges are the current value and counters are the total, not
+ * the per-interval stats reported to the API.
+ */
+
+const PROMETHEUS_CONTENT_TYPE = "text/plain; version=0.0.4"
+
+type Exporter struct {
+	logger *pct.Logger
+	// --
+	mux      *sync.RWMutex
+	metrics  map[promInstance]map[string]Metric // keyed on instance, metric name
+	listener net.Listener
+}
+
+func NewExporter(logger *pct.Logger) *Exporter {
+	e := &Exporter{
+		logger: logger,
+		// --
+		mux:     &sync.RWMutex{},
+		metrics: make(map[promInstance]map[string]Metric),
+	}
+	return e
+}
+
+// Start listens on addr, e.g. "127.0.0.1:9104", and serves metrics at
+// /metrics until Stop is called.
+func (e *Exporter) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	e.listener = listener
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	go func() {
+		// Serve returns an error when Stop closes the listener.
+		if err := http.Serve(listener, mux); err != nil {
+			e.logger.Debug("Serve:", err)
+		}
+	}()
+	e.logger.Info("Serving Prometheus metrics on http://" + listener.Addr().String() + "/metrics")
+	return nil
+}
+
+// Addr returns the listen address, or an empty string if not started.
+func (e *Exporter) Addr() string {
+	if e.listener == nil {
+		return ""
+	}
+	return e.listener.Addr().String()
+}
+
+func (e *Exporter) Stop() error {
+	if e.listener == nil {
+		return nil
+	}
+	err := e.listener.Close()
+	e.listener = nil
+	return err
+}
+
+// Add saves the latest value of each metric in the collection. Metrics not
+// in the collection keep their previous value because monitors can collect
+// some metrics less often than others.
+func (e *Exporter) Add(c *Collection) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	si := promInstance{c.Service, c.InstanceId}
+	metrics, ok := e.metrics[si]
+	if !ok {
+		metrics = make(map[string]Metric)
+		e.metrics[si] = metrics
+	}
+	for _, metric := range c.Metrics {
+		if metric.Type != "gauge" && metric.Type != "counter" {
+			continue // Prometheus doesn't have string metrics
+		}
+		metrics[metric.Name] = metric
+	}
+}
+
+// Remove removes all metrics for the service instance, e.g. when its
+// monitor is stopped.
+func (e *Exporter) Remove(service string, instanceId uint) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	delete(e.metrics, promInstance{service, instanceId})
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+	w.Write(e.Metrics())
+}
+
+// Metrics returns all metrics in the Prometheus text format, sorted by name.
+// Each metric has service and instance_id labels because the same metric,
+// e.g. mysql_status_threads_running, can be collected from several instances.
+func (e *Exporter) Metrics() []byte {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	// Group by Prometheus name because all samples of a metric must be
+	// together after its TYPE line.
+	types := make(map[string]string)
+	samples := make(map[string][]promSample)
+	for si, metrics := range e.metrics {
+		for _, metric := range metrics {
+			name := PrometheusName(metric.Name)
+			if t, ok := types[name]; ok && t != metric.Type {
+				// Two mm names map to the same Prometheus name with different
+				// types, e.g. foo/bar gauge and foo-bar counter. Rare, skip.
+				continue
+			}
+			types[name] = metric.Type
+			samples[name] = append(samples[name], promSample{si, metric.Number})
+		}
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, types[name])
+		s := samples[name]
+		sort.Sort(byInstance(s))
+		for _, v := range s {
+			fmt.Fprintf(&buf, "%s{service=%q,instance_id=\"%d\"} %s\n",
+				name, v.si.Service, v.si.InstanceId, strconv.FormatFloat(v.value, 'g', -1, 64))
+		}
+	}
+	return buf.Bytes()
+}
+
+// PrometheusName returns a valid Prometheus metric name for an mm metric
+// name: mysql/status/Threads_running -> mysql_status_threads_running.
+func PrometheusName(name string) string {
+	name = strings.ToLower(name)
+	b := []byte(name)
+	for i, c := range b {
+		if (c >= 'a' && c <= 'z') || c == '_' || c == ':' || (c >= '0' && c <= '9' && i > 0) {
+			continue
+		}
+		b[i] = '_'
+	}
+	return string(b)
+}
+
+// --------------------------------------------------------------------------
+
+// promInstance is a proto.ServiceInstance without Instance, which is a
+// []byte so proto.ServiceInstance can't be a map key.
+type promInstance struct {
+	Service    string
+	InstanceId uint
+}
+
+type promSample struct {
+	si    promInstance
+	value float64
+}
+
+type byInstance []promSample
+
+func (a byInstance) Len() int      { return len(a) }
+func (a byInstance) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byInstance) Less(i, j int) bool {
+	if a[i].si.Service != a[j].si.Service {
+		return a[i].si.Service < a[j].si.Service
+	}
+	return a[i].si.InstanceId < a[j].si.InstanceId
+}
@@ -17,9 +17,41 @@
 package system
 
 import (
+	"errors"
+
 	"github.com/percona/percona-agent/mm"
 )
 
 type Config struct {
 	mm.Config
+	Processes []Process // optional, e.g. mysqld
+	// Filesystems are paths, e.g. /var/lib/mysql, whose filesystems space and
+	// inode metrics are collected. MySQLInstances are IDs of MySQL instances
+	// to discover the datadir, tmpdir, binary log and slow log paths from.
+	Filesystems    []string
+	MySQLInstances []uint
+}
+
+// A Process to collect per-process metrics for, like process/mysqld/rss.
+// The process is found by PidFile if set, else by Name which must match
+// its /proc/<pid>/comm (the first 15 characters of the command name).
+type Process struct {
+	Name    string // e.g. mysqld
+	PidFile string // e.g. /var/lib/mysql/db1.pid
+}
+
+// ValidateConfig returns an error if a Process has no Name or the same Name
+// as another Process, because Name is the metric prefix, e.g. process/mysqld/rss.
+func ValidateConfig(config *Config) error {
+	seen := make(map[string]bool)
+	for _, p := range config.Processes {
+		if p.Name == "" {
+			return errors.New("Process Name is empty")
+		}
+		if seen[p.Name] {
+			return errors.New("Duplicate Process Name: " + p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
 }
@@ -0,0 +1,209 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package system
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mysql"
+)
+
+// AddMySQL makes the monitor discover the datadir, tmpdir, binary log and
+// slow log directories of the MySQL instance and collect metrics for their
+// filesystems like the Config.Filesystems. It must be called before Start.
+func (m *Monitor) AddMySQL(conn mysql.Connector) {
+	m.mysql = append(m.mysql, conn)
+}
+
+// MySQLPaths returns the directories of the MySQL datadir, tmpdir, binary logs
+// and slow log. Relative log file paths are relative to the datadir. Paths for
+// variables that are not set, e.g. log_bin_basename if binary logging is off,
+// are not returned.
+func MySQLPaths(conn mysql.Connector) []string {
+	paths := []string{}
+	datadir := conn.GetGlobalVarString("datadir")
+	if datadir != "" {
+		paths = append(paths, datadir)
+	}
+	// tmpdir can be a list of paths, like PATH.
+	for _, dir := range strings.Split(conn.GetGlobalVarString("tmpdir"), ":") {
+		if dir != "" {
+			paths = append(paths, dir)
+		}
+	}
+	for _, varName := range []string{"log_bin_basename", "slow_query_log_file"} {
+		file := conn.GetGlobalVarString(varName)
+		if file == "" {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			if datadir == "" {
+				continue
+			}
+			file = filepath.Join(datadir, file)
+		}
+		paths = append(paths, filepath.Dir(file))
+	}
+	return paths
+}
+
+// MountPoint returns the mount point of the filesystem that path is on, given
+// the contents of /proc/mounts. path should be absolute and have no symlinks.
+func MountPoint(mounts []byte, path string) string {
+	/**
+	 * rootfs / rootfs rw 0 0
+	 * /dev/sda1 / ext4 rw,relatime,data=ordered 0 0
+	 * /dev/sdb1 /var/lib/mysql xfs rw,noatime,attr2,inode64,noquota 0 0
+	 *
+	 * Field 1 is the mount point. Spaces in it are escaped as \040. The
+	 * longest mount point that's a prefix of path wins, and later mounts
+	 * hide earlier ones on the same mount point.
+	 */
+	path = filepath.Clean(path)
+	mountPoint := "/"
+	lines := strings.Split(string(mounts), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 { // at least two fields expected
+			continue
+		}
+		mount := strings.Replace(fields[1], "\\040", " ", -1)
+		if mount != "/" && path != mount && !strings.HasPrefix(path, mount+"/") {
+			continue
+		}
+		if len(mount) >= len(mountPoint) {
+			mountPoint = mount
+		}
+	}
+	return mountPoint
+}
+
+// StatfsMetrics returns the space and inode metrics for the filesystem mounted
+// on mountPoint, e.g. fs/var/lib/mysql/bytes_free. The root filesystem is
+// fs/root. bytes_free is the space available to unprivileged users, like
+// mysqld, so it excludes reserved blocks and bytes_used + bytes_free can be
+// less than bytes_total.
+func StatfsMetrics(mountPoint string, st *syscall.Statfs_t) []mm.Metric {
+	name := "fs/" + strings.TrimPrefix(mountPoint, "/")
+	if mountPoint == "/" {
+		name = "fs/root"
+	}
+	bsize := uint64(st.Frsize)
+	if bsize == 0 {
+		bsize = uint64(st.Bsize)
+	}
+	metrics := []mm.Metric{
+		{Name: name + "/bytes_total", Type: "gauge", Number: float64(st.Blocks * bsize)},
+		{Name: name + "/bytes_used", Type: "gauge", Number: float64((st.Blocks - st.Bfree) * bsize)},
+		{Name: name + "/bytes_free", Type: "gauge", Number: float64(st.Bavail * bsize)},
+		{Name: name + "/inodes_total", Type: "gauge", Number: float64(st.Files)},
+		{Name: name + "/inodes_used", Type: "gauge", Number: float64(st.Files - st.Ffree)},
+		{Name: name + "/inodes_free", Type: "gauge", Number: float64(st.Ffree)},
+	}
+	return metrics
+}
+
+func (m *Monitor) Filesystems(paths []string, mounts []byte) ([]mm.Metric, error) {
+	m.logger.Debug("Filesystems:call")
+	defer m.logger.Debug("Filesystems:return")
+
+	m.status.Update(m.name, "Getting filesystem metrics")
+
+	// Report each filesystem once: the datadir and binary logs, for example,
+	// are usually on the same filesystem.
+	metrics := []mm.Metric{}
+	seen := make(map[string]bool)
+	var lastErr error
+	for _, path := range paths {
+		realPath, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		mountPoint := MountPoint(mounts, realPath)
+		if seen[mountPoint] {
+			continue
+		}
+		seen[mountPoint] = true
+		st := &syscall.Statfs_t{}
+		if err := syscall.Statfs(mountPoint, st); err != nil {
+			lastErr = fmt.Errorf("statfs %s: %s", mountPoint, err)
+			continue
+		}
+		metrics = append(metrics, StatfsMetrics(mountPoint, st)...)
+	}
+	return metrics, lastErr
+}
+
+func (m *Monitor) filesystemPaths() []string {
+	m.mysqlPathsMux.Lock()
+	defer m.mysqlPathsMux.Unlock()
+	paths := make([]string, 0, len(m.config.Filesystems)+len(m.mysqlPaths))
+	paths = append(paths, m.config.Filesystems...)
+	paths = append(paths, m.mysqlPaths...)
+	return paths
+}
+
+// @goroutine[2]
+func (m *Monitor) discoverMySQLPaths(stopChan chan bool) {
+	m.logger.Debug("discoverMySQLPaths:call")
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("MySQL path discovery crashed: ", err)
+		}
+		m.logger.Debug("discoverMySQLPaths:return")
+	}()
+
+	// Connecting can fail if MySQL isn't running yet, so keep trying. The
+	// connections back off, so this doesn't retry too often.
+	todo := m.mysql
+	for len(todo) > 0 {
+		retry := []mysql.Connector{}
+		for _, conn := range todo {
+			select {
+			case <-stopChan:
+				return
+			default:
+			}
+			if err := conn.Connect(1); err != nil {
+				m.logger.Warn("Cannot discover MySQL paths:", err)
+				retry = append(retry, conn)
+				continue
+			}
+			paths := MySQLPaths(conn)
+			conn.Close()
+			m.logger.Info("MySQL paths:", strings.Join(paths, ", "))
+			m.mysqlPathsMux.Lock()
+			m.mysqlPaths = append(m.mysqlPaths, paths...)
+			m.mysqlPathsMux.Unlock()
+		}
+		todo = retry
+		if len(todo) > 0 {
+			select {
+			case <-stopChan:
+				return
+			case <-time.After(1 * time.Second):
+			}
+		}
+	}
+}
@@ -21,10 +21,12 @@ import (
 	"fmt"
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/mm"
+	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -43,9 +45,15 @@ type Monitor struct {
 	// --
 	prevCPUval map[string][]float64 // [cpu0] => [user, nice, ...]
 	prevCPUsum map[string]float64   // [cpu0] => user + nice + ...
+	procErr    map[string]string    // [mysqld] => last error
+	fsErr      string               // last Filesystems error
 	sync       *pct.SyncChan
 	status     *pct.Status
 	running    bool
+	// --
+	mysql         []mysql.Connector // AddMySQL
+	mysqlPaths    []string          // discovered from mysql
+	mysqlPathsMux *sync.Mutex
 }
 
 func NewMonitor(name string, config *Config, logger *pct.Logger) *Monitor {
@@ -56,8 +64,13 @@ func NewMonitor(name string, config *Config, logger *pct.Logger) *Monitor {
 		// --
 		prevCPUval: make(map[string][]float64),
 		prevCPUsum: make(map[string]float64),
+		procErr:    make(map[string]string),
 		status:     pct.NewStatus([]string{name}),
 		sync:       pct.NewSyncChan(),
+		// --
+		mysql:         []mysql.Connector{},
+		mysqlPaths:    []string{},
+		mysqlPathsMux: &sync.Mutex{},
 	}
 	return m
 }
@@ -145,6 +158,12 @@ func (m *Monitor) run() {
 		m.logger.Debug("run:return")
 	}()
 
+	if len(m.mysql) > 0 {
+		stopDiscoverChan := make(chan bool)
+		defer close(stopDiscoverChan)
+		go m.discoverMySQLPaths(stopDiscoverChan)
+	}
+
 	var lastTs int64
 	for {
 		m.logger.Debug("run:idle")
@@ -208,6 +227,64 @@ func (m *Monitor) run() {
 				}
 			}
 
+			content, err = ioutil.ReadFile("/proc/net/dev")
+			if err == nil {
+				if metrics, err := m.ProcNetDev(content); err != nil {
+					m.logger.Warn("system:run:ProcNetDev:", err)
+				} else {
+					c.Metrics = append(c.Metrics, metrics...)
+				}
+			}
+
+			content, err = ioutil.ReadFile("/proc/net/snmp")
+			if err == nil {
+				if metrics, err := m.ProcNetSnmp(content); err != nil {
+					m.logger.Warn("system:run:ProcNetSnmp:", err)
+				} else {
+					c.Metrics = append(c.Metrics, metrics...)
+				}
+			}
+
+			content, err = ioutil.ReadFile("/proc/net/netstat")
+			if err == nil {
+				if metrics, err := m.ProcNetNetstat(content); err != nil {
+					m.logger.Warn("system:run:ProcNetNetstat:", err)
+				} else {
+					c.Metrics = append(c.Metrics, metrics...)
+				}
+			}
+
+			if paths := m.filesystemPaths(); len(paths) > 0 {
+				content, err = ioutil.ReadFile("/proc/mounts")
+				if err == nil {
+					metrics, err := m.Filesystems(paths, content)
+					if err != nil {
+						// Warn once, not every tick, while a path is missing.
+						if err.Error() != m.fsErr {
+							m.logger.Warn("system:run:Filesystems:", err)
+							m.fsErr = err.Error()
+						}
+					} else {
+						m.fsErr = ""
+					}
+					c.Metrics = append(c.Metrics, metrics...)
+				}
+			}
+
+			for _, p := range m.config.Processes {
+				metrics, err := m.ProcessMetrics(p)
+				if err != nil {
+					// Warn once, not every tick, while the process isn't running.
+					if err.Error() != m.procErr[p.Name] {
+						m.logger.Warn("system:run:ProcessMetrics:"+p.Name+":", err)
+						m.procErr[p.Name] = err.Error()
+					}
+					continue
+				}
+				delete(m.procErr, p.Name)
+				c.Metrics = append(c.Metrics, metrics...)
+			}
+
 			// Send the metrics to the aggregator.
 			if len(c.Metrics) > 0 {
 				select {
@@ -527,3 +604,136 @@ func (m *Monitor) ProcDiskstats(content []byte) ([]mm.Metric, error) {
 	}
 	return metrics, nil
 }
+
+func (m *Monitor) ProcNetDev(content []byte) ([]mm.Metric, error) {
+	m.logger.Debug("ProcNetDev:call")
+	defer m.logger.Debug("ProcNetDev:return")
+
+	m.status.Update(m.name, "Getting /proc/net/dev metrics")
+
+	/**
+	 * Inter-|   Receive                                                |  Transmit
+	 *  face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+	 *     lo: 2177406455 12097815    0    0    0     0          0         0 2177406455 12097815    0    0    0     0       0          0
+	 *   eth0:3839542183 41249856    0  257    0     0          0      1263 1624384542 27612090    2    0    0     0       0          0
+	 *
+	 * Older kernels don't put a space after the colon, so split on it first.
+	 * Fields 0-7 are receive stats, 8-15 are transmit stats.
+	 */
+	metrics := []mm.Metric{}
+	lines := strings.Split(string(content), "\n")
+	for _, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon < 0 { // header lines
+			continue
+		}
+
+		// Ignore loopback like ram and loop devices in diskstats.
+		iface := strings.TrimSpace(line[0:colon])
+		if iface == "lo" {
+			continue
+		}
+
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) < 12 { // at least 12 fields expected, through tx drop
+			continue
+		}
+
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/rx_bytes", Type: "counter", Number: StrToFloat(fields[0])})
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/rx_packets", Type: "counter", Number: StrToFloat(fields[1])})
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/rx_errors", Type: "counter", Number: StrToFloat(fields[2])})
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/rx_drops", Type: "counter", Number: StrToFloat(fields[3])})
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/tx_bytes", Type: "counter", Number: StrToFloat(fields[8])})
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/tx_packets", Type: "counter", Number: StrToFloat(fields[9])})
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/tx_errors", Type: "counter", Number: StrToFloat(fields[10])})
+		metrics = append(metrics, mm.Metric{Name: "net/" + iface + "/tx_drops", Type: "counter", Number: StrToFloat(fields[11])})
+	}
+	return metrics, nil
+}
+
+// NetSnmpStats are the /proc/net/snmp stats collected and their types.
+var NetSnmpStats = map[string]string{
+	"Tcp/ActiveOpens":  "counter",
+	"Tcp/PassiveOpens": "counter",
+	"Tcp/AttemptFails": "counter",
+	"Tcp/EstabResets":  "counter",
+	"Tcp/CurrEstab":    "gauge",
+	"Tcp/InSegs":       "counter",
+	"Tcp/OutSegs":      "counter",
+	"Tcp/RetransSegs":  "counter",
+	"Tcp/InErrs":       "counter",
+	"Tcp/OutRsts":      "counter",
+	"Udp/InDatagrams":  "counter",
+	"Udp/NoPorts":      "counter",
+	"Udp/InErrors":     "counter",
+	"Udp/OutDatagrams": "counter",
+	"Udp/RcvbufErrors": "counter",
+	"Udp/SndbufErrors": "counter",
+}
+
+// NetNetstatStats are the /proc/net/netstat stats collected and their types.
+var NetNetstatStats = map[string]string{
+	"TcpExt/ListenOverflows":     "counter",
+	"TcpExt/ListenDrops":         "counter",
+	"TcpExt/TCPLostRetransmit":   "counter",
+	"TcpExt/TCPFastRetrans":      "counter",
+	"TcpExt/TCPSlowStartRetrans": "counter",
+	"TcpExt/TCPTimeouts":         "counter",
+	"TcpExt/TCPAbortOnTimeout":   "counter",
+	"TcpExt/TCPBacklogDrop":      "counter",
+}
+
+func (m *Monitor) ProcNetSnmp(content []byte) ([]mm.Metric, error) {
+	m.logger.Debug("ProcNetSnmp:call")
+	defer m.logger.Debug("ProcNetSnmp:return")
+
+	m.status.Update(m.name, "Getting /proc/net/snmp metrics")
+
+	return procNetStats(content, NetSnmpStats)
+}
+
+func (m *Monitor) ProcNetNetstat(content []byte) ([]mm.Metric, error) {
+	m.logger.Debug("ProcNetNetstat:call")
+	defer m.logger.Debug("ProcNetNetstat:return")
+
+	m.status.Update(m.name, "Getting /proc/net/netstat metrics")
+
+	return procNetStats(content, NetNetstatStats)
+}
+
+// procNetStats parses /proc/net/snmp and /proc/net/netstat which have pairs
+// of lines, a header then values, for each protocol:
+//
+//	Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens ...
+//	Tcp: 1 200 120000 -1 1852130 6322817 ...
+//
+// Columns vary by kernel, so values are matched to the header. Metrics are
+// named like tcp/RetransSegs and returned in the order they appear.
+func procNetStats(content []byte, stats map[string]string) ([]mm.Metric, error) {
+	metrics := []mm.Metric{}
+	lines := strings.Split(string(content), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		header := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+		if len(header) < 2 { // at least proto and one column expected
+			continue
+		}
+		if len(values) != len(header) || values[0] != header[0] {
+			return nil, fmt.Errorf("%s values do not match header", header[0])
+		}
+		proto := strings.TrimRight(header[0], ":")
+		for j := 1; j < len(header); j++ {
+			metricType, ok := stats[proto+"/"+header[j]]
+			if !ok {
+				continue
+			}
+			m := mm.Metric{
+				Name:   strings.ToLower(proto) + "/" + header[j],
+				Type:   metricType,
+				Number: StrToFloat(values[j]),
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, nil
+}
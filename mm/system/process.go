@@ -0,0 +1,243 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/percona/percona-agent/mm"
+)
+
+// Linux reports process CPU times in clock ticks, USER_HZ, which is 100 on
+// all architectures we support (sysconf(_SC_CLK_TCK) requires cgo).
+const userHZ = 100
+
+// FindPid returns the pid of the process by its pid file, else by its name.
+// The pid from a pid file is returned only if that process exists. Finding
+// by name is an error if several processes have the name, e.g. two mysqld,
+// because their metrics would be mixed up; set PidFile for them.
+func FindPid(p Process) (int, error) {
+	if p.PidFile != "" {
+		content, err := ioutil.ReadFile(p.PidFile)
+		if err != nil {
+			return 0, err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			return 0, fmt.Errorf("Invalid pid in %s: %s", p.PidFile, err)
+		}
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err != nil {
+			return 0, fmt.Errorf("Process %d from %s is not running", pid, p.PidFile)
+		}
+		return pid, nil
+	}
+
+	// /proc/<pid>/comm is the command name truncated to 15 characters.
+	name := p.Name
+	if len(name) > 15 {
+		name = name[0:15]
+	}
+	files, err := filepath.Glob("/proc/[0-9]*/comm")
+	if err != nil {
+		return 0, err
+	}
+	pids := []string{}
+	for _, file := range files {
+		comm, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue // process exited
+		}
+		if strings.TrimSpace(string(comm)) != name {
+			continue
+		}
+		pids = append(pids, filepath.Base(filepath.Dir(file)))
+	}
+	switch len(pids) {
+	case 0:
+		return 0, errors.New("No process named " + name)
+	case 1:
+		return strconv.Atoi(pids[0])
+	default:
+		return 0, fmt.Errorf("%d processes named %s (pids %s), set PidFile to choose one", len(pids), name, strings.Join(pids, ", "))
+	}
+}
+
+// ProcessMetrics returns the /proc/<pid>/stat, status, io and fd metrics for
+// the process. io requires the agent to run as root or the process's user,
+// so it's skipped if it cannot be read.
+func (m *Monitor) ProcessMetrics(p Process) ([]mm.Metric, error) {
+	m.logger.Debug("ProcessMetrics:call:" + p.Name)
+	defer m.logger.Debug("ProcessMetrics:return:" + p.Name)
+
+	m.status.Update(m.name, "Getting "+p.Name+" process metrics")
+
+	pid, err := FindPid(p)
+	if err != nil {
+		return nil, err
+	}
+	dir := fmt.Sprintf("/proc/%d", pid)
+
+	content, err := ioutil.ReadFile(dir + "/stat")
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := m.ProcPidStat(p.Name, content)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = ioutil.ReadFile(dir + "/status")
+	if err != nil {
+		return nil, err
+	}
+	status, err := m.ProcPidStatus(p.Name, content)
+	if err != nil {
+		return nil, err
+	}
+	metrics = append(metrics, status...)
+
+	if content, err = ioutil.ReadFile(dir + "/io"); err == nil {
+		io, err := m.ProcPidIo(p.Name, content)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, io...)
+	}
+
+	if fds, err := ioutil.ReadDir(dir + "/fd"); err == nil {
+		metrics = append(metrics, mm.Metric{Name: "process/" + p.Name + "/open_fds", Type: "gauge", Number: float64(len(fds))})
+	}
+
+	return metrics, nil
+}
+
+func (m *Monitor) ProcPidStat(name string, content []byte) ([]mm.Metric, error) {
+	m.logger.Debug("ProcPidStat:call")
+	defer m.logger.Debug("ProcPidStat:return")
+
+	/**
+	 * One line:
+	 * 1234 (mysqld) S 1 1233 1233 0 -1 4202752 3523 0 21 0 96 52 0 0 20 0 22 0 ...
+	 *
+	 * Field 2, comm, is in parentheses and can contain spaces, so fields are
+	 * counted after the last ")". Fields (numbered from 1 like proc(5)):
+	 *   10: minflt   Minor faults
+	 *   12: majflt   Major faults
+	 *   14: utime    User mode time in clock ticks
+	 *   15: stime    Kernel mode time in clock ticks
+	 *   20: num_threads
+	 * http://man7.org/linux/man-pages/man5/proc.5.html
+	 */
+	s := string(content)
+	end := strings.LastIndex(s, ")")
+	if end < 0 {
+		return nil, errors.New("Invalid /proc/<pid>/stat: no comm")
+	}
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 18 { // fields 3 through 20
+		return nil, fmt.Errorf("Invalid /proc/<pid>/stat: expected at least 18 fields after comm, got %d", len(fields))
+	}
+	field := func(n int) float64 {
+		return StrToFloat(fields[n-3]) // fields[0] is field 3, state
+	}
+
+	prefix := "process/" + name + "/"
+	metrics := []mm.Metric{
+		{Name: prefix + "cpu_user", Type: "counter", Number: field(14) / userHZ},
+		{Name: prefix + "cpu_system", Type: "counter", Number: field(15) / userHZ},
+		{Name: prefix + "minor_faults", Type: "counter", Number: field(10)},
+		{Name: prefix + "major_faults", Type: "counter", Number: field(12)},
+		{Name: prefix + "threads", Type: "gauge", Number: field(20)},
+	}
+	return metrics, nil
+}
+
+func (m *Monitor) ProcPidStatus(name string, content []byte) ([]mm.Metric, error) {
+	m.logger.Debug("ProcPidStatus:call")
+	defer m.logger.Debug("ProcPidStatus:return")
+
+	/**
+	 * Name:	mysqld
+	 * ...
+	 * VmSize:	 1063544 kB
+	 * VmRSS:	  143488 kB
+	 * ...
+	 * voluntary_ctxt_switches:	1416
+	 * nonvoluntary_ctxt_switches:	28
+	 */
+	prefix := "process/" + name + "/"
+	metrics := []mm.Metric{}
+	lines := strings.Split(string(content), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 { // at least two fields expected
+			continue
+		}
+
+		switch s := strings.TrimRight(fields[0], ":"); s {
+		case "VmSize":
+			metrics = append(metrics, mm.Metric{Name: prefix + "vsize", Type: "gauge", Number: StrToFloat(fields[1])})
+		case "VmRSS":
+			metrics = append(metrics, mm.Metric{Name: prefix + "rss", Type: "gauge", Number: StrToFloat(fields[1])})
+		case "VmSwap":
+			metrics = append(metrics, mm.Metric{Name: prefix + "swap", Type: "gauge", Number: StrToFloat(fields[1])})
+		case "voluntary_ctxt_switches", "nonvoluntary_ctxt_switches":
+			metrics = append(metrics, mm.Metric{Name: prefix + s, Type: "counter", Number: StrToFloat(fields[1])})
+		}
+	}
+	return metrics, nil
+}
+
+func (m *Monitor) ProcPidIo(name string, content []byte) ([]mm.Metric, error) {
+	m.logger.Debug("ProcPidIo:call")
+	defer m.logger.Debug("ProcPidIo:return")
+
+	/**
+	 * rchar: 323934931
+	 * wchar: 323929600
+	 * syscr: 632687
+	 * syscw: 632675
+	 * read_bytes: 0
+	 * write_bytes: 323932160
+	 * cancelled_write_bytes: 0
+	 *
+	 * read_bytes and write_bytes are storage IO; rchar and wchar include
+	 * reads and writes satisfied by the page cache.
+	 */
+	prefix := "process/" + name + "/"
+	metrics := []mm.Metric{}
+	lines := strings.Split(string(content), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 { // at least two fields expected
+			continue
+		}
+
+		switch s := strings.TrimRight(fields[0], ":"); s {
+		case "rchar", "wchar", "syscr", "syscw", "read_bytes", "write_bytes", "cancelled_write_bytes":
+			metrics = append(metrics, mm.Metric{Name: prefix + s, Type: "counter", Number: StrToFloat(fields[1])})
+		}
+	}
+	return metrics, nil
+}
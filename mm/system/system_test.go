@@ -18,14 +18,20 @@
 package system_test
 
 import (
+	"fmt"
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/mm"
 	"github.com/percona/percona-agent/mm/system"
 	"github.com/percona/percona-agent/pct"
 	"github.com/percona/percona-agent/test"
+	"github.com/percona/percona-agent/test/mock"
 	. "gopkg.in/check.v1"
 	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -445,6 +451,431 @@ func (s *ProcDiskstatsTestSuite) TestProcDiskstats001(t *C) {
 	}
 }
 
+/////////////////////////////////////////////////////////////////////////////
+// ProcNet
+/////////////////////////////////////////////////////////////////////////////
+
+type ProcNetTestSuite struct {
+	logChan chan *proto.LogEntry
+	logger  *pct.Logger
+}
+
+var _ = Suite(&ProcNetTestSuite{})
+
+func (s *ProcNetTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 10)
+	s.logger = pct.NewLogger(s.logChan, "system-monitor-test")
+}
+
+// --------------------------------------------------------------------------
+
+func (s *ProcNetTestSuite) TestProcNetDev001(t *C) {
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+	content, err := ioutil.ReadFile(sample + "/proc/net-dev001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ProcNetDev(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// lo is ignored.  eth0 has no space after the colon.
+	expect := []mm.Metric{
+		{Name: "net/eth0/rx_bytes", Type: "counter", Number: 3839542183},
+		{Name: "net/eth0/rx_packets", Type: "counter", Number: 41249856},
+		{Name: "net/eth0/rx_errors", Type: "counter", Number: 0},
+		{Name: "net/eth0/rx_drops", Type: "counter", Number: 257},
+		{Name: "net/eth0/tx_bytes", Type: "counter", Number: 1624384542},
+		{Name: "net/eth0/tx_packets", Type: "counter", Number: 27612090},
+		{Name: "net/eth0/tx_errors", Type: "counter", Number: 2},
+		{Name: "net/eth0/tx_drops", Type: "counter", Number: 0},
+		{Name: "net/eth1/rx_bytes", Type: "counter", Number: 1044563},
+		{Name: "net/eth1/rx_packets", Type: "counter", Number: 12067},
+		{Name: "net/eth1/rx_errors", Type: "counter", Number: 5},
+		{Name: "net/eth1/rx_drops", Type: "counter", Number: 1},
+		{Name: "net/eth1/tx_bytes", Type: "counter", Number: 943821},
+		{Name: "net/eth1/tx_packets", Type: "counter", Number: 8761},
+		{Name: "net/eth1/tx_errors", Type: "counter", Number: 0},
+		{Name: "net/eth1/tx_drops", Type: "counter", Number: 3},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+}
+
+func (s *ProcNetTestSuite) TestProcNetSnmp001(t *C) {
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+	content, err := ioutil.ReadFile(sample + "/proc/net-snmp001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ProcNetSnmp(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Remember: the order of this array must match order in which each
+	// stat appears in the input file:
+	expect := []mm.Metric{
+		{Name: "tcp/ActiveOpens", Type: "counter", Number: 1852130},
+		{Name: "tcp/PassiveOpens", Type: "counter", Number: 6322817},
+		{Name: "tcp/AttemptFails", Type: "counter", Number: 10551},
+		{Name: "tcp/EstabResets", Type: "counter", Number: 79921},
+		{Name: "tcp/CurrEstab", Type: "gauge", Number: 47},
+		{Name: "tcp/InSegs", Type: "counter", Number: 1030744419},
+		{Name: "tcp/OutSegs", Type: "counter", Number: 1148315393},
+		{Name: "tcp/RetransSegs", Type: "counter", Number: 38211},
+		{Name: "tcp/InErrs", Type: "counter", Number: 12},
+		{Name: "tcp/OutRsts", Type: "counter", Number: 126563},
+		{Name: "udp/InDatagrams", Type: "counter", Number: 2216904},
+		{Name: "udp/NoPorts", Type: "counter", Number: 1097},
+		{Name: "udp/InErrors", Type: "counter", Number: 3},
+		{Name: "udp/OutDatagrams", Type: "counter", Number: 2219041},
+		{Name: "udp/RcvbufErrors", Type: "counter", Number: 2},
+		{Name: "udp/SndbufErrors", Type: "counter", Number: 0},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	// Values that don't match the header are an error, not bad metrics.
+	_, err = m.ProcNetSnmp([]byte("Tcp: RtoAlgorithm RtoMin\nTcp: 1\n"))
+	t.Check(err, NotNil)
+}
+
+func (s *ProcNetTestSuite) TestProcNetNetstat001(t *C) {
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+	content, err := ioutil.ReadFile(sample + "/proc/net-netstat001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ProcNetNetstat(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []mm.Metric{
+		{Name: "tcpext/ListenOverflows", Type: "counter", Number: 1521},
+		{Name: "tcpext/ListenDrops", Type: "counter", Number: 1530},
+		{Name: "tcpext/TCPLostRetransmit", Type: "counter", Number: 94},
+		{Name: "tcpext/TCPFastRetrans", Type: "counter", Number: 15020},
+		{Name: "tcpext/TCPSlowStartRetrans", Type: "counter", Number: 118},
+		{Name: "tcpext/TCPTimeouts", Type: "counter", Number: 3120},
+		{Name: "tcpext/TCPAbortOnTimeout", Type: "counter", Number: 31},
+		{Name: "tcpext/TCPBacklogDrop", Type: "counter", Number: 7},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Filesystem
+/////////////////////////////////////////////////////////////////////////////
+
+type FilesystemTestSuite struct {
+	logChan chan *proto.LogEntry
+	logger  *pct.Logger
+}
+
+var _ = Suite(&FilesystemTestSuite{})
+
+func (s *FilesystemTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 10)
+	s.logger = pct.NewLogger(s.logChan, "system-monitor-test")
+}
+
+// --------------------------------------------------------------------------
+
+func (s *FilesystemTestSuite) TestMountPoint001(t *C) {
+	mounts, err := ioutil.ReadFile(sample + "/proc/mounts001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]string{
+		"/":                                "/",
+		"/var/lib/mysql":                   "/var/lib/mysql",
+		"/var/lib/mysql/":                  "/var/lib/mysql",
+		"/var/lib/mysql/db1":               "/var/lib/mysql",
+		"/var/lib/mysql/binlogs":           "/var/lib/mysql/binlogs",
+		"/var/lib/mysql-files":             "/", // not /var/lib/mysql
+		"/tmp":                             "/tmp",
+		"/usr/local/mysql":                 "/",
+		"/mnt/slow logs/slow.log":          "/mnt/slow logs",
+		"/var/lib/mysql/binlogs/../tmpdir": "/var/lib/mysql",
+	}
+	for path, mount := range paths {
+		t.Check(system.MountPoint(mounts, path), Equals, mount, Commentf("%s", path))
+	}
+}
+
+func (s *FilesystemTestSuite) TestStatfsMetrics(t *C) {
+	st := &syscall.Statfs_t{
+		Bsize:  4096,
+		Frsize: 4096,
+		Blocks: 1000,
+		Bfree:  300,
+		Bavail: 250, // 50 blocks reserved for root
+		Files:  640,
+		Ffree:  600,
+	}
+	got := system.StatfsMetrics("/var/lib/mysql", st)
+	expect := []mm.Metric{
+		{Name: "fs/var/lib/mysql/bytes_total", Type: "gauge", Number: 1000 * 4096},
+		{Name: "fs/var/lib/mysql/bytes_used", Type: "gauge", Number: 700 * 4096},
+		{Name: "fs/var/lib/mysql/bytes_free", Type: "gauge", Number: 250 * 4096},
+		{Name: "fs/var/lib/mysql/inodes_total", Type: "gauge", Number: 640},
+		{Name: "fs/var/lib/mysql/inodes_used", Type: "gauge", Number: 40},
+		{Name: "fs/var/lib/mysql/inodes_free", Type: "gauge", Number: 600},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	got = system.StatfsMetrics("/", st)
+	t.Check(got[0].Name, Equals, "fs/root/bytes_total")
+}
+
+func (s *FilesystemTestSuite) TestMySQLPaths(t *C) {
+	conn := mock.NewNullMySQL()
+	conn.SetGlobalVarString("datadir", "/var/lib/mysql/")
+	conn.SetGlobalVarString("tmpdir", "/tmp:/var/tmp")
+	conn.SetGlobalVarString("log_bin_basename", "/var/lib/mysql/binlogs/mysql-bin")
+	conn.SetGlobalVarString("slow_query_log_file", "slow.log") // relative to datadir
+	got := system.MySQLPaths(conn)
+	t.Check(got, DeepEquals, []string{"/var/lib/mysql/", "/tmp", "/var/tmp", "/var/lib/mysql/binlogs", "/var/lib/mysql"})
+
+	// Binary logging is off.
+	conn = mock.NewNullMySQL()
+	conn.SetGlobalVarString("datadir", "/var/lib/mysql/")
+	got = system.MySQLPaths(conn)
+	t.Check(got, DeepEquals, []string{"/var/lib/mysql/"})
+}
+
+func (s *FilesystemTestSuite) TestFilesystems(t *C) {
+	mounts, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+
+	// / twice is reported once.
+	got, err := m.Filesystems([]string{"/", "/"}, mounts)
+	t.Assert(err, IsNil)
+	t.Assert(got, HasLen, 6)
+	t.Check(got[0].Name, Equals, "fs/root/bytes_total")
+	t.Check(got[0].Number > 0, Equals, true)
+
+	// Metrics for paths that exist are returned with an error for those that don't.
+	got, err = m.Filesystems([]string{"/does/not/exist", "/"}, mounts)
+	t.Check(err, NotNil)
+	t.Check(got, HasLen, 6)
+}
+
+func (s *FilesystemTestSuite) TestDiscoverMySQLPaths(t *C) {
+	conn := mock.NewNullMySQL()
+	conn.SetGlobalVarString("datadir", "/")
+
+	tickChan := make(chan time.Time)
+	collectionChan := make(chan *mm.Collection, 1)
+	m := system.NewMonitor("system", &system.Config{}, s.logger)
+	m.AddMySQL(conn)
+	err := m.Start(tickChan, collectionChan)
+	t.Assert(err, IsNil)
+	defer m.Stop()
+
+	// Discovery is async, so tick until the datadir filesystem is reported.
+	found := false
+	for i := 0; i < 10 && !found; i++ {
+		tickChan <- time.Now()
+		got := test.WaitCollection(collectionChan, 1)
+		t.Assert(got, HasLen, 1)
+		found, _ = haveMetric("fs/root/bytes_free", got[0].Metrics)
+	}
+	t.Check(found, Equals, true)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Process
+/////////////////////////////////////////////////////////////////////////////
+
+type ProcessTestSuite struct {
+	logChan chan *proto.LogEntry
+	logger  *pct.Logger
+	tmpDir  string
+}
+
+var _ = Suite(&ProcessTestSuite{})
+
+func (s *ProcessTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 10)
+	s.logger = pct.NewLogger(s.logChan, "system-monitor-test")
+
+	var err error
+	s.tmpDir, err = ioutil.TempDir("/tmp", "agent-test")
+	t.Assert(err, IsNil)
+}
+
+func (s *ProcessTestSuite) TearDownSuite(t *C) {
+	if err := os.RemoveAll(s.tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
+// --------------------------------------------------------------------------
+
+func (s *ProcessTestSuite) TestProcPidStat001(t *C) {
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+	content, err := ioutil.ReadFile(sample + "/proc/pid-stat001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ProcPidStat("mysqld", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []mm.Metric{
+		{Name: "process/mysqld/cpu_user", Type: "counter", Number: 90.87},
+		{Name: "process/mysqld/cpu_system", Type: "counter", Number: 42.15},
+		{Name: "process/mysqld/minor_faults", Type: "counter", Number: 62113},
+		{Name: "process/mysqld/major_faults", Type: "counter", Number: 112},
+		{Name: "process/mysqld/threads", Type: "gauge", Number: 27},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	// comm can have spaces and parentheses.
+	got, err = m.ProcPidStat("foo", []byte("42 (a (b) c) S 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18"))
+	t.Assert(err, IsNil)
+	t.Check(got[0].Number, Equals, 0.11) // utime 11
+	t.Check(got[4].Number, Equals, float64(17))
+
+	_, err = m.ProcPidStat("foo", []byte("42 (foo) S 1 2 3"))
+	t.Check(err, NotNil)
+}
+
+func (s *ProcessTestSuite) TestProcPidStatus001(t *C) {
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+	content, err := ioutil.ReadFile(sample + "/proc/pid-status001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ProcPidStatus("mysqld", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []mm.Metric{
+		{Name: "process/mysqld/vsize", Type: "gauge", Number: 1063624},
+		{Name: "process/mysqld/rss", Type: "gauge", Number: 147488},
+		{Name: "process/mysqld/swap", Type: "gauge", Number: 12},
+		{Name: "process/mysqld/voluntary_ctxt_switches", Type: "counter", Number: 15934},
+		{Name: "process/mysqld/nonvoluntary_ctxt_switches", Type: "counter", Number: 287},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+}
+
+func (s *ProcessTestSuite) TestProcPidIo001(t *C) {
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+	content, err := ioutil.ReadFile(sample + "/proc/pid-io001.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ProcPidIo("mysqld", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []mm.Metric{
+		{Name: "process/mysqld/rchar", Type: "counter", Number: 323934931},
+		{Name: "process/mysqld/wchar", Type: "counter", Number: 323929600},
+		{Name: "process/mysqld/syscr", Type: "counter", Number: 632687},
+		{Name: "process/mysqld/syscw", Type: "counter", Number: 632675},
+		{Name: "process/mysqld/read_bytes", Type: "counter", Number: 29741056},
+		{Name: "process/mysqld/write_bytes", Type: "counter", Number: 323932160},
+		{Name: "process/mysqld/cancelled_write_bytes", Type: "counter", Number: 4096},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+}
+
+func (s *ProcessTestSuite) TestFindPid(t *C) {
+	// By pid file.
+	pidFile := filepath.Join(s.tmpDir, "test.pid")
+	err := ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+	t.Assert(err, IsNil)
+	pid, err := system.FindPid(system.Process{Name: "test", PidFile: pidFile})
+	t.Check(err, IsNil)
+	t.Check(pid, Equals, os.Getpid())
+
+	_, err = system.FindPid(system.Process{Name: "test", PidFile: filepath.Join(s.tmpDir, "nonexistent.pid")})
+	t.Check(err, NotNil)
+
+	// By name, which is this test binary.
+	comm, err := ioutil.ReadFile("/proc/self/comm")
+	t.Assert(err, IsNil)
+	pid, err = system.FindPid(system.Process{Name: strings.TrimSpace(string(comm))})
+	t.Check(err, IsNil)
+	t.Check(pid, Equals, os.Getpid())
+
+	_, err = system.FindPid(system.Process{Name: "no-such-process"})
+	t.Check(err, NotNil)
+
+	// Several processes with the name is an error without a pid file.
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command("sleep", "60")
+		t.Assert(cmd.Start(), IsNil)
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+	}
+	_, err = system.FindPid(system.Process{Name: "sleep"})
+	t.Check(err, ErrorMatches, `\d+ processes named sleep .*`)
+}
+
+func (s *ProcessTestSuite) TestValidateConfig(t *C) {
+	config := &system.Config{
+		Processes: []system.Process{{Name: "mysqld"}, {Name: "mysqld2", PidFile: "/var/lib/mysql2/db2.pid"}},
+	}
+	t.Check(system.ValidateConfig(config), IsNil)
+
+	config.Processes = append(config.Processes, system.Process{PidFile: "/var/lib/mysql3/db3.pid"})
+	t.Check(system.ValidateConfig(config), ErrorMatches, "Process Name is empty")
+
+	config.Processes[2].Name = "mysqld"
+	t.Check(system.ValidateConfig(config), ErrorMatches, "Duplicate Process Name: mysqld")
+}
+
+func (s *ProcessTestSuite) TestProcessMetrics(t *C) {
+	pidFile := filepath.Join(s.tmpDir, "self.pid")
+	err := ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+	t.Assert(err, IsNil)
+
+	m := system.NewMonitor("", &system.Config{}, s.logger)
+	got, err := m.ProcessMetrics(system.Process{Name: "self", PidFile: pidFile})
+	t.Assert(err, IsNil)
+
+	ok, val := haveMetric("process/self/rss", got)
+	t.Check(ok, Equals, true)
+	t.Check(val > 0, Equals, true)
+	ok, val = haveMetric("process/self/threads", got)
+	t.Check(ok, Equals, true)
+	t.Check(val > 0, Equals, true)
+	ok, val = haveMetric("process/self/open_fds", got)
+	t.Check(ok, Equals, true)
+	t.Check(val > 0, Equals, true)
+	ok, _ = haveMetric("process/self/read_bytes", got)
+	t.Check(ok, Equals, true) // we can read our own io
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Manager
 /////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,147 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/percona/percona-agent/pct"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const HiddenPassword = "<password-hidden>"
+
+type Connector interface {
+	DSN() string
+	Connect(tries uint) error
+	Close()
+	ServerStatus() (map[string]interface{}, error)
+}
+
+// A Connection is a direct connection to a single mongod or mongos, even if
+// it's a replica set member, so metrics are for that server only.
+type Connection struct {
+	dsn             string
+	session         *mgo.Session
+	backoff         *pct.Backoff
+	connectedAmount uint
+	connectionMux   *sync.Mutex
+}
+
+func NewConnection(dsn string) *Connection {
+	c := &Connection{
+		dsn:           dsn,
+		backoff:       pct.NewBackoff(20 * time.Second),
+		connectionMux: &sync.Mutex{},
+	}
+	return c
+}
+
+func (c *Connection) DSN() string {
+	return c.dsn
+}
+
+func (c *Connection) Connect(tries uint) error {
+	if tries == 0 {
+		return nil
+	}
+	c.connectionMux.Lock()
+	defer c.connectionMux.Unlock()
+	if c.connectedAmount > 0 {
+		// already have opened connection
+		c.connectedAmount++
+		return nil
+	}
+	info, err := mgo.ParseURL(c.dsn)
+	if err != nil {
+		return fmt.Errorf("Invalid MongoDB DSN %s: %s", HideDSNPassword(c.dsn), err)
+	}
+	info.Direct = true
+	info.Timeout = 5 * time.Second
+	var session *mgo.Session
+	for i := tries; i > 0; i-- {
+		// Wait before attempt.
+		time.Sleep(c.backoff.Wait())
+
+		session, err = mgo.DialWithInfo(info)
+		if err != nil {
+			continue
+		}
+
+		// Direct connections to secondaries require a non-strong mode.
+		session.SetMode(mgo.Monotonic, true)
+
+		c.session = session
+		c.backoff.Success()
+		c.connectedAmount++
+		return nil
+	}
+
+	return fmt.Errorf("Cannot connect to MongoDB %s: %s", HideDSNPassword(c.dsn), err)
+}
+
+func (c *Connection) Close() {
+	c.connectionMux.Lock()
+	defer c.connectionMux.Unlock()
+	if c.connectedAmount == 0 {
+		// connection closed already
+		return
+	}
+	c.connectedAmount--
+	if c.connectedAmount == 0 && c.session != nil {
+		c.session.Close()
+		c.session = nil
+	}
+}
+
+// ServerStatus returns the output of the serverStatus command. Embedded
+// documents are bson.M, which is a map[string]interface{}.
+func (c *Connection) ServerStatus() (map[string]interface{}, error) {
+	if c.session == nil {
+		return nil, errors.New("Not connected")
+	}
+	status := bson.M{}
+	if err := c.session.DB("admin").Run(bson.D{{"serverStatus", 1}}, &status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// HideDSNPassword replaces the password in a mongodb:// DSN with
+// HiddenPassword so the DSN can be logged.
+func HideDSNPassword(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return dsn
+	}
+	if _, ok := u.User.Password(); !ok {
+		return dsn
+	}
+	u.User = url.UserPassword(u.User.Username(), HiddenPassword)
+	s := u.String()
+	// url escapes the < and > of HiddenPassword.
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		s = unescaped
+	}
+	return s
+}
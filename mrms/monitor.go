@@ -18,15 +18,100 @@
 package mrms
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
+// A Monitor checks MySQL instances for changes and sends an Event to the
+// channels subscribed to an instance when something changes. Subscribers
+// make the channel, so one channel can be subscribed to several instances.
+// Sending to a channel waits at most 1s, so make it buffered.
 type Monitor interface {
 	Start(interval time.Duration) error
 	Stop() error
 	Status() map[string]string
-	Add(dsn string) (c <-chan bool, err error)
-	Remove(dsn string, c <-chan bool)
+	Subscribe(dsn string, c chan *Event) error
+	Unsubscribe(dsn string, c chan *Event)
 	Check()
-	GlobalSubscribe() (chan string, error)
+}
+
+// Types of changes, i.e. reasons for an event, in order of importance.
+const (
+	CHANGE_RESTART   = "restart"   // Uptime decreased or version changed
+	CHANGE_SERVER    = "server"    // server_uuid or hostname changed, e.g. failover behind a VIP
+	CHANGE_RECONNECT = "reconnect" // MySQL was unreachable, but it wasn't restarted
+	CHANGE_READ_ONLY = "read_only" // read_only changed, e.g. master demoted
+	CHANGE_SLOW_LOG  = "slow_log"  // slow_query_log or slow_query_log_file changed
+)
+
+var changeOrder = []string{CHANGE_RESTART, CHANGE_SERVER, CHANGE_RECONNECT, CHANGE_READ_ONLY, CHANGE_SLOW_LOG}
+
+// A Change is one thing that changed. Var is the global variable that changed,
+// if any, with its Old and New values.
+type Change struct {
+	Type string
+	Var  string `json:",omitempty"`
+	Old  string
+	New  string
+}
+
+// An Event is all the changes found by one check of a MySQL instance.
+type Event struct {
+	DSN       string
+	Ts        time.Time // UTC
+	Reason    string    // most important change type, e.g. restart
+	OldUptime int64     // seconds, at last check
+	NewUptime int64     // seconds, at this check
+	Version   string    // @@version
+	Changes   []Change
+}
+
+// NewEvent returns an event for the changes, setting Reason.
+func NewEvent(dsn string, ts time.Time, changes []Change) *Event {
+	e := &Event{
+		DSN:     dsn,
+		Ts:      ts,
+		Changes: changes,
+	}
+	for _, changeType := range changeOrder {
+		if e.Has(changeType) {
+			e.Reason = changeType
+			break
+		}
+	}
+	return e
+}
+
+// Has returns true if the event has a change of the given type.
+func (e *Event) Has(changeType string) bool {
+	for _, c := range e.Changes {
+		if c.Type == changeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Restarted returns true if MySQL was restarted or it's a different server.
+// Either way, it's a new MySQL, so global settings like SET GLOBAL
+// long_query_time need to be set again.
+func (e *Event) Restarted() bool {
+	return e.Has(CHANGE_RESTART) || e.Has(CHANGE_SERVER)
+}
+
+// String returns the changes like "restart (uptime 3600 -> 5), read_only '0' -> '1'".
+func (e *Event) String() string {
+	s := make([]string, len(e.Changes))
+	for i, c := range e.Changes {
+		switch {
+		case c.Type == CHANGE_RESTART && c.Var == "":
+			s[i] = fmt.Sprintf("restart (uptime %d -> %d)", e.OldUptime, e.NewUptime)
+		case c.Type == CHANGE_RECONNECT:
+			s[i] = "reconnected"
+		default:
+			s[i] = fmt.Sprintf("%s '%s' -> '%s'", c.Var, c.Old, c.New)
+		}
+	}
+	return strings.Join(s, ", ")
 }
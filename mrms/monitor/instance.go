@@ -19,12 +19,27 @@ package monitor
 
 import (
 	"fmt"
+	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// Global variables checked for changes, and the type of change if one does.
+var checkVars = []struct {
+	name       string
+	changeType string
+}{
+	{"version", mrms.CHANGE_RESTART},
+	{"server_uuid", mrms.CHANGE_SERVER}, // MySQL 5.6+, else it's always ""
+	{"hostname", mrms.CHANGE_SERVER},
+	{"read_only", mrms.CHANGE_READ_ONLY},
+	{"slow_query_log", mrms.CHANGE_SLOW_LOG},
+	{"slow_query_log_file", mrms.CHANGE_SLOW_LOG},
+}
+
 type MysqlInstance struct {
 	logger      *pct.Logger
 	mysqlConn   mysql.Connector
@@ -32,6 +47,8 @@ type MysqlInstance struct {
 	// --
 	lastUptime      int64
 	lastUptimeCheck time.Time
+	lastVars        map[string]string
+	disconnected    bool // Connect failed at last check
 	sync.Mutex
 }
 
@@ -59,17 +76,21 @@ func NewMysqlInstance(logger *pct.Logger, mysqlConn mysql.Connector, subscribers
 		Subscribers:     subscribers,
 		lastUptime:      lastUptime,
 		lastUptimeCheck: lastUptimeCheck,
+		lastVars:        getVars(mysqlConn),
 	}
 
 	return mi, nil
 }
 
-func (m *MysqlInstance) CheckIfMysqlRestarted() (bool, error) {
+// Check returns an event with everything that changed since the last check,
+// or nil if nothing changed.
+func (m *MysqlInstance) Check() (*mrms.Event, error) {
 	m.Lock()
 	defer m.Unlock()
 
 	if err := m.mysqlConn.Connect(1); err != nil {
-		return false, err
+		m.disconnected = true
+		return nil, err
 	}
 	defer m.mysqlConn.Close()
 
@@ -77,8 +98,9 @@ func (m *MysqlInstance) CheckIfMysqlRestarted() (bool, error) {
 	lastUptimeCheck := m.lastUptimeCheck
 	currentUptime, err := m.mysqlConn.Uptime()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	currentVars := getVars(m.mysqlConn)
 
 	m.logger.Debug(fmt.Sprintf("lastUptime=%d lastUptimeCheck=%s currentUptime=%d",
 		lastUptime, lastUptimeCheck.UTC(), currentUptime))
@@ -99,19 +121,70 @@ func (m *MysqlInstance) CheckIfMysqlRestarted() (bool, error) {
 	expectedUptime := lastUptime + elapsedTime
 	m.logger.Debug(fmt.Sprintf("elapsedTime=%d expectedUptime=%d", elapsedTime, expectedUptime))
 
-	// Save uptime from last check
-	m.lastUptime = currentUptime
-	m.lastUptimeCheck = time.Now()
+	changes := []mrms.Change{}
 
 	// If current server uptime is lower than last registered uptime
 	// then we can assume that server was restarted
-	if currentUptime < expectedUptime {
-		return true, nil
+	restarted := currentUptime < expectedUptime
+	if restarted {
+		changes = append(changes, mrms.Change{
+			Type: mrms.CHANGE_RESTART,
+			Old:  strconv.FormatInt(lastUptime, 10),
+			New:  strconv.FormatInt(currentUptime, 10),
+		})
+	}
+
+	// A server with a higher uptime isn't a restart, but if it has a different
+	// server_uuid or hostname, then it's a different server, e.g. a failover.
+	for _, v := range checkVars {
+		if currentVars[v.name] == "" && m.lastVars[v.name] != "" {
+			// GetGlobalVarString returns "" on error, so the value is
+			// unknown, not changed. Keep the last value.
+			currentVars[v.name] = m.lastVars[v.name]
+			continue
+		}
+		if currentVars[v.name] == m.lastVars[v.name] {
+			continue
+		}
+		m.logger.Debug(fmt.Sprintf("%s: '%s' -> '%s'", v.name, m.lastVars[v.name], currentVars[v.name]))
+		changes = append(changes, mrms.Change{
+			Type: v.changeType,
+			Var:  v.name,
+			Old:  m.lastVars[v.name],
+			New:  currentVars[v.name],
+		})
 	}
 
-	return false, nil
+	// If MySQL was unreachable but not restarted, subscribers might have
+	// lost their connections, so tell them.
+	if m.disconnected && !restarted {
+		changes = append(changes, mrms.Change{Type: mrms.CHANGE_RECONNECT})
+	}
+
+	// Save uptime and vars from last check
+	m.lastUptime = currentUptime
+	m.lastUptimeCheck = time.Now()
+	m.lastVars = currentVars
+	m.disconnected = false
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	event := mrms.NewEvent(m.mysqlConn.DSN(), time.Now().UTC(), changes)
+	event.OldUptime = lastUptime
+	event.NewUptime = currentUptime
+	event.Version = currentVars["version"]
+	return event, nil
 }
 
 func (m *MysqlInstance) DSN() string {
 	return m.mysqlConn.DSN()
 }
+
+func getVars(mysqlConn mysql.Connector) map[string]string {
+	vars := make(map[string]string, len(checkVars))
+	for _, v := range checkVars {
+		vars[v.name] = mysqlConn.GetGlobalVarString(v.name)
+	}
+	return vars
+}
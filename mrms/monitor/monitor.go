@@ -18,6 +18,7 @@
 package monitor
 
 import (
+	"fmt"
 	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
@@ -36,9 +37,8 @@ type Monitor struct {
 	mysqlInstances map[string]*MysqlInstance
 	sync.RWMutex
 	// --
-	status     *pct.Status
-	sync       *pct.SyncChan
-	globalChan chan string
+	status *pct.Status
+	sync   *pct.SyncChan
 }
 
 func NewMonitor(logger *pct.Logger, mysqlConnFactory mysql.ConnectionFactory) mrms.Monitor {
@@ -48,9 +48,8 @@ func NewMonitor(logger *pct.Logger, mysqlConnFactory mysql.ConnectionFactory) mr
 		// --
 		mysqlInstances: make(map[string]*MysqlInstance),
 		// --
-		status:     pct.NewStatus([]string{MONITOR_NAME}),
-		sync:       pct.NewSyncChan(),
-		globalChan: make(chan string, 100),
+		status: pct.NewStatus([]string{MONITOR_NAME}),
+		sync:   pct.NewSyncChan(),
 	}
 	return m
 }
@@ -83,46 +82,33 @@ func (m *Monitor) Status() map[string]string {
 	return m.status.All()
 }
 
-func (m *Monitor) Add(dsn string) (c <-chan bool, err error) {
-	m.logger.Debug("Add:call:" + mysql.HideDSNPassword(dsn))
-	defer m.logger.Debug("Add:return:" + mysql.HideDSNPassword(dsn))
+// Subscribe starts monitoring the MySQL instance, if not already monitored,
+// and sends its events to c.
+func (m *Monitor) Subscribe(dsn string, c chan *mrms.Event) error {
+	m.logger.Debug("Subscribe:call:" + mysql.HideDSNPassword(dsn))
+	defer m.logger.Debug("Subscribe:return:" + mysql.HideDSNPassword(dsn))
 
 	m.Lock()
 	defer m.Unlock()
 
 	mysqlInstance, ok := m.mysqlInstances[dsn]
 	if !ok {
+		var err error
 		mysqlInstance, err = m.createMysqlInstance(dsn)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		m.mysqlInstances[dsn] = mysqlInstance
 	}
 
-	c = mysqlInstance.Subscribers.Add()
-	return c, nil
+	return mysqlInstance.Subscribers.Add(c)
 }
 
-func (m *Monitor) GlobalSubscribe() (chan string, error) {
-	m.logger.Debug("GlobalSusbcribe:call")
-	defer m.logger.Debug("GlobalSubscribe:return")
-
-	m.Lock()
-	defer m.Unlock()
-	var err error
-
-	for _, instance := range m.mysqlInstances {
-		err = instance.Subscribers.GlobalAdd(m.globalChan, instance.mysqlConn.DSN())
-		if err != nil {
-			return nil, err
-		}
-	}
-	return m.globalChan, nil
-}
-
-func (m *Monitor) Remove(dsn string, c <-chan bool) {
-	m.logger.Debug("Remove:call:" + mysql.HideDSNPassword(dsn))
-	defer m.logger.Debug("Remove:return:" + mysql.HideDSNPassword(dsn))
+// Unsubscribe stops sending events for the MySQL instance to c, and stops
+// monitoring the instance if it has no more subscribers.
+func (m *Monitor) Unsubscribe(dsn string, c chan *mrms.Event) {
+	m.logger.Debug("Unsubscribe:call:" + mysql.HideDSNPassword(dsn))
+	defer m.logger.Debug("Unsubscribe:return:" + mysql.HideDSNPassword(dsn))
 
 	m.Lock()
 	defer m.Unlock()
@@ -132,7 +118,6 @@ func (m *Monitor) Remove(dsn string, c <-chan bool) {
 		if mysqlInstance.Subscribers.Empty() {
 			delete(m.mysqlInstances, dsn)
 		}
-		mysqlInstance.Subscribers.GlobalRemove(dsn)
 	}
 }
 
@@ -144,14 +129,14 @@ func (m *Monitor) Check() {
 	defer m.RUnlock()
 
 	for _, mysqlInstance := range m.mysqlInstances {
-		wasRestarted, err := mysqlInstance.CheckIfMysqlRestarted()
+		event, err := mysqlInstance.Check()
 		if err != nil {
 			m.logger.Error(err)
 			continue
 		}
-		if wasRestarted {
-			m.logger.Debug("Check:restarted:" + mysql.HideDSNPassword(mysqlInstance.DSN()))
-			mysqlInstance.Subscribers.Notify()
+		if event != nil {
+			m.logger.Info(fmt.Sprintf("%s: %s", mysql.HideDSNPassword(mysqlInstance.DSN()), event))
+			mysqlInstance.Subscribers.Notify(event)
 		}
 	}
 }
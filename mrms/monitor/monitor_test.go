@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mrms/monitor"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
@@ -34,6 +35,16 @@ func Test(t *testing.T) { TestingT(t) }
 
 var dsn = os.Getenv("PCT_TEST_MYSQL_DSN")
 
+// recv returns the next event on c, or nil if there isn't one.
+func recv(c chan *mrms.Event) *mrms.Event {
+	select {
+	case e := <-c:
+		return e
+	default:
+		return nil
+	}
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Test Suite
 /////////////////////////////////////////////////////////////////////////////
@@ -66,7 +77,8 @@ func (s *TestSuite) TestStartStop(t *C) {
 	// Set initial uptime
 	mockConn.SetUptime(10)
 	t.Assert(mockConn.GetUptimeCount(), Equals, uint(0))
-	subChan, err := m.Add(dsn)
+	subChan := make(chan *mrms.Event, 1)
+	err := m.Subscribe(dsn, subChan)
 	t.Assert(err, IsNil)
 	t.Assert(mockConn.GetUptimeCount(), Equals, uint(1), Commentf("MRMS didn't checked uptime after adding first subscriber"))
 
@@ -81,12 +93,15 @@ func (s *TestSuite) TestStartStop(t *C) {
 	mockConn.SetUptime(5)
 
 	// After max 1 second it should notify subscriber about MySQL restart
-	var notified bool
+	var e *mrms.Event
 	select {
-	case notified = <-subChan:
+	case e = <-subChan:
 	case <-time.After(1 * time.Second):
 	}
-	t.Assert(notified, Equals, true, Commentf("MySQL was restarted but MRMS didn't notify subscribers"))
+	t.Assert(e, NotNil, Commentf("MySQL was restarted but MRMS didn't notify subscribers"))
+	t.Check(e.Reason, Equals, mrms.CHANGE_RESTART)
+	t.Check(e.OldUptime, Equals, int64(10))
+	t.Check(e.NewUptime, Equals, int64(5))
 
 	/**
 	 * Stop MRMS
@@ -105,28 +120,39 @@ func (s *TestSuite) TestStartStop(t *C) {
 
 	// After stopping service it should not notify subscribers anymore
 	time.Sleep(2 * time.Second)
-	select {
-	case notified = <-subChan:
-	default:
-	}
-	t.Assert(notified, Equals, true, Commentf("MRMS notified subscribers after being stopped"))
+	t.Assert(recv(subChan), IsNil, Commentf("MRMS notified subscribers after being stopped"))
 }
 
-func (s *TestSuite) TestGlobalSubscribe(t *C) {
+func (s *TestSuite) TestSubscribeChannel(t *C) {
 	mockConn := mock.NewNullMySQL()
 	mockConnFactory := &mock.ConnectionFactory{
 		Conn: mockConn,
 	}
 	m := monitor.NewMonitor(s.logger, mockConnFactory)
 	dsn := "fake:dsn@tcp(127.0.0.1:3306)/?parseTime=true"
-	subChan, err := m.Add(dsn)
-	t.Assert(err, IsNil)
-	t.Assert(subChan, NotNil)
 
-	gc, err := m.GlobalSubscribe()
+	// Subscribers make the channel.
+	err := m.Subscribe(dsn, nil)
+	t.Assert(err, NotNil)
+
+	// Like the instance manager, one channel can be subscribed to several
+	// instances, and subscribing it twice doesn't send events twice.
+	c := make(chan *mrms.Event, 10)
+	err = m.Subscribe(dsn, c)
+	t.Assert(err, IsNil)
+	err = m.Subscribe(dsn, c)
 	t.Assert(err, IsNil)
-	t.Assert(gc, NotNil)
+
+	mockConn.SetUptime(10)
+	m.Check()
+	mockConn.SetUptime(0)
+	m.Check()
+	t.Check(len(c), Equals, 1)
+	e := recv(c)
+	t.Assert(e, NotNil)
+	t.Check(e.DSN, Equals, mockConn.DSN())
 }
+
 func (s *TestSuite) TestNotifications(t *C) {
 	mockConn := mock.NewNullMySQL()
 	mockConnFactory := &mock.ConnectionFactory{
@@ -140,18 +166,14 @@ func (s *TestSuite) TestNotifications(t *C) {
 	 */
 	// Set initial uptime
 	mockConn.SetUptime(10)
-	subChan, err := m.Add(dsn)
+	subChan := make(chan *mrms.Event, 1)
+	err := m.Subscribe(dsn, subChan)
 	t.Assert(err, IsNil)
 
 	/**
 	 * MRMS should not send notification after first check for given dsn
 	 */
-	var notified bool
-	select {
-	case notified = <-subChan:
-	default:
-	}
-	t.Assert(notified, Equals, false, Commentf("MySQL was not restarted (first check of MySQL server), but MRMS notified subscribers"))
+	t.Assert(recv(subChan), IsNil, Commentf("MySQL was not restarted (first check of MySQL server), but MRMS notified subscribers"))
 
 	/**
 	 * If MySQL was restarted then MRMS should notify subscriber
@@ -159,12 +181,9 @@ func (s *TestSuite) TestNotifications(t *C) {
 	// Imitate MySQL restart by returning 0s uptime (previously 10s)
 	mockConn.SetUptime(0)
 	m.Check()
-	notified = false
-	select {
-	case notified = <-subChan:
-	default:
-	}
-	t.Assert(notified, Equals, true, Commentf("MySQL was restarted, but MRMS didn't notify subscribers"))
+	e := recv(subChan)
+	t.Assert(e, NotNil, Commentf("MySQL was restarted, but MRMS didn't notify subscribers"))
+	t.Check(e.Restarted(), Equals, true)
 
 	/**
 	 * If MySQL was not restarted then MRMS should not notify subscriber
@@ -172,12 +191,7 @@ func (s *TestSuite) TestNotifications(t *C) {
 	// 2s uptime is higher than previous 0s, this indicates MySQL was not restarted
 	mockConn.SetUptime(2)
 	m.Check()
-	notified = false
-	select {
-	case notified = <-subChan:
-	default:
-	}
-	t.Assert(notified, Equals, false, Commentf("MySQL was not restarted, but MRMS notified subscribers"))
+	t.Assert(recv(subChan), IsNil, Commentf("MySQL was not restarted, but MRMS notified subscribers"))
 
 	/**
 	 * Now let's imitate MySQL server restart and let's wait 3 seconds before next check.
@@ -191,36 +205,32 @@ func (s *TestSuite) TestNotifications(t *C) {
 	time.Sleep(time.Duration(waitTime) * time.Second)
 	mockConn.SetUptime(waitTime)
 	m.Check()
-	select {
-	case notified = <-subChan:
-	default:
-	}
-	t.Assert(notified, Equals, true, Commentf("MySQL was restarted (uptime overlaped last registered uptime), but MRMS didn't notify subscribers"))
+	e = recv(subChan)
+	t.Assert(e, NotNil, Commentf("MySQL was restarted (uptime overlaped last registered uptime), but MRMS didn't notify subscribers"))
+	t.Check(e.Reason, Equals, mrms.CHANGE_RESTART)
 
 	/**
 	 * After removing subscriber MRMS should not notify it anymore about MySQL restarts
 	 */
 	// Imitate MySQL restart by returning 0s uptime (previously 3s)
 	mockConn.SetUptime(0)
-	m.Remove(dsn, subChan)
+	m.Unsubscribe(dsn, subChan)
 	m.Check()
-	notified = false
-	select {
-	case notified = <-subChan:
-	default:
-	}
-	t.Assert(notified, Equals, false, Commentf("Subscriber was removed but MRMS still notified it about MySQL restart"))
+	t.Assert(recv(subChan), IsNil, Commentf("Subscriber was removed but MRMS still notified it about MySQL restart"))
 }
 
 func (s *TestSuite) TestSubscribers(t *C) {
 	subs := monitor.NewSubscribers(s.logger)
-	rwChan := make(chan string, 100)
-	dsn := "fake:dsn@tcp(127.0.0.1:3306)/?parseTime=true"
-	err := subs.GlobalAdd(rwChan, dsn)
-	t.Assert(err, Equals, nil)
+	c := make(chan *mrms.Event, 1)
+	err := subs.Add(c)
+	t.Assert(err, IsNil)
+	t.Check(subs.Empty(), Equals, false)
 
-	err = subs.GlobalAdd(rwChan, "")
+	err = subs.Add(nil)
 	t.Assert(err, NotNil)
+
+	subs.Remove(c)
+	t.Check(subs.Empty(), Equals, true)
 }
 
 func (s *TestSuite) Test2Subscribers(t *C) {
@@ -231,39 +241,23 @@ func (s *TestSuite) Test2Subscribers(t *C) {
 	m := monitor.NewMonitor(s.logger, mockConnFactory)
 	dsn := "fake:dsn@tcp(127.0.0.1:3306)/?parseTime=true"
 
-	c1, err := m.Add(dsn)
+	c1 := make(chan *mrms.Event, 1)
+	err := m.Subscribe(dsn, c1)
 	t.Assert(err, IsNil)
 
-	c2, err := m.Add(dsn)
+	c2 := make(chan *mrms.Event, 1)
+	err = m.Subscribe(dsn, c2)
 	t.Assert(err, IsNil)
 
-	var notified bool
-
 	mockConn.SetUptime(1)
 	m.Check()
-	select {
-	case notified = <-c1:
-	default:
-	}
-	t.Check(notified, Equals, false)
-	select {
-	case notified = <-c2:
-	default:
-	}
-	t.Check(notified, Equals, false)
+	t.Check(recv(c1), IsNil)
+	t.Check(recv(c2), IsNil)
 
 	mockConn.SetUptime(2)
 	m.Check()
-	select {
-	case notified = <-c1:
-	default:
-	}
-	t.Check(notified, Equals, false)
-	select {
-	case notified = <-c2:
-	default:
-	}
-	t.Check(notified, Equals, false)
+	t.Check(recv(c1), IsNil)
+	t.Check(recv(c2), IsNil)
 }
 
 func (s *TestSuite) TestRealMySQL(t *C) {
@@ -271,17 +265,96 @@ func (s *TestSuite) TestRealMySQL(t *C) {
 		t.Skip("PCT_TEST_MYSQL_DSN is not set")
 	}
 	m := monitor.NewMonitor(s.logger, &mysql.RealConnectionFactory{})
-	c, err := m.Add(dsn)
+	c := make(chan *mrms.Event, 1)
+	err := m.Subscribe(dsn, c)
 	t.Assert(err, IsNil)
-	defer m.Remove(dsn, c)
+	defer m.Unsubscribe(dsn, c)
 	for i := 0; i < 2; i++ {
 		time.Sleep(1 * time.Second)
 		m.Check()
 		select {
-		case <-c:
-			t.Logf("False-positive restart reported on check number %d", i)
+		case e := <-c:
+			t.Logf("False-positive change reported on check number %d: %s", i, e)
 			t.FailNow()
 		default:
 		}
 	}
 }
+
+func (s *TestSuite) TestChanges(t *C) {
+	mockConn := mock.NewNullMySQL()
+	mockConnFactory := &mock.ConnectionFactory{
+		Conn: mockConn,
+	}
+	m := monitor.NewMonitor(s.logger, mockConnFactory)
+	dsn := "fake:dsn@tcp(127.0.0.1:3306)/?parseTime=true"
+
+	mockConn.SetUptime(100)
+	mockConn.SetGlobalVarString("version", "5.6.24")
+	mockConn.SetGlobalVarString("server_uuid", "a3f4b2ba-fe8b-11e4-8e26-080027b7cd2b")
+	mockConn.SetGlobalVarString("hostname", "db1")
+	mockConn.SetGlobalVarString("read_only", "0")
+	mockConn.SetGlobalVarString("slow_query_log", "1")
+	mockConn.SetGlobalVarString("slow_query_log_file", "/var/lib/mysql/db1-slow.log")
+
+	c := make(chan *mrms.Event, 1)
+	err := m.Subscribe(dsn, c)
+	t.Assert(err, IsNil)
+
+	// No changes, no event.
+	mockConn.SetUptime(101)
+	m.Check()
+	t.Check(recv(c), IsNil)
+
+	// Failover behind a VIP: new server has a higher uptime, but it's a
+	// different server, so subscribers need to re-configure it like a restart.
+	mockConn.SetUptime(5000)
+	mockConn.SetGlobalVarString("server_uuid", "c1b8e6a0-fe8b-11e4-8e26-080027b7cd2c")
+	mockConn.SetGlobalVarString("hostname", "db2")
+	mockConn.SetGlobalVarString("slow_query_log_file", "/var/lib/mysql/db2-slow.log")
+	m.Check()
+	e := recv(c)
+	t.Assert(e, NotNil)
+	t.Check(e.DSN, Equals, mockConn.DSN())
+	t.Check(e.Reason, Equals, mrms.CHANGE_SERVER)
+	t.Check(e.Version, Equals, "5.6.24")
+	t.Check(e.OldUptime, Equals, int64(101))
+	t.Check(e.NewUptime, Equals, int64(5000))
+	t.Check(e.Changes, DeepEquals, []mrms.Change{
+		{Type: mrms.CHANGE_SERVER, Var: "server_uuid", Old: "a3f4b2ba-fe8b-11e4-8e26-080027b7cd2b", New: "c1b8e6a0-fe8b-11e4-8e26-080027b7cd2c"},
+		{Type: mrms.CHANGE_SERVER, Var: "hostname", Old: "db1", New: "db2"},
+		{Type: mrms.CHANGE_SLOW_LOG, Var: "slow_query_log_file", Old: "/var/lib/mysql/db1-slow.log", New: "/var/lib/mysql/db2-slow.log"},
+	})
+	t.Check(e.Restarted(), Equals, true)
+	t.Check(e.Has(mrms.CHANGE_RESTART), Equals, false)
+
+	// read_only flip is an event, but not a restart.
+	mockConn.SetUptime(5001)
+	mockConn.SetGlobalVarString("read_only", "1")
+	m.Check()
+	e = recv(c)
+	t.Assert(e, NotNil)
+	t.Check(e.Reason, Equals, mrms.CHANGE_READ_ONLY)
+	t.Check(e.Changes, DeepEquals, []mrms.Change{
+		{Type: mrms.CHANGE_READ_ONLY, Var: "read_only", Old: "0", New: "1"},
+	})
+	t.Check(e.Restarted(), Equals, false)
+	t.Check(e.String(), Equals, "read_only '0' -> '1'")
+
+	// Restart and upgrade: uptime is lower and version changed.
+	mockConn.SetUptime(1)
+	mockConn.SetGlobalVarString("version", "5.6.25")
+	m.Check()
+	e = recv(c)
+	t.Assert(e, NotNil)
+	t.Check(e.Reason, Equals, mrms.CHANGE_RESTART)
+	t.Check(e.Version, Equals, "5.6.25")
+	t.Check(e.String(), Equals, "restart (uptime 5001 -> 1), version '5.6.24' -> '5.6.25'")
+
+	// Unsubscribed channel isn't notified.
+	m.Unsubscribe(dsn, c)
+	mockConn.SetGlobalVarString("read_only", "0")
+	mockConn.SetUptime(0)
+	m.Check()
+	t.Check(recv(c), IsNil)
+}
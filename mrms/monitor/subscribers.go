@@ -22,64 +22,42 @@ import (
 	"sync"
 	"time"
 
+	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/pct"
 )
 
 type Subscribers struct {
 	logger *pct.Logger
 	// --
-	subscribers       map[<-chan bool]chan bool
-	globalSubscribers map[chan string]string
+	subscribers map[chan *mrms.Event]bool
 
 	sync.RWMutex
 }
 
 func NewSubscribers(logger *pct.Logger) *Subscribers {
 	return &Subscribers{
-		logger:            logger,
-		subscribers:       make(map[<-chan bool]chan bool),
-		globalSubscribers: make(map[chan string]string),
+		logger:      logger,
+		subscribers: make(map[chan *mrms.Event]bool),
 	}
 }
 
-func (s *Subscribers) Add() (rChan <-chan bool) {
+func (s *Subscribers) Add(c chan *mrms.Event) error {
+	if c == nil {
+		return fmt.Errorf("Invalid channel")
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
-	rwChan := make(chan bool, 1)
-	rChan = rwChan
-	s.subscribers[rChan] = rwChan
-
-	return rChan
-}
-
-func (s *Subscribers) GlobalAdd(rwChan chan string, dsn string) error {
-	if rwChan == nil {
-		return fmt.Errorf("Invalid global channel")
-	}
-	if dsn == "" {
-		return fmt.Errorf("DSN cannot be blank")
-	}
-	s.globalSubscribers[rwChan] = dsn
+	s.subscribers[c] = true
 	return nil
 }
 
-func (s *Subscribers) GlobalRemove(inDsn string) {
-	for ch, dsn := range s.globalSubscribers {
-		if dsn == inDsn {
-			delete(s.globalSubscribers, ch)
-		}
-	}
-	return
-}
-
-func (s *Subscribers) Remove(rChan <-chan bool) {
+func (s *Subscribers) Remove(c chan *mrms.Event) {
 	s.Lock()
 	defer s.Unlock()
 
-	if _, ok := s.subscribers[rChan]; ok {
-		delete(s.subscribers, rChan)
-	}
+	delete(s.subscribers, c)
 }
 
 func (s *Subscribers) Empty() bool {
@@ -89,27 +67,15 @@ func (s *Subscribers) Empty() bool {
 	return len(s.subscribers) == 0
 }
 
-func (s *Subscribers) Notify() {
+func (s *Subscribers) Notify(e *mrms.Event) {
 	s.RLock()
 	defer s.RUnlock()
 
-	for _, rwChan := range s.subscribers {
+	for c := range s.subscribers {
 		select {
-		case rwChan <- true:
+		case c <- e:
 		case <-time.After(1 * time.Second):
 			s.logger.Warn("Unable to notify subscriber")
 		}
 	}
-	s.notifyGlobalSubscribers()
-}
-
-func (s *Subscribers) notifyGlobalSubscribers() {
-	for globalChan, dsn := range s.globalSubscribers {
-		select {
-		case globalChan <- dsn:
-
-		case <-time.After(1 * time.Second):
-			s.logger.Warn("Unable to notify global subscriber")
-		}
-	}
 }
@@ -20,6 +20,7 @@ package mysql
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os/exec"
 	"os/user"
 	"path"
@@ -160,3 +161,37 @@ func HideDSNPassword(dsn string) string {
 	userPasswordParts := strings.Split(userPart, ":")
 	return userPasswordParts[0] + ":" + HiddenPassword + "@" + hostPart
 }
+
+// LocalDSN returns true if the DSN connects to MySQL on the local host, i.e. by
+// socket, or by TCP to localhost or a loopback address.  Only then are the PID
+// file, process, and option files on this host those of the MySQL instance.
+func LocalDSN(dsn string) bool {
+	// [user[:password]@][net[(addr)]]/dbname[?param1=value1&paramN=valueN]
+	if i := strings.LastIndex(dsn, "@"); i >= 0 {
+		dsn = dsn[i+1:]
+	}
+	addr := ""
+	if i := strings.Index(dsn, "("); i >= 0 {
+		if j := strings.Index(dsn[i:], ")"); j > 0 {
+			addr = dsn[i+1 : i+j]
+		}
+		dsn = dsn[:i]
+	} else if i := strings.Index(dsn, "/"); i >= 0 {
+		dsn = dsn[:i]
+	}
+	switch dsn {
+	case "unix":
+		return true
+	case "", "tcp":
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if host == "" || host == "localhost" {
+			return true // driver default is 127.0.0.1:3306
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
@@ -81,3 +81,25 @@ func (s *DSNTestSuite) TestHideDSNPassword(t *C) {
 	dsn = ""
 	t.Check(mysql.HideDSNPassword(dsn), Equals, ":"+mysql.HiddenPassword+"@")
 }
+
+func (s *DSNTestSuite) TestLocalDSN(t *C) {
+	local := []string{
+		"user:pass@/",
+		"user:pass@unix(/var/run/mysqld/mysqld.sock)/",
+		"user:pass@tcp(localhost:3306)/",
+		"user:pass@tcp(127.0.0.1:3307)/?parseTime=true",
+		"user:pass@tcp([::1]:3306)/",
+		"user:p@ss@tcp/",
+	}
+	for _, dsn := range local {
+		t.Check(mysql.LocalDSN(dsn), Equals, true, Commentf(dsn))
+	}
+	remote := []string{
+		"user:pass@tcp(db1.example.com:3306)/",
+		"user:pass@tcp(10.0.0.5)/",
+		"user:localhost@tcp(10.0.0.5:3306)/",
+	}
+	for _, dsn := range remote {
+		t.Check(mysql.LocalDSN(dsn), Equals, false, Commentf(dsn))
+	}
+}
@@ -29,6 +29,8 @@ func FormatError(err error) string {
 // MySQL error codes
 const (
 	ER_SPECIFIC_ACCESS_DENIED_ERROR = 1227
+	ER_DBACCESS_DENIED_ERROR        = 1044
 	ER_SYNTAX_ERROR                 = 1064
 	ER_USER_DENIED                  = 1142
+	ER_NO_SUCH_TABLE                = 1146
 )
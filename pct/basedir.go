@@ -127,12 +127,12 @@ func (b *basedir) WriteConfig(service string, config interface{}) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(configFile, data, 0600)
+	return WriteFileAtomic(configFile, data, 0600)
 }
 
 func (b *basedir) WriteConfigString(service, config string) error {
 	configFile := filepath.Join(b.configDir, service+CONFIG_FILE_SUFFIX)
-	return ioutil.WriteFile(configFile, []byte(config), 0600)
+	return WriteFileAtomic(configFile, []byte(config), 0600)
 }
 
 func (b *basedir) RemoveConfig(service string) error {
@@ -151,3 +151,17 @@ func (b *basedir) File(file string) string {
 	}
 	return filepath.Join(b.Path(), file)
 }
+
+// WriteFileAtomic writes data to a temp file then renames it to file so
+// file is never partially written, e.g. if the agent crashes.
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmpFile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, file); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
@@ -70,6 +70,18 @@ func RemoveFile(file string) error {
 	return nil
 }
 
+// SelectedValue returns the [selected] value of a /sys choice file like
+// "always [madvise] never", or the whole value with whitespace collapsed if
+// nothing is selected.
+func SelectedValue(value string) string {
+	start := strings.Index(value, "[")
+	end := strings.Index(value, "]")
+	if start < 0 || end < start {
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return value[start+1 : end]
+}
+
 func FileExists(file string) bool {
 	_, err := os.Stat(file)
 	if err == nil {
@@ -89,6 +89,13 @@ func (s *SysTestSuite) TestSameFile(t *C) {
 	}
 }
 
+func (s *SysTestSuite) TestSelectedValue(t *C) {
+	t.Check(pct.SelectedValue("always [madvise] never\n"), Equals, "madvise")
+	t.Check(pct.SelectedValue("noop deadline [cfq] \n"), Equals, "cfq")
+	t.Check(pct.SelectedValue("none\n"), Equals, "none")
+	t.Check(pct.SelectedValue("128\n"), Equals, "128")
+}
+
 func (s *SysTestSuite) TestMbps(t *C) {
 	t.Check(pct.Mbps(0, 1.0), Equals, "0.00")
 	t.Check(pct.Mbps(12749201, 0), Equals, "0.00")
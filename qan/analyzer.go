@@ -21,10 +21,12 @@ import (
 	"fmt"
 	"log"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/percona/percona-agent/data"
+	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
 	"github.com/percona/percona-agent/ticker"
@@ -40,6 +42,7 @@ type Worker interface {
 	Stop() error
 	Cleanup() error
 	Status() map[string]string
+	SetConfig(Config)
 }
 
 // An Analyzer runs a Worker at each Interval. Analyzers are responsible for
@@ -58,7 +61,13 @@ type Analyzer interface {
 
 // An AnalyzerFactory makes an Analyzer, real or mock.
 type AnalyzerFactory interface {
-	Make(config Config, name string, mysqlConn mysql.Connector, restartChan <-chan bool, tickChan chan time.Time) Analyzer
+	Make(config Config, name string, mysqlConn mysql.Connector, restartChan <-chan *mrms.Event, tickChan chan time.Time) Analyzer
+}
+
+// A Backfiller parses old data, e.g. rotated slow logs, into Reports. Unlike
+// an Analyzer, it runs once and does not configure MySQL.
+type Backfiller interface {
+	Backfill(config BackfillConfig, mysqlConn mysql.Connector, stopChan <-chan bool) error
 }
 
 // --------------------------------------------------------------------------
@@ -68,7 +77,7 @@ type RealAnalyzer struct {
 	config      Config
 	iter        IntervalIter
 	mysqlConn   mysql.Connector
-	restartChan <-chan bool
+	restartChan <-chan *mrms.Event
 	worker      Worker
 	clock       ticker.Manager
 	spool       data.Spooler
@@ -81,9 +90,12 @@ type RealAnalyzer struct {
 	configureMySQLSync  *pct.SyncChan
 	running             bool
 	mux                 *sync.RWMutex
+	configMux           *sync.RWMutex
+	reconfigureChan     chan bool
+	psMaxSlowLogSize    int64 // Percona Server max_slowlog_size if we took over rotation
 }
 
-func NewRealAnalyzer(logger *pct.Logger, config Config, iter IntervalIter, mysqlConn mysql.Connector, restartChan <-chan bool, worker Worker, clock ticker.Manager, spool data.Spooler) *RealAnalyzer {
+func NewRealAnalyzer(logger *pct.Logger, config Config, iter IntervalIter, mysqlConn mysql.Connector, restartChan <-chan *mrms.Event, worker Worker, clock ticker.Manager, spool data.Spooler) *RealAnalyzer {
 	name := logger.Service()
 	a := &RealAnalyzer{
 		logger:      logger,
@@ -102,6 +114,8 @@ func NewRealAnalyzer(logger *pct.Logger, config Config, iter IntervalIter, mysql
 		runSync:             pct.NewSyncChan(),
 		configureMySQLSync:  pct.NewSyncChan(),
 		mux:                 &sync.RWMutex{},
+		configMux:           &sync.RWMutex{},
+		reconfigureChan:     make(chan bool, 1),
 	}
 	return a
 }
@@ -149,11 +163,46 @@ func (a *RealAnalyzer) Status() map[string]string {
 }
 
 func (a *RealAnalyzer) Config() Config {
+	a.configMux.RLock()
+	defer a.configMux.RUnlock()
 	return a.config
 }
 
+// SetConfig changes the config of a running analyzer. The new config is used
+// starting with the next interval. If the Start queries changed, MySQL is
+// re-configured with the new queries, else MySQL is not touched. The caller
+// is responsible for re-registering the tick chan if Interval changed.
 func (a *RealAnalyzer) SetConfig(config Config) {
+	a.configMux.Lock()
+	startChanged := !SameQueries(a.config.Start, config.Start)
+	if a.psMaxSlowLogSize > 0 {
+		// We turned off Percona Server rotation, so it can't be taken over
+		// again; keep rotating the slow log at its size.
+		config.MaxSlowLogSize = a.psMaxSlowLogSize
+	}
 	a.config = config
+	a.configMux.Unlock()
+
+	if startChanged {
+		select {
+		case a.reconfigureChan <- true:
+		default:
+			// Already re-configuring.
+		}
+	}
+}
+
+// SameQueries returns true if both lists have the same queries in the same order.
+func SameQueries(q1, q2 []mysql.Query) bool {
+	if len(q1) != len(q2) {
+		return false
+	}
+	for i := range q1 {
+		if q1[i] != q2[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // --------------------------------------------------------------------------
@@ -169,7 +218,10 @@ func (a *RealAnalyzer) TakeOverPerconaServerRotation() error {
 	// http://www.percona.com/doc/percona-server/5.6/flexibility/slowlog_rotation.html
 	if maxSlowLogSize >= MIN_SLOWLOG_ROTATION_SIZE {
 		a.logger.Info("Taking over Percona Server slow log rotation, max_slowlog_size:", maxSlowLogSize)
+		a.configMux.Lock()
 		a.config.MaxSlowLogSize = maxSlowLogSize
+		a.psMaxSlowLogSize = maxSlowLogSize
+		a.configMux.Unlock()
 
 		// Using Set makes testing easier
 		disablePSrotation := []mysql.Query{
@@ -241,7 +293,14 @@ func (a *RealAnalyzer) run() {
 	defer a.logger.Debug("run:return")
 
 	mysqlConfigured := false
-	go a.configureMySQL(a.config.Start, 0) // try forever
+	reconfigure := false
+	configuresMySQL := ConfiguresMySQL(a.Config())
+	if configuresMySQL {
+		go a.configureMySQL(a.Config().Start, 0) // try forever
+	} else {
+		// Nothing to configure, so start the iter now. The chan is buffered.
+		a.mysqlConfiguredChan <- true
+	}
 
 	defer func() {
 		a.logger.Info("Stopping")
@@ -252,14 +311,16 @@ func (a *RealAnalyzer) run() {
 		a.status.Update(a.name, "Stopping interval iter")
 		a.iter.Stop()
 
-		if !mysqlConfigured {
-			a.status.Update(a.name, "Stopping MySQL config")
-			a.configureMySQLSync.Stop()
-			a.configureMySQLSync.Wait()
-		}
+		if configuresMySQL {
+			if !mysqlConfigured {
+				a.status.Update(a.name, "Stopping MySQL config")
+				a.configureMySQLSync.Stop()
+				a.configureMySQLSync.Wait()
+			}
 
-		a.status.Update(a.name, "Stopping QAN on MySQL")
-		a.configureMySQL(a.config.Stop, 1) // try once
+			a.status.Update(a.name, "Stopping QAN on MySQL")
+			a.configureMySQL(a.Config().Stop, 1) // try once
+		}
 
 		if err := recover(); err != nil {
 			a.logger.Error("QAN crashed: ", err)
@@ -315,7 +376,7 @@ func (a *RealAnalyzer) run() {
 
 			if interval.StartTime.After(lastTs) {
 				t0 := interval.StartTime.Format("2006-01-02 15:04:05")
-				if a.config.CollectFrom == "slowlog" {
+				if a.Config().CollectFrom == "slowlog" {
 					t1 := interval.StopTime.Format("15:04:05 MST")
 					a.status.Update(a.name+"-last-interval", fmt.Sprintf("%s to %s", t0, t1))
 				} else {
@@ -325,6 +386,14 @@ func (a *RealAnalyzer) run() {
 			}
 		case mysqlConfigured = <-a.mysqlConfiguredChan:
 			a.logger.Debug("run:mysql:configured")
+			if reconfigure {
+				// MySQL was configured with the old Start queries, so
+				// configure it again with the new ones.
+				reconfigure = false
+				mysqlConfigured = false
+				go a.configureMySQL(a.Config().Start, 0) // try forever
+				continue
+			}
 			// Start the IntervalIter once MySQL has been configured.
 			// This avoids no data or partial data, e.g. slow log verbosity
 			// not set yet.
@@ -339,21 +408,42 @@ func (a *RealAnalyzer) run() {
 			tickChan := a.iter.TickChan()
 			t := a.clock.ETA(tickChan)
 			if t > 60 {
-				began := ticker.Began(a.config.Interval, uint(time.Now().UTC().Unix()))
+				began := ticker.Began(a.Config().Interval, uint(time.Now().UTC().Unix()))
 				a.logger.Info("First interval began at", began)
 				tickChan <- began
 			} else {
 				a.logger.Info(fmt.Sprintf("First interval begins in %.1f seconds", t))
 			}
-		case <-a.restartChan:
+		case e := <-a.restartChan:
 			a.logger.Debug("run:mysql:restart")
+			if !a.needsConfigure(e) {
+				// Changes like read_only don't undo our global settings.
+				a.logger.Info("MySQL changed: " + e.String())
+				continue
+			}
+			a.logger.Info("Re-configuring MySQL because of " + e.String())
 			// If MySQL is not configured, then configureMySQL() should already
 			// be running, trying to configure it. Else, we need to run
 			// configureMySQL again.
 			if mysqlConfigured {
 				mysqlConfigured = false
 				a.iter.Stop()
-				go a.configureMySQL(a.config.Start, 0) // try forever
+				go a.configureMySQL(a.Config().Start, 0) // try forever
+			}
+		case <-a.reconfigureChan:
+			if !configuresMySQL {
+				continue
+			}
+			a.logger.Info("Start queries changed, re-configuring MySQL")
+			// Like a restart, but if MySQL is not configured yet then
+			// configureMySQL() is running with the old Start queries, so
+			// wait for it and run it again.
+			if mysqlConfigured {
+				mysqlConfigured = false
+				a.iter.Stop()
+				go a.configureMySQL(a.Config().Start, 0) // try forever
+			} else {
+				reconfigure = true
 			}
 		case <-a.runSync.StopChan:
 			a.logger.Debug("run:stop")
@@ -362,6 +452,36 @@ func (a *RealAnalyzer) run() {
 	}
 }
 
+// ConfiguresMySQL returns true if the analyzer configures MySQL with the Start
+// and Stop queries and needs it configured before the worker runs. The pcap
+// worker only reads capture files, and the pg_stat_statements worker runs its
+// own Start queries on PostgreSQL.
+func ConfiguresMySQL(config Config) bool {
+	return config.CollectFrom == "slowlog" || config.CollectFrom == "perfschema"
+}
+
+// needsConfigure returns true if the MySQL change can undo the Start queries.
+// A restart or new server undoes all global settings, someone can change the
+// slow log settings, and after a reconnect we can't be sure the global settings
+// are still ours, so Start queries that set globals are run again.
+func (a *RealAnalyzer) needsConfigure(e *mrms.Event) bool {
+	if e.Restarted() {
+		return true
+	}
+	config := a.Config()
+	if e.Has(mrms.CHANGE_SLOW_LOG) && config.CollectFrom == "slowlog" {
+		return true
+	}
+	if e.Has(mrms.CHANGE_RECONNECT) {
+		for _, q := range config.Start {
+			if strings.Contains(strings.ToUpper(q.Set), "GLOBAL") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (a *RealAnalyzer) runWorker(interval *Interval) {
 	a.logger.Debug(fmt.Sprintf("runWorker:call:%d", interval.Number))
 	defer func() {
@@ -375,6 +495,10 @@ func (a *RealAnalyzer) runWorker(interval *Interval) {
 		a.logger.Debug(fmt.Sprintf("runWorker:return:%d", interval.Number))
 	}()
 
+	// Give the worker the current config in case it was changed by SetConfig.
+	config := a.Config()
+	a.worker.SetConfig(config)
+
 	// Let worker do whatever it needs before it starts processing
 	// the interval. This mostly makes testing easier.
 	if err := a.worker.Setup(interval); err != nil {
@@ -399,7 +523,7 @@ func (a *RealAnalyzer) runWorker(interval *Interval) {
 		return
 	}
 	if result == nil {
-		if a.config.CollectFrom == "slowlog" {
+		if config.CollectFrom == "slowlog" {
 			// This shouldn't happen. If it does, the slow log worker has a bug
 			// because it should have returned an error above.
 			a.logger.Error("Nil result", interval)
@@ -410,7 +534,7 @@ func (a *RealAnalyzer) runWorker(interval *Interval) {
 
 	// Translate the results into a report and spool.
 	// NOTE: "qan" here is correct; do not use a.name.
-	report := MakeReport(a.config, interval, result)
+	report := MakeReport(config, interval, result)
 	if err := a.spool.Write("qan", report); err != nil {
 		a.logger.Warn("Lost report:", err)
 	}
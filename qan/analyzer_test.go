@@ -26,6 +26,7 @@ import (
 	. "github.com/go-test/test"
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/instance"
+	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
 	"github.com/percona/percona-agent/qan"
@@ -42,7 +43,7 @@ type AnalyzerTestSuite struct {
 	clock         *mock.Clock
 	api           *mock.API
 	worker        *mock.QanWorker
-	restartChan   chan bool
+	restartChan   chan *mrms.Event
 	logChan       chan *proto.LogEntry
 	logger        *pct.Logger
 	intervalChan  chan *qan.Interval
@@ -56,6 +57,8 @@ type AnalyzerTestSuite struct {
 
 var _ = Suite(&AnalyzerTestSuite{})
 
+var restartEvent = mrms.NewEvent("", time.Now().UTC(), []mrms.Change{{Type: mrms.CHANGE_RESTART}})
+
 // The highest possible value max_slowlog_size can be set to (from Percona Server documentation)
 const MAX_SLOW_LOG_SIZE int64 = 1073741824
 
@@ -97,7 +100,7 @@ func (s *AnalyzerTestSuite) SetUpSuite(t *C) {
 	}
 	s.api = mock.NewAPI("http://localhost", "http://localhost", "123", "abc-123-def", links)
 
-	s.restartChan = make(chan bool, 1)
+	s.restartChan = make(chan *mrms.Event, 1)
 }
 
 func (s *AnalyzerTestSuite) SetUpTest(t *C) {
@@ -258,7 +261,7 @@ func (s *AnalyzerTestSuite) TestMySQLRestart(t *C) {
 	// Simulate a MySQL restart. This causes the analyzer to re-configure MySQL
 	// using the same Start queries.
 	s.nullmysql.Reset()
-	s.restartChan <- true
+	s.restartChan <- restartEvent
 	if !test.WaitState(s.nullmysql.SetChan) {
 		t.Error("Timeout waiting for <-s.nullmysql.SetChan")
 	}
@@ -271,11 +274,46 @@ func (s *AnalyzerTestSuite) TestMySQLRestart(t *C) {
 
 	// Analyzer stops and re-starts its iter on MySQL restart.
 	t.Check(s.iter.Calls(), DeepEquals, []string{"Stop", "Start"})
+	s.iter.Reset()
+
+	// Other changes don't undo the global settings, so the analyzer
+	// doesn't re-configure MySQL.
+	s.nullmysql.Reset()
+	s.restartChan <- mrms.NewEvent(s.nullmysql.DSN(), time.Now().UTC(), []mrms.Change{
+		{Type: mrms.CHANGE_READ_ONLY, Var: "read_only", Old: "0", New: "1"},
+	})
+	time.Sleep(200 * time.Millisecond)
+	t.Check(s.nullmysql.GetSet(), HasLen, 0)
+	t.Check(s.iter.Calls(), HasLen, 0)
+
+	// A reconnect doesn't either because the Start queries don't set globals.
+	s.restartChan <- mrms.NewEvent(s.nullmysql.DSN(), time.Now().UTC(), []mrms.Change{
+		{Type: mrms.CHANGE_RECONNECT},
+	})
+	time.Sleep(200 * time.Millisecond)
+	t.Check(s.nullmysql.GetSet(), HasLen, 0)
+	t.Check(s.iter.Calls(), HasLen, 0)
+
+	// But if someone changes the slow log, the analyzer re-configures MySQL.
+	s.restartChan <- mrms.NewEvent(s.nullmysql.DSN(), time.Now().UTC(), []mrms.Change{
+		{Type: mrms.CHANGE_SLOW_LOG, Var: "slow_query_log", Old: "1", New: "0"},
+	})
+	if !test.WaitState(s.nullmysql.SetChan) {
+		t.Error("Timeout waiting for <-s.nullmysql.SetChan")
+	}
+	test.WaitStatus(1, a, "qan-analyzer", "Idle")
+	got = s.nullmysql.GetSet()
+	if same, diff := IsDeeply(got, expect); !same {
+		Dump(got)
+		t.Error(diff)
+	}
+	t.Check(s.iter.Calls(), DeepEquals, []string{"Stop", "Start"})
+	s.iter.Reset()
 
 	s.nullmysql.Reset()
 	// Enable slowlog DB rotation by setting max_slowlog_size to a value > 4096 and simulate MySQL restart
 	s.nullmysql.SetGlobalVarNumber("max_slowlog_size", 100000)
-	s.restartChan <- true
+	s.restartChan <- restartEvent
 	if !test.WaitState(s.nullmysql.SetChan) {
 		t.Error("Timeout waiting for <-s.nullmysql.SetChan")
 	}
@@ -504,3 +542,131 @@ func (s *AnalyzerTestSuite) TestSlowLogTakeOver(t *C) {
 	test.WaitStatus(1, a, "qan-analyzer", "Stopped")
 	t.Check(a.String(), Equals, "qan-analyzer")
 }
+
+func (s *AnalyzerTestSuite) TestSetConfig(t *C) {
+	a := qan.NewRealAnalyzer(
+		pct.NewLogger(s.logChan, "qan-analyzer"),
+		s.config,
+		s.iter,
+		s.nullmysql,
+		s.restartChan,
+		s.worker,
+		s.clock,
+		s.spool,
+	)
+	err := a.Start()
+	t.Assert(err, IsNil)
+	test.WaitStatus(1, a, "qan-analyzer", "Idle")
+	t.Check(s.iter.Calls(), DeepEquals, []string{"Start"})
+	s.iter.Reset()
+	s.nullmysql.Reset()
+
+	// Changing only the report limit and example queries does not touch MySQL.
+	config := a.Config()
+	config.ReportLimit = 10
+	config.ExampleQueries = true
+	a.SetConfig(config)
+	t.Check(a.Config(), DeepEquals, config)
+
+	// The worker gets the new config before the next interval.
+	now := time.Now()
+	i := &qan.Interval{
+		Number:      1,
+		StartTime:   now,
+		StopTime:    now.Add(1 * time.Minute),
+		Filename:    "slow.log",
+		StartOffset: 0,
+		EndOffset:   999,
+	}
+	s.intervalChan <- i
+	if !test.WaitState(s.worker.SetupChan) {
+		t.Fatal("Timeout waiting for <-s.worker.SetupChan")
+	}
+	if !test.WaitState(s.worker.CleanupChan) {
+		t.Fatal("Timeout waiting for <-s.worker.CleanupChan")
+	}
+	t.Check(s.worker.Config, DeepEquals, config)
+	test.WaitStatus(1, a, "qan-analyzer", "Idle")
+	t.Check(s.nullmysql.GetSet(), HasLen, 0)
+	t.Check(s.iter.Calls(), HasLen, 0)
+
+	// Changing the Start queries re-configures MySQL with the new queries.
+	config.Start = []mysql.Query{
+		mysql.Query{Set: "-- new start"},
+	}
+	a.SetConfig(config)
+	if !test.WaitState(s.nullmysql.SetChan) {
+		t.Error("Timeout waiting for <-s.nullmysql.SetChan")
+	}
+	test.WaitStatus(1, a, "qan-analyzer", "Idle")
+	got := s.nullmysql.GetSet()
+	if same, diff := IsDeeply(got, config.Start); !same {
+		Dump(got)
+		t.Error(diff)
+	}
+	t.Check(s.iter.Calls(), DeepEquals, []string{"Stop", "Start"})
+
+	err = a.Stop()
+	t.Assert(err, IsNil)
+}
+
+func (s *AnalyzerTestSuite) TestPcapDoesNotConfigureMySQL(t *C) {
+	// pcap only reads capture files, so the analyzer doesn't touch MySQL,
+	// not even for Percona Server slow log rotation.
+	s.nullmysql.SetGlobalVarNumber("max_slowlog_size", 5000)
+	config := s.config
+	config.CollectFrom = "pcap"
+	config.PcapFiles = "/tmp/mysql-*.pcap"
+	a := qan.NewRealAnalyzer(
+		pct.NewLogger(s.logChan, "qan-analyzer"),
+		config,
+		s.iter,
+		s.nullmysql,
+		nil, // not subscribed to MRMS
+		s.worker,
+		s.clock,
+		s.spool,
+	)
+	err := a.Start()
+	t.Assert(err, IsNil)
+	test.WaitStatus(1, a, "qan-analyzer", "Idle")
+	t.Check(s.iter.Calls(), DeepEquals, []string{"Start"})
+	t.Check(s.nullmysql.GetSet(), HasLen, 0)
+	t.Check(a.Config().MaxSlowLogSize, Equals, MAX_SLOW_LOG_SIZE)
+
+	err = a.Stop()
+	t.Assert(err, IsNil)
+	t.Check(s.nullmysql.GetSet(), HasLen, 0)
+}
+
+func (s *AnalyzerTestSuite) TestSetConfigSlowLogTakeOver(t *C) {
+	// Percona Server with max_slowlog_size set, so the analyzer takes over
+	// slow log rotation when it starts.
+	s.nullmysql.SetGlobalVarNumber("max_slowlog_size", 5000)
+	a := qan.NewRealAnalyzer(
+		pct.NewLogger(s.logChan, "qan-analyzer"),
+		s.config,
+		s.iter,
+		s.nullmysql,
+		s.restartChan,
+		s.worker,
+		s.clock,
+		s.spool,
+	)
+	err := a.Start()
+	t.Assert(err, IsNil)
+	test.WaitStatus(1, a, "qan-analyzer", "Idle")
+	t.Check(a.Config().MaxSlowLogSize, Equals, int64(5000))
+
+	// A new config from the API doesn't have Percona Server's size, but the
+	// analyzer keeps it because PS rotation is off now.
+	config := a.Config()
+	config.ReportLimit = 10
+	config.MaxSlowLogSize = 0
+	a.SetConfig(config)
+	t.Check(a.Config().ReportLimit, Equals, uint(10))
+	t.Check(a.Config().MaxSlowLogSize, Equals, int64(5000))
+
+	err = a.Stop()
+	t.Assert(err, IsNil)
+}
@@ -25,16 +25,29 @@ import (
 type Config struct {
 	proto.ServiceInstance
 	// Manager
-	CollectFrom       string // "slowlog" or "perfschema"
+	CollectFrom       string // "slowlog", "perfschema", "pcap", or "pg_stat_statements"
 	Start             []mysql.Query
 	Stop              []mysql.Query
 	MaxWorkers        int
 	Interval          uint  // minutes, "How often to report"
 	MaxSlowLogSize    int64 // bytes, 0 = no max
 	RemoveOldSlowLogs bool  // after rotating for MaxSlowLogSize
+	// pcap
+	PcapFiles string `json:",omitempty"` // glob of tcpdump -w files, e.g. /var/lib/pcap/mysql-*.pcap
+	PcapPort  uint   `json:",omitempty"` // MySQL server port in the captures, default 3306
 	// Worker
 	ExampleQueries bool // only fingerprints if false
 	WorkerRunTime  uint // seconds
 	// Report
 	ReportLimit uint
 }
+
+// BackfillConfig is the data of a Backfill cmd. Reports are made like
+// the analyzer makes them from a Config with the same fields.
+type BackfillConfig struct {
+	proto.ServiceInstance
+	Files          string // dir or glob of slow logs, e.g. /var/log/mysql/slow.log*
+	Interval       uint   // seconds
+	ExampleQueries bool
+	ReportLimit    uint
+}
@@ -22,10 +22,13 @@ import (
 
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/data"
+	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
 	"github.com/percona/percona-agent/qan"
+	"github.com/percona/percona-agent/qan/pcap"
 	"github.com/percona/percona-agent/qan/perfschema"
+	"github.com/percona/percona-agent/qan/pgstat"
 	"github.com/percona/percona-agent/qan/slowlog"
 	"github.com/percona/percona-agent/ticker"
 )
@@ -35,6 +38,8 @@ type RealAnalyzerFactory struct {
 	iterFactory             qan.IntervalIterFactory
 	slowlogWorkerFactory    slowlog.WorkerFactory
 	perfschemaWorkerFactory perfschema.WorkerFactory
+	pcapWorkerFactory       pcap.WorkerFactory
+	pgstatWorkerFactory     pgstat.WorkerFactory
 	spool                   data.Spooler
 	clock                   ticker.Manager
 }
@@ -44,6 +49,8 @@ func NewRealAnalyzerFactory(
 	iterFactory qan.IntervalIterFactory,
 	slowlogWorkerFactory slowlog.WorkerFactory,
 	perfschemaWorkerFactory perfschema.WorkerFactory,
+	pcapWorkerFactory pcap.WorkerFactory,
+	pgstatWorkerFactory pgstat.WorkerFactory,
 	spool data.Spooler,
 	clock ticker.Manager,
 ) *RealAnalyzerFactory {
@@ -52,8 +59,10 @@ func NewRealAnalyzerFactory(
 		iterFactory:             iterFactory,
 		slowlogWorkerFactory:    slowlogWorkerFactory,
 		perfschemaWorkerFactory: perfschemaWorkerFactory,
-		spool: spool,
-		clock: clock,
+		pcapWorkerFactory:       pcapWorkerFactory,
+		pgstatWorkerFactory:     pgstatWorkerFactory,
+		spool:                   spool,
+		clock:                   clock,
 	}
 	return f
 }
@@ -62,7 +71,7 @@ func (f *RealAnalyzerFactory) Make(
 	config qan.Config,
 	name string,
 	mysqlConn mysql.Connector,
-	restartChan <-chan bool,
+	restartChan <-chan *mrms.Event,
 	tickChan chan time.Time,
 ) qan.Analyzer {
 	var worker qan.Worker
@@ -71,7 +80,11 @@ func (f *RealAnalyzerFactory) Make(
 	case "slowlog":
 		worker = f.slowlogWorkerFactory.Make(name+"-worker", config, mysqlConn)
 	case "perfschema":
-		worker = f.perfschemaWorkerFactory.Make(name+"-worker", mysqlConn)
+		worker = f.perfschemaWorkerFactory.Make(name+"-worker", config, mysqlConn)
+	case "pcap":
+		worker = f.pcapWorkerFactory.Make(name+"-worker", config)
+	case "pg_stat_statements":
+		worker = f.pgstatWorkerFactory.Make(name+"-worker", config, mysqlConn)
 	default:
 		panic("Invalid analyzerType: " + analyzerType)
 	}
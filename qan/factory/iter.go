@@ -58,7 +58,9 @@ func (f *RealIntervalIterFactory) Make(analyzerType string, mysqlConn mysql.Conn
 			return filename, nil
 		}
 		return slowlog.NewIter(pct.NewLogger(f.logChan, "qan-interval"), getSlowLogFunc, tickChan)
-	case "perfschema":
+	case "perfschema", "pcap", "pg_stat_statements":
+		// pcap and pg_stat_statements intervals are just clock ticks like
+		// perf schema; the pcap worker tracks which files it has parsed.
 		return perfschema.NewIter(pct.NewLogger(f.logChan, "qan-interval"), tickChan)
 	default:
 		panic("Invalid analyzerType: " + analyzerType)
@@ -0,0 +1,134 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package qan
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// Values <= HISTOGRAM_MIN (1 microsecond) are counted as zero.
+	HISTOGRAM_MIN = 0.000001
+	// Each bucket is HISTOGRAM_GAMMA times larger than the previous bucket,
+	// so percentiles are accurate to about +/- 5%.
+	HISTOGRAM_GAMMA = 1.1
+)
+
+var logGamma = math.Log(HISTOGRAM_GAMMA)
+
+// A Histogram counts values, e.g. Query_time, in log-scale buckets. Unlike
+// min, max, and avg, percentiles cannot be merged, but histograms can, so
+// workers keep a Histogram per class and percentiles are calculated only
+// when the Report is made.
+type Histogram struct {
+	Count   uint64
+	Zero    uint64         // values <= HISTOGRAM_MIN
+	Buckets map[int]uint64 // sparse: bucket index => count
+}
+
+// Percentiles of Query_time, in seconds.
+type Percentiles struct {
+	P50 float64
+	P95 float64
+	P99 float64
+}
+
+func NewHistogram() *Histogram {
+	h := &Histogram{
+		Buckets: make(map[int]uint64),
+	}
+	return h
+}
+
+// Add counts one value.
+func (h *Histogram) Add(v float64) {
+	h.AddN(v, 1)
+}
+
+// AddN counts n values equal to v.
+func (h *Histogram) AddN(v float64, n uint64) {
+	if n == 0 {
+		return
+	}
+	h.Count += n
+	if v <= HISTOGRAM_MIN {
+		h.Zero += n
+		return
+	}
+	h.Buckets[bucket(v)] += n
+}
+
+// Merge adds all values counted by the other histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil {
+		return
+	}
+	h.Count += other.Count
+	h.Zero += other.Zero
+	for i, n := range other.Buckets {
+		h.Buckets[i] += n
+	}
+}
+
+// Percentile returns the value at or below which p percent (0 < p <= 100)
+// of values fall, or zero if the histogram is empty.
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.Count)))
+	if rank <= h.Zero {
+		return 0
+	}
+	seen := h.Zero
+	idx := make([]int, 0, len(h.Buckets))
+	for i := range h.Buckets {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		seen += h.Buckets[i]
+		if seen >= rank {
+			return value(i)
+		}
+	}
+	return value(idx[len(idx)-1])
+}
+
+// Percentiles returns the p50, p95, and p99 values.
+func (h *Histogram) Percentiles() *Percentiles {
+	return &Percentiles{
+		P50: h.Percentile(50),
+		P95: h.Percentile(95),
+		P99: h.Percentile(99),
+	}
+}
+
+// --------------------------------------------------------------------------
+
+// Bucket i counts values in (MIN * GAMMA^(i-1), MIN * GAMMA^i].
+func bucket(v float64) int {
+	return int(math.Ceil(math.Log(v/HISTOGRAM_MIN) / logGamma))
+}
+
+// Value returns the value in the middle of bucket i, which is within
+// (GAMMA-1)/(GAMMA+1) of any value counted by the bucket.
+func value(i int) float64 {
+	return HISTOGRAM_MIN * math.Pow(HISTOGRAM_GAMMA, float64(i)) * 2 / (HISTOGRAM_GAMMA + 1)
+}
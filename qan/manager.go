@@ -21,7 +21,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -30,6 +32,7 @@ import (
 	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/postgres"
 	"github.com/percona/percona-agent/ticker"
 )
 
@@ -37,7 +40,7 @@ import (
 // as configured.
 type AnalyzerInstance struct {
 	mysqlConn   mysql.Connector
-	restartChan <-chan bool
+	restartChan chan *mrms.Event
 	tickChan    chan time.Time
 	analyzer    Analyzer
 }
@@ -50,11 +53,13 @@ type Manager struct {
 	mrm             mrms.Monitor
 	mysqlFactory    mysql.ConnectionFactory
 	analyzerFactory AnalyzerFactory
+	backfiller      Backfiller
 	// --
-	mux       *sync.RWMutex
-	running   bool
-	analyzers map[uint]AnalyzerInstance
-	status    *pct.Status
+	mux              *sync.RWMutex
+	running          bool
+	analyzers        map[string]AnalyzerInstance // keyed on instance name, e.g. mysql-1
+	status           *pct.Status
+	backfillStopChan chan bool
 }
 
 func NewManager(
@@ -64,6 +69,7 @@ func NewManager(
 	mrm mrms.Monitor,
 	mysqlFactory mysql.ConnectionFactory,
 	analyzerFactory AnalyzerFactory,
+	backfiller Backfiller,
 ) *Manager {
 	m := &Manager{
 		logger:          logger,
@@ -72,10 +78,11 @@ func NewManager(
 		mrm:             mrm,
 		mysqlFactory:    mysqlFactory,
 		analyzerFactory: analyzerFactory,
+		backfiller:      backfiller,
 		// --
 		mux:       &sync.RWMutex{},
-		analyzers: make(map[uint]AnalyzerInstance),
-		status:    pct.NewStatus([]string{"qan"}),
+		analyzers: make(map[string]AnalyzerInstance),
+		status:    pct.NewStatus([]string{"qan", "qan-backfill"}),
 	}
 	return m
 }
@@ -103,29 +110,30 @@ func (m *Manager) Start() error {
 		m.status.Update("qan", "Running")
 	}()
 
-	// Load qan config from disk.
-	// todo-1.1: get and start all qan-*.conf
-	config := Config{}
-	if err := pct.Basedir.ReadConfig("qan", &config); err != nil {
-		if os.IsNotExist(err) {
-			m.logger.Info("Not enabled")
-			return nil
-		}
-		m.logger.Error("Read qan config:", err)
+	// Load all qan-*.conf from disk, one per MySQL instance.
+	configs, err := m.getConfigs()
+	if err != nil {
+		m.logger.Error("Read qan configs:", err)
+		return nil
+	}
+	if len(configs) == 0 {
+		m.logger.Info("Not enabled")
 		return nil
 	}
 
-	// Start the slow log or perf schema analyzer. If it fails that's ok for
+	// Start the slow log or perf schema analyzers. If one fails that's ok for
 	// the qan manager itself (i.e. don't fail this func) because user can fix
 	// or reconfigure this analyzer instance later and have qan manager try
-	// again to start it.
+	// again to start it. The other analyzers are not affected.
 	// todo: this fails if agent starts before MySQL is running because MRMS
 	//       fails to connect to MySQL in mrms/monitor/instance.NewMysqlInstance();
 	//       it should succeed and retry until MySQL is online.
-	if err := m.startAnalyzer(config); err != nil {
-		m.logger.Error(fmt.Sprintf("Cannot start Query Analytics: %s. Verify that MySQL is running, "+
-			"then try again.", err))
-		return nil
+	for _, config := range configs {
+		if err := m.startAnalyzer(config); err != nil {
+			m.logger.Error(fmt.Sprintf("Cannot start Query Analytics on %s: %s. Verify that the instance is running, "+
+				"then try again.", m.im.Name(config.Service, config.InstanceId), err))
+			continue
+		}
 	}
 
 	return nil // success
@@ -141,12 +149,18 @@ func (m *Manager) Stop() error {
 		return nil
 	}
 
-	for instanceId := range m.analyzers {
-		if err := m.stopAnalyzer(instanceId); err != nil {
+	for _, a := range m.analyzers {
+		config := a.analyzer.Config()
+		if err := m.stopAnalyzer(config.Service, config.InstanceId); err != nil {
 			m.logger.Error(err)
 		}
 	}
 
+	if m.backfillStopChan != nil {
+		close(m.backfillStopChan)
+		m.backfillStopChan = nil
+	}
+
 	m.running = false
 	m.logger.Info("Stopped")
 	m.status.Update("qan", "Stopped")
@@ -183,9 +197,9 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 		if err := m.startAnalyzer(config); err != nil {
 			return cmd.Reply(nil, err)
 		}
-		// Write qan.conf to disk so agent runs qan on restart.
-
-		if err := pct.Basedir.WriteConfig("qan", config); err != nil {
+		// Write qan-<service>-<id>.conf to disk so agent runs the analyzer
+		// on restart.
+		if err := pct.Basedir.WriteConfig(m.configName(config), config); err != nil {
 			return cmd.Reply(nil, err)
 		}
 		return cmd.Reply(nil) // success
@@ -195,23 +209,54 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 		if !m.running {
 			return cmd.Reply(nil, pct.ServiceIsNotRunningError{Service: "qan"})
 		}
+		// Stop only the analyzer for the given MySQL instance. If no instance
+		// is given (older API), stop all analyzers.
+		configs := []Config{}
+		if len(cmd.Data) > 0 {
+			config := Config{}
+			if err := json.Unmarshal(cmd.Data, &config); err != nil {
+				return cmd.Reply(nil, err)
+			}
+			configs = append(configs, config)
+		} else {
+			for _, a := range m.analyzers {
+				configs = append(configs, a.analyzer.Config())
+			}
+		}
 		errs := []error{}
-		for instanceId := range m.analyzers {
-			if err := m.stopAnalyzer(instanceId); err != nil {
+		for _, config := range configs {
+			if err := m.stopAnalyzer(config.Service, config.InstanceId); err != nil {
+				errs = append(errs, err)
+			}
+			// Remove the analyzer's config from disk so agent doesn't run
+			// it on restart.
+			if err := pct.Basedir.RemoveConfig(m.configName(config)); err != nil {
 				errs = append(errs, err)
 			}
-		}
-		// Remove qan.conf from disk so agent doesn't run qan on restart.
-		if err := pct.Basedir.RemoveConfig("qan"); err != nil {
-			errs = append(errs, err)
 		}
 		return cmd.Reply(nil, errs...)
+	case "SetConfig":
+		m.mux.Lock()
+		defer m.mux.Unlock()
+		if !m.running {
+			return cmd.Reply(nil, pct.ServiceIsNotRunningError{Service: "qan"})
+		}
+		newConfig, errs := m.handleSetConfig(cmd)
+		return cmd.Reply(newConfig, errs...)
+	case "Backfill":
+		m.mux.Lock()
+		defer m.mux.Unlock()
+		if !m.running {
+			return cmd.Reply(nil, pct.ServiceIsNotRunningError{Service: "qan"})
+		}
+		if err := m.startBackfill(cmd); err != nil {
+			return cmd.Reply(nil, err)
+		}
+		return cmd.Reply(nil) // success, backfill runs in background
 	case "GetConfig":
 		config, errs := m.GetConfig()
 		return cmd.Reply(config, errs...)
 	default:
-		// SetConfig does not work by design.  To re-configure QAN,
-		// stop it then start it again with the new config.
 		return cmd.Reply(nil, pct.UnknownCmdError{Cmd: cmd.Cmd})
 	}
 }
@@ -231,9 +276,13 @@ func (m *Manager) GetConfig() ([]proto.AgentConfig, []error) {
 			m.logger.Warn(err)
 			continue
 		}
+		config := a.analyzer.Config()
 		configs = append(configs, proto.AgentConfig{
 			InternalService: "qan",
-			// no external service
+			ExternalService: proto.ServiceInstance{
+				Service:    config.Service,
+				InstanceId: config.InstanceId,
+			},
 			Config:  string(bytes),
 			Running: true,
 		})
@@ -245,16 +294,40 @@ func ValidateConfig(config *Config) error {
 	if config.CollectFrom == "" {
 		// Before perf schema, CollectFrom didn't exist, so existing default QAN configs
 		// don't have it.  To be backwards-compatible, no CollectFrom == slowlog.
-		config.CollectFrom = "slowlog"
-	}
-	if config.CollectFrom != "slowlog" && config.CollectFrom != "perfschema" {
-		return fmt.Errorf("Invalid CollectFrom: '%s'.  Expected 'perfschema' or 'slowlog'.", config.CollectFrom)
+		if config.Service == "postgres" {
+			config.CollectFrom = "pg_stat_statements"
+		} else {
+			config.CollectFrom = "slowlog"
+		}
 	}
-	if config.Start == nil || len(config.Start) == 0 {
-		return errors.New("qan.Config.Start array is empty")
+	if (config.Service == "postgres") != (config.CollectFrom == "pg_stat_statements") {
+		return fmt.Errorf("Cannot collect from %s for %s", config.CollectFrom, config.Service)
 	}
-	if config.Stop == nil || len(config.Stop) == 0 {
-		return errors.New("qan.Config.Stop array is empty")
+	switch config.CollectFrom {
+	case "slowlog", "perfschema":
+		if config.Start == nil || len(config.Start) == 0 {
+			return errors.New("qan.Config.Start array is empty")
+		}
+		if config.Stop == nil || len(config.Stop) == 0 {
+			return errors.New("qan.Config.Stop array is empty")
+		}
+	case "pcap":
+		// MySQL doesn't need to be configured for pcap, so Start and Stop
+		// can be empty.
+		if config.PcapFiles == "" {
+			return errors.New("PcapFiles must be set")
+		}
+		if config.PcapPort == 0 {
+			config.PcapPort = 3306
+		}
+		if config.PcapPort > 65535 {
+			return errors.New("PcapPort must be <= 65535")
+		}
+	case "pg_stat_statements":
+		// Start can create the extension, but it's not required because
+		// the extension is usually created by the DBA.
+	default:
+		return fmt.Errorf("Invalid CollectFrom: '%s'.  Expected 'perfschema', 'slowlog', 'pcap', or 'pg_stat_statements'.", config.CollectFrom)
 	}
 	if config.MaxWorkers < 1 {
 		return errors.New("MaxWorkers must be > 0")
@@ -295,23 +368,43 @@ func (m *Manager) startAnalyzer(config Config) error {
 	}
 
 	// Check if an analyzer for this MySQL instance already exists.
-	if a, ok := m.analyzers[config.InstanceId]; ok {
+	if a, ok := m.analyzers[m.im.Name(config.Service, config.InstanceId)]; ok {
 		return pct.ServiceIsRunningError{Service: a.analyzer.String()}
 
 	}
 
-	// Get the MySQL DSN and create a MySQL connection.
-	mysqlInstance := proto.MySQLInstance{}
-	if err := m.im.Get(config.Service, config.InstanceId, &mysqlInstance); err != nil {
-		return fmt.Errorf("Cannot get MySQL instance from repo: %s", err)
-	}
-	mysqlConn := m.mysqlFactory.Make(mysqlInstance.DSN)
-
-	// Add the MySQL DSN to the MySQL restart monitor. If MySQL restarts,
-	// the analyzer will stop its worker and re-configure MySQL.
-	restartChan, err := m.mrm.Add(mysqlConn.DSN())
-	if err != nil {
-		return fmt.Errorf("Cannot add MySQL instance to restart monitor: %s", err)
+	var conn mysql.Connector
+	var restartChan chan *mrms.Event
+	switch config.Service {
+	case "postgres":
+		// Get the PostgreSQL DSN and create a PostgreSQL connection for the
+		// pg_stat_statements worker. The analyzer doesn't configure PostgreSQL;
+		// the worker runs the Start queries itself.
+		pgInstance := instance.PostgreSQLInstance{}
+		if err := m.im.Get(config.Service, config.InstanceId, &pgInstance); err != nil {
+			return fmt.Errorf("Cannot get PostgreSQL instance from repo: %s", err)
+		}
+		conn = postgres.NewConnection(pgInstance.DSN)
+		// The MySQL restart monitor doesn't monitor PostgreSQL, so restartChan
+		// is nil. pg_stat_statements doesn't need to be re-configured after
+		// a restart.
+	default:
+		// Get the MySQL DSN and create a MySQL connection.
+		mysqlInstance := proto.MySQLInstance{}
+		if err := m.im.Get(config.Service, config.InstanceId, &mysqlInstance); err != nil {
+			return fmt.Errorf("Cannot get MySQL instance from repo: %s", err)
+		}
+		conn = m.mysqlFactory.Make(mysqlInstance.DSN)
+
+		// Add the MySQL DSN to the MySQL restart monitor. If MySQL restarts,
+		// the analyzer will stop its worker and re-configure MySQL. Analyzers
+		// that don't configure MySQL, e.g. pcap, don't need MySQL to be up.
+		if ConfiguresMySQL(config) {
+			restartChan = make(chan *mrms.Event, 1)
+			if err := m.mrm.Subscribe(conn.DSN(), restartChan); err != nil {
+				return fmt.Errorf("Cannot add MySQL instance to restart monitor: %s", err)
+			}
+		}
 	}
 
 	// Make a chan on which the clock will tick at even intervals:
@@ -324,8 +417,8 @@ func (m *Manager) startAnalyzer(config Config) error {
 	// for each interval.
 	analyzer := m.analyzerFactory.Make(
 		config,
-		"qan-analyzer", // todo-1.1: append instance name
-		mysqlConn,
+		"qan-analyzer-"+m.im.Name(config.Service, config.InstanceId),
+		conn,
 		restartChan,
 		tickChan,
 	)
@@ -334,8 +427,8 @@ func (m *Manager) startAnalyzer(config Config) error {
 	}
 
 	// Save the new analyzer and its associated parts.
-	m.analyzers[config.InstanceId] = AnalyzerInstance{
-		mysqlConn:   mysqlConn,
+	m.analyzers[m.im.Name(config.Service, config.InstanceId)] = AnalyzerInstance{
+		mysqlConn:   conn,
 		restartChan: restartChan,
 		tickChan:    tickChan,
 		analyzer:    analyzer,
@@ -344,7 +437,186 @@ func (m *Manager) startAnalyzer(config Config) error {
 	return nil // success
 }
 
-func (m *Manager) stopAnalyzer(instanceId uint) error {
+func (m *Manager) handleSetConfig(cmd *proto.Cmd) (interface{}, []error) {
+	/*
+		XXX Assume caller has locked m.mux.
+	*/
+
+	m.logger.Debug("handleSetConfig:call")
+	defer m.logger.Debug("handleSetConfig:return")
+
+	newConfig := Config{}
+	if err := json.Unmarshal(cmd.Data, &newConfig); err != nil {
+		return nil, []error{err}
+	}
+	if err := ValidateConfig(&newConfig); err != nil {
+		return nil, []error{fmt.Errorf("Invalid qan.Config: %s", err)}
+	}
+
+	a, ok := m.analyzers[m.im.Name(newConfig.Service, newConfig.InstanceId)]
+	if !ok {
+		return nil, []error{fmt.Errorf("No analyzer for %s", m.im.Name(newConfig.Service, newConfig.InstanceId))}
+	}
+	oldConfig := a.analyzer.Config()
+
+	// The worker is made for a specific CollectFrom, so changing it requires
+	// a new analyzer. To do that, stop then start QAN with the new config.
+	if newConfig.CollectFrom != oldConfig.CollectFrom {
+		return nil, []error{fmt.Errorf("Cannot change CollectFrom from %s to %s while running",
+			oldConfig.CollectFrom, newConfig.CollectFrom)}
+	}
+
+	m.logger.Info(fmt.Sprintf("Setting %s config", a.analyzer))
+
+	// Re-register the tick chan so the clock ticks at the new interval.
+	// The analyzer's iter keeps reading the same chan.
+	if newConfig.Interval != oldConfig.Interval {
+		m.clock.Remove(a.tickChan)
+		m.clock.Add(a.tickChan, newConfig.Interval, true)
+	}
+
+	// The analyzer re-configures MySQL only if the Start queries changed.
+	// It can keep some values, e.g. MaxSlowLogSize from Percona Server.
+	a.analyzer.SetConfig(newConfig)
+	newConfig = a.analyzer.Config()
+
+	// Write the new config so agent uses it on restart. If this fails,
+	// agent will use the old config if restarted.
+	if err := pct.Basedir.WriteConfig(m.configName(newConfig), newConfig); err != nil {
+		return newConfig, []error{err}
+	}
+
+	return newConfig, nil // success
+}
+
+func (m *Manager) startBackfill(cmd *proto.Cmd) error {
+	/*
+		XXX Assume caller has locked m.mux.
+	*/
+
+	m.logger.Debug("startBackfill:call")
+	defer m.logger.Debug("startBackfill:return")
+
+	if m.backfiller == nil {
+		return errors.New("Backfill is not supported")
+	}
+	if m.backfillStopChan != nil {
+		return pct.ServiceIsRunningError{Service: "qan-backfill"}
+	}
+
+	config := BackfillConfig{}
+	if err := json.Unmarshal(cmd.Data, &config); err != nil {
+		return err
+	}
+	if config.Files == "" {
+		return errors.New("Files is empty")
+	}
+	if config.Interval == 0 || config.Interval > 3600 {
+		return errors.New("Interval must be > 0 and <= 3600 (1 hour)")
+	}
+
+	// The MySQL instance is needed for its timezone.
+	mysqlInstance := proto.MySQLInstance{}
+	if err := m.im.Get(config.Service, config.InstanceId, &mysqlInstance); err != nil {
+		return fmt.Errorf("Cannot get MySQL instance from repo: %s", err)
+	}
+	mysqlConn := m.mysqlFactory.Make(mysqlInstance.DSN)
+
+	m.backfillStopChan = make(chan bool)
+	go m.runBackfill(config, mysqlConn, m.backfillStopChan)
+
+	return nil
+}
+
+func (m *Manager) runBackfill(config BackfillConfig, mysqlConn mysql.Connector, stopChan chan bool) {
+	m.logger.Debug("runBackfill:call")
+	defer m.logger.Debug("runBackfill:return")
+
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("Backfill crashed: ", err)
+			m.status.Update("qan-backfill", "Crashed")
+		}
+		m.mux.Lock()
+		if m.backfillStopChan == stopChan {
+			m.backfillStopChan = nil
+		}
+		m.mux.Unlock()
+	}()
+
+	m.status.Update("qan-backfill", "Running "+config.Files)
+	if err := m.backfiller.Backfill(config, mysqlConn, stopChan); err != nil {
+		m.logger.Error("Backfill failed:", err)
+		m.status.Update("qan-backfill", "Failed "+config.Files+": "+err.Error())
+		return
+	}
+	m.status.Update("qan-backfill", "Done "+config.Files)
+}
+
+// configName returns the name of the analyzer's config file, e.g. qan-mysql-1.
+func (m *Manager) configName(config Config) string {
+	return "qan-" + m.im.Name(config.Service, config.InstanceId)
+}
+
+func (m *Manager) getConfigs() ([]Config, error) {
+	/*
+		XXX Assume caller has locked m.mux.
+	*/
+
+	m.logger.Debug("getConfigs:call")
+	defer m.logger.Debug("getConfigs:return")
+
+	configs := []Config{}
+	haveInstance := map[string]bool{} // keyed on instance name, e.g. mysql-1
+
+	glob := filepath.Join(pct.Basedir.Dir("config"), "qan-*.conf")
+	configFiles, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, err
+	}
+	for _, configFile := range configFiles {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			m.logger.Error("Read " + configFile + ": " + err.Error())
+			continue
+		}
+		config := Config{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			m.logger.Error("Decode " + configFile + ": " + err.Error())
+			continue
+		}
+		configs = append(configs, config)
+		haveInstance[m.im.Name(config.Service, config.InstanceId)] = true
+	}
+
+	// Agents < 1.1 wrote a single qan.conf. Convert it to qan-<service>-<id>.conf
+	// so it's handled like the others from now on.
+	config := Config{}
+	if err := pct.Basedir.ReadConfig("qan", &config); err != nil {
+		if !os.IsNotExist(err) {
+			m.logger.Error("Read qan config:", err)
+		}
+		return configs, nil
+	}
+	if config.Service == "" || config.InstanceId == 0 {
+		// Empty file or not a real config; ignore it.
+		return configs, nil
+	}
+	if !haveInstance[m.im.Name(config.Service, config.InstanceId)] {
+		configs = append(configs, config)
+		if err := pct.Basedir.WriteConfig(m.configName(config), config); err != nil {
+			// Keep qan.conf so the config isn't lost; try again next start.
+			m.logger.Warn("Cannot convert qan config:", err)
+			return configs, nil
+		}
+	}
+	if err := pct.Basedir.RemoveConfig("qan"); err != nil {
+		m.logger.Warn(err)
+	}
+	return configs, nil
+}
+
+func (m *Manager) stopAnalyzer(service string, instanceId uint) error {
 	/*
 		XXX Assume caller has locked m.mux.
 	*/
@@ -352,9 +624,10 @@ func (m *Manager) stopAnalyzer(instanceId uint) error {
 	m.logger.Debug("stopAnalyzer:call")
 	defer m.logger.Debug("stopAnalyzer:return")
 
-	a, ok := m.analyzers[instanceId]
+	name := m.im.Name(service, instanceId)
+	a, ok := m.analyzers[name]
 	if !ok {
-		m.logger.Debug("stopAnalyzer:na", instanceId)
+		m.logger.Debug("stopAnalyzer:na", name)
 		return nil
 	}
 
@@ -367,7 +640,9 @@ func (m *Manager) stopAnalyzer(instanceId uint) error {
 
 	// Stop watching this MySQL instance. Other tools watching this MySQL
 	// instance are not affected.
-	m.mrm.Remove(a.mysqlConn.DSN(), a.restartChan)
+	if a.restartChan != nil {
+		m.mrm.Unsubscribe(a.mysqlConn.DSN(), a.restartChan)
+	}
 
 	// Stop the analyzer. It stops its iter and worker and un-configures MySQL.
 	if err := a.analyzer.Stop(); err != nil {
@@ -375,9 +650,7 @@ func (m *Manager) stopAnalyzer(instanceId uint) error {
 	}
 
 	// Stop managing this analyzer.
-	delete(m.analyzers, instanceId)
-
-	// todo-1.1: remove the analyzer's config file?
+	delete(m.analyzers, name)
 
 	return nil // success
 }
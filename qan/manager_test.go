@@ -43,12 +43,13 @@ type ManagerTestSuite struct {
 	dataChan     chan interface{}
 	spool        *mock.Spooler
 	//workerFactory qan.WorkerFactory
-	clock         *mock.Clock
-	tmpDir        string
-	configDir     string
-	im            *instance.Repo
-	mysqlInstance proto.ServiceInstance
-	api           *mock.API
+	clock          *mock.Clock
+	tmpDir         string
+	configDir      string
+	im             *instance.Repo
+	mysqlInstance  proto.ServiceInstance
+	mysqlInstance2 proto.ServiceInstance
+	api            *mock.API
 }
 
 var _ = Suite(&ManagerTestSuite{})
@@ -83,6 +84,15 @@ func (s *ManagerTestSuite) SetUpSuite(t *C) {
 	s.im.Add("mysql", 1, data, false)
 	s.mysqlInstance = proto.ServiceInstance{Service: "mysql", InstanceId: 1}
 
+	data, err = json.Marshal(&proto.MySQLInstance{
+		Hostname: "bm-cloud-db01",
+		Alias:    "db01-3307",
+		DSN:      "user:pass@tcp(127.0.0.1:3307)/",
+	})
+	t.Assert(err, IsNil)
+	s.im.Add("mysql", 2, data, false)
+	s.mysqlInstance2 = proto.ServiceInstance{Service: "mysql", InstanceId: 2}
+
 	links := map[string]string{
 		"agent":     "http://localhost/agent",
 		"instances": "http://localhost/instances",
@@ -118,7 +128,7 @@ func (s *ManagerTestSuite) TestStarNoConfig(t *C) {
 	mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
 	a := mock.NewQanAnalyzer()
 	f := mock.NewQanAnalyzerFactory(a)
-	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f)
+	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, nil)
 	t.Assert(m, NotNil)
 
 	// qan.Manager should be able to start without a qan.conf, i.e. no analyzer.
@@ -157,7 +167,7 @@ func (s *ManagerTestSuite) TestStartWithConfig(t *C) {
 		mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
 		a := mock.NewQanAnalyzer()
 		f := mock.NewQanAnalyzerFactory(a)
-		m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f)
+		m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, nil)
 		t.Assert(m, NotNil)
 
 		// Write a realistic qan.conf config to disk.
@@ -177,10 +187,10 @@ func (s *ManagerTestSuite) TestStartWithConfig(t *C) {
 				mysql.Query{Set: "SET GLOBAL long_query_time=10"},
 			},
 		}
-		err := pct.Basedir.WriteConfig("qan", &config)
+		err := pct.Basedir.WriteConfig("qan-mysql-1", &config)
 		t.Assert(err, IsNil)
 
-		// qan.Start() reads qan.conf from disk and starts an analyzer for it.
+		// qan.Start() reads qan-mysql-1.conf from disk and starts an analyzer for it.
 		err = m.Start()
 		t.Check(err, IsNil)
 
@@ -201,10 +211,10 @@ func (s *ManagerTestSuite) TestStartWithConfig(t *C) {
 		} else {
 			t.Check(f.Args, HasLen, 1)
 			t.Check(f.Args[0].Config, DeepEquals, config)
-			t.Check(f.Args[0].Name, Equals, "qan-analyzer")
+			t.Check(f.Args[0].Name, Equals, "qan-analyzer-mysql-1")
 		}
 
-		// qan.Stop() stops the analyzer and leaves qan.conf on disk.
+		// qan.Stop() stops the analyzer and leaves qan-mysql-1.conf on disk.
 		err = m.Stop()
 		t.Assert(err, IsNil)
 
@@ -213,8 +223,8 @@ func (s *ManagerTestSuite) TestStartWithConfig(t *C) {
 			t.Fatal("Timeout waiting for <-a.StopChan")
 		}
 
-		// qan.conf still exists after qan.Stop().
-		t.Check(test.FileExists(pct.Basedir.ConfigFile("qan")), Equals, true)
+		// qan-mysql-1.conf still exists after qan.Stop().
+		t.Check(test.FileExists(pct.Basedir.ConfigFile("qan-mysql-1")), Equals, true)
 
 		// The analyzer is no longer reported in the status because it was stopped
 		// and removed when the manager was stopped.
@@ -228,7 +238,7 @@ func (s *ManagerTestSuite) TestGetConfig(t *C) {
 	mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
 	a := mock.NewQanAnalyzer()
 	f := mock.NewQanAnalyzerFactory(a)
-	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f)
+	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, nil)
 	t.Assert(m, NotNil)
 
 	// Write a realistic qan.conf config to disk.
@@ -248,7 +258,7 @@ func (s *ManagerTestSuite) TestGetConfig(t *C) {
 			mysql.Query{Set: "SET GLOBAL long_query_time=10"},
 		},
 	}
-	err := pct.Basedir.WriteConfig("qan", &config)
+	err := pct.Basedir.WriteConfig("qan-mysql-1", &config)
 	t.Assert(err, IsNil)
 
 	qanConfig, err := json.Marshal(config)
@@ -266,6 +276,7 @@ func (s *ManagerTestSuite) TestGetConfig(t *C) {
 	expect := []proto.AgentConfig{
 		{
 			InternalService: "qan",
+			ExternalService: s.mysqlInstance,
 			Config:          string(qanConfig),
 			Running:         true,
 		},
@@ -280,6 +291,89 @@ func (s *ManagerTestSuite) TestGetConfig(t *C) {
 	t.Assert(err, IsNil)
 }
 
+func (s *ManagerTestSuite) TestStartMultipleInstances(t *C) {
+	// Make a qan.Manager with mock factories and two mock analyzers.
+	mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
+	a1 := mock.NewQanAnalyzer()
+	a2 := mock.NewQanAnalyzer()
+	f := mock.NewQanAnalyzerFactory(a1, a2)
+	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, nil)
+	t.Assert(m, NotNil)
+
+	// Write one qan config per MySQL instance. The first is an old qan.conf
+	// which the manager should convert to qan-mysql-1.conf.
+	config1 := qan.Config{
+		ServiceInstance: s.mysqlInstance,
+		CollectFrom:     "slowlog",
+		Interval:        300,
+		MaxWorkers:      1,
+		WorkerRunTime:   600,
+		Start: []mysql.Query{
+			mysql.Query{Set: "SET GLOBAL slow_query_log=ON"},
+		},
+		Stop: []mysql.Query{
+			mysql.Query{Set: "SET GLOBAL slow_query_log=OFF"},
+		},
+	}
+	err := pct.Basedir.WriteConfig("qan", &config1)
+	t.Assert(err, IsNil)
+
+	config2 := config1
+	config2.ServiceInstance = s.mysqlInstance2
+	config2.CollectFrom = "perfschema"
+	err = pct.Basedir.WriteConfig("qan-mysql-2", &config2)
+	t.Assert(err, IsNil)
+
+	// qan.Start() should start an analyzer for each config.
+	err = m.Start()
+	t.Check(err, IsNil)
+	if !test.WaitState(a1.StartChan) {
+		t.Fatal("Timeout waiting for <-a1.StartChan")
+	}
+	if !test.WaitState(a2.StartChan) {
+		t.Fatal("Timeout waiting for <-a2.StartChan")
+	}
+	t.Assert(f.Args, HasLen, 2)
+	names := map[string]bool{}
+	for _, args := range f.Args {
+		names[args.Name] = true
+	}
+	t.Check(names, DeepEquals, map[string]bool{
+		"qan-analyzer-mysql-1": true,
+		"qan-analyzer-mysql-2": true,
+	})
+
+	// The old qan.conf was converted.
+	t.Check(test.FileExists(pct.Basedir.ConfigFile("qan")), Equals, false)
+	t.Check(test.FileExists(pct.Basedir.ConfigFile("qan-mysql-1")), Equals, true)
+
+	got, errs := m.GetConfig()
+	t.Check(errs, HasLen, 0)
+	t.Check(got, HasLen, 2)
+
+	// Stop only the second analyzer. The first should keep running.
+	qanConfig, _ := json.Marshal(config2)
+	cmd := &proto.Cmd{
+		Ts:      time.Now(),
+		Service: "qan",
+		Cmd:     "StopService",
+		Data:    qanConfig,
+	}
+	reply := m.Handle(cmd)
+	t.Assert(reply.Error, Equals, "")
+
+	// Only the second analyzer and its config were removed.
+	t.Check(test.FileExists(pct.Basedir.ConfigFile("qan-mysql-1")), Equals, true)
+	t.Check(test.FileExists(pct.Basedir.ConfigFile("qan-mysql-2")), Equals, false)
+	got, errs = m.GetConfig()
+	t.Check(errs, HasLen, 0)
+	t.Assert(got, HasLen, 1)
+	t.Check(got[0].ExternalService, DeepEquals, s.mysqlInstance)
+
+	err = m.Stop()
+	t.Assert(err, IsNil)
+}
+
 func (s *ManagerTestSuite) TestValidateConfig(t *C) {
 	config := qan.Config{
 		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 1},
@@ -345,6 +439,43 @@ func (s *ManagerTestSuite) TestValidateConfig(t *C) {
 	err = qan.ValidateConfig(&config)
 	t.Check(err, NotNil)
 	t.Check(config.CollectFrom, Equals, "slowlog")
+
+	// pcap doesn't need Start and Stop queries, but it needs files.
+	config = qan.Config{
+		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 1},
+		Interval:        300,
+		ExampleQueries:  true,
+		MaxWorkers:      1,
+		WorkerRunTime:   600,
+		CollectFrom:     "pcap",
+	}
+	err = qan.ValidateConfig(&config)
+	t.Check(err, NotNil)
+
+	config.PcapFiles = "/var/lib/pcap/mysql-*.pcap"
+	err = qan.ValidateConfig(&config)
+	t.Check(err, IsNil)
+	t.Check(config.PcapPort, Equals, uint(3306))
+
+	// PostgreSQL defaults to, and only has, pg_stat_statements.
+	config = qan.Config{
+		ServiceInstance: proto.ServiceInstance{Service: "postgres", InstanceId: 1},
+		Interval:        300,
+		MaxWorkers:      1,
+		WorkerRunTime:   600,
+	}
+	err = qan.ValidateConfig(&config)
+	t.Check(err, IsNil)
+	t.Check(config.CollectFrom, Equals, "pg_stat_statements")
+
+	config.CollectFrom = "slowlog"
+	err = qan.ValidateConfig(&config)
+	t.Check(err, NotNil)
+
+	config.Service = "mysql"
+	config.CollectFrom = "pg_stat_statements"
+	err = qan.ValidateConfig(&config)
+	t.Check(err, NotNil)
 }
 
 /*
@@ -356,7 +487,7 @@ func (s *ManagerTestSuite) TestStartService(t *C) {
 	mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
 	a := mock.NewQanAnalyzer()
 	f := mock.NewQanAnalyzerFactory(a)
-	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f)
+	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, nil)
 	t.Assert(m, NotNil)
 	err := m.Start()
 	t.Check(err, IsNil)
@@ -398,7 +529,7 @@ func (s *ManagerTestSuite) TestStartService(t *C) {
 	t.Assert(reply.Error, Equals, "")
 
 	// The manager writes the qan config to disk.
-	data, err := ioutil.ReadFile(pct.Basedir.ConfigFile("qan"))
+	data, err := ioutil.ReadFile(pct.Basedir.ConfigFile("qan-mysql-1"))
 	t.Check(err, IsNil)
 	gotConfig := &qan.Config{}
 	err = json.Unmarshal(data, gotConfig)
@@ -419,7 +550,6 @@ func (s *ManagerTestSuite) TestStartService(t *C) {
 	t.Check(reply.Error, Equals, "qan-analyzer service is running")
 
 	// Send a StopService cmd to stop the analyzer.
-	// todo-1.1: send Data with analyzer instance to stop.
 	now = time.Now()
 	cmd = &proto.Cmd{
 		User:      "daniel",
@@ -427,6 +557,7 @@ func (s *ManagerTestSuite) TestStartService(t *C) {
 		AgentUuid: "123",
 		Service:   "qan",
 		Cmd:       "StopService",
+		Data:      qanConfig,
 	}
 	reply = m.Handle(cmd)
 	t.Assert(reply.Error, Equals, "")
@@ -437,7 +568,7 @@ func (s *ManagerTestSuite) TestStartService(t *C) {
 
 	// And the manager has removed the qan config from disk so next time
 	// the agent starts the analyzer is not started.
-	t.Check(test.FileExists(pct.Basedir.ConfigFile("qan")), Equals, false)
+	t.Check(test.FileExists(pct.Basedir.ConfigFile("qan-mysql-1")), Equals, false)
 
 	// StopService should be idempotent, so send it again and expect no error.
 	reply = m.Handle(cmd)
@@ -448,11 +579,142 @@ func (s *ManagerTestSuite) TestStartService(t *C) {
 	t.Assert(err, IsNil)
 }
 
+func (s *ManagerTestSuite) TestSetConfig(t *C) {
+	// Make and start a qan.Manager with mock factories, no analyzer yet.
+	mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
+	a := mock.NewQanAnalyzer()
+	f := mock.NewQanAnalyzerFactory(a)
+	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, nil)
+	t.Assert(m, NotNil)
+	err := m.Start()
+	t.Check(err, IsNil)
+	defer m.Stop()
+	test.WaitStatus(1, m, "qan", "Running")
+
+	config := &qan.Config{
+		ServiceInstance: s.mysqlInstance,
+		Start: []mysql.Query{
+			mysql.Query{Set: "SET GLOBAL slow_query_log=ON"},
+		},
+		Stop: []mysql.Query{
+			mysql.Query{Set: "SET GLOBAL slow_query_log=OFF"},
+		},
+		Interval:      300,
+		MaxWorkers:    1,
+		WorkerRunTime: 600,
+		CollectFrom:   "slowlog",
+	}
+
+	// SetConfig requires a running analyzer for the instance.
+	qanConfig, _ := json.Marshal(config)
+	cmd := &proto.Cmd{
+		Ts:      time.Now(),
+		Service: "qan",
+		Cmd:     "SetConfig",
+		Data:    qanConfig,
+	}
+	reply := m.Handle(cmd)
+	t.Check(reply.Error, Not(Equals), "")
+
+	cmd.Cmd = "StartService"
+	reply = m.Handle(cmd)
+	t.Assert(reply.Error, Equals, "")
+	t.Check(s.clock.Added, DeepEquals, []uint{300})
+
+	// Change the interval and report limit.
+	config.Interval = 60
+	config.ReportLimit = 50
+	qanConfig, _ = json.Marshal(config)
+	cmd = &proto.Cmd{
+		Ts:      time.Now(),
+		Service: "qan",
+		Cmd:     "SetConfig",
+		Data:    qanConfig,
+	}
+	reply = m.Handle(cmd)
+	t.Assert(reply.Error, Equals, "")
+
+	// The analyzer was not stopped, it was given the new config.
+	select {
+	case <-a.StopChan:
+		t.Error("Analyzer.Stop() called")
+	default:
+	}
+	t.Check(a.Config(), DeepEquals, *config)
+
+	// The tick chan was re-registered at the new interval.
+	t.Check(s.clock.Removed, HasLen, 1)
+	t.Check(s.clock.Added, DeepEquals, []uint{300, 60})
+
+	// The new config was written to disk.
+	gotConfig := &qan.Config{}
+	err = pct.Basedir.ReadConfig("qan-mysql-1", gotConfig)
+	t.Check(err, IsNil)
+	if same, diff := IsDeeply(gotConfig, config); !same {
+		Dump(gotConfig)
+		t.Error(diff)
+	}
+
+	// CollectFrom cannot be changed while running.
+	config.CollectFrom = "perfschema"
+	qanConfig, _ = json.Marshal(config)
+	cmd.Data = qanConfig
+	reply = m.Handle(cmd)
+	t.Check(reply.Error, Not(Equals), "")
+}
+
+func (s *ManagerTestSuite) TestBackfill(t *C) {
+	mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
+	a := mock.NewQanAnalyzer()
+	f := mock.NewQanAnalyzerFactory(a)
+	b := mock.NewQanBackfiller()
+	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, b)
+	t.Assert(m, NotNil)
+	err := m.Start()
+	t.Check(err, IsNil)
+	defer m.Stop()
+	test.WaitStatus(1, m, "qan", "Running")
+
+	config := qan.BackfillConfig{
+		ServiceInstance: s.mysqlInstance,
+		Files:           "/var/log/mysql/slow.log*",
+		Interval:        300,
+		ExampleQueries:  true,
+	}
+	data, _ := json.Marshal(config)
+	cmd := &proto.Cmd{
+		Ts:      time.Now(),
+		Service: "qan",
+		Cmd:     "Backfill",
+		Data:    data,
+	}
+	reply := m.Handle(cmd)
+	t.Assert(reply.Error, Equals, "")
+
+	// The backfill runs in the background.
+	select {
+	case got := <-b.ConfigChan:
+		t.Check(got, DeepEquals, config)
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for Backfill()")
+	}
+	if !test.WaitStatus(1, m, "qan-backfill", "Done /var/log/mysql/slow.log*") {
+		t.Error("Backfill not done: ", m.Status()["qan-backfill"])
+	}
+
+	// No files, no backfill.
+	config.Files = ""
+	data, _ = json.Marshal(config)
+	cmd.Data = data
+	reply = m.Handle(cmd)
+	t.Check(reply.Error, Equals, "Files is empty")
+}
+
 func (s *ManagerTestSuite) TestBadCmd(t *C) {
 	mockConnFactory := &mock.ConnectionFactory{Conn: s.nullmysql}
 	a := mock.NewQanAnalyzer()
 	f := mock.NewQanAnalyzerFactory(a)
-	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f)
+	m := qan.NewManager(s.logger, s.clock, s.im, s.mrmsMonitor, mockConnFactory, f, nil)
 	t.Assert(m, NotNil)
 	err := m.Start()
 	t.Check(err, IsNil)
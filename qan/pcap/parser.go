@@ -0,0 +1,475 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/percona/go-mysql/log"
+)
+
+// MySQL client/server protocol: http://dev.mysql.com/doc/internals/en/client-server-protocol.html
+const (
+	COM_QUIT    = 0x01
+	COM_INIT_DB = 0x02
+	COM_QUERY   = 0x03
+
+	CLIENT_CONNECT_WITH_DB                = 0x00000008
+	CLIENT_PROTOCOL_41                    = 0x00000200
+	CLIENT_SSL                            = 0x00000800
+	CLIENT_SECURE_CONNECTION              = 0x00008000
+	CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA = 0x00200000
+
+	SERVER_MORE_RESULTS_EXISTS = 0x0008
+)
+
+// Max bytes buffered per direction per connection. A MySQL packet larger
+// than this, e.g. a huge INSERT, is skipped.
+const MAX_STREAM_BUFFER = 16 * 1024 * 1024
+
+// Response states of a query.
+const (
+	stateResponse = iota // waiting for OK, ERR, or result set column count
+	stateColumns         // reading column definitions
+	stateRows            // reading rows until EOF
+)
+
+// A Parser decodes MySQL queries from TCP packets in a pcap file into
+// log.Events like the slow log parser. It implements log.LogParser, so the
+// events are aggregated like slow log events. Only COM_QUERY is decoded;
+// prepared statements and SSL connections are ignored. Query_time is the time
+// from the query packet to the last packet of the response, so it includes
+// network time, unlike the slow log.
+type Parser struct {
+	r          *Reader
+	serverPort uint16
+	// --
+	eventChan chan *log.Event
+	stopChan  chan bool
+	stopOnce  *sync.Once
+	conns     map[string]*conn // keyed on client ip:port
+}
+
+func NewParser(r *Reader, serverPort uint16) *Parser {
+	p := &Parser{
+		r:          r,
+		serverPort: serverPort,
+		// --
+		eventChan: make(chan *log.Event),
+		stopChan:  make(chan bool),
+		stopOnce:  &sync.Once{},
+		conns:     make(map[string]*conn),
+	}
+	return p
+}
+
+func (p *Parser) EventChan() <-chan *log.Event {
+	return p.eventChan
+}
+
+func (p *Parser) Stop() {
+	p.stopOnce.Do(func() { close(p.stopChan) })
+}
+
+// Start parses all packets, sending events on the event chan, and returns
+// when done or stopped. The event chan is closed on return.
+func (p *Parser) Start() error {
+	defer close(p.eventChan)
+	for {
+		pkt, err := p.r.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if !p.packet(pkt) {
+			return nil // stopped
+		}
+	}
+	// Queries still waiting for the end of their response when the capture
+	// ended. They're reported with the time of the last packet received.
+	for key, c := range p.conns {
+		if !p.finishQuery(c) {
+			return nil // stopped
+		}
+		delete(p.conns, key)
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+type stream struct {
+	buf     []byte
+	nextSeq uint32
+	synced  bool
+}
+
+type query struct {
+	query     string
+	ts        time.Time
+	offset    uint64
+	lastTs    time.Time // of last response packet
+	responded bool
+	state     int
+	columns   uint64 // column definitions left to read
+	colEOF    bool   // EOF after column definitions
+	rowsSent  uint64
+	affected  uint64
+}
+
+type conn struct {
+	host      string
+	client    *stream
+	server    *stream
+	user      string
+	db        string
+	handshake bool // client has authenticated, or connection began mid-stream
+	ssl       bool
+	q         *query
+}
+
+// packet processes one TCP packet. It returns false if the parser was
+// stopped while sending an event.
+func (p *Parser) packet(pkt *Packet) bool {
+	var key, host string
+	fromClient := false
+	switch p.serverPort {
+	case pkt.DstPort:
+		fromClient = true
+		host = pkt.SrcIP.String()
+		key = fmt.Sprintf("%s:%d", host, pkt.SrcPort)
+	case pkt.SrcPort:
+		host = pkt.DstIP.String()
+		key = fmt.Sprintf("%s:%d", host, pkt.DstPort)
+	default:
+		return true // not MySQL
+	}
+
+	c, ok := p.conns[key]
+	if !ok {
+		c = &conn{
+			host:   host,
+			client: &stream{},
+			server: &stream{},
+			// If the capture began after the connection, we missed the
+			// handshake, so it's done.
+			handshake: !pkt.SYN,
+		}
+		p.conns[key] = c
+	}
+
+	if pkt.FIN || pkt.RST {
+		ok := p.finishQuery(c)
+		delete(p.conns, key)
+		return ok
+	}
+	if c.ssl {
+		return true // encrypted
+	}
+
+	s := c.server
+	if fromClient {
+		s = c.client
+	}
+	if gap := s.add(pkt); gap {
+		// Lost packets, so the response of the current query is unknown.
+		c.q = nil
+	}
+
+	for {
+		seq, payload, ok := s.next()
+		if !ok {
+			break
+		}
+		if fromClient {
+			if !p.clientPacket(c, pkt, seq, payload) {
+				return false
+			}
+		} else {
+			if !p.serverPacket(c, pkt, seq, payload) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *Parser) clientPacket(c *conn, pkt *Packet, seq byte, payload []byte) bool {
+	if !c.handshake {
+		if seq == 1 {
+			handshakeResponse(c, payload)
+		}
+		return true
+	}
+	if seq != 0 || len(payload) == 0 {
+		return true // not a command
+	}
+
+	// A new command means the previous query's response is done.
+	if !p.finishQuery(c) {
+		return false
+	}
+
+	switch payload[0] {
+	case COM_QUERY:
+		c.q = &query{
+			query:  string(payload[1:]),
+			ts:     pkt.Ts,
+			offset: pkt.Offset,
+		}
+	case COM_INIT_DB:
+		c.db = string(payload[1:])
+	case COM_QUIT:
+		c.q = nil
+	}
+	return true
+}
+
+func (p *Parser) serverPacket(c *conn, pkt *Packet, seq byte, payload []byte) bool {
+	if !c.handshake || c.q == nil || len(payload) == 0 {
+		return true
+	}
+	q := c.q
+	q.lastTs = pkt.Ts
+	q.responded = true
+
+	switch q.state {
+	case stateResponse:
+		switch payload[0] {
+		case 0x00: // OK
+			q.affected, _ = lenEncInt(payload[1:])
+			return p.finishQuery(c)
+		case 0xff: // ERR
+			return p.finishQuery(c)
+		case 0xfb: // LOCAL INFILE request, then OK or ERR
+		default:
+			q.columns, _ = lenEncInt(payload)
+			q.state = stateColumns
+		}
+	case stateColumns:
+		q.columns--
+		if q.columns == 0 {
+			q.state = stateRows
+		}
+	case stateRows:
+		if payload[0] == 0xff {
+			return p.finishQuery(c)
+		}
+		if payload[0] == 0xfe && len(payload) < 9 {
+			// EOF after the column definitions, unless CLIENT_DEPRECATE_EOF,
+			// or after the rows.
+			if q.rowsSent == 0 && !q.colEOF {
+				q.colEOF = true
+				return true
+			}
+			if len(payload) >= 5 && binary.LittleEndian.Uint16(payload[3:5])&SERVER_MORE_RESULTS_EXISTS != 0 {
+				q.state = stateResponse
+				q.colEOF = false
+				return true
+			}
+			return p.finishQuery(c)
+		}
+		q.rowsSent++
+	}
+	return true
+}
+
+// finishQuery sends the connection's current query, if any and it has a
+// response, as an event. It returns false if the parser was stopped.
+func (p *Parser) finishQuery(c *conn) bool {
+	q := c.q
+	c.q = nil
+	if q == nil || !q.responded {
+		return true
+	}
+	e := &log.Event{
+		Offset: q.offset,
+		Ts:     q.ts.Format("060102 15:04:05"), // UTC
+		Query:  q.query,
+		User:   c.user,
+		Host:   c.host,
+		Db:     c.db,
+		TimeMetrics: map[string]float32{
+			"Query_time": float32(q.lastTs.Sub(q.ts).Seconds()),
+		},
+		NumberMetrics: map[string]uint64{
+			"Rows_sent":     q.rowsSent,
+			"Rows_affected": q.affected,
+		},
+		BoolMetrics: map[string]bool{},
+	}
+	select {
+	case p.eventChan <- e:
+		return true
+	case <-p.stopChan:
+		return false
+	}
+}
+
+// handshakeResponse gets the user and db from the client's handshake
+// response (Protocol::HandshakeResponse41).
+func handshakeResponse(c *conn, payload []byte) {
+	c.handshake = true
+	if len(payload) < 32 {
+		return
+	}
+	capabilities := binary.LittleEndian.Uint32(payload[0:4])
+	if capabilities&CLIENT_PROTOCOL_41 == 0 {
+		return
+	}
+	if capabilities&CLIENT_SSL != 0 && len(payload) == 32 {
+		// SSL request; the real handshake response is encrypted.
+		c.ssl = true
+		return
+	}
+	rest := payload[32:]
+	user, rest, ok := nulString(rest)
+	if !ok {
+		return
+	}
+	c.user = user
+	if capabilities&CLIENT_CONNECT_WITH_DB == 0 {
+		return
+	}
+	var authLen uint64
+	switch {
+	case capabilities&CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA != 0:
+		var n int
+		authLen, n = lenEncInt(rest)
+		rest = rest[n:]
+	case capabilities&CLIENT_SECURE_CONNECTION != 0:
+		if len(rest) == 0 {
+			return
+		}
+		authLen = uint64(rest[0])
+		rest = rest[1:]
+	default:
+		_, rest, ok = nulString(rest)
+		if !ok {
+			return
+		}
+	}
+	if uint64(len(rest)) < authLen {
+		return
+	}
+	rest = rest[authLen:]
+	if db, _, ok := nulString(rest); ok {
+		c.db = db
+	}
+}
+
+// add adds the packet data to the stream, dropping retransmitted data. It
+// returns true if there's a gap, i.e. packets were lost, in which case the
+// stream restarts with this packet.
+func (s *stream) add(pkt *Packet) bool {
+	if pkt.SYN {
+		s.buf = nil
+		s.nextSeq = pkt.Seq + 1
+		s.synced = true
+		return false
+	}
+	if len(pkt.Data) == 0 {
+		return false
+	}
+	data := pkt.Data
+	gap := false
+	if !s.synced {
+		// The capture began mid-stream, so wait for a packet that looks
+		// like it begins with one complete MySQL packet, else we could
+		// start parsing in the middle of a MySQL packet.
+		if len(data) < 4 || 4+(int(data[0])|int(data[1])<<8|int(data[2])<<16) != len(data) {
+			return false
+		}
+		s.synced = true
+	} else if diff := int32(pkt.Seq - s.nextSeq); diff < 0 {
+		// Retransmission
+		if int(-diff) >= len(data) {
+			return false
+		}
+		data = data[-diff:]
+	} else if diff > 0 {
+		s.buf = nil
+		gap = true
+	}
+	s.nextSeq = pkt.Seq + uint32(len(pkt.Data))
+	if len(s.buf)+len(data) > MAX_STREAM_BUFFER {
+		s.buf = nil
+		return true
+	}
+	s.buf = append(s.buf, data...)
+	return gap
+}
+
+// next returns the next complete MySQL packet in the stream.
+func (s *stream) next() (byte, []byte, bool) {
+	if len(s.buf) < 4 {
+		return 0, nil, false
+	}
+	length := int(s.buf[0]) | int(s.buf[1])<<8 | int(s.buf[2])<<16
+	if len(s.buf) < 4+length {
+		return 0, nil, false
+	}
+	seq := s.buf[3]
+	payload := s.buf[4 : 4+length]
+	s.buf = s.buf[4+length:]
+	if len(s.buf) == 0 {
+		s.buf = nil // let the underlying array be freed
+	}
+	return seq, payload, true
+}
+
+// lenEncInt returns the length-encoded integer at the start of b and the
+// number of bytes it used.
+func lenEncInt(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] {
+	case 0xfc:
+		if len(b) < 3 {
+			return 0, len(b)
+		}
+		return uint64(binary.LittleEndian.Uint16(b[1:3])), 3
+	case 0xfd:
+		if len(b) < 4 {
+			return 0, len(b)
+		}
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+	case 0xfe:
+		if len(b) < 9 {
+			return 0, len(b)
+		}
+		return binary.LittleEndian.Uint64(b[1:9]), 9
+	}
+	return uint64(b[0]), 1
+}
+
+func nulString(b []byte) (string, []byte, bool) {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i]), b[i+1:], true
+		}
+	}
+	return "", b, false
+}
@@ -0,0 +1,252 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Link-layer header types: http://www.tcpdump.org/linktypes.html
+const (
+	LINKTYPE_NULL      = 0
+	LINKTYPE_ETHERNET  = 1
+	LINKTYPE_RAW       = 101
+	LINKTYPE_LINUX_SLL = 113
+)
+
+const (
+	PCAP_MAGIC    = 0xa1b2c3d4 // microsecond timestamps
+	PCAP_MAGIC_NS = 0xa1b23c4d // nanosecond timestamps
+	PCAPNG_MAGIC  = 0x0a0d0d0a
+)
+
+var ErrPcapNg = errors.New("pcapng files are not supported, use tcpdump -w or convert with editcap -F pcap")
+
+// A Packet is a TCP segment from a pcap file, i.e. the data and the parts of
+// the IP and TCP headers needed to reassemble the stream.
+type Packet struct {
+	Ts      time.Time
+	Offset  uint64 // of the pcap record in the file
+	SrcIP   net.IP
+	DstIP   net.IP
+	SrcPort uint16
+	DstPort uint16
+	Seq     uint32
+	SYN     bool
+	FIN     bool
+	RST     bool
+	Data    []byte
+}
+
+// A Reader reads TCP packets from a pcap file written by tcpdump -w. Only
+// the classic pcap format is supported, not pcapng.
+type Reader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nanosec  bool
+	linkType uint32
+	offset   uint64
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("Cannot read pcap file header: %s", err)
+	}
+	pr := &Reader{
+		r:      r,
+		offset: 24,
+	}
+	switch magic := binary.LittleEndian.Uint32(hdr[0:4]); magic {
+	case PCAP_MAGIC:
+		pr.order = binary.LittleEndian
+	case PCAP_MAGIC_NS:
+		pr.order = binary.LittleEndian
+		pr.nanosec = true
+	case PCAPNG_MAGIC:
+		return nil, ErrPcapNg
+	default:
+		switch binary.BigEndian.Uint32(hdr[0:4]) {
+		case PCAP_MAGIC:
+			pr.order = binary.BigEndian
+		case PCAP_MAGIC_NS:
+			pr.order = binary.BigEndian
+			pr.nanosec = true
+		default:
+			return nil, fmt.Errorf("Not a pcap file: invalid magic number 0x%x", magic)
+		}
+	}
+	pr.linkType = pr.order.Uint32(hdr[20:24])
+	switch pr.linkType {
+	case LINKTYPE_NULL, LINKTYPE_ETHERNET, LINKTYPE_RAW, LINKTYPE_LINUX_SLL:
+	default:
+		return nil, fmt.Errorf("Unsupported pcap link type: %d", pr.linkType)
+	}
+	return pr, nil
+}
+
+// Next returns the next TCP packet, skipping non-TCP packets, or io.EOF when
+// there are no more packets. A file truncated by tcpdump being killed returns
+// io.EOF, not an error.
+func (pr *Reader) Next() (*Packet, error) {
+	hdr := make([]byte, 16)
+	for {
+		offset := pr.offset
+		if _, err := io.ReadFull(pr.r, hdr); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		sec := pr.order.Uint32(hdr[0:4])
+		frac := pr.order.Uint32(hdr[4:8])
+		inclLen := pr.order.Uint32(hdr[8:12])
+		if inclLen > 256*1024 {
+			return nil, fmt.Errorf("Invalid pcap record at offset %d: length %d", offset, inclLen)
+		}
+		data := make([]byte, inclLen)
+		if _, err := io.ReadFull(pr.r, data); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		pr.offset += 16 + uint64(inclLen)
+
+		if !pr.nanosec {
+			frac *= 1000
+		}
+		p := &Packet{
+			Ts:     time.Unix(int64(sec), int64(frac)).UTC(),
+			Offset: offset,
+		}
+		if decodeLink(pr.linkType, data, p) {
+			return p, nil
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+
+func decodeLink(linkType uint32, data []byte, p *Packet) bool {
+	var etherType uint16
+	switch linkType {
+	case LINKTYPE_ETHERNET:
+		if len(data) < 14 {
+			return false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == 0x8100 && len(data) >= 4 { // 802.1Q VLAN
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case LINKTYPE_LINUX_SLL:
+		if len(data) < 16 {
+			return false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case LINKTYPE_NULL:
+		// 4-byte address family in host byte order of the capturing machine.
+		if len(data) < 4 {
+			return false
+		}
+		data = data[4:]
+		if len(data) > 0 && data[0]>>4 == 6 {
+			etherType = 0x86dd
+		} else {
+			etherType = 0x0800
+		}
+	case LINKTYPE_RAW:
+		if len(data) > 0 && data[0]>>4 == 6 {
+			etherType = 0x86dd
+		} else {
+			etherType = 0x0800
+		}
+	}
+	switch etherType {
+	case 0x0800:
+		return decodeIPv4(data, p)
+	case 0x86dd:
+		return decodeIPv6(data, p)
+	}
+	return false
+}
+
+func decodeIPv4(data []byte, p *Packet) bool {
+	if len(data) < 20 {
+		return false
+	}
+	ihl := int(data[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(data[2:4]))
+	if data[9] != 6 || ihl < 20 || totalLen < ihl || len(data) < ihl {
+		return false // not TCP or invalid
+	}
+	if flagsFrag := binary.BigEndian.Uint16(data[6:8]); flagsFrag&0x1fff != 0 {
+		return false // fragment, not the first
+	}
+	if totalLen < len(data) {
+		data = data[:totalLen] // Ethernet padding
+	}
+	p.SrcIP = net.IP(data[12:16])
+	p.DstIP = net.IP(data[16:20])
+	return decodeTCP(data[ihl:], p)
+}
+
+func decodeIPv6(data []byte, p *Packet) bool {
+	if len(data) < 40 {
+		return false
+	}
+	// Extension headers are not supported; they're rare for TCP.
+	if data[6] != 6 {
+		return false
+	}
+	payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+	p.SrcIP = net.IP(data[8:24])
+	p.DstIP = net.IP(data[24:40])
+	data = data[40:]
+	if payloadLen < len(data) {
+		data = data[:payloadLen]
+	}
+	return decodeTCP(data, p)
+}
+
+func decodeTCP(data []byte, p *Packet) bool {
+	if len(data) < 20 {
+		return false
+	}
+	dataOffset := int(data[12]>>4) * 4
+	if dataOffset < 20 || len(data) < dataOffset {
+		return false
+	}
+	p.SrcPort = binary.BigEndian.Uint16(data[0:2])
+	p.DstPort = binary.BigEndian.Uint16(data[2:4])
+	p.Seq = binary.BigEndian.Uint32(data[4:8])
+	flags := data[13]
+	p.FIN = flags&0x01 != 0
+	p.SYN = flags&0x02 != 0
+	p.RST = flags&0x04 != 0
+	p.Data = data[dataOffset:]
+	return true
+}
@@ -0,0 +1,366 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pcap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/go-mysql/log"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/qan"
+	"github.com/percona/percona-agent/qan/pcap"
+	"github.com/percona/percona-agent/test"
+	"github.com/percona/percona-agent/test/mock"
+	"github.com/percona/percona-agent/ticker"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+var (
+	client = net.IPv4(10, 0, 0, 2).To4()
+	server = net.IPv4(10, 0, 0, 1).To4()
+)
+
+const (
+	clientPort = 50000
+	serverPort = 3306
+	SYN        = 0x02
+	FIN        = 0x01
+	ACK        = 0x10
+)
+
+// pcapWriter writes a pcap file of Ethernet/IPv4/TCP packets like tcpdump -w.
+type pcapWriter struct {
+	buf       bytes.Buffer
+	clientSeq uint32
+	serverSeq uint32
+}
+
+func newPcapWriter() *pcapWriter {
+	w := &pcapWriter{
+		clientSeq: 1000,
+		serverSeq: 5000,
+	}
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:4], pcap.PCAP_MAGIC)
+	binary.LittleEndian.PutUint16(hdr[4:6], 2)
+	binary.LittleEndian.PutUint16(hdr[6:8], 4)
+	binary.LittleEndian.PutUint32(hdr[16:20], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:24], pcap.LINKTYPE_ETHERNET)
+	w.buf.Write(hdr)
+	return w
+}
+
+// packet writes a TCP packet from the client if fromClient, else from the
+// server, and advances the sender's sequence number.
+func (w *pcapWriter) packet(ts time.Time, fromClient bool, flags byte, data []byte) {
+	srcIP, dstIP := server, client
+	srcPort, dstPort := uint16(serverPort), uint16(clientPort)
+	seq := &w.serverSeq
+	if fromClient {
+		srcIP, dstIP = client, server
+		srcPort, dstPort = clientPort, serverPort
+		seq = &w.clientSeq
+	}
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:2], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:4], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:8], *seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	tcp = append(tcp, data...)
+	if flags&(SYN|FIN) != 0 {
+		*seq++
+	}
+	*seq += uint32(len(data))
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+	ip[8] = 64
+	ip[9] = 6
+	copy(ip[12:16], srcIP)
+	copy(ip[16:20], dstIP)
+	ip = append(ip, tcp...)
+
+	eth := make([]byte, 14)
+	binary.BigEndian.PutUint16(eth[12:14], 0x0800)
+	eth = append(eth, ip...)
+
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:8], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:12], uint32(len(eth)))
+	binary.LittleEndian.PutUint32(rec[12:16], uint32(len(eth)))
+	w.buf.Write(rec)
+	w.buf.Write(eth)
+}
+
+// retransmit writes the last n bytes sent by the client again.
+func (w *pcapWriter) retransmit(ts time.Time, data []byte) {
+	w.clientSeq -= uint32(len(data))
+	w.packet(ts, true, ACK, data)
+}
+
+func mysqlPackets(seq byte, payloads ...[]byte) []byte {
+	buf := []byte{}
+	for _, payload := range payloads {
+		n := len(payload)
+		buf = append(buf, byte(n), byte(n>>8), byte(n>>16), seq)
+		buf = append(buf, payload...)
+		seq++
+	}
+	return buf
+}
+
+func comQuery(query string) []byte {
+	return mysqlPackets(0, append([]byte{pcap.COM_QUERY}, query...))
+}
+
+// writeSession writes a connection which runs a SELECT that takes 0.5s and
+// returns 2 rows, then an UPDATE that takes 0.25s and affects 1 row.
+func writeSession(w *pcapWriter, t0 time.Time) {
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+
+	w.packet(ms(0), true, SYN, nil)
+	w.packet(ms(0), false, SYN|ACK, nil)
+
+	// Server greeting; only its sequence number matters.
+	w.packet(ms(1), false, ACK, mysqlPackets(0, append([]byte{0x0a}, "5.6.24\x00"...)))
+
+	// Handshake response: user "app", 20-byte auth response, db "sakila".
+	caps := uint32(pcap.CLIENT_PROTOCOL_41 | pcap.CLIENT_SECURE_CONNECTION | pcap.CLIENT_CONNECT_WITH_DB)
+	hr := make([]byte, 32)
+	binary.LittleEndian.PutUint32(hr[0:4], caps)
+	hr = append(hr, "app\x00"...)
+	hr = append(hr, 20)
+	hr = append(hr, make([]byte, 20)...)
+	hr = append(hr, "sakila\x00"...)
+	w.packet(ms(2), true, ACK, mysqlPackets(1, hr))
+	w.packet(ms(3), false, ACK, mysqlPackets(2, []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}))
+
+	// SELECT: column count, column def, EOF, 2 rows, EOF.
+	w.packet(ms(100), true, ACK, comQuery("SELECT * FROM film WHERE film_id = 10"))
+	w.packet(ms(600), false, ACK, mysqlPackets(1,
+		[]byte{0x01},
+		[]byte("\x03def\x06sakila\x04film\x04film\x07film_id\x07film_id"),
+		[]byte{0xfe, 0x00, 0x00, 0x02, 0x00},
+		[]byte("\x0210"),
+		[]byte("\x0211"),
+		[]byte{0xfe, 0x00, 0x00, 0x02, 0x00},
+	))
+
+	// UPDATE, retransmitted once, then OK with 1 affected row.
+	update := comQuery("UPDATE film SET title = 'x' WHERE film_id = 20")
+	w.packet(ms(1000), true, ACK, update)
+	w.retransmit(ms(1200), update)
+	w.packet(ms(1250), false, ACK, mysqlPackets(1, []byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00}))
+
+	w.packet(ms(2000), true, ACK, mysqlPackets(0, []byte{pcap.COM_QUIT}))
+	w.packet(ms(2000), true, FIN|ACK, nil)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Parser test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type ParserTestSuite struct{}
+
+var _ = Suite(&ParserTestSuite{})
+
+func (s *ParserTestSuite) TestParser(t *C) {
+	t0 := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	w := newPcapWriter()
+	writeSession(w, t0)
+
+	r, err := pcap.NewReader(bytes.NewReader(w.buf.Bytes()))
+	t.Assert(err, IsNil)
+	p := pcap.NewParser(r, serverPort)
+	doneChan := make(chan error, 1)
+	go func() {
+		doneChan <- p.Start()
+	}()
+	events := []*log.Event{}
+	for e := range p.EventChan() {
+		events = append(events, e)
+	}
+	t.Check(<-doneChan, IsNil)
+
+	t.Assert(events, HasLen, 2)
+
+	e := events[0]
+	t.Check(e.Query, Equals, "SELECT * FROM film WHERE film_id = 10")
+	t.Check(e.Ts, Equals, "150601 12:00:00")
+	t.Check(e.User, Equals, "app")
+	t.Check(e.Host, Equals, "10.0.0.2")
+	t.Check(e.Db, Equals, "sakila")
+	t.Check(e.TimeMetrics["Query_time"], Equals, float32(0.5))
+	t.Check(e.NumberMetrics["Rows_sent"], Equals, uint64(2))
+
+	e = events[1]
+	t.Check(e.Query, Equals, "UPDATE film SET title = 'x' WHERE film_id = 20")
+	t.Check(e.Ts, Equals, "150601 12:00:01")
+	t.Check(e.TimeMetrics["Query_time"], Equals, float32(0.25))
+	t.Check(e.NumberMetrics["Rows_sent"], Equals, uint64(0))
+	t.Check(e.NumberMetrics["Rows_affected"], Equals, uint64(1))
+}
+
+func (s *ParserTestSuite) TestNotPcap(t *C) {
+	_, err := pcap.NewReader(bytes.NewReader([]byte("# Time: 071015 21:43:52\n# User@Host: root[root] @ localhost []\n")))
+	t.Check(err, NotNil)
+
+	// pcapng
+	_, err = pcap.NewReader(bytes.NewReader([]byte{0x0a, 0x0d, 0x0d, 0x0a, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}))
+	t.Check(err, Equals, pcap.ErrPcapNg)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Worker test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type WorkerTestSuite struct {
+	logChan  chan *proto.LogEntry
+	logger   *pct.Logger
+	tmpDir   string
+	dataChan chan interface{}
+	spool    *mock.Spooler
+}
+
+var _ = Suite(&WorkerTestSuite{})
+
+func (s *WorkerTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 100)
+	s.logger = pct.NewLogger(s.logChan, "qan-worker")
+	s.dataChan = make(chan interface{}, 10)
+}
+
+func (s *WorkerTestSuite) SetUpTest(t *C) {
+	var err error
+	s.tmpDir, err = ioutil.TempDir("/tmp", "pct-qan-pcap")
+	t.Assert(err, IsNil)
+	if err := pct.Basedir.Init(s.tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	s.spool = mock.NewSpooler(s.dataChan)
+}
+
+func (s *WorkerTestSuite) TearDownTest(t *C) {
+	if err := os.RemoveAll(s.tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
+func (s *WorkerTestSuite) TestWorker(t *C) {
+	// Two files like tcpdump -G 60 writes, and the last file which tcpdump is
+	// still writing. Each file has one session in its own minute.
+	begin := ticker.Began(60, uint(time.Now().Unix())).Add(-5 * time.Minute)
+	minute := func(n int) time.Time { return begin.Add(time.Duration(n) * time.Minute) }
+	files := []string{"mysql-1.pcap", "mysql-2.pcap", "mysql-3.pcap"}
+	for i, file := range files {
+		w := newPcapWriter()
+		writeSession(w, minute(i).Add(10*time.Second))
+		file = filepath.Join(s.tmpDir, file)
+		err := ioutil.WriteFile(file, w.buf.Bytes(), 0644)
+		t.Assert(err, IsNil)
+		mtime := minute(i + 1)
+		if i == 2 {
+			mtime = minute(1).Add(1 * time.Second)
+		}
+		err = os.Chtimes(file, mtime, mtime)
+		t.Assert(err, IsNil)
+	}
+
+	config := qan.Config{
+		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 1},
+		CollectFrom:     "pcap",
+		PcapFiles:       filepath.Join(s.tmpDir, "mysql-*.pcap"),
+		PcapPort:        serverPort,
+		Interval:        60,
+		WorkerRunTime:   60,
+		ExampleQueries:  true,
+	}
+	w := pcap.NewWorker(s.logger, config, s.spool)
+	w.ZeroRunTime = true
+
+	// The first 2 files are done. Events in the current interval are returned,
+	// and events in the previous interval are spooled.
+	err := w.Setup(&qan.Interval{Number: 1, StartTime: minute(1), StopTime: minute(2)})
+	t.Assert(err, IsNil)
+	res, err := w.Run()
+	t.Assert(err, IsNil)
+	t.Assert(res, NotNil)
+	t.Check(res.Error, Equals, "")
+	t.Check(res.Global.TotalQueries, Equals, uint64(2))
+	t.Check(res.Class, HasLen, 2)
+	t.Check(res.Histogram, HasLen, 2)
+	for _, class := range res.Class {
+		t.Check(class.TotalQueries, Equals, uint64(1))
+		t.Check(class.Example, NotNil)
+	}
+	err = w.Cleanup()
+	t.Assert(err, IsNil)
+
+	reports := test.WaitData(s.dataChan)
+	t.Assert(reports, HasLen, 1)
+	report := reports[0].(*qan.Report)
+	t.Check(report.StartTs, Equals, minute(0).UTC())
+	t.Check(report.EndTs, Equals, minute(1).UTC())
+	t.Check(report.Global.TotalQueries, Equals, uint64(2))
+
+	// Next interval, the 3rd file is done, and the first 2 aren't parsed again.
+	err = w.Setup(&qan.Interval{Number: 2, StartTime: minute(2), StopTime: minute(3)})
+	t.Assert(err, IsNil)
+	res, err = w.Run()
+	t.Assert(err, IsNil)
+	t.Assert(res, NotNil)
+	t.Check(res.Global.TotalQueries, Equals, uint64(2))
+	err = w.Cleanup()
+	t.Assert(err, IsNil)
+	t.Check(test.WaitData(s.dataChan), HasLen, 0)
+
+	// Nothing new, not even after a restart because parsed files are saved.
+	w = pcap.NewWorker(s.logger, config, s.spool)
+	err = w.Setup(&qan.Interval{Number: 3, StartTime: minute(3), StopTime: minute(4)})
+	t.Assert(err, IsNil)
+	res, err = w.Run()
+	t.Assert(err, IsNil)
+	t.Check(res, IsNil)
+
+	// tcpdump -W reuses file names, so a rewritten file is parsed again.
+	// Its events aren't in the current interval, so they're spooled.
+	mtime := minute(3).Add(1 * time.Second)
+	err = os.Chtimes(filepath.Join(s.tmpDir, files[0]), mtime, mtime)
+	t.Assert(err, IsNil)
+	err = w.Setup(&qan.Interval{Number: 4, StartTime: minute(4), StopTime: minute(5)})
+	t.Assert(err, IsNil)
+	res, err = w.Run()
+	t.Assert(err, IsNil)
+	t.Check(res, IsNil)
+	t.Check(test.WaitData(s.dataChan), HasLen, 1)
+}
@@ -0,0 +1,454 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pcap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/go-mysql/event"
+	"github.com/percona/go-mysql/query"
+	"github.com/percona/percona-agent/data"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/qan"
+	"github.com/percona/percona-agent/ticker"
+)
+
+// Times to retry spooling a report for a past interval before it's lost.
+// A capture file can span many intervals, so the spool can be busy.
+const SPOOL_TRIES = 10
+
+type WorkerFactory interface {
+	Make(name string, config qan.Config) *Worker
+}
+
+type RealWorkerFactory struct {
+	logChan chan *proto.LogEntry
+	spool   data.Spooler
+}
+
+func NewRealWorkerFactory(logChan chan *proto.LogEntry, spool data.Spooler) *RealWorkerFactory {
+	f := &RealWorkerFactory{
+		logChan: logChan,
+		spool:   spool,
+	}
+	return f
+}
+
+func (f *RealWorkerFactory) Make(name string, config qan.Config) *Worker {
+	return NewWorker(pct.NewLogger(f.logChan, name), config, f.spool)
+}
+
+// --------------------------------------------------------------------------
+
+// A Worker parses pcap files matching qan.Config.PcapFiles, e.g. written by
+// tcpdump -w -G, into a qan.Result. Each interval it parses the files it
+// hasn't parsed yet which are complete, i.e. tcpdump isn't writing them.
+// Like a slow log backfill, events are put in intervals by packet time: the
+// result for the current interval is returned, and reports for other
+// intervals are spooled directly.
+type Worker struct {
+	logger *pct.Logger
+	config qan.Config
+	spool  data.Spooler
+	// --
+	ZeroRunTime bool // testing
+	// --
+	name     string
+	status   *pct.Status
+	sync     *pct.SyncChan
+	running  bool
+	interval *qan.Interval
+	parsed   map[string]int64 // files already parsed => mod time (Unix ns)
+}
+
+func NewWorker(logger *pct.Logger, config qan.Config, spool data.Spooler) *Worker {
+	// Fingerprint like the slow log worker.
+	query.ReplaceNumbersInWords = true
+
+	name := logger.Service()
+	w := &Worker{
+		logger: logger,
+		config: config,
+		spool:  spool,
+		// --
+		name:   name,
+		status: pct.NewStatus([]string{name}),
+		sync:   pct.NewSyncChan(),
+	}
+
+	// Files parsed before the agent restarted are not parsed again.
+	parsed, err := readParsed(w.parsedFile())
+	if err != nil {
+		logger.Warn("Read parsed pcap files: " + err.Error())
+	}
+	w.parsed = parsed
+
+	return w
+}
+
+func (w *Worker) Setup(interval *qan.Interval) error {
+	w.logger.Debug("Setup:call")
+	defer w.logger.Debug("Setup:return")
+	w.interval = interval
+	return nil
+}
+
+func (w *Worker) Run() (*qan.Result, error) {
+	w.logger.Debug("Run:call")
+	defer w.logger.Debug("Run:return")
+
+	defer w.status.Update(w.name, "Idle")
+
+	stopped := false
+	w.running = true
+	defer func() {
+		if stopped {
+			w.sync.Done()
+		}
+		w.running = false
+	}()
+
+	files, err := w.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	t0 := time.Now()
+	runTime := time.Duration(w.config.WorkerRunTime) * time.Second
+	errMsg := ""
+
+	buckets := make(map[int64]*bucket) // keyed on interval start (Unix ts)
+	nEvents := 0
+
+FILE_LOOP:
+	for _, file := range files {
+		w.status.Update(w.name, "Parsing "+file)
+		p, f, err := w.openFile(file)
+		if err != nil {
+			// Don't try again; the file is probably not a pcap file.
+			w.logger.Warn(err)
+			w.markParsed(file)
+			continue
+		}
+		parserErrChan := make(chan error, 1)
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					parserErrChan <- fmt.Errorf("pcap parser for %s crashed: %s", file, err)
+				}
+			}()
+			parserErrChan <- p.Start()
+		}()
+
+		for e := range p.EventChan() {
+			select {
+			case <-w.sync.StopChan:
+				w.logger.Debug("Run:stop")
+				stopped = true
+				p.Stop()
+				f.Close()
+				break FILE_LOOP
+			default:
+			}
+
+			// Packet timestamps are UTC.
+			ts, err := time.Parse("060102 15:04:05", e.Ts)
+			if err != nil {
+				w.logger.Warn(fmt.Sprintf("Invalid timestamp in %s: %s", file, err))
+				continue
+			}
+			fp, err := fingerprint(e.Query)
+			if err != nil {
+				w.logger.Warn(fmt.Sprintf("Cannot fingerprint '%s': %s", e.Query, err))
+				continue
+			}
+			id := query.Id(fp)
+			b := w.bucket(buckets, ts)
+			b.a.AddEvent(e, id, fp)
+			h, ok := b.histograms[id]
+			if !ok {
+				h = qan.NewHistogram()
+				b.histograms[id] = h
+			}
+			h.Add(float64(e.TimeMetrics["Query_time"]))
+			nEvents++
+		}
+		f.Close()
+		w.markParsed(file)
+		if err := <-parserErrChan; err != nil {
+			// Events before the error are still reported.
+			w.logger.Warn(err)
+			errMsg = err.Error()
+		}
+
+		// Stop if runtime exceeded. The remaining files are parsed next interval.
+		if time.Now().Sub(t0) >= runTime {
+			errMsg = fmt.Sprintf("Timeout parsing %s", file)
+			w.logger.Warn(errMsg)
+			break FILE_LOOP
+		}
+	}
+
+	w.status.Update(w.name, "Finalizing")
+	w.logger.Info(fmt.Sprintf("Parsed %d queries in %d files", nEvents, len(files)))
+
+	// Return the current interval's result, if any, and spool the others.
+	var result *qan.Result
+	starts := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	sort.Sort(int64s(starts))
+	for _, start := range starts {
+		b := buckets[start]
+		r := b.result()
+		r.Error = errMsg
+		if !w.ZeroRunTime {
+			r.RunTime = time.Now().Sub(t0).Seconds()
+		}
+		if w.interval != nil && b.interval.StartTime.Equal(w.interval.StartTime) {
+			result = r
+			continue
+		}
+		w.report(&b.interval, r)
+	}
+
+	if err := writeParsed(w.parsedFile(), w.parsed); err != nil {
+		w.logger.Warn("Write parsed pcap files: " + err.Error())
+	}
+
+	return result, nil
+}
+
+func (w *Worker) Stop() error {
+	w.logger.Debug("Stop:call")
+	defer w.logger.Debug("Stop:return")
+	if w.running {
+		w.sync.Stop()
+		w.sync.Wait()
+	}
+	return nil
+}
+
+func (w *Worker) Cleanup() error {
+	w.logger.Debug("Cleanup:call")
+	defer w.logger.Debug("Cleanup:return")
+	// Forget parsed files that were removed, e.g. by tcpdump -W, so the
+	// map doesn't grow forever.
+	n := len(w.parsed)
+	for file := range w.parsed {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			delete(w.parsed, file)
+		}
+	}
+	if len(w.parsed) != n {
+		if err := writeParsed(w.parsedFile(), w.parsed); err != nil {
+			w.logger.Warn("Write parsed pcap files: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (w *Worker) Status() map[string]string {
+	return w.status.All()
+}
+
+func (w *Worker) SetConfig(config qan.Config) {
+	w.config = config
+}
+
+// --------------------------------------------------------------------------
+
+// files returns the files to parse, oldest first. The newest file is
+// skipped if it was modified during the interval because tcpdump is probably
+// still writing it.
+func (w *Worker) files() ([]string, error) {
+	matches, err := filepath.Glob(w.config.PcapFiles)
+	if err != nil {
+		return nil, err
+	}
+	files := []pcapFile{}
+	for _, file := range matches {
+		fi, err := os.Stat(file)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		// tcpdump -W reuses file names, so a file with a new mod time is new.
+		if modTime, ok := w.parsed[file]; ok && modTime == fi.ModTime().UnixNano() {
+			continue
+		}
+		files = append(files, pcapFile{file, fi.ModTime()})
+	}
+	sort.Sort(byModTime(files))
+	if n := len(files); n > 0 && w.interval != nil && files[n-1].modTime.After(w.interval.StartTime) {
+		files = files[0 : n-1]
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+func (w *Worker) openFile(file string) (*Parser, *os.File, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %s", file, err)
+	}
+	port := w.config.PcapPort
+	if port == 0 {
+		port = 3306
+	}
+	return NewParser(r, uint16(port)), f, nil
+}
+
+func (w *Worker) markParsed(file string) {
+	var modTime int64
+	if fi, err := os.Stat(file); err == nil {
+		modTime = fi.ModTime().UnixNano()
+	}
+	w.parsed[file] = modTime
+}
+
+// bucket returns the bucket for the interval that ts is in, making it if needed.
+func (w *Worker) bucket(buckets map[int64]*bucket, ts time.Time) *bucket {
+	began := ticker.Began(w.config.Interval, uint(ts.Unix()))
+	b, ok := buckets[began.Unix()]
+	if !ok {
+		b = &bucket{
+			interval: qan.Interval{
+				StartTime: began,
+				StopTime:  began.Add(time.Duration(w.config.Interval) * time.Second),
+			},
+			// Packet timestamps are UTC, so there's no UTC offset.
+			a:          event.NewEventAggregator(w.config.ExampleQueries, 0),
+			histograms: make(map[string]*qan.Histogram),
+		}
+		buckets[began.Unix()] = b
+	}
+	return b
+}
+
+// report spools the result for a past interval like the analyzer does for
+// the current interval.
+func (w *Worker) report(interval *qan.Interval, result *qan.Result) {
+	report := qan.MakeReport(w.config, interval, result)
+	for try := 1; try <= SPOOL_TRIES; try++ {
+		err := w.spool.Write("qan", report)
+		if err == nil {
+			w.logger.Debug("report:", interval.String())
+			return
+		}
+		if err != data.ErrSpoolTimeout || try == SPOOL_TRIES {
+			w.logger.Warn("Lost report:", err)
+			return
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// parsedFile is where the parsed files are saved. It's not a .conf file so
+// the manager doesn't try to start it as an analyzer.
+func (w *Worker) parsedFile() string {
+	return filepath.Join(pct.Basedir.Dir("config"), w.name+".parsed")
+}
+
+func readParsed(file string) (map[string]int64, error) {
+	parsed := make(map[string]int64)
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return parsed, nil
+		}
+		return parsed, err
+	}
+	if err := json.Unmarshal(buf, &parsed); err != nil {
+		return make(map[string]int64), err
+	}
+	return parsed, nil
+}
+
+func writeParsed(file string, parsed map[string]int64) error {
+	buf, err := json.Marshal(parsed)
+	if err != nil {
+		return err
+	}
+	return pct.WriteFileAtomic(file, buf, 0600)
+}
+
+func fingerprint(q string) (f string, err error) {
+	// Don't let one bad query stop parsing.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+	return query.Fingerprint(q), nil
+}
+
+type pcapFile struct {
+	name    string
+	modTime time.Time
+}
+
+type byModTime []pcapFile
+
+func (a byModTime) Len() int           { return len(a) }
+func (a byModTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byModTime) Less(i, j int) bool { return a[i].modTime.Before(a[j].modTime) }
+
+// A bucket aggregates the events in one interval by packet time.
+type bucket struct {
+	interval   qan.Interval
+	a          *event.EventAggregator
+	histograms map[string]*qan.Histogram
+}
+
+func (b *bucket) result() *qan.Result {
+	r := b.a.Finalize()
+	classes := make([]*event.QueryClass, 0, len(r.Class))
+	for _, class := range r.Class {
+		classes = append(classes, class)
+	}
+	return &qan.Result{
+		Global:    r.Global,
+		Class:     classes,
+		Histogram: b.histograms,
+	}
+}
+
+type int64s []int64
+
+func (a int64s) Len() int           { return len(a) }
+func (a int64s) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a int64s) Less(i, j int) bool { return a[i] < a[j] }
@@ -120,6 +120,25 @@ func makeGetRowsFunc(iters [][]*perfschema.DigestRow) perfschema.GetDigestRowsFu
 	}
 }
 
+func makeGetHistoryFunc(iters [][]*perfschema.HistoryRow) perfschema.GetHistoryRowsFunc {
+	return func(c chan<- *perfschema.HistoryRow, done chan<- error) error {
+		if len(iters) == 0 {
+			return fmt.Errorf("No more iters")
+		}
+		rows := iters[0]
+		iters = iters[1:len(iters)]
+		go func() {
+			defer func() {
+				done <- nil
+			}()
+			for _, row := range rows {
+				c <- row
+			}
+		}()
+		return nil
+	}
+}
+
 func makeGetTextFunc(texts ...string) perfschema.GetDigestTextFunc {
 	return func(digest string) (string, error) {
 		if len(texts) == 0 {
@@ -158,7 +177,7 @@ func (s *WorkerTestSuite) Test001(t *C) {
 	t.Assert(err, IsNil)
 	getRows := makeGetRowsFunc(rows)
 	getText := makeGetTextFunc("select 1")
-	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText)
+	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText, nil)
 
 	// First run doesn't produce a result because 2 snapshots are required.
 	i := &qan.Interval{
@@ -185,6 +204,10 @@ func (s *WorkerTestSuite) Test001(t *C) {
 
 	res, err = w.Run()
 	t.Assert(err, IsNil)
+	t.Assert(res, NotNil)
+	// Without statement history, Perf Schema has only totals, not each
+	// Query_time, so no percentiles.
+	t.Check(res.Histogram, HasLen, 0)
 	normalizeResult(res)
 	expect, err := s.loadResult("001/res01.json")
 	t.Assert(err, IsNil)
@@ -211,7 +234,7 @@ func (s *WorkerTestSuite) Test002(t *C) {
 	t.Assert(err, IsNil)
 	getRows := makeGetRowsFunc(rows)
 	getText := makeGetTextFunc("select 1")
-	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText)
+	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText, nil)
 
 	// First run doesn't produce a result because 2 snapshots are required.
 	i := &qan.Interval{
@@ -250,6 +273,60 @@ func (s *WorkerTestSuite) Test002(t *C) {
 	t.Assert(err, IsNil)
 }
 
+func (s *WorkerTestSuite) TestExampleQueries(t *C) {
+	rows, err := s.loadData("001")
+	t.Assert(err, IsNil)
+	getRows := makeGetRowsFunc(rows)
+	getText := makeGetTextFunc("select 1")
+
+	// The history table is a ring buffer, so the 2nd iter still has the
+	// statement from the 1st iter (TimerEnd 100) which is the slowest, but
+	// it's not an example for the 2nd interval.
+	digest := "4fadbbec94239d89c40318bfc3888aed"
+	first := &perfschema.HistoryRow{Schema: "db1", Digest: digest, SQLText: "select 1", TimerEnd: 100, TimerWait: 804610000}
+	history := [][]*perfschema.HistoryRow{
+		{first},
+		{
+			first,
+			&perfschema.HistoryRow{Schema: "db1", Digest: digest, SQLText: "select 10", TimerEnd: 200, TimerWait: 20000000},
+			&perfschema.HistoryRow{Schema: "db2", Digest: digest, SQLText: "select 20", TimerEnd: 300, TimerWait: 50000000},
+			&perfschema.HistoryRow{Schema: "db1", Digest: "", SQLText: "select 30", TimerEnd: 400, TimerWait: 90000000},
+		},
+	}
+	getHistory := makeGetHistoryFunc(history)
+
+	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText, getHistory)
+	w.SetConfig(qan.Config{ExampleQueries: true})
+
+	err = w.Setup(&qan.Interval{Number: 1, StartTime: time.Now().UTC()})
+	t.Assert(err, IsNil)
+	res, err := w.Run()
+	t.Assert(err, IsNil)
+	t.Check(res, IsNil)
+	err = w.Cleanup()
+	t.Assert(err, IsNil)
+
+	err = w.Setup(&qan.Interval{Number: 2, StartTime: time.Now().UTC()})
+	t.Assert(err, IsNil)
+	res, err = w.Run()
+	t.Assert(err, IsNil)
+	t.Assert(res, NotNil)
+	t.Assert(res.Class, HasLen, 1)
+	example := res.Class[0].Example
+	t.Assert(example, NotNil)
+	t.Check(example.Query, Equals, "select 20")
+	t.Check(example.Db, Equals, "db2")
+	t.Check(example.QueryTime > 0.0000499 && example.QueryTime < 0.0000501, Equals, true) // 50000000 ps
+
+	// The same new statements are the Query_time samples for percentiles.
+	h := res.Histogram[res.Class[0].Id]
+	t.Assert(h, NotNil)
+	t.Check(h.Count, Equals, uint64(2))
+	t.Check(h.Percentile(99) > 0.0000475 && h.Percentile(99) < 0.0000525, Equals, true)
+	err = w.Cleanup()
+	t.Assert(err, IsNil)
+}
+
 func (s *WorkerTestSuite) TestEmptyDigest(t *C) {
 	// This is the simplest input possible: 1 query in iter 1 and 2. The result
 	// is just the increase in its values.
@@ -258,7 +335,7 @@ func (s *WorkerTestSuite) TestEmptyDigest(t *C) {
 	t.Assert(err, IsNil)
 	getRows := makeGetRowsFunc(rows)
 	getText := makeGetTextFunc("select 1")
-	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText)
+	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText, nil)
 
 	// First run doesn't produce a result because 2 snapshots are required.
 	i := &qan.Interval{
@@ -286,7 +363,7 @@ func (s *WorkerTestSuite) TestRealWorker(t *C) {
 	defer mysqlConn.Close()
 
 	f := perfschema.NewRealWorkerFactory(s.logChan)
-	w := f.Make("qan-worker", mysqlConn)
+	w := f.Make("qan-worker", qan.Config{}, mysqlConn)
 
 	start := []mysql.Query{
 		mysql.Query{Verify: "performance_schema", Expect: "1"},
@@ -378,7 +455,7 @@ func (s *WorkerTestSuite) TestIterOutOfSeq(t *C) {
 	defer mysqlConn.Close()
 
 	f := perfschema.NewRealWorkerFactory(s.logChan)
-	w := f.Make("qan-worker", mysqlConn)
+	w := f.Make("qan-worker", qan.Config{}, mysqlConn)
 
 	start := []mysql.Query{
 		mysql.Query{Verify: "performance_schema", Expect: "1"},
@@ -454,7 +531,7 @@ func (s *WorkerTestSuite) TestIterClockReset(t *C) {
 	defer mysqlConn.Close()
 
 	f := perfschema.NewRealWorkerFactory(s.logChan)
-	w := f.Make("qan-worker", mysqlConn)
+	w := f.Make("qan-worker", qan.Config{}, mysqlConn)
 
 	start := []mysql.Query{
 		mysql.Query{Verify: "performance_schema", Expect: "1"},
@@ -554,7 +631,7 @@ func (s *WorkerTestSuite) Test003(t *C) {
 	t.Assert(err, IsNil)
 	getRows := makeGetRowsFunc(rows)
 	getText := makeGetTextFunc("select 1", "select 2", "select 3", "select 4")
-	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText)
+	w := perfschema.NewWorker(s.logger, s.nullmysql, getRows, getText, nil)
 
 	// First interval doesn't produce a result because 2 snapshots are required.
 	i := &qan.Interval{
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/percona/cloud-protocol/proto/v1"
@@ -61,6 +62,16 @@ type DigestRow struct {
 	SumNoGoodIndexUsed      uint64
 }
 
+// A HistoryRow is a row from performance_schema.events_statements_history_long,
+// i.e. a single execution of a query.
+type HistoryRow struct {
+	Schema    string
+	Digest    string
+	SQLText   string
+	TimerEnd  uint64 // picoseconds since server start
+	TimerWait uint64
+}
+
 // A Class represents a single query and its per-schema instances.
 type Class struct {
 	DigestText string
@@ -75,7 +86,7 @@ type Snapshot map[string]Class // keyed on digest (classId)
 // --------------------------------------------------------------------------
 
 type WorkerFactory interface {
-	Make(name string, mysqlConn mysql.Connector) *Worker
+	Make(name string, config qan.Config, mysqlConn mysql.Connector) *Worker
 }
 
 type RealWorkerFactory struct {
@@ -89,14 +100,19 @@ func NewRealWorkerFactory(logChan chan *proto.LogEntry) *RealWorkerFactory {
 	return f
 }
 
-func (f *RealWorkerFactory) Make(name string, mysqlConn mysql.Connector) *Worker {
+func (f *RealWorkerFactory) Make(name string, config qan.Config, mysqlConn mysql.Connector) *Worker {
 	getRows := func(c chan<- *DigestRow, doneChan chan<- error) error {
 		return GetDigestRows(mysqlConn, c, doneChan)
 	}
 	getText := func(digest string) (string, error) {
 		return GetDigestText(mysqlConn, digest)
 	}
-	return NewWorker(pct.NewLogger(f.logChan, name), mysqlConn, getRows, getText)
+	getHistory := func(c chan<- *HistoryRow, doneChan chan<- error) error {
+		return GetHistoryRows(mysqlConn, c, doneChan)
+	}
+	w := NewWorker(pct.NewLogger(f.logChan, name), mysqlConn, getRows, getText, getHistory)
+	w.SetConfig(config)
+	return w
 }
 
 func GetDigestRows(mysqlConn mysql.Connector, c chan<- *DigestRow, doneChan chan<- error) error {
@@ -177,16 +193,56 @@ func GetDigestText(mysqlConn mysql.Connector, digest string) (string, error) {
 	return digestText, err
 }
 
+// GetHistoryRows gets the statements in events_statements_history_long. The
+// events_statements_history_long consumer must be enabled, else the table is
+// empty. The table only has the last performance_schema_events_statements_history_long_size
+// statements, so on a busy server the examples are from the end of the interval.
+func GetHistoryRows(mysqlConn mysql.Connector, c chan<- *HistoryRow, doneChan chan<- error) error {
+	rows, err := mysqlConn.DB().Query(
+		"SELECT" +
+			" COALESCE(CURRENT_SCHEMA, ''), DIGEST, SQL_TEXT, TIMER_END, TIMER_WAIT" +
+			" FROM performance_schema.events_statements_history_long" +
+			" WHERE DIGEST IS NOT NULL AND SQL_TEXT IS NOT NULL AND TIMER_END IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	go func() {
+		var err error
+		defer func() {
+			rows.Close()
+			doneChan <- err
+		}()
+		for rows.Next() {
+			row := &HistoryRow{}
+			err = rows.Scan(
+				&row.Schema,
+				&row.Digest,
+				&row.SQLText,
+				&row.TimerEnd,
+				&row.TimerWait,
+			)
+			if err != nil {
+				return
+			}
+			c <- row
+		}
+		err = rows.Err()
+	}()
+	return nil
+}
+
 // --------------------------------------------------------------------------
 
 type GetDigestRowsFunc func(c chan<- *DigestRow, doneChan chan<- error) error
 type GetDigestTextFunc func(string) (string, error)
+type GetHistoryRowsFunc func(c chan<- *HistoryRow, doneChan chan<- error) error
 
 type Worker struct {
-	logger    *pct.Logger
-	mysqlConn mysql.Connector
-	getRows   GetDigestRowsFunc
-	getText   GetDigestTextFunc
+	logger     *pct.Logger
+	mysqlConn  mysql.Connector
+	getRows    GetDigestRowsFunc
+	getText    GetDigestTextFunc
+	getHistory GetHistoryRowsFunc
 	// --
 	name          string
 	status        *pct.Status
@@ -197,19 +253,30 @@ type Worker struct {
 	lastRowCnt    uint
 	lastFetchTime float64
 	lastPrepTime  float64
+	// Example queries and Query_time samples:
+	configMux    *sync.RWMutex
+	config       qan.Config
+	examples     map[string]*event.Example // keyed on classId
+	histograms   map[string]*qan.Histogram // keyed on classId
+	lastTimerEnd uint64                    // of history rows already seen
 }
 
-func NewWorker(logger *pct.Logger, mysqlConn mysql.Connector, getRows GetDigestRowsFunc, getText GetDigestTextFunc) *Worker {
+// NewWorker returns a Worker which gets Query_time samples for percentiles,
+// and example queries if config.ExampleQueries is true, with getHistory.
+// getHistory can be nil for no percentiles and no examples.
+func NewWorker(logger *pct.Logger, mysqlConn mysql.Connector, getRows GetDigestRowsFunc, getText GetDigestTextFunc, getHistory GetHistoryRowsFunc) *Worker {
 	name := logger.Service()
 	w := &Worker{
-		logger:    logger,
-		mysqlConn: mysqlConn,
-		getRows:   getRows,
-		getText:   getText,
+		logger:     logger,
+		mysqlConn:  mysqlConn,
+		getRows:    getRows,
+		getText:    getText,
+		getHistory: getHistory,
 		// --
-		name:   name,
-		status: pct.NewStatus([]string{name, name + "-last"}),
-		prev:   make(Snapshot),
+		name:      name,
+		status:    pct.NewStatus([]string{name, name + "-last"}),
+		prev:      make(Snapshot),
+		configMux: &sync.RWMutex{},
 	}
 	return w
 }
@@ -254,6 +321,19 @@ func (w *Worker) Run() (*qan.Result, error) {
 		return nil, err
 	}
 
+	// Samples are statements executed between the previous snapshot and
+	// this one, so get them even if there's no previous snapshot to set
+	// lastTimerEnd for the next interval.
+	w.examples = nil
+	w.histograms = nil
+	if w.getHistory != nil {
+		w.examples, w.histograms, err = w.getSamples()
+		if err != nil {
+			// Not fatal: the result just won't have examples or percentiles.
+			w.logger.Warn("Cannot get statement history:", err)
+		}
+	}
+
 	if len(w.prev) == 0 {
 		return nil, nil
 	}
@@ -288,6 +368,12 @@ func (w *Worker) Status() map[string]string {
 	return w.status.All()
 }
 
+func (w *Worker) SetConfig(config qan.Config) {
+	w.configMux.Lock()
+	defer w.configMux.Unlock()
+	w.config = config
+}
+
 // --------------------------------------------------------------------------
 
 func (w *Worker) reset() {
@@ -297,6 +383,84 @@ func (w *Worker) reset() {
 	w.lastRowCnt = 0
 	w.lastFetchTime = 0
 	w.lastPrepTime = 0
+	w.lastTimerEnd = 0
+}
+
+func (w *Worker) exampleQueries() bool {
+	w.configMux.RLock()
+	defer w.configMux.RUnlock()
+	return w.config.ExampleQueries && w.getHistory != nil
+}
+
+// getSamples returns a Query_time histogram per class and, if example queries
+// are enabled, the slowest statement per class, from statements executed since
+// the last call. The history table is a ring buffer, so statements seen in the
+// last call are still in it; lastTimerEnd filters them out. The table only has
+// the last statements, so on a busy server the percentiles are from a sample
+// at the end of the interval, and classes without samples have none.
+func (w *Worker) getSamples() (map[string]*event.Example, map[string]*qan.Histogram, error) {
+	w.logger.Debug("getSamples:call:", w.iter.Number)
+	defer w.logger.Debug("getSamples:return:", w.iter.Number)
+
+	w.status.Update(w.name, "Getting statement history")
+	defer w.status.Update(w.name, "Idle")
+
+	exampleQueries := w.exampleQueries()
+	examples := make(map[string]*event.Example)
+	histograms := make(map[string]*qan.Histogram)
+	slowest := make(map[string]uint64) // TimerWait of examples
+	maxTimerEnd := uint64(0)
+	rowChan := make(chan *HistoryRow)
+	doneChan := make(chan error, 1)
+	if err := w.getHistory(rowChan, doneChan); err != nil {
+		if err == sql.ErrNoRows {
+			return examples, histograms, nil
+		}
+		return nil, nil, err
+	}
+	// TIMER_END is relative to server start, so it's the same for all rows
+	// at this time; it's not the wall clock time the statement ended.
+	ts := time.Now().UTC().Format("2006-01-02 15:04:05")
+	var err error // from getHistory() on doneChan
+ROW_LOOP:
+	for {
+		select {
+		case row := <-rowChan:
+			if row.TimerEnd > maxTimerEnd {
+				maxTimerEnd = row.TimerEnd
+			}
+			if row.TimerEnd <= w.lastTimerEnd || len(row.Digest) < 32 {
+				continue
+			}
+			classId := strings.ToUpper(row.Digest[16:32])
+			h, ok := histograms[classId]
+			if !ok {
+				h = qan.NewHistogram()
+				histograms[classId] = h
+			}
+			h.Add(float64(row.TimerWait) * math.Pow10(-12))
+			if !exampleQueries || row.TimerWait < slowest[classId] {
+				continue
+			}
+			slowest[classId] = row.TimerWait
+			examples[classId] = &event.Example{
+				QueryTime: float64(row.TimerWait) * math.Pow10(-12),
+				Db:        row.Schema,
+				Query:     row.SQLText,
+				Ts:        ts,
+			}
+		case err = <-doneChan:
+			break ROW_LOOP
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxTimerEnd > 0 {
+		// If MySQL restarted, timers restarted, so maxTimerEnd < lastTimerEnd.
+		w.lastTimerEnd = maxTimerEnd
+	}
+	return examples, histograms, nil
 }
 
 func (w *Worker) getSnapshot(prev Snapshot) (Snapshot, error) {
@@ -386,6 +550,7 @@ func (w *Worker) prepareResult(prev, curr Snapshot) (*qan.Result, error) {
 
 	global := event.NewGlobalClass()
 	classes := []*event.QueryClass{}
+	histograms := make(map[string]*qan.Histogram)
 
 	// Compare current classes to previous.
 CLASS_LOOP:
@@ -537,7 +702,13 @@ CLASS_LOOP:
 		class := event.NewQueryClass(classId, class.DigestText, false, 0)
 		class.TotalQueries = d.CountStar
 		class.Metrics = stats
+		if example, ok := w.examples[classId]; ok {
+			class.Example = example
+		}
 		classes = append(classes, class)
+		if h, ok := w.histograms[classId]; ok {
+			histograms[classId] = h
+		}
 
 		// Add the class to the global metrics.
 		global.AddClass(class)
@@ -553,6 +724,9 @@ CLASS_LOOP:
 		Global: global,
 		Class:  classes,
 	}
+	if len(histograms) > 0 {
+		result.Histogram = histograms
+	}
 
 	return result, nil
 }
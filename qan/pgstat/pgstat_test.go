@@ -0,0 +1,130 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pgstat_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/mysql"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/qan"
+	"github.com/percona/percona-agent/qan/pgstat"
+	"github.com/percona/percona-agent/test/mock"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type WorkerTestSuite struct {
+	logChan   chan *proto.LogEntry
+	logger    *pct.Logger
+	nullmysql *mock.NullMySQL
+}
+
+var _ = Suite(&WorkerTestSuite{})
+
+func (s *WorkerTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 100)
+	s.logger = pct.NewLogger(s.logChan, "qan-worker")
+	s.nullmysql = mock.NewNullMySQL()
+}
+
+func makeGetRowsFunc(iters ...[]*pgstat.StatementRow) pgstat.GetStatementRowsFunc {
+	return func() ([]*pgstat.StatementRow, error) {
+		if len(iters) == 0 {
+			return nil, fmt.Errorf("No more iters")
+		}
+		rows := iters[0]
+		iters = iters[1:]
+		return rows, nil
+	}
+}
+
+func run(t *C, w *pgstat.Worker, n int) *qan.Result {
+	err := w.Setup(&qan.Interval{Number: n, StartTime: time.Now().UTC()})
+	t.Assert(err, IsNil)
+	res, err := w.Run()
+	t.Assert(err, IsNil)
+	err = w.Cleanup()
+	t.Assert(err, IsNil)
+	return res
+}
+
+// --------------------------------------------------------------------------
+
+func (s *WorkerTestSuite) TestWorker(t *C) {
+	q1 := "SELECT * FROM t WHERE id = ?"
+	q2 := "UPDATE t SET c = ? WHERE id = ?"
+	iter1 := []*pgstat.StatementRow{
+		{UserId: 10, Db: "app", QueryId: 1, Query: q1, Calls: 100, TotalTime: 1000, Rows: 100},
+		{UserId: 10, Db: "app", QueryId: -2, Query: q2, Calls: 10, TotalTime: 50, Rows: 10},
+	}
+	iter2 := []*pgstat.StatementRow{
+		// q1 executed 50 more times in app, and 10 times in a new db.
+		{UserId: 10, Db: "app", QueryId: 1, Query: q1, Calls: 150, TotalTime: 1100, Rows: 150, SharedBlksHit: 5},
+		{UserId: 10, Db: "app2", QueryId: 1, Query: q1, Calls: 10, TotalTime: 100, Rows: 10},
+		// q2 didn't execute.
+		{UserId: 10, Db: "app", QueryId: -2, Query: q2, Calls: 10, TotalTime: 50, Rows: 10},
+	}
+	iter3 := []*pgstat.StatementRow{
+		// pg_stat_statements_reset() was called, so q1 restarted from zero.
+		{UserId: 10, Db: "app", QueryId: 1, Query: q1, Calls: 4, TotalTime: 8, Rows: 4},
+	}
+	s.nullmysql.Reset()
+	w := pgstat.NewWorker(s.logger, s.nullmysql, makeGetRowsFunc(iter1, iter2, iter3))
+	start := []mysql.Query{{Set: "CREATE EXTENSION IF NOT EXISTS pg_stat_statements"}}
+	w.SetConfig(qan.Config{CollectFrom: "pg_stat_statements", Start: start})
+
+	// First run doesn't produce a result because 2 snapshots are required.
+	// The worker runs the Start queries because the analyzer doesn't.
+	res := run(t, w, 1)
+	t.Check(res, IsNil)
+	t.Check(s.nullmysql.GetSet(), DeepEquals, start)
+
+	// Second run is the diff of the two snapshots.
+	res = run(t, w, 2)
+	t.Assert(res, NotNil)
+	t.Assert(res.Class, HasLen, 1)
+	class := res.Class[0]
+	t.Check(class.Id, Equals, "0000000000000001")
+	t.Check(class.Fingerprint, Equals, q1)
+	t.Check(class.TotalQueries, Equals, uint64(60))
+	qt := class.Metrics.TimeMetrics["Query_time"]
+	t.Check(qt.Sum, Equals, 0.2)   // (100 + 100) ms
+	t.Check(qt.Min, Equals, 0.002) // 100 ms / 50 calls in app
+	t.Check(qt.Max, Equals, 0.01)  // 100 ms / 10 calls in app2
+	totalTime := 200.0
+	t.Check(qt.Avg, Equals, totalTime/60/1000)
+	t.Check(class.Metrics.NumberMetrics["Rows_sent"].Sum, Equals, uint64(60))
+	t.Check(class.Metrics.NumberMetrics["Shared_blks_hit"].Sum, Equals, uint64(5))
+	// pg_stat_statements has only totals, not each execution time, so no percentiles.
+	t.Check(res.Histogram, HasLen, 0)
+
+	// Negative queryids are unsigned in the class ID.
+	t.Check(pgstat.ClassId(-2), Equals, "FFFFFFFFFFFFFFFE")
+
+	// After a reset, the current values are used.
+	res = run(t, w, 3)
+	t.Assert(res, NotNil)
+	t.Assert(res.Class, HasLen, 1)
+	t.Check(res.Class[0].TotalQueries, Equals, uint64(4))
+}
@@ -0,0 +1,440 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pgstat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/go-mysql/event"
+	"github.com/percona/percona-agent/mysql"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/qan"
+)
+
+// A StatementRow is a row from pg_stat_statements. Times are milliseconds.
+// The view requires PostgreSQL 9.4 or newer for queryid, and the
+// pg_stat_statements extension: CREATE EXTENSION pg_stat_statements.
+type StatementRow struct {
+	UserId            uint64
+	Db                string
+	QueryId           int64
+	Query             string // normalized, e.g. SELECT * FROM t WHERE id = ?
+	Calls             uint64
+	TotalTime         float64
+	Rows              uint64
+	SharedBlksHit     uint64
+	SharedBlksRead    uint64
+	SharedBlksDirtied uint64
+	SharedBlksWritten uint64
+	LocalBlksHit      uint64
+	LocalBlksRead     uint64
+	TempBlksRead      uint64
+	TempBlksWritten   uint64
+	BlkReadTime       float64
+	BlkWriteTime      float64
+}
+
+// A Class represents a single query and its per-database, per-user instances.
+type Class struct {
+	Query string
+	Rows  map[string]*StatementRow // keyed on db/userid
+}
+
+// A Snapshot represents all rows from pg_stat_statements at a single time,
+// grouped by queryid into classes. Like perf schema Snapshots, two
+// consecutive Snapshots are needed to produce a qan.Result.
+type Snapshot map[string]Class // keyed on classId
+
+// ClassId returns the queryid as 16 hex digits, like perf schema class IDs.
+func ClassId(queryId int64) string {
+	return fmt.Sprintf("%016X", uint64(queryId))
+}
+
+// --------------------------------------------------------------------------
+
+type WorkerFactory interface {
+	Make(name string, config qan.Config, conn mysql.Connector) *Worker
+}
+
+type RealWorkerFactory struct {
+	logChan chan *proto.LogEntry
+}
+
+func NewRealWorkerFactory(logChan chan *proto.LogEntry) *RealWorkerFactory {
+	f := &RealWorkerFactory{
+		logChan: logChan,
+	}
+	return f
+}
+
+func (f *RealWorkerFactory) Make(name string, config qan.Config, conn mysql.Connector) *Worker {
+	getRows := func() ([]*StatementRow, error) {
+		return GetStatementRows(conn)
+	}
+	w := NewWorker(pct.NewLogger(f.logChan, name), conn, getRows)
+	w.SetConfig(config)
+	return w
+}
+
+// GetStatementRows gets all rows from pg_stat_statements. conn must be a
+// postgres.Connection.
+func GetStatementRows(conn mysql.Connector) ([]*StatementRow, error) {
+	rows, err := conn.DB().Query(
+		"SELECT s.userid, COALESCE(d.datname, ''), s.queryid, s.query," +
+			" s.calls, s.total_time, s.rows," +
+			" s.shared_blks_hit, s.shared_blks_read, s.shared_blks_dirtied, s.shared_blks_written," +
+			" s.local_blks_hit, s.local_blks_read, s.temp_blks_read, s.temp_blks_written," +
+			" s.blk_read_time, s.blk_write_time" +
+			" FROM pg_stat_statements s LEFT JOIN pg_database d ON d.oid = s.dbid" +
+			" WHERE s.queryid IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stmts := []*StatementRow{}
+	for rows.Next() {
+		row := &StatementRow{}
+		err := rows.Scan(
+			&row.UserId,
+			&row.Db,
+			&row.QueryId,
+			&row.Query,
+			&row.Calls,
+			&row.TotalTime,
+			&row.Rows,
+			&row.SharedBlksHit,
+			&row.SharedBlksRead,
+			&row.SharedBlksDirtied,
+			&row.SharedBlksWritten,
+			&row.LocalBlksHit,
+			&row.LocalBlksRead,
+			&row.TempBlksRead,
+			&row.TempBlksWritten,
+			&row.BlkReadTime,
+			&row.BlkWriteTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, row)
+	}
+	return stmts, rows.Err()
+}
+
+// --------------------------------------------------------------------------
+
+type GetStatementRowsFunc func() ([]*StatementRow, error)
+
+type Worker struct {
+	logger  *pct.Logger
+	conn    mysql.Connector
+	getRows GetStatementRowsFunc
+	// --
+	name          string
+	status        *pct.Status
+	prev          Snapshot
+	curr          Snapshot
+	iter          *qan.Interval
+	lastErr       error
+	lastRowCnt    uint
+	lastFetchTime float64
+	lastPrepTime  float64
+	configMux     *sync.RWMutex
+	config        qan.Config
+	started       bool // ran config.Start
+}
+
+func NewWorker(logger *pct.Logger, conn mysql.Connector, getRows GetStatementRowsFunc) *Worker {
+	name := logger.Service()
+	w := &Worker{
+		logger:  logger,
+		conn:    conn,
+		getRows: getRows,
+		// --
+		name:      name,
+		status:    pct.NewStatus([]string{name, name + "-last"}),
+		prev:      make(Snapshot),
+		configMux: &sync.RWMutex{},
+	}
+	return w
+}
+
+func (w *Worker) Setup(interval *qan.Interval) error {
+	if w.iter != nil {
+		// Ensure intervals are in sequence, else reset.
+		if interval.Number != w.iter.Number+1 {
+			w.logger.Warn(fmt.Sprintf("Interval out of sequence: got %d, expected %d", interval.Number, w.iter.Number+1))
+			w.reset()
+		} else if interval.StartTime.Before(w.iter.StartTime) {
+			w.logger.Warn(fmt.Sprintf("Interval reset: previous at %s, now %s", interval.StartTime, w.iter.StartTime))
+			w.reset()
+		}
+	}
+	w.iter = interval
+	// Reset -last status vals.
+	w.lastRowCnt = 0
+	w.lastFetchTime = 0
+	w.lastPrepTime = 0
+	return nil
+}
+
+func (w *Worker) Run() (*qan.Result, error) {
+	w.logger.Debug("Run:call:", w.iter.Number)
+	defer w.logger.Debug("Run:return:", w.iter.Number)
+
+	defer w.status.Update(w.name, "Idle")
+
+	w.status.Update(w.name, "Connecting to PostgreSQL")
+	if err := w.conn.Connect(1); err != nil {
+		w.logger.Warn("Cannot connect to PostgreSQL:", err)
+		w.lastErr = err
+		return nil, nil // not an error to caller
+	}
+	defer w.conn.Close()
+
+	// The analyzer only configures MySQL, so run the Start queries, e.g.
+	// CREATE EXTENSION pg_stat_statements, once per config. If they fail,
+	// the extension may exist already, so try to collect anyway.
+	w.configMux.Lock()
+	if !w.started {
+		w.started = true
+		if err := w.conn.Set(w.config.Start); err != nil {
+			w.logger.Warn("Cannot run Start queries:", err)
+		}
+	}
+	w.configMux.Unlock()
+
+	var err error
+	w.curr, err = w.getSnapshot()
+	if err != nil {
+		w.lastErr = err
+		return nil, err
+	}
+
+	if len(w.prev) == 0 {
+		return nil, nil
+	}
+
+	res, err := w.prepareResult(w.prev, w.curr)
+	if err != nil {
+		w.lastErr = err
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (w *Worker) Cleanup() error {
+	w.logger.Debug("Cleanup:call:", w.iter.Number)
+	defer w.logger.Debug("Cleanup:return:", w.iter.Number)
+	w.prev = w.curr
+	last := fmt.Sprintf("rows: %d, fetch: %s, prep: %s",
+		w.lastRowCnt, pct.Duration(w.lastFetchTime), pct.Duration(w.lastPrepTime))
+	if w.lastErr != nil {
+		last += fmt.Sprintf(", error: %s", w.lastErr)
+	}
+	w.status.Update(w.name+"-last", last)
+	return nil
+}
+
+func (w *Worker) Stop() error {
+	return nil
+}
+
+func (w *Worker) Status() map[string]string {
+	return w.status.All()
+}
+
+func (w *Worker) SetConfig(config qan.Config) {
+	w.configMux.Lock()
+	defer w.configMux.Unlock()
+	if !qan.SameQueries(w.config.Start, config.Start) {
+		w.started = false
+	}
+	w.config = config
+}
+
+// --------------------------------------------------------------------------
+
+func (w *Worker) reset() {
+	w.iter = nil
+	w.prev = make(Snapshot)
+	w.lastErr = nil
+	w.lastRowCnt = 0
+	w.lastFetchTime = 0
+	w.lastPrepTime = 0
+}
+
+func (w *Worker) getSnapshot() (Snapshot, error) {
+	w.logger.Debug("getSnapshot:call:", w.iter.Number)
+	defer w.logger.Debug("getSnapshot:return:", w.iter.Number)
+
+	w.status.Update(w.name, "Getting pg_stat_statements")
+	defer w.status.Update(w.name, "Idle")
+
+	t0 := time.Now()
+	defer func() { w.lastFetchTime = time.Now().Sub(t0).Seconds() }()
+
+	rows, err := w.getRows()
+	if err != nil {
+		return nil, err
+	}
+	curr := make(Snapshot)
+	for _, row := range rows {
+		w.lastRowCnt++
+		classId := ClassId(row.QueryId)
+		key := row.Db + "/" + strconv.FormatUint(row.UserId, 10)
+		class, ok := curr[classId]
+		if !ok {
+			class = Class{
+				Query: row.Query,
+				Rows:  make(map[string]*StatementRow),
+			}
+			curr[classId] = class
+		}
+		if _, ok := class.Rows[key]; ok {
+			w.logger.Error("Got class twice: ", key, classId)
+			continue
+		}
+		class.Rows[key] = row
+	}
+	return curr, nil
+}
+
+func (w *Worker) prepareResult(prev, curr Snapshot) (*qan.Result, error) {
+	w.logger.Debug("prepareResult:call:", w.iter.Number)
+	defer w.logger.Debug("prepareResult:return:", w.iter.Number)
+
+	w.status.Update(w.name, "Preparing result")
+	defer w.status.Update(w.name, "Idle")
+
+	t0 := time.Now()
+	defer func() { w.lastPrepTime = time.Now().Sub(t0).Seconds() }()
+
+	global := event.NewGlobalClass()
+	classes := []*event.QueryClass{}
+
+	for classId, class := range curr {
+		prevClass := prev[classId]
+
+		// Like perf schema, diff each row with its previous values, or use
+		// its current values if it's new. pg_stat_statements doesn't have
+		// the min and max time during the interval, so they're the min and
+		// max of the rows' averages for the interval.
+		d := StatementRow{} // class aggregate, becomes class metrics
+		minTime := math.MaxFloat64
+		maxTime := 0.0
+		for key, row := range class.Rows {
+			r := *row
+			if prevRow, ok := prevClass.Rows[key]; ok && row.Calls >= prevRow.Calls {
+				if row.Calls == prevRow.Calls {
+					continue // not executed during interval
+				}
+				r = diff(row, prevRow)
+			}
+			// Else the row is new, or pg_stat_statements_reset() was called
+			// and the row restarted from zero, so use its current values.
+			d.Calls += r.Calls
+			d.TotalTime += r.TotalTime
+			d.Rows += r.Rows
+			d.SharedBlksHit += r.SharedBlksHit
+			d.SharedBlksRead += r.SharedBlksRead
+			d.SharedBlksDirtied += r.SharedBlksDirtied
+			d.SharedBlksWritten += r.SharedBlksWritten
+			d.LocalBlksHit += r.LocalBlksHit
+			d.LocalBlksRead += r.LocalBlksRead
+			d.TempBlksRead += r.TempBlksRead
+			d.TempBlksWritten += r.TempBlksWritten
+			d.BlkReadTime += r.BlkReadTime
+			d.BlkWriteTime += r.BlkWriteTime
+
+			avg := r.TotalTime / float64(r.Calls) / 1000 // ms -> s
+			if avg < minTime {
+				minTime = avg
+			}
+			if avg > maxTime {
+				maxTime = avg
+			}
+		}
+		if d.Calls == 0 {
+			continue // no rows executed during interval
+		}
+
+		stats := event.NewMetrics()
+		stats.TimeMetrics["Query_time"] = &event.TimeStats{
+			Sum: d.TotalTime / 1000,
+			Min: minTime,
+			Avg: d.TotalTime / float64(d.Calls) / 1000,
+			Max: maxTime,
+		}
+		stats.TimeMetrics["Blk_read_time"] = &event.TimeStats{Sum: d.BlkReadTime / 1000}
+		stats.TimeMetrics["Blk_write_time"] = &event.TimeStats{Sum: d.BlkWriteTime / 1000}
+		stats.NumberMetrics["Rows_sent"] = &event.NumberStats{Sum: d.Rows}
+		stats.NumberMetrics["Shared_blks_hit"] = &event.NumberStats{Sum: d.SharedBlksHit}
+		stats.NumberMetrics["Shared_blks_read"] = &event.NumberStats{Sum: d.SharedBlksRead}
+		stats.NumberMetrics["Shared_blks_dirtied"] = &event.NumberStats{Sum: d.SharedBlksDirtied}
+		stats.NumberMetrics["Shared_blks_written"] = &event.NumberStats{Sum: d.SharedBlksWritten}
+		stats.NumberMetrics["Local_blks_hit"] = &event.NumberStats{Sum: d.LocalBlksHit}
+		stats.NumberMetrics["Local_blks_read"] = &event.NumberStats{Sum: d.LocalBlksRead}
+		stats.NumberMetrics["Temp_blks_read"] = &event.NumberStats{Sum: d.TempBlksRead}
+		stats.NumberMetrics["Temp_blks_written"] = &event.NumberStats{Sum: d.TempBlksWritten}
+
+		// 0 as tzDiff (last param) because we are not saving examples
+		qc := event.NewQueryClass(classId, class.Query, false, 0)
+		qc.TotalQueries = d.Calls
+		qc.Metrics = stats
+		classes = append(classes, qc)
+
+		// Add the class to the global metrics.
+		global.AddClass(qc)
+	}
+
+	if len(classes) == 0 {
+		return nil, nil
+	}
+
+	result := &qan.Result{
+		Global: global,
+		Class:  classes,
+	}
+	return result, nil
+}
+
+// diff returns curr - prev for the counters in a row.
+func diff(curr, prev *StatementRow) StatementRow {
+	d := *curr
+	d.Calls -= prev.Calls
+	d.TotalTime -= prev.TotalTime
+	d.Rows -= prev.Rows
+	d.SharedBlksHit -= prev.SharedBlksHit
+	d.SharedBlksRead -= prev.SharedBlksRead
+	d.SharedBlksDirtied -= prev.SharedBlksDirtied
+	d.SharedBlksWritten -= prev.SharedBlksWritten
+	d.LocalBlksHit -= prev.LocalBlksHit
+	d.LocalBlksRead -= prev.LocalBlksRead
+	d.TempBlksRead -= prev.TempBlksRead
+	d.TempBlksWritten -= prev.TempBlksWritten
+	d.BlkReadTime -= prev.BlkReadTime
+	d.BlkWriteTime -= prev.BlkWriteTime
+	return d
+}
@@ -31,11 +31,12 @@ import (
 // Data for an interval from slow log or performance schema (pfs) parser,
 // passed to MakeReport() which wraps it in a Report{} with metadata.
 type Result struct {
-	Global     *event.GlobalClass  // metrics for all data
-	Class      []*event.QueryClass // per-class metrics
-	RunTime    float64             // seconds parsing data, hopefully < interval
-	StopOffset int64               // slow log offset where parsing stopped, should be <= end offset
-	Error      string              `json:",omitempty"`
+	Global     *event.GlobalClass    // metrics for all data
+	Class      []*event.QueryClass   // per-class metrics
+	RunTime    float64               // seconds parsing data, hopefully < interval
+	StopOffset int64                 // slow log offset where parsing stopped, should be <= end offset
+	Error      string                `json:",omitempty"`
+	Histogram  map[string]*Histogram `json:",omitempty"` // per-class Query_time, keyed on class Id
 }
 
 // Final QAN data struct, composed of a Result{} and metatdata, sent to the
@@ -48,6 +49,12 @@ type Report struct {
 	RunTime               float64             // seconds parsing data
 	Global                *event.GlobalClass  // metrics for all data
 	Class                 []*event.QueryClass // per-class metrics
+	// Query_time percentiles, if the worker kept histograms. Perf schema
+	// samples only some queries, so not every class may have percentiles.
+	// pg_stat_statements has only totals, so NoPercentiles is true.
+	GlobalPercentiles *Percentiles            `json:",omitempty"`
+	ClassPercentiles  map[string]*Percentiles `json:",omitempty"` // keyed on class Id
+	NoPercentiles     bool                    `json:",omitempty"` // no Query_time samples
 	// slow log:
 	SlowLogFile     string `json:",omitempty"` // not slow_query_log_file if rotated
 	SlowLogFileSize int64  `json:",omitempty"`
@@ -93,27 +100,63 @@ func MakeReport(config Config, interval *Interval, result *Result) *Report {
 		report.StopOffset = result.StopOffset
 	}
 
+	// Percentiles for all classes. Histograms are merged, not the percentiles,
+	// because percentiles of percentiles are meaningless.
+	if len(result.Histogram) > 0 {
+		global := NewHistogram()
+		for _, h := range result.Histogram {
+			global.Merge(h)
+		}
+		report.GlobalPercentiles = global.Percentiles()
+		report.ClassPercentiles = make(map[string]*Percentiles)
+	} else {
+		// Percentiles aren't zero, they're unknown, so say so explicitly.
+		report.NoPercentiles = true
+	}
+
 	// Return all query classes if there's no limit or number of classes is
 	// less than the limit.
 	n := len(result.Class)
 	if config.ReportLimit == 0 || n <= int(config.ReportLimit) {
+		addPercentiles(report, report.Class, result.Histogram)
 		return report // all classes, no LRQ
 	}
 
 	// Top queries
 	report.Class = result.Class[0:config.ReportLimit]
+	addPercentiles(report, report.Class, result.Histogram)
 
 	// Low-ranking Queries
 	lrq := event.NewQueryClass("0", "", false, 0*time.Second)
+	lrqQueries := uint64(0)
+	lrqHistogram := NewHistogram()
 	for _, query := range result.Class[config.ReportLimit:n] {
-		addQuery(lrq, query)
+		addQuery(lrq, query, lrqQueries)
+		lrqQueries += query.TotalQueries
+		lrqHistogram.Merge(result.Histogram[query.Id])
 	}
 	report.Class = append(report.Class, lrq)
+	if report.ClassPercentiles != nil && lrqHistogram.Count > 0 {
+		report.ClassPercentiles[lrq.Id] = lrqHistogram.Percentiles()
+	}
 
 	return report // top classes, the rest as LRQ
 }
 
-func addQuery(dst, src *event.QueryClass) {
+func addPercentiles(report *Report, classes []*event.QueryClass, histograms map[string]*Histogram) {
+	if report.ClassPercentiles == nil {
+		return
+	}
+	for _, class := range classes {
+		if h, ok := histograms[class.Id]; ok && h.Count > 0 {
+			report.ClassPercentiles[class.Id] = h.Percentiles()
+		}
+	}
+}
+
+// addQuery adds the src class metrics to dst which already has the metrics
+// of dstQueries queries.
+func addQuery(dst, src *event.QueryClass, dstQueries uint64) {
 	dst.TotalQueries++
 	for srcMetric, srcStats := range src.Metrics.TimeMetrics {
 		dstStats, ok := dst.Metrics.TimeMetrics[srcMetric]
@@ -122,7 +165,11 @@ func addQuery(dst, src *event.QueryClass) {
 			dst.Metrics.TimeMetrics[srcMetric] = &m
 		} else {
 			dstStats.Sum += srcStats.Sum
-			dstStats.Avg = (dstStats.Avg + srcStats.Avg) / 2
+			// Weight the averages by the number of queries, else a class
+			// executed once counts as much as a class executed 1,000 times.
+			if n := dstQueries + src.TotalQueries; n > 0 {
+				dstStats.Avg = (dstStats.Avg*float64(dstQueries) + srcStats.Avg*float64(src.TotalQueries)) / float64(n)
+			}
 			if srcStats.Min < dstStats.Min {
 				dstStats.Min = srcStats.Min
 			}
@@ -127,3 +127,79 @@ func (s *ReportTestSuite) TestResult014(t *C) {
 	// This query required improving the log parser to get the correct checksum ID:
 	t.Check(report.Class[0].Id, Equals, "DB9EF18846547B8C")
 }
+
+func (s *ReportTestSuite) TestPercentiles(t *C) {
+	data, err := ioutil.ReadFile(outputDir + "/result001.json")
+	t.Assert(err, IsNil)
+
+	result := &qan.Result{}
+	err = json.Unmarshal(data, result)
+	t.Assert(err, IsNil)
+
+	// Class 1: 100 queries from 0.01s to 1s, so p50 ~0.5s and p99 ~0.99s.
+	// Class 5: 100 queries at 5s, all in the LRQ with ReportLimit=2.
+	h1 := qan.NewHistogram()
+	for i := 1; i <= 100; i++ {
+		h1.Add(float64(i) / 100)
+	}
+	h5 := qan.NewHistogram()
+	h5.AddN(5, 100)
+	result.Histogram = map[string]*qan.Histogram{
+		"1000000000000001": h1,
+		"5000000000000005": h5,
+	}
+
+	// Percentiles are accurate to +/- 5%.
+	within := func(got, expect float64) bool {
+		return got >= expect*0.95 && got <= expect*1.05
+	}
+
+	interval := &qan.Interval{
+		Filename:  "slow.log",
+		StartTime: time.Now().Add(-1 * time.Second),
+		StopTime:  time.Now(),
+	}
+	config := qan.Config{
+		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 1},
+		ReportLimit:     2,
+	}
+	report := qan.MakeReport(config, interval, result)
+	t.Assert(report.Class, HasLen, 3)
+
+	// Global: 200 queries, half <= 1s, half 5s.
+	t.Assert(report.GlobalPercentiles, NotNil)
+	t.Check(within(report.GlobalPercentiles.P50, 0.5), Equals, false)
+	t.Check(within(report.GlobalPercentiles.P50, 1), Equals, true)
+	t.Check(within(report.GlobalPercentiles.P95, 5), Equals, true)
+
+	// Top queries 3 and 2 don't have histograms, so no percentiles.
+	t.Check(report.ClassPercentiles, HasLen, 1)
+
+	// LRQ merges the histograms of classes 1, 4, and 5.
+	p := report.ClassPercentiles["0"]
+	t.Assert(p, NotNil)
+	t.Check(within(p.P50, 1), Equals, true)
+	t.Check(within(p.P99, 5), Equals, true)
+
+	// Without a limit, each class has its own percentiles.
+	config.ReportLimit = 0
+	report = qan.MakeReport(config, interval, result)
+	t.Check(report.ClassPercentiles, HasLen, 2)
+	p = report.ClassPercentiles["1000000000000001"]
+	t.Assert(p, NotNil)
+	t.Check(within(p.P50, 0.5), Equals, true)
+	t.Check(within(p.P95, 0.95), Equals, true)
+	t.Check(within(p.P99, 0.99), Equals, true)
+	p = report.ClassPercentiles["5000000000000005"]
+	t.Assert(p, NotNil)
+	t.Check(within(p.P50, 5), Equals, true)
+	t.Check(report.NoPercentiles, Equals, false)
+
+	// Without histograms, e.g. pg_stat_statements, the report says there are
+	// no percentiles rather than just omitting them.
+	result.Histogram = nil
+	report = qan.MakeReport(config, interval, result)
+	t.Check(report.GlobalPercentiles, IsNil)
+	t.Check(report.ClassPercentiles, IsNil)
+	t.Check(report.NoPercentiles, Equals, true)
+}
@@ -0,0 +1,400 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package slowlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/go-mysql/event"
+	"github.com/percona/go-mysql/log"
+	parser "github.com/percona/go-mysql/log/slow"
+	"github.com/percona/go-mysql/query"
+	"github.com/percona/percona-agent/data"
+	"github.com/percona/percona-agent/mysql"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/qan"
+	"github.com/percona/percona-agent/ticker"
+)
+
+// Slow log timestamp formats: "# Time: 071015 21:43:52" (MySQL < 5.7) and
+// "# Time: 2015-12-01T12:00:00.123456Z" (MySQL 5.7).
+var tsFormats = []string{
+	"060102 15:04:05",
+	time.RFC3339Nano,
+}
+
+// Times to retry spooling a report before it's lost. Backfilling produces
+// reports much faster than the agent normally does, so the spool can be busy.
+const BACKFILL_SPOOL_TRIES = 10
+
+// A Backfiller parses old slow logs, e.g. rotated by logrotate and gzip'ed,
+// into normal qan.Reports. Unlike a Worker, it does not need MySQL configured
+// and it makes intervals from event timestamps, not clock ticks.
+type Backfiller struct {
+	logChan chan *proto.LogEntry
+	spool   data.Spooler
+	// --
+	ZeroRunTime bool // testing
+}
+
+func NewBackfiller(logChan chan *proto.LogEntry, spool data.Spooler) *Backfiller {
+	// Fingerprint like the worker does.
+	query.ReplaceNumbersInWords = true
+
+	b := &Backfiller{
+		logChan: logChan,
+		spool:   spool,
+	}
+	return b
+}
+
+// BackfillFiles returns the slow log files in dir, or matching the glob,
+// sorted oldest first by modification time.
+func BackfillFiles(dirOrGlob string) ([]string, error) {
+	glob := dirOrGlob
+	if fi, err := os.Stat(dirOrGlob); err == nil && fi.IsDir() {
+		glob = filepath.Join(dirOrGlob, "*")
+	}
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, err
+	}
+	files := []backfillFile{}
+	for _, file := range matches {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
+			continue
+		}
+		files = append(files, backfillFile{file, fi.ModTime()})
+	}
+	if len(files) == 0 {
+		return nil, errors.New("No slow log files match " + dirOrGlob)
+	}
+	sort.Sort(byModTime(files))
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+// Backfill parses all files matching config.Files, in time order, and spools
+// a qan.Report for every config.Interval seconds of events. It returns when
+// all files are parsed or stopChan is closed.
+func (b *Backfiller) Backfill(config qan.BackfillConfig, mysqlConn mysql.Connector, stopChan <-chan bool) error {
+	logger := pct.NewLogger(b.logChan, "qan-backfill")
+
+	files, err := BackfillFiles(config.Files)
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Backfilling %d slow logs: %s", len(files), strings.Join(files, ", ")))
+
+	// Slow log timestamps are MySQL system time, so like the worker we need
+	// the offset to UTC. If MySQL isn't available, presume it's UTC.
+	utcOffset, err := GetutcOffset(mysqlConn)
+	if err != nil {
+		logger.Warn(err.Error())
+	}
+
+	bf := &backfill{
+		logger:    logger,
+		spool:     b.spool,
+		stopChan:  stopChan,
+		utcOffset: utcOffset,
+		config: qan.Config{
+			ServiceInstance: config.ServiceInstance,
+			CollectFrom:     "slowlog",
+			Interval:        config.Interval,
+			ExampleQueries:  config.ExampleQueries,
+			ReportLimit:     config.ReportLimit,
+		},
+		zeroRunTime: b.ZeroRunTime,
+	}
+	for _, file := range files {
+		if err := bf.parseFile(file); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		if bf.stopped {
+			logger.Info("Backfill stopped")
+			return nil
+		}
+	}
+	bf.report() // last interval
+
+	logger.Info(fmt.Sprintf("Backfilled %d intervals", bf.interval.Number))
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+type backfill struct {
+	logger      *pct.Logger
+	spool       data.Spooler
+	stopChan    <-chan bool
+	utcOffset   time.Duration
+	config      qan.Config
+	zeroRunTime bool
+	// --
+	interval   qan.Interval
+	a          *event.EventAggregator
+	histograms map[string]*qan.Histogram
+	t0         time.Time
+	lastTs     time.Time
+	stopped    bool
+}
+
+func (bf *backfill) parseFile(filename string) error {
+	bf.logger.Info("Parsing " + filename)
+
+	file, err := openSlowLog(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+		if file.Name() != filename {
+			os.Remove(file.Name()) // decompressed copy
+		}
+	}()
+
+	opts := log.Options{
+		FilterAdminCommand: map[string]bool{
+			"Binlog Dump":      true,
+			"Binlog Dump GTID": true,
+		},
+	}
+	p := parser.NewSlowLogParser(file, opts)
+	parserErrChan := make(chan error, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				parserErrChan <- fmt.Errorf("Slow log parser crashed: %s", err)
+			}
+		}()
+		parserErrChan <- p.Start()
+	}()
+	defer p.Stop()
+
+	for e := range p.EventChan() {
+		select {
+		case <-bf.stopChan:
+			bf.stopped = true
+			return nil
+		default:
+		}
+
+		// Events without a timestamp happened at the same time as the
+		// previous event, so they belong to the same interval.
+		if e.Ts != "" {
+			ts, err := parseTs(e.Ts, bf.utcOffset)
+			if err != nil {
+				bf.logger.Warn(fmt.Sprintf("Invalid timestamp at %s offset %d: %s", filename, e.Offset, err))
+			} else {
+				bf.lastTs = ts
+			}
+		}
+		if bf.lastTs.IsZero() {
+			// Can't place events in an interval until we see a timestamp.
+			continue
+		}
+
+		// Report the current interval and begin the next one if the event
+		// is after the end of the current interval.
+		if bf.a == nil || !bf.lastTs.Before(bf.interval.StopTime) {
+			bf.report()
+			began := ticker.Began(bf.config.Interval, uint(bf.lastTs.Unix()))
+			bf.interval = qan.Interval{
+				Number:      bf.interval.Number + 1,
+				StartTime:   began,
+				StopTime:    began.Add(time.Duration(bf.config.Interval) * time.Second),
+				Filename:    filename,
+				StartOffset: int64(e.Offset),
+			}
+			bf.a = event.NewEventAggregator(bf.config.ExampleQueries, bf.utcOffset)
+			bf.histograms = make(map[string]*qan.Histogram)
+			bf.t0 = time.Now()
+		}
+		bf.interval.EndOffset = int64(e.Offset)
+
+		f, err := fingerprint(e.Query)
+		if err != nil {
+			bf.logger.Warn(fmt.Sprintf("Cannot fingerprint '%s': %s", e.Query, err))
+			continue
+		}
+		id := query.Id(f)
+		bf.a.AddEvent(e, id, f)
+		addQueryTime(bf.histograms, id, e)
+	}
+
+	return <-parserErrChan
+}
+
+func (bf *backfill) report() {
+	if bf.a == nil {
+		return
+	}
+	r := bf.a.Finalize()
+	bf.a = nil
+
+	// The aggregator result is a map, but we need an array of classes for
+	// the query report, so convert it.
+	classes := make([]*event.QueryClass, 0, len(r.Class))
+	for _, class := range r.Class {
+		classes = append(classes, class)
+	}
+	result := &qan.Result{
+		Global:    r.Global,
+		Class:     classes,
+		Histogram: bf.histograms,
+	}
+	if !bf.zeroRunTime {
+		result.RunTime = time.Now().Sub(bf.t0).Seconds()
+	}
+
+	report := qan.MakeReport(bf.config, &bf.interval, result)
+	for try := 1; try <= BACKFILL_SPOOL_TRIES; try++ {
+		err := bf.spool.Write("qan", report)
+		if err == nil {
+			bf.logger.Debug("report:", bf.interval.String())
+			return
+		}
+		if err != data.ErrSpoolTimeout || try == BACKFILL_SPOOL_TRIES {
+			bf.logger.Warn("Lost report:", err)
+			return
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// openSlowLog opens the slow log file. The slow log parser needs an *os.File
+// so it can seek, so a gzip'ed slow log is decompressed into a temp file first.
+func openSlowLog(filename string) (*os.File, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(filename, ".gz") {
+		return file, nil
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tmpFile, err := ioutil.TempFile("", "qan-backfill-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmpFile, gz); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return nil, err
+	}
+	if _, err := tmpFile.Seek(0, os.SEEK_SET); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return nil, err
+	}
+	return tmpFile, nil
+}
+
+// parseTs returns the UTC time of a slow log timestamp. Only the old format
+// is MySQL's local time, so utcOffset is only added to it; the RFC3339
+// format of MySQL 5.7 has its own zone.
+func parseTs(ts string, utcOffset time.Duration) (time.Time, error) {
+	// MySQL pads single-digit hours with a space: "071015  9:43:52".
+	ts = strings.Join(strings.Fields(ts), " ")
+	var err error
+	for i, format := range tsFormats {
+		var t time.Time
+		if t, err = time.Parse(format, ts); err == nil {
+			if i == 0 {
+				return t.Add(utcOffset), nil
+			}
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func fingerprint(q string) (f string, err error) {
+	// Like Worker.fingerprinter(), don't let one bad query stop parsing.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+	return query.Fingerprint(q), nil
+}
+
+type backfillFile struct {
+	name    string
+	modTime time.Time
+}
+
+type byModTime []backfillFile
+
+func (a byModTime) Len() int      { return len(a) }
+func (a byModTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byModTime) Less(i, j int) bool {
+	if a[i].modTime.Equal(a[j].modTime) {
+		// logrotate: slow.log.10 is older than slow.log.2.gz which is older
+		// than slow.log.1 which is older than slow.log.
+		baseI, nI := rotation(a[i].name)
+		baseJ, nJ := rotation(a[j].name)
+		if baseI == baseJ {
+			return nI > nJ
+		}
+		return a[i].name > a[j].name
+	}
+	return a[i].modTime.Before(a[j].modTime)
+}
+
+// rotation returns the name of the log without the logrotate suffix, and the
+// rotation number, e.g. slow.log.2.gz = (slow.log, 2). The number is 0 if the
+// log isn't rotated.
+func rotation(name string) (string, int) {
+	base := strings.TrimSuffix(name, ".gz")
+	ext := filepath.Ext(base)
+	if ext == "" {
+		return base, 0
+	}
+	n, err := strconv.Atoi(ext[1:])
+	if err != nil || n < 0 {
+		return base, 0
+	}
+	return strings.TrimSuffix(base, ext), n
+}
@@ -18,6 +18,7 @@
 package slowlog_test
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -149,6 +150,7 @@ func (s *WorkerTestSuite) TestWorkerWithAnotherTZ(t *C) {
 	expect.Class[0].Example.Ts = "2007-10-15 22:45:10"
 	expect.Class[1].Example.Ts = "2007-10-15 22:43:52"
 
+	got.Histogram = nil // tested in TestWorkerSlow001
 	sort.Sort(ByQueryId(got.Class))
 	sort.Sort(ByQueryId(expect.Class))
 	if ok, diff := IsDeeply(got, expect); !ok {
@@ -170,6 +172,18 @@ func (s *WorkerTestSuite) TestWorkerSlow001(t *C) {
 	t.Check(err, IsNil)
 	expect := &qan.Result{}
 	test.LoadMmReport(outputDir+"slow001.json", expect)
+
+	// Each class has 1 query, so every percentile is its Query_time.
+	t.Assert(got.Histogram, HasLen, 2)
+	for _, class := range got.Class {
+		h := got.Histogram[class.Id]
+		t.Assert(h, NotNil)
+		t.Check(h.Count, Equals, uint64(1))
+		p := h.Percentiles()
+		t.Check(p.P50, Equals, p.P99)
+	}
+	got.Histogram = nil
+
 	sort.Sort(ByQueryId(got.Class))
 	sort.Sort(ByQueryId(expect.Class))
 	if ok, diff := IsDeeply(got, expect); !ok {
@@ -195,6 +209,7 @@ func (s *WorkerTestSuite) TestWorkerSlow001NoExamples(t *C) {
 	if err := test.LoadMmReport(outputDir+"slow001-no-examples.json", expect); err != nil {
 		t.Fatal(err)
 	}
+	got.Histogram = nil // tested in TestWorkerSlow001
 	sort.Sort(ByQueryId(got.Class))
 	sort.Sort(ByQueryId(expect.Class))
 	if same, diff := IsDeeply(got, expect); !same {
@@ -221,6 +236,7 @@ func (s *WorkerTestSuite) TestWorkerSlow001Half(t *C) {
 	if err := test.LoadMmReport(outputDir+"slow001-half.json", expect); err != nil {
 		t.Fatal(err)
 	}
+	got.Histogram = nil // tested in TestWorkerSlow001
 	sort.Sort(ByQueryId(got.Class))
 	sort.Sort(ByQueryId(expect.Class))
 	if ok, diff := IsDeeply(got, expect); !ok {
@@ -245,6 +261,7 @@ func (s *WorkerTestSuite) TestWorkerSlow001Resume(t *C) {
 	t.Check(err, IsNil)
 	expect := &qan.Result{}
 	test.LoadMmReport(outputDir+"slow001-resume.json", expect)
+	got.Histogram = nil // tested in TestWorkerSlow001
 	sort.Sort(ByQueryId(got.Class))
 	sort.Sort(ByQueryId(expect.Class))
 	if ok, diff := IsDeeply(got, expect); !ok {
@@ -269,6 +286,7 @@ func (s *WorkerTestSuite) TestWorkerSlow011(t *C) {
 	if err := test.LoadMmReport(outputDir+"slow011.json", expect); err != nil {
 		t.Fatal(err)
 	}
+	got.Histogram = nil // tested in TestWorkerSlow001
 	sort.Sort(ByQueryId(got.Class))
 	sort.Sort(ByQueryId(expect.Class))
 	if same, diff := IsDeeply(got, expect); !same {
@@ -710,3 +728,117 @@ func (s *IterTestSuite) TestIterFile(t *C) {
 
 	i.Stop()
 }
+
+/////////////////////////////////////////////////////////////////////////////
+// Backfiller test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type BackfillTestSuite struct {
+	logChan   chan *proto.LogEntry
+	nullmysql *mock.NullMySQL
+	tmpDir    string
+}
+
+var _ = Suite(&BackfillTestSuite{})
+
+func (s *BackfillTestSuite) SetUpSuite(t *C) {
+	s.logChan = make(chan *proto.LogEntry, 1000)
+	s.nullmysql = mock.NewNullMySQL()
+}
+
+func (s *BackfillTestSuite) SetUpTest(t *C) {
+	var err error
+	s.tmpDir, err = ioutil.TempDir("/tmp", "agent-test")
+	t.Assert(err, IsNil)
+}
+
+func (s *BackfillTestSuite) TearDownTest(t *C) {
+	if err := os.RemoveAll(s.tmpDir); err != nil {
+		t.Error(err)
+	}
+}
+
+func (s *BackfillTestSuite) TestBackfillFiles(t *C) {
+	// logrotate names: slow.log.10 is older than slow.log.2.gz which is older
+	// than slow.log.1 which is older than slow.log. Give them the same mod time
+	// except slow.log. Sorting the names as strings would put slow.log.10 after
+	// slow.log.1.
+	now := time.Now()
+	for _, file := range []string{"slow.log.1", "slow.log.10", "slow.log.2.gz", "slow.log"} {
+		name := filepath.Join(s.tmpDir, file)
+		err := ioutil.WriteFile(name, []byte{}, 0644)
+		t.Assert(err, IsNil)
+		modTime := now.Add(-1 * time.Hour)
+		if file == "slow.log" {
+			modTime = now
+		}
+		err = os.Chtimes(name, modTime, modTime)
+		t.Assert(err, IsNil)
+	}
+
+	expect := []string{
+		filepath.Join(s.tmpDir, "slow.log.10"),
+		filepath.Join(s.tmpDir, "slow.log.2.gz"),
+		filepath.Join(s.tmpDir, "slow.log.1"),
+		filepath.Join(s.tmpDir, "slow.log"),
+	}
+
+	// Glob
+	got, err := slowlog.BackfillFiles(filepath.Join(s.tmpDir, "slow.log*"))
+	t.Assert(err, IsNil)
+	t.Check(got, DeepEquals, expect)
+
+	// Dir
+	got, err = slowlog.BackfillFiles(s.tmpDir)
+	t.Assert(err, IsNil)
+	t.Check(got, DeepEquals, expect)
+
+	// No files is an error.
+	_, err = slowlog.BackfillFiles(filepath.Join(s.tmpDir, "foo*"))
+	t.Check(err, NotNil)
+}
+
+func (s *BackfillTestSuite) TestBackfillGzip(t *C) {
+	// Gzip slow001.log which has two queries: one at 21:43:52, one at 21:45:10.
+	slowLog, err := ioutil.ReadFile(inputDir + "slow001.log")
+	t.Assert(err, IsNil)
+	file, err := os.Create(filepath.Join(s.tmpDir, "slow.log.1.gz"))
+	t.Assert(err, IsNil)
+	gz := gzip.NewWriter(file)
+	_, err = gz.Write(slowLog)
+	t.Assert(err, IsNil)
+	gz.Close()
+	file.Close()
+
+	spool := mock.NewSpooler(nil)
+	b := slowlog.NewBackfiller(s.logChan, spool)
+	b.ZeroRunTime = true
+	config := qan.BackfillConfig{
+		ServiceInstance: proto.ServiceInstance{Service: "mysql", InstanceId: 1},
+		Files:           filepath.Join(s.tmpDir, "slow.log*"),
+		Interval:        60,
+	}
+	err = b.Backfill(config, s.nullmysql, make(chan bool))
+	t.Assert(err, IsNil)
+
+	// One report per 1m interval with a query.
+	t.Assert(spool.DataIn, HasLen, 2)
+	ts := []time.Time{
+		time.Date(2007, 10, 15, 21, 43, 0, 0, time.UTC),
+		time.Date(2007, 10, 15, 21, 45, 0, 0, time.UTC),
+	}
+	for i, data := range spool.DataIn {
+		report, ok := data.(*qan.Report)
+		t.Assert(ok, Equals, true)
+		t.Check(report.ServiceInstance, DeepEquals, config.ServiceInstance)
+		t.Check(report.StartTs, Equals, ts[i])
+		t.Check(report.EndTs, Equals, ts[i].Add(1*time.Minute))
+		t.Check(report.SlowLogFile, Equals, filepath.Join(s.tmpDir, "slow.log.1.gz"))
+		t.Check(report.Global.TotalQueries, Equals, uint64(1))
+		t.Check(report.Class, HasLen, 1)
+	}
+
+	// The decompressed copy is removed.
+	tmpFiles, _ := filepath.Glob(filepath.Join(os.TempDir(), "qan-backfill-*"))
+	t.Check(tmpFiles, HasLen, 0)
+}
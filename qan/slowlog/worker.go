@@ -194,6 +194,10 @@ func (w *Worker) Run() (*qan.Result, error) {
 	// queries, group, and aggregate.
 	a := event.NewEventAggregator(w.job.ExampleQueries, w.utcOffset)
 
+	// The aggregator doesn't keep percentiles, so keep a Query_time
+	// histogram per class.
+	histograms := make(map[string]*qan.Histogram)
+
 	// Misc runtime meta data.
 	jobSize := w.job.EndOffset - w.job.StartOffset
 	runtime := time.Duration(0)
@@ -269,6 +273,7 @@ EVENT_LOOP:
 		case fingerprint = <-w.fingerprintChan:
 			id := query.Id(fingerprint)
 			a.AddEvent(event, id, fingerprint)
+			addQueryTime(histograms, id, event)
 		case _ = <-w.errChan:
 			w.logger.Warn(fmt.Sprintf("Cannot fingerprint '%s'", event.Query))
 			go w.fingerprinter()
@@ -298,6 +303,7 @@ EVENT_LOOP:
 	}
 	result.Global = r.Global
 	result.Class = classes
+	result.Histogram = histograms
 
 	// Zero the runtime for testing.
 	if !w.ZeroRunTime {
@@ -337,6 +343,10 @@ func (w *Worker) Status() map[string]string {
 	return w.status.All()
 }
 
+func (w *Worker) SetConfig(config qan.Config) {
+	w.config = config
+}
+
 func (w *Worker) SetLogParser(p log.LogParser) {
 	// This is just for testing, so tests can inject a parser that does
 	// abnormal things like be slow, crash, etc.
@@ -413,6 +423,19 @@ func (w *Worker) rotateSlowLog(interval *qan.Interval) error {
 	return nil
 }
 
+func addQueryTime(histograms map[string]*qan.Histogram, id string, e *log.Event) {
+	queryTime, ok := e.TimeMetrics["Query_time"]
+	if !ok {
+		return
+	}
+	h, ok := histograms[id]
+	if !ok {
+		h = qan.NewHistogram()
+		histograms[id] = h
+	}
+	h.Add(float64(queryTime))
+}
+
 func GetutcOffset(mysqlConn mysql.Connector) (time.Duration, error) {
 	var hours int64
 	if mysqlConn == nil {
@@ -21,7 +21,12 @@ import (
 	"github.com/percona/cloud-protocol/proto/v1"
 )
 
+const (
+	DEFAULT_FULL_REPORT = 86400 // 1d
+)
+
 type Config struct {
 	proto.ServiceInstance
-	Report uint // how often to collect and send config (seconds)
+	Report uint // how often to collect config and send changes (seconds)
+	Full   uint // how often to send full config (seconds), DEFAULT_FULL_REPORT if zero
 }
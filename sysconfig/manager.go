@@ -45,11 +45,14 @@ type Manager struct {
 	im      *instance.Repo
 	// --
 	monitors       map[string]Monitor
+	full           map[string]uint // full report interval per monitor
 	running        bool
-	mux            *sync.RWMutex // guards monitors and running
+	mux            *sync.RWMutex // guards monitors, full, and running
 	reportChan     chan *Report  // <- Report from monitor
 	spoolerRunning bool
 	status         *pct.Status
+	last           map[string]map[string]*lastReport // monitor => system => last report
+	lastMux        *sync.Mutex                       // guards last and its files
 }
 
 func NewManager(logger *pct.Logger, factory MonitorFactory, clock ticker.Manager, spool data.Spooler, im *instance.Repo) *Manager {
@@ -62,8 +65,11 @@ func NewManager(logger *pct.Logger, factory MonitorFactory, clock ticker.Manager
 		// --
 		reportChan: make(chan *Report, 3),
 		monitors:   make(map[string]Monitor),
+		full:       make(map[string]uint),
 		status:     pct.NewStatus([]string{"sysconfig", "sysconfig-spooler"}),
 		mux:        &sync.RWMutex{},
+		last:       make(map[string]map[string]*lastReport),
+		lastMux:    &sync.Mutex{},
 	}
 	return m
 }
@@ -168,20 +174,10 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 			return cmd.Reply(nil, errors.New("Factory: "+err.Error()))
 		}
 
-		// Make unsynchronized (3rd arg=false) ticker for collect interval,
-		// it's unsynchronized because 1) we don't need sysconfig data to be
-		// synchronized, and 2) sysconfig monitors usually collect very slowly,
-		// e.g. 1h, so if we synced it it could wait awhile before 1st tick.
-		tickChan := make(chan time.Time)
-		m.clock.Add(tickChan, c.Report, false)
-
 		// Start the monitor.
-		if err = monitor.Start(tickChan, m.reportChan); err != nil {
+		if err = m.startMonitor(name, monitor, c); err != nil {
 			return cmd.Reply(nil, errors.New("Start "+name+": "+err.Error()))
 		}
-		m.mux.Lock()
-		m.monitors[name] = monitor
-		m.mux.Unlock()
 
 		// Save the monitor-specific config to disk so agent starts on restart.
 		monitorConfig := monitor.Config()
@@ -211,14 +207,40 @@ func (m *Manager) Handle(cmd *proto.Cmd) *proto.Reply {
 		}
 		m.mux.Lock()
 		delete(m.monitors, name)
+		delete(m.full, name)
 		m.mux.Unlock()
+
+		// Forget the monitor's last settings so if it's started again its
+		// first report is a full report, not a diff against stale settings.
+		m.lastMux.Lock()
+		delete(m.last, name)
+		err = removeLastReports(name)
+		m.lastMux.Unlock()
+		if err != nil {
+			m.logger.Warn("Remove " + name + " settings: " + err.Error())
+		}
+		return cmd.Reply(nil) // success
+	case "SetConfig":
+		c, name, err := m.getMonitorConfig(cmd)
+		if err != nil {
+			return cmd.Reply(nil, err)
+		}
+		m.status.UpdateRe("sysconfig", "Setting "+name+" config", cmd)
+		m.logger.Info("Set", name, cmd)
+		m.mux.RLock()
+		oldMonitor, ok := m.monitors[name]
+		m.mux.RUnlock()
+		if !ok {
+			return cmd.Reply(nil, errors.New("Unknown monitor: "+name))
+		}
+		if err := m.setMonitorConfig(name, oldMonitor, c, cmd.Data); err != nil {
+			return cmd.Reply(nil, err)
+		}
 		return cmd.Reply(nil) // success
 	case "GetConfig":
 		config, errs := m.GetConfig()
 		return cmd.Reply(config, errs...)
 	default:
-		// SetConfig does not work by design.  To re-configure a monitor,
-		// stop it then start it again with the new config.
 		return cmd.Reply(nil, pct.UnknownCmdError{Cmd: cmd.Cmd})
 	}
 }
@@ -288,11 +310,154 @@ func (m *Manager) spooler() {
 		m.status.Update("sysconfig-spooler", "Stopped")
 	}()
 	m.status.Update("sysconfig-spooler", "Running")
-	for s := range m.reportChan {
-		if err := m.spool.Write("sysconfig", s); err != nil {
-			m.logger.Warn("Lost report:", err)
+	for r := range m.reportChan {
+		for _, s := range m.reports(r) {
+			if err := m.spool.Write("sysconfig", s); err != nil {
+				m.logger.Warn("Lost report:", err)
+			}
+		}
+	}
+}
+
+// reports returns the reports to spool for the given full report from a monitor:
+// a diff report if the settings changed since its last report, and the full report
+// if this is the first report for its system or the full report interval elapsed.
+// If nothing changed and a full report isn't due, it returns no reports.
+func (m *Manager) reports(r *Report) []*Report {
+	name := "sysconfig-" + m.im.Name(r.Service, r.InstanceId)
+
+	m.mux.RLock()
+	full := m.full[name]
+	m.mux.RUnlock()
+	if full == 0 {
+		full = DEFAULT_FULL_REPORT
+	}
+
+	m.lastMux.Lock()
+	defer m.lastMux.Unlock()
+
+	last, ok := m.last[name]
+	if !ok {
+		var err error
+		if last, err = readLastReports(name); err != nil {
+			m.logger.Warn("Read " + name + " settings: " + err.Error())
+		}
+		m.last[name] = last
+	}
+
+	reports := []*Report{}
+	prev, havePrev := last[r.System]
+	if !havePrev {
+		prev = &lastReport{}
+	} else if changes := Diff(prev.Settings, r.Settings); len(changes) > 0 {
+		diff := &Report{
+			ServiceInstance: r.ServiceInstance,
+			Ts:              r.Ts,
+			System:          r.System,
+			Settings:        []Setting{},
+			Changes:         changes,
+			Drift:           r.Drift,
+		}
+		reports = append(reports, diff)
+	}
+
+	fullTs := prev.FullTs
+	if !havePrev || r.Ts-prev.FullTs >= int64(full) {
+		reports = append(reports, r)
+		fullTs = r.Ts
+	}
+
+	if len(reports) == 0 {
+		return reports // no changes
+	}
+
+	last[r.System] = &lastReport{
+		FullTs:   fullTs,
+		Settings: r.Settings,
+	}
+	if err := writeLastReports(name, last); err != nil {
+		m.logger.Warn("Write " + name + " settings: " + err.Error())
+	}
+
+	return reports
+}
+
+// setMonitorConfig replaces the running oldMonitor with a monitor made from
+// the new config data.  The monitor's last settings are kept, so its next
+// report is a diff against them.  If the new monitor fails to start, the old
+// config is restored.
+// @goroutine[0]
+func (m *Manager) setMonitorConfig(name string, oldMonitor Monitor, c *Config, data []byte) error {
+	oldData, err := json.Marshal(oldMonitor.Config())
+	if err != nil {
+		return errors.New("Encode " + name + " config: " + err.Error())
+	}
+
+	// Make the new monitor first so a bad config doesn't stop the old monitor.
+	monitor, err := m.factory.Make(c.Service, c.InstanceId, data)
+	if err != nil {
+		return errors.New("Factory: " + err.Error())
+	}
+
+	if err := oldMonitor.Stop(); err != nil {
+		return errors.New("Stop " + name + ": " + err.Error())
+	}
+	m.clock.Remove(oldMonitor.TickChan())
+
+	if err := m.startMonitor(name, monitor, c); err != nil {
+		startErr := errors.New("Start " + name + ": " + err.Error())
+		if err := m.restoreMonitor(name, oldData); err != nil {
+			m.logger.Error("Restore " + name + ": " + err.Error())
 		}
+		return startErr
+	}
+
+	if err := pct.Basedir.WriteConfig(name, monitor.Config()); err != nil {
+		return errors.New("Write " + name + " config:" + err.Error())
+	}
+	return nil
+}
+
+// restoreMonitor starts a new monitor with the old config data after
+// setMonitorConfig failed to start the new one.
+// @goroutine[0]
+func (m *Manager) restoreMonitor(name string, data []byte) error {
+	c := &Config{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	monitor, err := m.factory.Make(c.Service, c.InstanceId, data)
+	if err != nil {
+		return err
 	}
+	if err := m.startMonitor(name, monitor, c); err != nil {
+		m.mux.Lock()
+		delete(m.monitors, name)
+		delete(m.full, name)
+		m.mux.Unlock()
+		return err
+	}
+	return nil
+}
+
+// startMonitor starts the monitor with a ticker for its report interval.
+// @goroutine[0]
+func (m *Manager) startMonitor(name string, monitor Monitor, c *Config) error {
+	// Make unsynchronized (3rd arg=false) ticker for collect interval,
+	// it's unsynchronized because 1) we don't need sysconfig data to be
+	// synchronized, and 2) sysconfig monitors usually collect very slowly,
+	// e.g. 1h, so if we synced it it could wait awhile before 1st tick.
+	tickChan := make(chan time.Time)
+	m.clock.Add(tickChan, c.Report, false)
+	if err := monitor.Start(tickChan, m.reportChan); err != nil {
+		m.clock.Remove(tickChan)
+		return err
+	}
+	m.mux.Lock()
+	m.monitors[name] = monitor
+	m.full[name] = c.Full
+	m.mux.Unlock()
+	return nil
 }
 
 func (m *Manager) getMonitorConfig(cmd *proto.Cmd) (*Config, string, error) {
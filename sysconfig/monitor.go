@@ -37,9 +37,24 @@ type MonitorFactory interface {
 // ["variable", "value"]
 type Setting [2]string
 
+// A full report has all Settings and no Changes.  A diff report has only
+// the Changes since the previous report for the same System.  Drift is set
+// for systems that compare two sources of the same settings, and it's always
+// the current drift, even in diff reports.
 type Report struct {
 	proto.ServiceInstance
 	Ts       int64 // UTC Unix timestamp
 	System   string
 	Settings []Setting
+	Changes  []Change `json:",omitempty"`
+	Drift    []Drift  `json:",omitempty"`
+}
+
+// A Drift is a setting whose value in a config file differs from its
+// runtime value, e.g. a SET GLOBAL that was not persisted in my.cnf.
+type Drift struct {
+	Variable     string
+	File         string
+	FileValue    string
+	RuntimeValue string
 }
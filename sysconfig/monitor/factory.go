@@ -24,8 +24,11 @@ import (
 	"github.com/percona/percona-agent/instance"
 	mysqlConn "github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
+	pgConn "github.com/percona/percona-agent/postgres"
 	"github.com/percona/percona-agent/sysconfig"
 	"github.com/percona/percona-agent/sysconfig/mysql"
+	"github.com/percona/percona-agent/sysconfig/postgres"
+	"github.com/percona/percona-agent/sysconfig/system"
 )
 
 type Factory struct {
@@ -67,6 +70,44 @@ func (f *Factory) Make(service string, instanceId uint, data []byte) (sysconfig.
 			pct.NewLogger(f.logChan, alias),
 			mysqlConn.NewConnection(mysqlIt.DSN),
 		)
+	case "postgres":
+		// Load the PostgreSQL instance info (DSN, name, etc.).
+		pgIt := &instance.PostgreSQLInstance{}
+		if err := f.ir.Get(service, instanceId, pgIt); err != nil {
+			return nil, err
+		}
+
+		// Parse the PostgreSQL sysconfig config.
+		config := &postgres.Config{}
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+
+		alias := "sysconfig-postgres-" + pgIt.Hostname
+
+		// Make a PostgreSQL sysconfig monitor.
+		monitor = postgres.NewMonitor(
+			alias,
+			config,
+			pct.NewLogger(f.logChan, alias),
+			pgConn.NewConnection(pgIt.DSN),
+		)
+	case "server":
+		// Parse the system sysconfig config.
+		config := &system.Config{}
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+
+		// Only one system, so no "-instanceName" suffix like mm-system.
+		alias := "sysconfig-system"
+
+		// Make a system sysconfig monitor.
+		monitor = system.NewMonitor(
+			alias,
+			config,
+			pct.NewLogger(f.logChan, alias),
+		)
 	default:
 		return nil, errors.New("Unknown sysconfig monitor type: " + service)
 	}
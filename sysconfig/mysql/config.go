@@ -23,4 +23,5 @@ import (
 
 type Config struct {
 	sysconfig.Config
+	OptionFiles bool // report my.cnf options and drift from global variables
 }
@@ -120,6 +120,14 @@ func (m *Monitor) run() {
 		m.sync.Done()
 	}()
 
+	// mysqld and its option files are found on the local host, so they're
+	// only the ones of the MySQL instance if it's local.
+	optionFiles := m.config.OptionFiles
+	if optionFiles && !mysql.LocalDSN(m.conn.DSN()) {
+		m.logger.Info("Not reading option files because MySQL is not on this host")
+		optionFiles = false
+	}
+
 	var lastTs int64
 	for {
 		m.logger.Debug("run:idle")
@@ -159,17 +167,24 @@ func (m *Monitor) run() {
 			m.status.Update(m.name+"-mysql", "Disconnected (OK)")
 
 			if len(c.Settings) > 0 {
-				select {
-				case m.reportChan <- c:
+				if m.send(c) {
 					lastTs = c.Ts
-				case <-time.After(500 * time.Millisecond):
-					// lost sysconfig
-					m.logger.Debug("Lost MySQL settings; timeout spooling after 500ms")
 				}
 			} else {
 				m.logger.Debug("No settings") // shouldn't happen
 			}
 
+			// Get options from my.cnf and their drift from global variables.
+			if optionFiles && len(c.Settings) > 0 {
+				options, drift, err := m.GetOptionFiles(c)
+				if err != nil {
+					m.logger.Warn(err)
+				} else {
+					m.send(options)
+					m.send(drift)
+				}
+			}
+
 			m.logger.Debug("run:collect:stop")
 		case <-m.sync.StopChan:
 			m.logger.Debug("run:stop")
@@ -178,6 +193,18 @@ func (m *Monitor) run() {
 	}
 }
 
+// @goroutine[2]
+func (m *Monitor) send(c *sysconfig.Report) bool {
+	select {
+	case m.reportChan <- c:
+		return true
+	case <-time.After(500 * time.Millisecond):
+		// lost sysconfig
+		m.logger.Debug("Lost " + c.System + "; timeout spooling after 500ms")
+		return false
+	}
+}
+
 // @goroutine[2]
 func (m *Monitor) GetGlobalVariables(conn *sql.DB, c *sysconfig.Report) error {
 	m.logger.Debug("Getting global variables")
@@ -205,3 +232,52 @@ func (m *Monitor) GetGlobalVariables(conn *sql.DB, c *sysconfig.Report) error {
 	}
 	return nil
 }
+
+// GetOptionFiles returns a report of the options in the option files (my.cnf)
+// that mysqld reads, and a report of the options that differ from the global
+// variables in vars.  The latter's settings are the runtime values of the
+// drifted variables.
+// @goroutine[2]
+func (m *Monitor) GetOptionFiles(vars *sysconfig.Report) (*sysconfig.Report, *sysconfig.Report, error) {
+	m.logger.Debug("Getting option files")
+	m.status.Update(m.name, "Getting option files")
+
+	runtime := make(map[string]string, len(vars.Settings))
+	for _, s := range vars.Settings {
+		runtime[s[0]] = s[1]
+	}
+
+	// Find mysqld by its PID file to know which option files it read.
+	args, env, err := MysqldArgs(runtime["pid_file"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot get mysqld args: %s", err)
+	}
+	files, groupSuffix := DefaultOptionFiles(args, env)
+	groups := OptionGroups(runtime["version"], groupSuffix)
+	options, read, err := ReadOptionFiles(files, groups)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.logger.Debug("Read option files: ", read)
+
+	optionsReport := &sysconfig.Report{
+		ServiceInstance: vars.ServiceInstance,
+		Ts:              vars.Ts,
+		System:          "mysql option files",
+		Settings:        OptionSettings(options),
+	}
+
+	drift := OptionDrift(options, runtime)
+	driftReport := &sysconfig.Report{
+		ServiceInstance: vars.ServiceInstance,
+		Ts:              vars.Ts,
+		System:          "mysql option file drift",
+		Settings:        make([]sysconfig.Setting, len(drift)),
+		Drift:           drift,
+	}
+	for i, d := range drift {
+		driftReport.Settings[i] = sysconfig.Setting{d.Variable, d.RuntimeValue}
+	}
+
+	return optionsReport, driftReport, nil
+}
@@ -133,3 +133,209 @@ func (s *TestSuite) TestStartCollectStop(t *C) {
 		t.Fatal("Monitor has stopped")
 	}
 }
+
+/////////////////////////////////////////////////////////////////////////////
+// Option file test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type OptionFileTestSuite struct {
+	sample string
+}
+
+var _ = Suite(&OptionFileTestSuite{})
+
+func (s *OptionFileTestSuite) SetUpSuite(t *C) {
+	s.sample = test.RootDir + "/sysconfig/mysql"
+}
+
+func (s *OptionFileTestSuite) TestDefaultOptionFiles(t *C) {
+	files, suffix := mysql.DefaultOptionFiles(
+		[]string{"/usr/sbin/mysqld", "--defaults-group-suffix=_a", "--basedir=/usr"},
+		map[string]string{"HOME": "/home/mysql", "MYSQL_HOME": "/usr"},
+	)
+	expect := []string{"/etc/my.cnf", "/etc/mysql/my.cnf", "/usr/my.cnf", "/home/mysql/.my.cnf"}
+	if same, diff := test.IsDeeply(files, expect); !same {
+		test.Dump(files)
+		t.Error(diff)
+	}
+	t.Check(suffix, Equals, "_a")
+
+	files, _ = mysql.DefaultOptionFiles(
+		[]string{"/usr/sbin/mysqld", "--defaults-extra-file=/etc/extra.cnf"},
+		map[string]string{},
+	)
+	expect = []string{"/etc/my.cnf", "/etc/mysql/my.cnf", "/etc/extra.cnf"}
+	if same, diff := test.IsDeeply(files, expect); !same {
+		test.Dump(files)
+		t.Error(diff)
+	}
+
+	files, _ = mysql.DefaultOptionFiles(
+		[]string{"/usr/sbin/mysqld", "--defaults-file=/etc/my-3307.cnf"},
+		map[string]string{"HOME": "/home/mysql"},
+	)
+	t.Check(files, DeepEquals, []string{"/etc/my-3307.cnf"})
+
+	files, _ = mysql.DefaultOptionFiles([]string{"/usr/sbin/mysqld", "--no-defaults"}, nil)
+	t.Check(files, HasLen, 0)
+}
+
+func (s *OptionFileTestSuite) TestOptionGroups(t *C) {
+	got := mysql.OptionGroups("5.6.24-72.2-log", "")
+	t.Check(got, DeepEquals, []string{"mysqld", "server", "mysqld-5.6"})
+
+	got = mysql.OptionGroups("10.0.17-MariaDB", "_a")
+	expect := []string{
+		"mysqld", "server", "mysqld-10.0", "mariadb",
+		"mysqld_a", "server_a", "mysqld-10.0_a", "mariadb_a",
+	}
+	t.Check(got, DeepEquals, expect)
+}
+
+func (s *OptionFileTestSuite) TestReadOptionFiles(t *C) {
+	myCnf := s.sample + "/my.cnf"
+	files := []string{myCnf, s.sample + "/does-not-exist.cnf"}
+	groups := mysql.OptionGroups("5.6.24", "")
+	options, read, err := mysql.ReadOptionFiles(files, groups)
+	t.Assert(err, IsNil)
+
+	expectRead := []string{
+		myCnf,
+		s.sample + "/extra.cnf",
+		s.sample + "/conf.d/01-a.cnf",
+		s.sample + "/conf.d/02-b.cnf",
+	}
+	if same, diff := test.IsDeeply(read, expectRead); !same {
+		test.Dump(read)
+		t.Error(diff)
+	}
+
+	expect := []mysql.Option{
+		{"datadir", "/var/lib/mysql", myCnf},
+		{"port", "3306", myCnf},
+		{"skip_name_resolve", "", myCnf},
+		{"innodb_buffer_pool_size", "1G", myCnf},
+		{"innodb_flush_log_at_trx_commit", "1", myCnf},
+		{"max_connections", "100", myCnf},
+		{"user", "mysql", myCnf},
+		{"sql_mode", "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", myCnf},
+		{"sync_binlog", "0", s.sample + "/extra.cnf"},
+		{"max_connections", "500", s.sample + "/conf.d/01-a.cnf"},
+		{"read_only", "ON", s.sample + "/conf.d/02-b.cnf"},
+	}
+	if same, diff := test.IsDeeply(options, expect); !same {
+		test.Dump(options)
+		t.Error(diff)
+	}
+
+	// Options that mysqld converts, and secrets.
+	options = append(options,
+		mysql.Option{Name: "log_bin", Value: "mysql-bin", File: myCnf},
+		mysql.Option{Name: "pid_file", Value: "db1.pid", File: myCnf},
+		mysql.Option{Name: "log_error", Value: "/var/log/mysql/error.log", File: myCnf},
+		mysql.Option{Name: "wsrep_sst_auth", Value: "sst:secret", File: myCnf},
+		mysql.Option{Name: "report_password", Value: "secret", File: myCnf},
+	)
+
+	// Last value wins, and secrets are hidden.
+	settings := mysql.OptionSettings(options)
+	expectSettings := []sysconfig.Setting{
+		{"datadir", "/var/lib/mysql"},
+		{"innodb_buffer_pool_size", "1G"},
+		{"innodb_flush_log_at_trx_commit", "1"},
+		{"log_bin", "mysql-bin"},
+		{"log_error", "/var/log/mysql/error.log"},
+		{"max_connections", "500"},
+		{"pid_file", "db1.pid"},
+		{"port", "3306"},
+		{"read_only", "ON"},
+		{"report_password", mysqlConn.HiddenPassword},
+		{"skip_name_resolve", ""},
+		{"sql_mode", "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION"},
+		{"sync_binlog", "0"},
+		{"user", "mysql"},
+		{"wsrep_sst_auth", mysqlConn.HiddenPassword},
+	}
+	if same, diff := test.IsDeeply(settings, expectSettings); !same {
+		test.Dump(settings)
+		t.Error(diff)
+	}
+
+	runtime := map[string]string{
+		"datadir":                        "/var/lib/mysql/",
+		"innodb_buffer_pool_size":        "1073741824",
+		"innodb_flush_log_at_trx_commit": "2", // SET GLOBAL not persisted
+		"log_bin":                        "ON",
+		"log_error":                      "/var/log/mysql/mysqld.log", // changed but not restarted
+		"max_connections":                "500",
+		"pid_file":                       "/var/lib/mysql/db1.pid",
+		"port":                           "3306",
+		"read_only":                      "OFF", // SET GLOBAL not persisted
+		"report_password":                "other",
+		"skip_name_resolve":              "ON",
+		"sql_mode":                       "NO_ENGINE_SUBSTITUTION,STRICT_TRANS_TABLES",
+		"sync_binlog":                    "0",
+		"wsrep_sst_auth":                 "********",
+	}
+	drift := mysql.OptionDrift(options, runtime)
+	expectDrift := []sysconfig.Drift{
+		{
+			Variable:     "innodb_flush_log_at_trx_commit",
+			File:         myCnf,
+			FileValue:    "1",
+			RuntimeValue: "2",
+		},
+		{
+			Variable:     "log_error",
+			File:         myCnf,
+			FileValue:    "/var/log/mysql/error.log",
+			RuntimeValue: "/var/log/mysql/mysqld.log",
+		},
+		{
+			Variable:     "read_only",
+			File:         s.sample + "/conf.d/02-b.cnf",
+			FileValue:    "ON",
+			RuntimeValue: "OFF",
+		},
+		{
+			Variable:     "report_password",
+			File:         myCnf,
+			FileValue:    mysqlConn.HiddenPassword,
+			RuntimeValue: mysqlConn.HiddenPassword,
+		},
+	}
+	if same, diff := test.IsDeeply(drift, expectDrift); !same {
+		test.Dump(drift)
+		t.Error(diff)
+	}
+}
+
+func (s *OptionFileTestSuite) TestSameOptionValue(t *C) {
+	datadir := "/var/lib/mysql/"
+	t.Check(mysql.SameOptionValue("skip_name_resolve", "", "ON", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("read_only", "1", "ON", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("read_only", "false", "OFF", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("read_only", "1", "OFF", datadir), Equals, false)
+	t.Check(mysql.SameOptionValue("innodb_buffer_pool_size", "128M", "134217728", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("innodb_buffer_pool_size", "128k", "134217728", datadir), Equals, false)
+	t.Check(mysql.SameOptionValue("max_connections", "100", "151", datadir), Equals, false)
+	t.Check(mysql.SameOptionValue("binlog_format", "ROW", "row", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("tmpdir", "/data/", "/data", datadir), Equals, true)
+
+	// log-bin is a path or base name, but the variable is ON.
+	t.Check(mysql.SameOptionValue("log_bin", "/var/log/mysql/mysql-bin", "ON", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("log_bin", "mysql-bin", "OFF", datadir), Equals, false)
+	t.Check(mysql.SameOptionValue("read_only", "mysql-bin", "ON", datadir), Equals, false)
+
+	// Relative paths are relative to the datadir.
+	t.Check(mysql.SameOptionValue("pid_file", "db1.pid", "/var/lib/mysql/db1.pid", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("log_error", "./db1.err", "./db1.err", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("slow_query_log_file", "slow.log", "/var/lib/mysql/slow.log", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("slow_query_log_file", "slow.log", "/tmp/slow.log", datadir), Equals, false)
+	t.Check(mysql.SameOptionValue("slow_query_log_file", "/var/lib/mysql/Slow.log", "/var/lib/mysql/slow.log", datadir), Equals, false)
+
+	// Sets are in any order.
+	t.Check(mysql.SameOptionValue("sql_mode", "STRICT_TRANS_TABLES, NO_ENGINE_SUBSTITUTION", "NO_ENGINE_SUBSTITUTION,STRICT_TRANS_TABLES", datadir), Equals, true)
+	t.Check(mysql.SameOptionValue("sql_mode", "STRICT_TRANS_TABLES", "NO_ENGINE_SUBSTITUTION,STRICT_TRANS_TABLES", datadir), Equals, false)
+	t.Check(mysql.SameOptionValue("sql_mode", "", "", datadir), Equals, true)
+}
@@ -0,0 +1,472 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/percona/percona-agent/mysql"
+	"github.com/percona/percona-agent/sysconfig"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_INCLUDE_DEPTH = 10
+)
+
+// An Option is one option in an option file (my.cnf).  Name is normalized like
+// a system variable: lowercase with underscores and no loose_ prefix.  Value is
+// empty for options given without a value, e.g. skip-name-resolve.
+type Option struct {
+	Name  string
+	Value string
+	File  string
+}
+
+// MysqldArgs returns the command line args and environment of the mysqld process
+// which wrote pidFile.  It only works if mysqld runs on the local host.
+func MysqldArgs(pidFile string) ([]string, map[string]string, error) {
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid PID in %s: %s", pidFile, err)
+	}
+
+	procDir := filepath.Join("/proc", strconv.Itoa(pid))
+	data, err = ioutil.ReadFile(filepath.Join(procDir, "cmdline"))
+	if err != nil {
+		return nil, nil, err
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+
+	// Environment is only readable by the mysqld user and root, but it's only
+	// needed for MYSQL_HOME and HOME, so it's ok if it can't be read.
+	env := make(map[string]string)
+	if data, err = ioutil.ReadFile(filepath.Join(procDir, "environ")); err == nil {
+		for _, kv := range strings.Split(string(data), "\x00") {
+			if i := strings.Index(kv, "="); i > 0 {
+				env[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+
+	return args, env, nil
+}
+
+// DefaultOptionFiles returns the option files that mysqld started with args and
+// env reads, in the order it reads them, and the group suffix if any.  Files that
+// do not exist are not filtered out.
+func DefaultOptionFiles(args []string, env map[string]string) ([]string, string) {
+	var defaultsFile, extraFile, groupSuffix string
+	noDefaults := false
+	// --no-defaults, etc. must be the first options, but be lenient.
+	for _, arg := range args {
+		switch {
+		case arg == "--no-defaults":
+			noDefaults = true
+		case strings.HasPrefix(arg, "--defaults-file="):
+			defaultsFile = strings.TrimPrefix(arg, "--defaults-file=")
+		case strings.HasPrefix(arg, "--defaults-extra-file="):
+			extraFile = strings.TrimPrefix(arg, "--defaults-extra-file=")
+		case strings.HasPrefix(arg, "--defaults-group-suffix="):
+			groupSuffix = strings.TrimPrefix(arg, "--defaults-group-suffix=")
+		}
+	}
+	if suffix, ok := env["MYSQL_GROUP_SUFFIX"]; ok && groupSuffix == "" {
+		groupSuffix = suffix
+	}
+
+	if noDefaults {
+		return []string{}, groupSuffix
+	}
+	if defaultsFile != "" {
+		return []string{defaultsFile}, groupSuffix
+	}
+
+	files := []string{"/etc/my.cnf", "/etc/mysql/my.cnf"}
+	if home, ok := env["MYSQL_HOME"]; ok && home != "" {
+		files = append(files, filepath.Join(home, "my.cnf"))
+	}
+	if extraFile != "" {
+		files = append(files, extraFile)
+	}
+	if home, ok := env["HOME"]; ok && home != "" {
+		files = append(files, filepath.Join(home, ".my.cnf"))
+	}
+	return files, groupSuffix
+}
+
+var reVersion = regexp.MustCompile(`^(\d+\.\d+)`)
+
+// OptionGroups returns the option file groups that mysqld reads given its version
+// (@@version) and group suffix (--defaults-group-suffix).
+func OptionGroups(version, suffix string) []string {
+	groups := []string{"mysqld", "server"}
+	if m := reVersion.FindStringSubmatch(version); m != nil {
+		groups = append(groups, "mysqld-"+m[1])
+	}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		groups = append(groups, "mariadb")
+	}
+	if suffix != "" {
+		for _, g := range groups {
+			groups = append(groups, g+suffix)
+		}
+	}
+	return groups
+}
+
+// ReadOptionFiles returns the options in the given groups from the given option
+// files and the files they include, in the order mysqld reads them.  Files that
+// do not exist are skipped.  It returns the files read, too.
+func ReadOptionFiles(files []string, groups []string) ([]Option, []string, error) {
+	r := &optionFileReader{
+		groups:  make(map[string]bool),
+		options: []Option{},
+		read:    []string{},
+	}
+	for _, g := range groups {
+		r.groups[g] = true
+	}
+	for _, file := range files {
+		if err := r.readFile(file, 0); err != nil {
+			return r.options, r.read, err
+		}
+	}
+	return r.options, r.read, nil
+}
+
+type optionFileReader struct {
+	groups  map[string]bool
+	options []Option
+	read    []string
+}
+
+func (r *optionFileReader) readFile(file string, depth int) error {
+	if depth > MAX_INCLUDE_DEPTH {
+		return fmt.Errorf("Too many nested includes in %s", file)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	r.read = append(r.read, file)
+
+	inGroup := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		// !include and !includedir are read regardless of the current group.
+		if strings.HasPrefix(line, "!includedir") {
+			dir := r.includePath(file, strings.TrimSpace(strings.TrimPrefix(line, "!includedir")))
+			if err := r.readDir(dir, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "!include") {
+			inc := r.includePath(file, strings.TrimSpace(strings.TrimPrefix(line, "!include")))
+			if err := r.readFile(inc, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return fmt.Errorf("Invalid group in %s: %s", file, line)
+			}
+			group := strings.ToLower(strings.TrimSpace(line[1:end]))
+			inGroup = r.groups[group]
+			continue
+		}
+
+		if !inGroup {
+			continue
+		}
+
+		name, value := line, ""
+		if i := strings.Index(line, "="); i >= 0 {
+			name, value = line[:i], optionValue(line[i+1:])
+		}
+		r.options = append(r.options, Option{
+			Name:  OptionName(name),
+			Value: value,
+			File:  file,
+		})
+	}
+	return scanner.Err()
+}
+
+func (r *optionFileReader) readDir(dir string, depth int) error {
+	// mysqld reads only *.cnf files from !includedir on Unix.
+	files, err := filepath.Glob(filepath.Join(dir, "*.cnf"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if err := r.readFile(file, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *optionFileReader) includePath(file, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(file), path)
+}
+
+// OptionName normalizes an option name like a system variable name,
+// e.g. "loose-Innodb-Buffer-Pool-Size" becomes "innodb_buffer_pool_size".
+func OptionName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.Replace(name, "-", "_", -1)
+	return strings.TrimPrefix(name, "loose_")
+}
+
+// optionValue returns the value with quotes and trailing comment removed.
+func optionValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	if i := strings.Index(value, "#"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// SecretOption returns true if the option value is a secret, like a password,
+// which must not be reported.
+func SecretOption(name string) bool {
+	return name == "wsrep_sst_auth" || strings.Contains(name, "password")
+}
+
+// OptionSettings returns the options as settings sorted by name.  Like mysqld,
+// the last value of an option wins.  Secret option values are hidden.
+func OptionSettings(options []Option) []sysconfig.Setting {
+	last := make(map[string]string)
+	for _, o := range options {
+		if SecretOption(o.Name) {
+			last[o.Name] = mysql.HiddenPassword
+		} else {
+			last[o.Name] = o.Value
+		}
+	}
+	names := make([]string, 0, len(last))
+	for name := range last {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	settings := make([]sysconfig.Setting, len(names))
+	for i, name := range names {
+		settings[i] = sysconfig.Setting{name, last[name]}
+	}
+	return settings
+}
+
+// OptionDrift returns the options whose value differs from the runtime value of
+// the variable of the same name, sorted by name.  Options that are not variables,
+// e.g. "user", are ignored.  Secret option values are compared but hidden.
+func OptionDrift(options []Option, runtime map[string]string) []sysconfig.Drift {
+	last := make(map[string]Option)
+	for _, o := range options {
+		name, value := o.Name, o.Value
+		if _, ok := runtime[name]; !ok {
+			// --skip-foo, --disable-foo and --enable-foo set variable foo.
+			for _, prefix := range []string{"skip_", "disable_", "enable_"} {
+				if strings.HasPrefix(name, prefix) && value == "" {
+					name = strings.TrimPrefix(name, prefix)
+					if prefix == "enable_" {
+						value = "ON"
+					} else {
+						value = "OFF"
+					}
+					break
+				}
+			}
+		}
+		last[name] = Option{Name: name, Value: value, File: o.File}
+	}
+
+	drift := []sysconfig.Drift{}
+	for name, o := range last {
+		runtimeValue, ok := runtime[name]
+		if !ok {
+			continue
+		}
+		if SameOptionValue(name, o.Value, runtimeValue, runtime["datadir"]) {
+			continue
+		}
+		fileValue := o.Value
+		if SecretOption(name) {
+			if strings.Trim(runtimeValue, "*") == "" {
+				continue // MySQL hides the value, e.g. wsrep_sst_auth, so it can't be compared
+			}
+			fileValue = mysql.HiddenPassword
+			runtimeValue = mysql.HiddenPassword
+		}
+		drift = append(drift, sysconfig.Drift{
+			Variable:     name,
+			File:         o.File,
+			FileValue:    fileValue,
+			RuntimeValue: runtimeValue,
+		})
+	}
+	sort.Sort(byDriftVariable(drift))
+	return drift
+}
+
+type byDriftVariable []sysconfig.Drift
+
+func (d byDriftVariable) Len() int           { return len(d) }
+func (d byDriftVariable) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byDriftVariable) Less(i, j int) bool { return d[i].Variable < d[j].Variable }
+
+var reSize = regexp.MustCompile(`^(\d+)([kmgtpe])$`)
+
+// Options whose value is a path or base name, but whose variable is ON,
+// e.g. log-bin=mysql-bin.
+var pathBoolOptions = map[string]bool{
+	"log_bin":           true,
+	"log_slave_updates": true,
+}
+
+// Options whose value is a path which mysqld resolves against the datadir if
+// it's relative, e.g. pid-file=db1.pid is /var/lib/mysql/db1.pid at runtime.
+var datadirPathOptions = map[string]bool{
+	"pid_file":            true,
+	"log_error":           true,
+	"slow_query_log_file": true,
+	"general_log_file":    true,
+	"log_bin_index":       true,
+	"relay_log_index":     true,
+}
+
+// Options whose value is a comma-separated set in any order, e.g. sql_mode.
+var setOptions = map[string]bool{
+	"sql_mode":               true,
+	"log_output":             true,
+	"slave_type_conversions": true,
+}
+
+// SameOptionValue returns true if the option file value and runtime value of
+// the named option are the same, allowing for how mysqld converts option values:
+// boolean options can be given as 1/0, on/off, true/false, or no value, sizes
+// with K, M, G, etc., paths relative to the datadir, and sets in any order.
+func SameOptionValue(name, fileValue, runtimeValue, datadir string) bool {
+	// Paths are case-sensitive, so compare them first.
+	if datadirPathOptions[name] && fileValue != "" && datadir != "" {
+		resolve := func(path string) string {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(datadir, path)
+			}
+			return filepath.Clean(path)
+		}
+		return resolve(fileValue) == resolve(runtimeValue)
+	}
+
+	f := strings.ToLower(fileValue)
+	r := strings.ToLower(runtimeValue)
+	if f == r {
+		return true
+	}
+
+	if r == "on" || r == "off" {
+		switch f {
+		case "", "1", "on", "true", "yes":
+			return r == "on"
+		case "0", "off", "false", "no":
+			return r == "off"
+		}
+		if pathBoolOptions[name] {
+			return r == "on"
+		}
+		return false
+	}
+
+	if setOptions[name] {
+		return sameSet(f, r)
+	}
+
+	if rn, err := strconv.ParseUint(r, 10, 64); err == nil {
+		if m := reSize.FindStringSubmatch(f); m != nil {
+			n, err := strconv.ParseUint(m[1], 10, 64)
+			if err != nil {
+				return false
+			}
+			shift := uint(10 * (strings.Index("kmgtpe", m[2]) + 1))
+			return n<<shift == rn
+		}
+		return false
+	}
+
+	// Directories, e.g. datadir=/var/lib/mysql is /var/lib/mysql/ at runtime.
+	if strings.TrimRight(f, "/") == strings.TrimRight(r, "/") && f != "" {
+		return true
+	}
+
+	return false
+}
+
+// sameSet returns true if the comma-separated values have the same items.
+func sameSet(a, b string) bool {
+	items := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				set[item] = true
+			}
+		}
+		return set
+	}
+	setA, setB := items(a), items(b)
+	if len(setA) != len(setB) {
+		return false
+	}
+	for item := range setA {
+		if !setB[item] {
+			return false
+		}
+	}
+	return true
+}
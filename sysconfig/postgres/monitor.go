@@ -0,0 +1,266 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/mysql"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/sysconfig"
+)
+
+type Monitor struct {
+	name   string
+	config *Config
+	logger *pct.Logger
+	conn   mysql.Connector // postgres.Connection
+	// --
+	tickChan   chan time.Time
+	reportChan chan *sysconfig.Report
+	status     *pct.Status
+	sync       *pct.SyncChan
+	running    bool
+}
+
+func NewMonitor(name string, config *Config, logger *pct.Logger, conn mysql.Connector) *Monitor {
+	m := &Monitor{
+		name:   name,
+		config: config,
+		logger: logger,
+		conn:   conn,
+		// --
+		sync:   pct.NewSyncChan(),
+		status: pct.NewStatus([]string{name, name + "-postgres"}),
+	}
+	return m
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Interface
+/////////////////////////////////////////////////////////////////////////////
+
+// @goroutine[0]
+func (m *Monitor) Start(tickChan chan time.Time, reportChan chan *sysconfig.Report) error {
+	if m.running {
+		return pct.ServiceIsRunningError{m.name}
+	}
+
+	m.status.Update(m.name, "Starting")
+	m.tickChan = tickChan
+	m.reportChan = reportChan
+	go m.run()
+	m.running = true
+	m.logger.Info("Started")
+	return nil
+}
+
+// @goroutine[0]
+func (m *Monitor) Stop() error {
+	if !m.running {
+		return nil // already stopped
+	}
+
+	// Stop run().  When it returns, it updates status to "Stopped".
+	m.status.Update(m.name, "Stopping")
+	m.sync.Stop()
+	m.sync.Wait()
+	m.running = false
+	m.logger.Info("Stopped")
+	// Do not update status to "Stopped" here; run() does that on return.
+
+	return nil
+}
+
+// @goroutine[0]
+func (m *Monitor) Status() map[string]string {
+	return m.status.All()
+}
+
+// @goroutine[0]
+func (m *Monitor) TickChan() chan time.Time {
+	return m.tickChan
+}
+
+// @goroutine[0]
+func (m *Monitor) Config() interface{} {
+	return m.config
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Implementation
+/////////////////////////////////////////////////////////////////////////////
+
+// @goroutine[2]
+func (m *Monitor) run() {
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("PostgreSQL sysconfig monitor crashed: ", err)
+		}
+		m.status.Update(m.name, "Stopped")
+		m.sync.Done()
+	}()
+
+	var lastTs int64
+	for {
+		m.logger.Debug("run:idle")
+		m.status.Update(m.name, fmt.Sprintf("Idle (last collected at %s)", time.Unix(lastTs, 0)))
+
+		select {
+		case now := <-m.tickChan:
+			m.logger.Debug("run:collect:start")
+			m.status.Update(m.name, "Running")
+
+			// Connect to PostgreSQL.
+			m.status.Update(m.name+"-postgres", "Connecting")
+			if err := m.conn.Connect(2); err != nil {
+				m.logger.Warn(err)
+				m.status.Update(m.name+"-postgres", "Error: "+err.Error())
+				continue
+			}
+			m.status.Update(m.name+"-postgres", "Connected")
+
+			c := &sysconfig.Report{
+				ServiceInstance: proto.ServiceInstance{
+					Service:    m.config.Service,
+					InstanceId: m.config.InstanceId,
+				},
+				Ts:       now.UTC().Unix(),
+				System:   "postgres settings",
+				Settings: []sysconfig.Setting{},
+			}
+
+			// Get pg_settings.
+			if err := m.GetSettings(m.conn.DB(), c); err != nil {
+				m.logger.Warn(err)
+			}
+
+			// Disconnect from PostgreSQL.
+			m.conn.Close()
+			m.status.Update(m.name+"-postgres", "Disconnected (OK)")
+
+			if len(c.Settings) > 0 {
+				select {
+				case m.reportChan <- c:
+					lastTs = c.Ts
+				case <-time.After(500 * time.Millisecond):
+					// lost sysconfig
+					m.logger.Debug("Lost PostgreSQL settings; timeout spooling after 500ms")
+				}
+			} else {
+				m.logger.Debug("No settings") // shouldn't happen
+			}
+
+			m.logger.Debug("run:collect:stop")
+		case <-m.sync.StopChan:
+			m.logger.Debug("run:stop")
+			return
+		}
+	}
+}
+
+// @goroutine[2]
+func (m *Monitor) GetSettings(conn *sql.DB, c *sysconfig.Report) error {
+	m.logger.Debug("Getting settings")
+	m.status.Update(m.name, "Getting pg_settings")
+
+	// Settings with a unit, e.g. shared_buffers 16384 8kB, are reported with
+	// the unit like SHOW shared_buffers: 128MB is easier to read than 16384.
+	rows, err := conn.Query("SELECT name, setting, COALESCE(unit, '') FROM pg_settings ORDER BY name")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, setting, unit string
+		if err = rows.Scan(&name, &setting, &unit); err != nil {
+			return err
+		}
+		c.Settings = append(c.Settings, sysconfig.Setting{name, FormatSetting(setting, unit)})
+	}
+	return rows.Err()
+}
+
+type unitSize struct {
+	unit string
+	size int64
+}
+
+// Largest first, like SHOW uses the largest unit that divides the value evenly.
+var memoryUnits = []unitSize{
+	{"TB", 1024 * 1024 * 1024},
+	{"GB", 1024 * 1024},
+	{"MB", 1024},
+	{"kB", 1},
+}
+
+var timeUnits = []unitSize{
+	{"d", 24 * 60 * 60 * 1000},
+	{"h", 60 * 60 * 1000},
+	{"min", 60 * 1000},
+	{"s", 1000},
+	{"ms", 1},
+}
+
+// FormatSetting returns the setting with its unit like SHOW does, e.g.
+// setting "16384" with unit "8kB" is "128MB". Settings without a unit,
+// and special values like -1, are returned as-is.
+func FormatSetting(setting, unit string) string {
+	if unit == "" {
+		return setting
+	}
+	v, err := strconv.ParseInt(setting, 10, 64)
+	if err != nil || v <= 0 {
+		return setting
+	}
+
+	// Unit is a base unit, e.g. kB or ms, with an optional multiplier, e.g. 8kB.
+	i := strings.IndexFunc(unit, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		return setting
+	}
+	baseUnit := unit[i:]
+	if i > 0 {
+		n, _ := strconv.ParseInt(unit[0:i], 10, 64)
+		v *= n
+	}
+
+	for _, units := range [][]unitSize{memoryUnits, timeUnits} {
+		var base int64
+		for _, u := range units {
+			if u.unit == baseUnit {
+				base = u.size
+			}
+		}
+		if base == 0 {
+			continue // not this kind of unit
+		}
+		v *= base
+		for _, u := range units {
+			if v%u.size == 0 {
+				return fmt.Sprintf("%d%s", v/u.size, u.unit)
+			}
+		}
+	}
+	return setting + unit // unknown unit
+}
@@ -0,0 +1,53 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/percona/percona-agent/sysconfig/postgres"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct {
+}
+
+var _ = Suite(&TestSuite{})
+
+func (s *TestSuite) TestFormatSetting(t *C) {
+	settings := []struct {
+		setting string
+		unit    string
+		expect  string
+	}{
+		{"16384", "8kB", "128MB"}, // shared_buffers
+		{"4096", "kB", "4MB"},     // work_mem
+		{"1048576", "kB", "1GB"},
+		{"200", "ms", "200ms"},
+		{"60", "s", "1min"},  // checkpoint_timeout 1min
+		{"300", "s", "5min"}, // checkpoint_timeout default
+		{"-1", "ms", "-1"},   // disabled, e.g. log_min_duration_statement
+		{"on", "", "on"},     // no unit
+		{"5", "foo", "5foo"}, // unknown unit
+	}
+	for _, s := range settings {
+		t.Check(postgres.FormatSetting(s.setting, s.unit), Equals, s.expect, Commentf("%s %s", s.setting, s.unit))
+	}
+}
@@ -0,0 +1,121 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package sysconfig
+
+import (
+	"encoding/json"
+	"github.com/percona/percona-agent/pct"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	CHANGE_ADDED   = "added"
+	CHANGE_REMOVED = "removed"
+	CHANGE_CHANGED = "changed"
+)
+
+// A Change is one difference between two sets of Settings.  OldValue is empty
+// for added variables and NewValue is empty for removed variables.
+type Change struct {
+	Variable string
+	Change   string // CHANGE_ADDED, CHANGE_REMOVED, or CHANGE_CHANGED
+	OldValue string
+	NewValue string
+}
+
+// Diff returns the changes from prev to cur sorted by variable name, or nil if
+// the settings are the same.
+func Diff(prev, cur []Setting) []Change {
+	prevVal := make(map[string]string, len(prev))
+	for _, s := range prev {
+		prevVal[s[0]] = s[1]
+	}
+	curVal := make(map[string]string, len(cur))
+	for _, s := range cur {
+		curVal[s[0]] = s[1]
+	}
+
+	var changes []Change
+	for name, newValue := range curVal {
+		oldValue, ok := prevVal[name]
+		if !ok {
+			changes = append(changes, Change{name, CHANGE_ADDED, "", newValue})
+		} else if oldValue != newValue {
+			changes = append(changes, Change{name, CHANGE_CHANGED, oldValue, newValue})
+		}
+	}
+	for name, oldValue := range prevVal {
+		if _, ok := curVal[name]; !ok {
+			changes = append(changes, Change{name, CHANGE_REMOVED, oldValue, ""})
+		}
+	}
+	sort.Sort(byVariable(changes))
+	return changes
+}
+
+type byVariable []Change
+
+func (c byVariable) Len() int           { return len(c) }
+func (c byVariable) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byVariable) Less(i, j int) bool { return c[i].Variable < c[j].Variable }
+
+// --------------------------------------------------------------------------
+
+// lastReport is the last settings of one system (Report.System) and when
+// a full report for it was last sent.  They are saved per monitor, keyed on
+// system, so changes made while the agent is not running are reported when
+// it starts again.
+type lastReport struct {
+	FullTs   int64
+	Settings []Setting
+}
+
+func lastReportFile(name string) string {
+	// Not .conf else manager would try to start it as a monitor.
+	return filepath.Join(pct.Basedir.Dir("config"), name+".settings")
+}
+
+func readLastReports(name string) (map[string]*lastReport, error) {
+	last := make(map[string]*lastReport)
+	data, err := ioutil.ReadFile(lastReportFile(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return last, nil
+		}
+		return last, err
+	}
+	if err := json.Unmarshal(data, &last); err != nil {
+		return make(map[string]*lastReport), err
+	}
+	return last, nil
+}
+
+func writeLastReports(name string, last map[string]*lastReport) error {
+	data, err := json.Marshal(last)
+	if err != nil {
+		return err
+	}
+	return pct.WriteFileAtomic(lastReportFile(name), data, 0600)
+}
+
+func removeLastReports(name string) error {
+	return pct.RemoveFile(lastReportFile(name))
+}
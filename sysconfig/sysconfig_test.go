@@ -339,3 +339,272 @@ func (s *ManagerTestSuite) TestGetConfig(t *C) {
 		t.Error(diff)
 	}
 }
+
+func (s *ManagerTestSuite) TestDiffReports(t *C) {
+	m := sysconfig.NewManager(s.logger, s.factory, s.clock, s.spool, s.im)
+	t.Assert(m, NotNil)
+
+	err := m.Start()
+	t.Assert(err, IsNil)
+
+	sysconfigConfig := &mysql.Config{
+		Config: sysconfig.Config{
+			ServiceInstance: proto.ServiceInstance{
+				Service:    "mysql",
+				InstanceId: 1,
+			},
+			Report: 3600,
+			Full:   7200,
+		},
+	}
+	sysconfigConfigData, err := json.Marshal(sysconfigConfig)
+	t.Assert(err, IsNil)
+	s.mockMonitor.SetConfig(sysconfigConfig)
+
+	cmd := &proto.Cmd{
+		User:    "daniel",
+		Service: "sysconfig",
+		Cmd:     "StartService",
+		Data:    sysconfigConfigData,
+	}
+	reply := m.Handle(cmd)
+	t.Assert(reply, NotNil)
+	t.Assert(reply.Error, Equals, "")
+
+	si := proto.ServiceInstance{Service: "mysql", InstanceId: 1}
+
+	// First report is sent as-is because there's nothing to diff against.
+	r1 := &sysconfig.Report{
+		ServiceInstance: si,
+		Ts:              1000,
+		System:          "mysql global variables",
+		Settings: []sysconfig.Setting{
+			{"a", "1"},
+			{"b", "2"},
+		},
+	}
+	s.mockMonitor.SendReport(r1)
+	got := test.WaitData(s.dataChan)
+	if same, diff := test.IsDeeply(got, []interface{}{r1}); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	// Same settings and full report not due yet: nothing is sent.
+	r2 := &sysconfig.Report{
+		ServiceInstance: si,
+		Ts:              2000,
+		System:          "mysql global variables",
+		Settings: []sysconfig.Setting{
+			{"a", "1"},
+			{"b", "2"},
+		},
+	}
+	s.mockMonitor.SendReport(r2)
+	got = test.WaitData(s.dataChan)
+	t.Check(got, HasLen, 0)
+
+	// b changed and c added: only a diff report is sent.
+	r3 := &sysconfig.Report{
+		ServiceInstance: si,
+		Ts:              3000,
+		System:          "mysql global variables",
+		Settings: []sysconfig.Setting{
+			{"a", "1"},
+			{"b", "3"},
+			{"c", "4"},
+		},
+	}
+	s.mockMonitor.SendReport(r3)
+	got = test.WaitData(s.dataChan)
+	expect := []interface{}{
+		&sysconfig.Report{
+			ServiceInstance: si,
+			Ts:              3000,
+			System:          "mysql global variables",
+			Settings:        []sysconfig.Setting{},
+			Changes: []sysconfig.Change{
+				{Variable: "b", Change: sysconfig.CHANGE_CHANGED, OldValue: "2", NewValue: "3"},
+				{Variable: "c", Change: sysconfig.CHANGE_ADDED, OldValue: "", NewValue: "4"},
+			},
+		},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	// Last settings are saved so they're diffed across agent restarts.
+	settingsFile := filepath.Join(s.configDir, "sysconfig-mysql-1.settings")
+	t.Check(pct.FileExists(settingsFile), Equals, true)
+
+	m.Stop()
+	s.factory.Set([]sysconfig.Monitor{s.mockMonitor})
+	m = sysconfig.NewManager(s.logger, s.factory, s.clock, s.spool, s.im)
+	err = m.Start()
+	t.Assert(err, IsNil)
+
+	// a removed while agent was stopped, and full report is due (9000-1000 >= 7200),
+	// so the diff report is followed by a full report.
+	r4 := &sysconfig.Report{
+		ServiceInstance: si,
+		Ts:              9000,
+		System:          "mysql global variables",
+		Settings: []sysconfig.Setting{
+			{"b", "3"},
+			{"c", "4"},
+		},
+	}
+	s.mockMonitor.SendReport(r4)
+	got = test.WaitData(s.dataChan)
+	expect = []interface{}{
+		&sysconfig.Report{
+			ServiceInstance: si,
+			Ts:              9000,
+			System:          "mysql global variables",
+			Settings:        []sysconfig.Setting{},
+			Changes: []sysconfig.Change{
+				{Variable: "a", Change: sysconfig.CHANGE_REMOVED, OldValue: "1", NewValue: ""},
+			},
+		},
+		r4,
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	// Stopping the monitor removes its last settings.
+	cmd.Cmd = "StopService"
+	reply = m.Handle(cmd)
+	t.Assert(reply, NotNil)
+	t.Check(reply.Error, Equals, "")
+	t.Check(pct.FileExists(settingsFile), Equals, false)
+
+	m.Stop()
+}
+
+func (s *ManagerTestSuite) TestSetConfig(t *C) {
+	m := sysconfig.NewManager(s.logger, s.factory, s.clock, s.spool, s.im)
+	t.Assert(m, NotNil)
+
+	err := m.Start()
+	t.Assert(err, IsNil)
+	defer m.Stop()
+
+	sysconfigConfig := &mysql.Config{
+		Config: sysconfig.Config{
+			ServiceInstance: proto.ServiceInstance{
+				Service:    "mysql",
+				InstanceId: 1,
+			},
+			Report: 3600,
+		},
+	}
+	sysconfigConfigData, err := json.Marshal(sysconfigConfig)
+	t.Assert(err, IsNil)
+	s.mockMonitor.SetConfig(sysconfigConfig)
+
+	cmd := &proto.Cmd{
+		User:    "daniel",
+		Service: "sysconfig",
+		Cmd:     "StartService",
+		Data:    sysconfigConfigData,
+	}
+	reply := m.Handle(cmd)
+	t.Assert(reply, NotNil)
+	t.Assert(reply.Error, Equals, "")
+
+	// Report every 10 minutes and read option files.  The mock factory makes
+	// the next monitor, so it must be set again.
+	newConfig := &mysql.Config{
+		Config: sysconfig.Config{
+			ServiceInstance: proto.ServiceInstance{
+				Service:    "mysql",
+				InstanceId: 1,
+			},
+			Report: 600,
+		},
+		OptionFiles: true,
+	}
+	newConfigData, err := json.Marshal(newConfig)
+	t.Assert(err, IsNil)
+	s.factory.Set([]sysconfig.Monitor{s.mockMonitor})
+	s.mockMonitor.SetConfig(newConfig)
+
+	cmd = &proto.Cmd{
+		User:    "daniel",
+		Service: "sysconfig",
+		Cmd:     "SetConfig",
+		Data:    newConfigData,
+	}
+	reply = m.Handle(cmd)
+	t.Assert(reply, NotNil)
+	t.Check(reply.Error, Equals, "")
+
+	status := s.mockMonitor.Status()
+	t.Check(status["monitor"], Equals, "Running")
+
+	// The 3600s ticker was replaced by a 600s ticker.
+	if ok, diff := test.IsDeeply(s.clock.Added, []uint{3600, 600}); !ok {
+		test.Dump(s.clock.Added)
+		t.Errorf("Replace 3600s ticker with 600s ticker\n%s", diff)
+	}
+	t.Check(s.clock.Removed, HasLen, 1)
+
+	data, err := ioutil.ReadFile(s.configDir + "/sysconfig-mysql-1.conf")
+	t.Check(err, IsNil)
+	gotConfig := &mysql.Config{}
+	err = json.Unmarshal(data, gotConfig)
+	t.Check(err, IsNil)
+	if same, diff := test.IsDeeply(gotConfig, newConfig); !same {
+		test.Dump(gotConfig)
+		t.Error(diff)
+	}
+
+	// GetConfig returns the new config.
+	configs, errs := m.GetConfig()
+	t.Check(errs, HasLen, 0)
+	t.Assert(configs, HasLen, 1)
+	t.Check(configs[0].Config, Equals, string(newConfigData))
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Diff test suite
+/////////////////////////////////////////////////////////////////////////////
+
+type DiffTestSuite struct {
+}
+
+var _ = Suite(&DiffTestSuite{})
+
+func (s *DiffTestSuite) TestDiff(t *C) {
+	prev := []sysconfig.Setting{
+		{"max_connections", "151"},
+		{"read_only", "OFF"},
+		{"sync_binlog", "1"},
+	}
+
+	// No changes.
+	t.Check(sysconfig.Diff(prev, prev), IsNil)
+
+	cur := []sysconfig.Setting{
+		{"sync_binlog", "0"},
+		{"max_connections", "151"},
+		{"innodb_flush_log_at_trx_commit", "2"},
+	}
+	got := sysconfig.Diff(prev, cur)
+	expect := []sysconfig.Change{
+		{Variable: "innodb_flush_log_at_trx_commit", Change: sysconfig.CHANGE_ADDED, OldValue: "", NewValue: "2"},
+		{Variable: "read_only", Change: sysconfig.CHANGE_REMOVED, OldValue: "OFF", NewValue: ""},
+		{Variable: "sync_binlog", Change: sysconfig.CHANGE_CHANGED, OldValue: "1", NewValue: "0"},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+
+	// Everything is new.
+	got = sysconfig.Diff(nil, prev)
+	t.Check(got, HasLen, 3)
+}
@@ -0,0 +1,65 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package system
+
+import (
+	mmSystem "github.com/percona/percona-agent/mm/system"
+	"github.com/percona/percona-agent/sysconfig"
+)
+
+type Config struct {
+	sysconfig.Config
+	Sysctl    []string           // e.g. vm.swappiness, DefaultSysctl if empty
+	Processes []mmSystem.Process // for ulimits and NUMA policy, DefaultProcesses if empty
+	// NumaMaps enables reading /proc/<pid>/numa_maps for the NUMA policy of
+	// processes. The kernel walks the whole address space to read it, which
+	// can stall a process with a large buffer pool, so it's off by default.
+	NumaMaps bool
+}
+
+// /proc/sys settings that commonly affect database servers.
+var DefaultSysctl = []string{
+	"fs.aio-max-nr",
+	"fs.file-max",
+	"kernel.numa_balancing",
+	"kernel.shmall",
+	"kernel.shmmax",
+	"net.core.netdev_max_backlog",
+	"net.core.somaxconn",
+	"net.ipv4.ip_local_port_range",
+	"net.ipv4.tcp_fin_timeout",
+	"net.ipv4.tcp_keepalive_time",
+	"net.ipv4.tcp_max_syn_backlog",
+	"net.ipv4.tcp_tw_reuse",
+	"vm.dirty_background_bytes",
+	"vm.dirty_background_ratio",
+	"vm.dirty_bytes",
+	"vm.dirty_expire_centisecs",
+	"vm.dirty_ratio",
+	"vm.dirty_writeback_centisecs",
+	"vm.min_free_kbytes",
+	"vm.nr_hugepages",
+	"vm.overcommit_memory",
+	"vm.overcommit_ratio",
+	"vm.swappiness",
+	"vm.zone_reclaim_mode",
+}
+
+var DefaultProcesses = []mmSystem.Process{
+	{Name: "mysqld"},
+}
@@ -0,0 +1,351 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/percona/cloud-protocol/proto/v1"
+	mmSystem "github.com/percona/percona-agent/mm/system"
+	"github.com/percona/percona-agent/pct"
+	"github.com/percona/percona-agent/sysconfig"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Monitor struct {
+	name   string
+	config *Config
+	logger *pct.Logger
+	// --
+	tickChan   chan time.Time
+	reportChan chan *sysconfig.Report
+	status     *pct.Status
+	sync       *pct.SyncChan
+	running    bool
+}
+
+func NewMonitor(name string, config *Config, logger *pct.Logger) *Monitor {
+	m := &Monitor{
+		name:   name,
+		config: config,
+		logger: logger,
+		// --
+		sync:   pct.NewSyncChan(),
+		status: pct.NewStatus([]string{name}),
+	}
+	return m
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Interface
+/////////////////////////////////////////////////////////////////////////////
+
+// @goroutine[0]
+func (m *Monitor) Start(tickChan chan time.Time, reportChan chan *sysconfig.Report) error {
+	if m.running {
+		return pct.ServiceIsRunningError{m.name}
+	}
+
+	m.status.Update(m.name, "Starting")
+	m.tickChan = tickChan
+	m.reportChan = reportChan
+	go m.run()
+	m.running = true
+	m.logger.Info("Started")
+	return nil
+}
+
+// @goroutine[0]
+func (m *Monitor) Stop() error {
+	if !m.running {
+		return nil // already stopped
+	}
+
+	// Stop run().  When it returns, it updates status to "Stopped".
+	m.status.Update(m.name, "Stopping")
+	m.sync.Stop()
+	m.sync.Wait()
+	m.running = false
+	m.logger.Info("Stopped")
+	// Do not update status to "Stopped" here; run() does that on return.
+
+	return nil
+}
+
+// @goroutine[0]
+func (m *Monitor) Status() map[string]string {
+	return m.status.All()
+}
+
+// @goroutine[0]
+func (m *Monitor) TickChan() chan time.Time {
+	return m.tickChan
+}
+
+// @goroutine[0]
+func (m *Monitor) Config() interface{} {
+	return m.config
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Implementation
+/////////////////////////////////////////////////////////////////////////////
+
+// @goroutine[2]
+func (m *Monitor) run() {
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.Error("System sysconfig monitor crashed: ", err)
+		}
+		m.status.Update(m.name, "Stopped")
+		m.sync.Done()
+	}()
+
+	var lastTs int64
+	for {
+		m.logger.Debug("run:idle")
+		m.status.Update(m.name, fmt.Sprintf("Idle (last collected at %s)", time.Unix(lastTs, 0)))
+
+		select {
+		case now := <-m.tickChan:
+			m.logger.Debug("run:collect:start")
+			m.status.Update(m.name, "Running")
+
+			c := &sysconfig.Report{
+				ServiceInstance: proto.ServiceInstance{
+					Service:    m.config.Service,
+					InstanceId: m.config.InstanceId,
+				},
+				Ts:       now.UTC().Unix(),
+				System:   "server os settings",
+				Settings: m.GetSettings(),
+			}
+
+			if len(c.Settings) > 0 {
+				select {
+				case m.reportChan <- c:
+					lastTs = c.Ts
+				case <-time.After(500 * time.Millisecond):
+					// lost sysconfig
+					m.logger.Debug("Lost OS settings; timeout spooling after 500ms")
+				}
+			} else {
+				m.logger.Debug("No settings") // shouldn't happen
+			}
+
+			m.logger.Debug("run:collect:stop")
+		case <-m.sync.StopChan:
+			m.logger.Debug("run:stop")
+			return
+		}
+	}
+}
+
+// GetSettings returns the sysctl, transparent hugepage, block device, NUMA,
+// and process settings.  Settings that cannot be read are skipped; errors other
+// than not exist are logged.
+// @goroutine[2]
+func (m *Monitor) GetSettings() []sysconfig.Setting {
+	m.logger.Debug("Getting OS settings")
+	m.status.Update(m.name, "Getting OS settings")
+
+	settings := []sysconfig.Setting{}
+
+	keys := m.config.Sysctl
+	if len(keys) == 0 {
+		keys = DefaultSysctl
+	}
+	for _, key := range keys {
+		value, err := readValue(SysctlFile(key))
+		if err != nil {
+			m.warn(err)
+			continue
+		}
+		settings = append(settings, sysconfig.Setting{key, SysctlValue(value)})
+	}
+
+	// RHEL 6 has its own transparent hugepage dir.
+	for _, dir := range []string{"/sys/kernel/mm/transparent_hugepage", "/sys/kernel/mm/redhat_transparent_hugepage"} {
+		for _, file := range []string{"enabled", "defrag"} {
+			value, err := readValue(filepath.Join(dir, file))
+			if err != nil {
+				m.warn(err)
+				continue
+			}
+			settings = append(settings, sysconfig.Setting{"transparent_hugepage." + file, pct.SelectedValue(value)})
+		}
+	}
+
+	devices, _ := filepath.Glob("/sys/block/*")
+	sort.Strings(devices)
+	for _, dir := range devices {
+		dev := filepath.Base(dir)
+		if strings.HasPrefix(dev, "loop") || strings.HasPrefix(dev, "ram") {
+			continue
+		}
+		for _, file := range []string{"scheduler", "read_ahead_kb", "nr_requests", "rotational"} {
+			value, err := readValue(filepath.Join(dir, "queue", file))
+			if err != nil {
+				m.warn(err)
+				continue
+			}
+			settings = append(settings, sysconfig.Setting{"block." + dev + "." + file, pct.SelectedValue(value)})
+		}
+	}
+
+	nodes, _ := filepath.Glob("/sys/devices/system/node/node[0-9]*")
+	if len(nodes) > 0 {
+		settings = append(settings, sysconfig.Setting{"numa.nodes", strconv.Itoa(len(nodes))})
+	}
+
+	processes := m.config.Processes
+	if len(processes) == 0 {
+		processes = DefaultProcesses
+	}
+	for _, p := range processes {
+		pid, err := mmSystem.FindPid(p)
+		if err != nil {
+			m.logger.Debug(err) // process not running
+			continue
+		}
+		procDir := fmt.Sprintf("/proc/%d", pid)
+		if content, err := ioutil.ReadFile(procDir + "/limits"); err == nil {
+			settings = append(settings, ProcLimits(p.Name, content)...)
+		} else {
+			m.warn(err)
+		}
+		// Mems_allowed_list is cheap to read, unlike numa_maps.
+		if content, err := ioutil.ReadFile(procDir + "/status"); err == nil {
+			if mems := MemsAllowed(content); mems != "" {
+				settings = append(settings, sysconfig.Setting{"process." + p.Name + ".mems_allowed", mems})
+			}
+		} else {
+			m.warn(err)
+		}
+		if !m.config.NumaMaps {
+			continue
+		}
+		// numa_maps exists only if the kernel has NUMA support.
+		if content, err := ioutil.ReadFile(procDir + "/numa_maps"); err == nil {
+			settings = append(settings, sysconfig.Setting{"process." + p.Name + ".numa_policy", NumaPolicy(content)})
+		} else {
+			m.warn(err)
+		}
+	}
+
+	return settings
+}
+
+func (m *Monitor) warn(err error) {
+	if !os.IsNotExist(err) {
+		m.logger.Warn(err)
+	}
+}
+
+func readValue(file string) (string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// SysctlFile returns the /proc/sys file of a sysctl key, e.g. vm.swappiness
+// is /proc/sys/vm/swappiness.
+func SysctlFile(key string) string {
+	return filepath.Join("/proc/sys", strings.Replace(key, ".", "/", -1))
+}
+
+// SysctlValue returns the value with whitespace collapsed like sysctl prints it,
+// e.g. "32768\t60999\n" is "32768 60999".
+func SysctlValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// ProcLimits returns the soft and hard limits in /proc/<pid>/limits content as
+// settings like process.mysqld.limits.max_open_files.soft.
+func ProcLimits(name string, content []byte) []sysconfig.Setting {
+	settings := []sysconfig.Setting{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	if !scanner.Scan() {
+		return settings
+	}
+	// Columns are fixed-width, aligned with the header:
+	// Limit                     Soft Limit           Hard Limit           Units
+	header := scanner.Text()
+	soft := strings.Index(header, "Soft Limit")
+	hard := strings.Index(header, "Hard Limit")
+	units := strings.Index(header, "Units")
+	if soft < 0 || hard < soft || units < hard {
+		return settings
+	}
+	prefix := "process." + name + ".limits."
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < units {
+			line += strings.Repeat(" ", units-len(line))
+		}
+		limit := strings.ToLower(strings.TrimSpace(line[:soft]))
+		limit = strings.Join(strings.Fields(limit), "_")
+		settings = append(settings,
+			sysconfig.Setting{prefix + limit + ".soft", strings.TrimSpace(line[soft:hard])},
+			sysconfig.Setting{prefix + limit + ".hard", strings.TrimSpace(line[hard:units])},
+		)
+	}
+	return settings
+}
+
+// MemsAllowed returns the NUMA nodes the process may allocate memory on, like
+// "0-1", from /proc/<pid>/status content, or "" if the kernel doesn't say.
+func MemsAllowed(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// Mems_allowed_list:	0-1
+		f := strings.Fields(scanner.Text())
+		if len(f) == 2 && f[0] == "Mems_allowed_list:" {
+			return f[1]
+		}
+	}
+	return ""
+}
+
+// NumaPolicy returns the distinct NUMA memory policies in /proc/<pid>/numa_maps
+// content, sorted and comma-separated, e.g. "default,interleave:0-1".
+func NumaPolicy(content []byte) string {
+	seen := make(map[string]bool)
+	policies := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// 7f2c1c000000 interleave:0-1 anon=1 dirty=1 N0=1
+		f := strings.Fields(scanner.Text())
+		if len(f) < 2 || seen[f[1]] {
+			continue
+		}
+		seen[f[1]] = true
+		policies = append(policies, f[1])
+	}
+	sort.Strings(policies)
+	return strings.Join(policies, ",")
+}
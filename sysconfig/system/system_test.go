@@ -0,0 +1,82 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package system_test
+
+import (
+	"github.com/percona/percona-agent/sysconfig"
+	"github.com/percona/percona-agent/sysconfig/system"
+	"github.com/percona/percona-agent/test"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"testing"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+var sample = test.RootDir + "/sysconfig/system"
+
+type TestSuite struct {
+}
+
+var _ = Suite(&TestSuite{})
+
+func (s *TestSuite) TestSysctl(t *C) {
+	t.Check(system.SysctlFile("vm.swappiness"), Equals, "/proc/sys/vm/swappiness")
+	t.Check(system.SysctlFile("net.core.somaxconn"), Equals, "/proc/sys/net/core/somaxconn")
+	t.Check(system.SysctlValue("60\n"), Equals, "60")
+	t.Check(system.SysctlValue("32768\t60999\n"), Equals, "32768 60999")
+}
+
+func (s *TestSuite) TestProcLimits(t *C) {
+	content, err := ioutil.ReadFile(sample + "/limits001.txt")
+	t.Assert(err, IsNil)
+	got := system.ProcLimits("mysqld", content)
+	expect := []sysconfig.Setting{
+		{"process.mysqld.limits.max_cpu_time.soft", "unlimited"},
+		{"process.mysqld.limits.max_cpu_time.hard", "unlimited"},
+		{"process.mysqld.limits.max_file_size.soft", "unlimited"},
+		{"process.mysqld.limits.max_file_size.hard", "unlimited"},
+		{"process.mysqld.limits.max_core_file_size.soft", "0"},
+		{"process.mysqld.limits.max_core_file_size.hard", "unlimited"},
+		{"process.mysqld.limits.max_processes.soft", "63459"},
+		{"process.mysqld.limits.max_processes.hard", "63459"},
+		{"process.mysqld.limits.max_open_files.soft", "65535"},
+		{"process.mysqld.limits.max_open_files.hard", "65535"},
+		{"process.mysqld.limits.max_locked_memory.soft", "65536"},
+		{"process.mysqld.limits.max_locked_memory.hard", "65536"},
+		{"process.mysqld.limits.max_nice_priority.soft", "0"},
+		{"process.mysqld.limits.max_nice_priority.hard", "0"},
+	}
+	if same, diff := test.IsDeeply(got, expect); !same {
+		test.Dump(got)
+		t.Error(diff)
+	}
+}
+
+func (s *TestSuite) TestMemsAllowed(t *C) {
+	content := []byte("Name:\tmysqld\nCpus_allowed_list:\t0-7\nMems_allowed:\t00000000,00000003\nMems_allowed_list:\t0-1\nvoluntary_ctxt_switches:\t1416\n")
+	t.Check(system.MemsAllowed(content), Equals, "0-1")
+	t.Check(system.MemsAllowed([]byte("Name:\tmysqld\n")), Equals, "")
+}
+
+func (s *TestSuite) TestNumaPolicy(t *C) {
+	content, err := ioutil.ReadFile(sample + "/numa_maps001.txt")
+	t.Assert(err, IsNil)
+	t.Check(system.NumaPolicy(content), Equals, "default,interleave:0-1")
+}
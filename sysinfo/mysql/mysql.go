@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/instance"
+	mysqlConn "github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/pct"
 	"github.com/percona/percona-agent/pct/cmd"
 )
@@ -33,6 +34,7 @@ const (
 
 type MySQL struct {
 	CmdName string
+	Native  bool // summarize natively, run CmdName only if that fails; Raw is empty if not
 	logger  *pct.Logger
 	ir      *instance.Repo
 }
@@ -62,6 +64,14 @@ func (m *MySQL) Handle(protoCmd *proto.Cmd) *proto.Reply {
 		return protoCmd.Reply(nil, err)
 	}
 
+	if m.Native {
+		summary, err := m.summarize(mysqlIt.DSN)
+		if err == nil {
+			return protoCmd.Reply(&Result{MySQL: summary})
+		}
+		m.logger.Warn(fmt.Sprintf("Native summary failed, running %s: %s", m.CmdName, mysqlConn.FormatError(err)))
+	}
+
 	// Parse DSN to get user, pass, host, port, socket as separate fields
 	// @todo parsing DSN should be as a method on proto.MySQLInstance.DSN or at least parser should be injected
 	dsn, err := NewDSN(mysqlIt.DSN)
@@ -79,8 +89,10 @@ func (m *MySQL) Handle(protoCmd *proto.Cmd) *proto.Reply {
 		m.logger.Error(fmt.Sprintf("%s: %s", m.CmdName, err))
 	}
 
-	result := &proto.SysinfoResult{
-		Raw: output,
+	result := &Result{
+		SysinfoResult: proto.SysinfoResult{
+			Raw: output,
+		},
 	}
 
 	return protoCmd.Reply(result, err)
@@ -90,6 +102,15 @@ func (m *MySQL) Handle(protoCmd *proto.Cmd) *proto.Reply {
 // Implementation
 /////////////////////////////////////////////////////////////////////////////
 
+func (m *MySQL) summarize(dsn string) (*Summary, error) {
+	conn := mysqlConn.NewConnection(dsn)
+	if err := conn.Connect(1); err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return Summarize(conn.DB())
+}
+
 func getServiceInstance(protoCmd *proto.Cmd) (serviceInstance *proto.ServiceInstance, err error) {
 	if protoCmd.Data == nil {
 		return nil, fmt.Errorf("%s.getMySQLInstance:cmd.Data is empty", SERVICE_NAME)
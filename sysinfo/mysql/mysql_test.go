@@ -180,6 +180,55 @@ func (s *TestSuite) TestExecutableNotFound(t *C) {
 	t.Assert(gotReply.Error, Equals, "Executable file not found in $PATH")
 }
 
+func (s *TestSuite) TestNative(t *C) {
+	service := mysql.NewMySQL(s.logger, s.rir)
+	service.Native = true
+	// Native summary doesn't need pt-mysql-summary.
+	service.CmdName = "unknown-executable"
+
+	data, err := json.Marshal(&s.mysqlInstance)
+	t.Assert(err, IsNil)
+
+	cmd := &proto.Cmd{
+		Service: "Summary",
+		Cmd:     "mysql",
+		Data:    data,
+	}
+
+	gotReply := service.Handle(cmd)
+	t.Assert(gotReply, NotNil)
+	t.Assert(gotReply.Error, Equals, "")
+
+	result := &mysql.Result{}
+	err = json.Unmarshal(gotReply.Data, result)
+	t.Assert(err, IsNil)
+	t.Check(result.Raw, Equals, "")
+	t.Assert(result.MySQL, NotNil)
+	t.Check(result.MySQL.Version, Not(Equals), "")
+	t.Check(result.MySQL.Uptime > 0, Equals, true)
+	t.Check(result.MySQL.BufferPool.Size > 0, Equals, true)
+	t.Check(result.MySQL.Variables["max_connections"], Not(Equals), "")
+
+	havePlugin := false
+	for _, p := range result.MySQL.Plugins {
+		if p.Name == "InnoDB" {
+			havePlugin = true
+			t.Check(p.Status, Equals, "ACTIVE")
+		}
+	}
+	t.Check(havePlugin, Equals, true)
+
+	haveSchema := false
+	for _, schema := range result.MySQL.Schemas {
+		if schema.Name == "mysql" {
+			haveSchema = true
+			t.Check(schema.Tables > 0, Equals, true)
+		}
+		t.Check(schema.Name, Not(Equals), "information_schema")
+	}
+	t.Check(haveSchema, Equals, true)
+}
+
 func (s *TestSuite) TestParsingParamsWithSocket(t *C) {
 	dsn, err := mysql.NewDSN("pt-agent:PabloIsAwesome@unix(/var/lib/mysql/mysql.sock)/")
 	t.Assert(err, IsNil)
@@ -0,0 +1,265 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"github.com/percona/cloud-protocol/proto/v1"
+	"strconv"
+	"strings"
+)
+
+// Result is a proto.SysinfoResult with the native Summary, or with Raw if
+// pt-mysql-summary was run because native summaries are disabled or failed.
+type Result struct {
+	proto.SysinfoResult
+	MySQL *Summary `json:",omitempty"`
+}
+
+// Summary is the native, structured equivalent of pt-mysql-summary.
+// Sizes are bytes.
+type Summary struct {
+	Version        string
+	VersionComment string
+	Hostname       string
+	Port           string
+	Uptime         int64
+	Plugins        []Plugin
+	Schemas        []Schema
+	Replication    Replication
+	BufferPool     BufferPool
+	Variables      map[string]string // KeyVariables
+}
+
+type Plugin struct {
+	Name    string
+	Status  string
+	Type    string
+	Library string
+	License string
+}
+
+type Schema struct {
+	Name      string
+	Tables    uint64
+	DataSize  uint64
+	IndexSize uint64
+}
+
+type Replication struct {
+	ServerId     string
+	LogBin       bool
+	BinlogFormat string
+	GtidMode     string
+	ReadOnly     bool
+	Slave        []map[string]string // SHOW SLAVE STATUS, one per channel
+}
+
+type BufferPool struct {
+	Size       uint64
+	Instances  uint64
+	PagesTotal uint64
+	PagesFree  uint64
+	PagesData  uint64
+	PagesDirty uint64
+}
+
+// Global variables worth knowing at a glance, like the "Noteworthy Variables"
+// section of pt-mysql-summary.  Variables that don't exist are not reported.
+var KeyVariables = []string{
+	"binlog_format",
+	"character_set_server",
+	"collation_server",
+	"datadir",
+	"innodb_buffer_pool_size",
+	"innodb_file_per_table",
+	"innodb_flush_log_at_trx_commit",
+	"innodb_flush_method",
+	"innodb_log_file_size",
+	"innodb_log_files_in_group",
+	"key_buffer_size",
+	"log_bin",
+	"long_query_time",
+	"max_connections",
+	"query_cache_size",
+	"query_cache_type",
+	"read_only",
+	"slow_query_log",
+	"sql_mode",
+	"sync_binlog",
+	"table_open_cache",
+	"thread_cache_size",
+	"tmp_table_size",
+}
+
+// Summarize returns the summary of the MySQL server connected to by db. Only
+// variables and status are required. Other sections are left empty if they
+// can't be queried, e.g. SHOW SLAVE STATUS without the REPLICATION CLIENT
+// privilege.
+func Summarize(db *sql.DB) (*Summary, error) {
+	vars, err := queryPairs(db, "SHOW /*!50002 GLOBAL */ VARIABLES")
+	if err != nil {
+		return nil, err
+	}
+	status, err := queryPairs(db, "SHOW /*!50002 GLOBAL */ STATUS")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Summary{
+		Version:        vars["version"],
+		VersionComment: vars["version_comment"],
+		Hostname:       vars["hostname"],
+		Port:           vars["port"],
+		Variables:      make(map[string]string),
+	}
+	s.Uptime, _ = strconv.ParseInt(status["uptime"], 10, 64)
+	for _, name := range KeyVariables {
+		if value, ok := vars[name]; ok {
+			s.Variables[name] = value
+		}
+	}
+
+	s.Replication = Replication{
+		ServerId:     vars["server_id"],
+		LogBin:       vars["log_bin"] == "ON",
+		BinlogFormat: vars["binlog_format"],
+		GtidMode:     vars["gtid_mode"],
+		ReadOnly:     vars["read_only"] == "ON",
+	}
+	if slave, err := slaveStatus(db); err == nil {
+		s.Replication.Slave = slave
+	}
+
+	s.BufferPool = BufferPool{
+		Size:       toUint(vars["innodb_buffer_pool_size"]),
+		Instances:  toUint(vars["innodb_buffer_pool_instances"]),
+		PagesTotal: toUint(status["innodb_buffer_pool_pages_total"]),
+		PagesFree:  toUint(status["innodb_buffer_pool_pages_free"]),
+		PagesData:  toUint(status["innodb_buffer_pool_pages_data"]),
+		PagesDirty: toUint(status["innodb_buffer_pool_pages_dirty"]),
+	}
+
+	if p, err := plugins(db); err == nil {
+		s.Plugins = p
+	}
+	if sc, err := schemas(db); err == nil {
+		s.Schemas = sc
+	}
+
+	return s, nil
+}
+
+// queryPairs returns the rows of a two-column query like SHOW VARIABLES as
+// a map with lowercase keys.
+func queryPairs(db *sql.DB, query string) (map[string]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pairs := make(map[string]string)
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		pairs[strings.ToLower(name)] = value.String
+	}
+	return pairs, rows.Err()
+}
+
+func slaveStatus(db *sql.DB) ([]map[string]string, error) {
+	// Columns vary by version, so scan them all.
+	rows, err := db.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	slave := []map[string]string{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		status := make(map[string]string)
+		for i, column := range columns {
+			if values[i].Valid {
+				status[column] = values[i].String
+			}
+		}
+		slave = append(slave, status)
+	}
+	return slave, rows.Err()
+}
+
+func plugins(db *sql.DB) ([]Plugin, error) {
+	rows, err := db.Query("SELECT PLUGIN_NAME, PLUGIN_STATUS, PLUGIN_TYPE, PLUGIN_LIBRARY, PLUGIN_LICENSE" +
+		" FROM information_schema.PLUGINS ORDER BY PLUGIN_NAME")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	plugins := []Plugin{}
+	for rows.Next() {
+		var p Plugin
+		var library, license sql.NullString // NULL for built-in plugins
+		if err = rows.Scan(&p.Name, &p.Status, &p.Type, &library, &license); err != nil {
+			return nil, err
+		}
+		p.Library = library.String
+		p.License = license.String
+		plugins = append(plugins, p)
+	}
+	return plugins, rows.Err()
+}
+
+func schemas(db *sql.DB) ([]Schema, error) {
+	rows, err := db.Query("SELECT TABLE_SCHEMA, COUNT(*)," +
+		" COALESCE(SUM(DATA_LENGTH), 0), COALESCE(SUM(INDEX_LENGTH), 0)" +
+		" FROM information_schema.TABLES" +
+		" WHERE TABLE_SCHEMA NOT IN ('information_schema', 'performance_schema')" +
+		" GROUP BY TABLE_SCHEMA ORDER BY TABLE_SCHEMA")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	schemas := []Schema{}
+	for rows.Next() {
+		var s Schema
+		if err = rows.Scan(&s.Name, &s.Tables, &s.DataSize, &s.IndexSize); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas, rows.Err()
+}
+
+func toUint(s string) uint64 {
+	n, _ := strconv.ParseUint(s, 10, 64)
+	return n
+}
@@ -0,0 +1,326 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/percona/cloud-protocol/proto/v1"
+	"github.com/percona/percona-agent/pct"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Result is a proto.SysinfoResult with the native Summary, or with Raw if
+// pt-summary was run because native summaries are disabled or failed.
+type Result struct {
+	proto.SysinfoResult
+	System *Summary `json:",omitempty"`
+}
+
+// Summary is the native, structured equivalent of pt-summary.  Sizes are bytes.
+type Summary struct {
+	Hostname string
+	Kernel   string
+	Platform string
+	CPU      CPU
+	Memory   Memory
+	Disks    []Disk
+	Mounts   []Mount
+	Network  []Interface
+}
+
+type CPU struct {
+	Model   string
+	Sockets int
+	Cores   int
+	Threads int
+	MHz     float64
+}
+
+type Memory struct {
+	Total     uint64
+	Free      uint64
+	Available uint64
+	Buffers   uint64
+	Cached    uint64
+	SwapTotal uint64
+	SwapFree  uint64
+}
+
+type Disk struct {
+	Name       string
+	Size       uint64
+	Rotational bool
+	Scheduler  string
+}
+
+type Mount struct {
+	Device  string
+	Path    string
+	Type    string
+	Options string
+	Size    uint64
+	Used    uint64
+	Free    uint64
+}
+
+type Interface struct {
+	Name  string
+	MAC   string
+	MTU   int
+	Addrs []string
+}
+
+// Summarize returns the system summary from /proc, /sys, and the kernel.
+// Only failing to read CPU and memory info is an error; other parts are
+// left empty if they cannot be read.
+func Summarize() (*Summary, error) {
+	s := &Summary{}
+	s.Hostname, _ = os.Hostname()
+	if content, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		s.Kernel = strings.TrimSpace(string(content))
+	}
+	if content, err := ioutil.ReadFile("/etc/os-release"); err == nil {
+		s.Platform = ParseOsRelease(content)
+	}
+
+	content, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	s.CPU = ParseCPUInfo(content)
+
+	content, err = ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	s.Memory = ParseMemInfo(content)
+
+	s.Disks = Disks()
+
+	if content, err := ioutil.ReadFile("/proc/mounts"); err == nil {
+		s.Mounts = ParseMounts(content)
+		for i := range s.Mounts {
+			m := &s.Mounts[i]
+			st := &syscall.Statfs_t{}
+			if err := syscall.Statfs(m.Path, st); err != nil {
+				continue
+			}
+			bsize := uint64(st.Frsize)
+			if bsize == 0 {
+				bsize = uint64(st.Bsize)
+			}
+			m.Size = st.Blocks * bsize
+			m.Used = (st.Blocks - st.Bfree) * bsize
+			m.Free = st.Bavail * bsize
+		}
+	}
+
+	s.Network = Network()
+
+	return s, nil
+}
+
+// ParseOsRelease returns PRETTY_NAME from /etc/os-release content.
+func ParseOsRelease(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "PRETTY_NAME=") {
+			return strings.Trim(strings.TrimPrefix(line, "PRETTY_NAME="), `"'`)
+		}
+	}
+	return ""
+}
+
+// ParseCPUInfo returns the CPU model and topology from /proc/cpuinfo content.
+func ParseCPUInfo(content []byte) CPU {
+	cpu := CPU{}
+	cores := make(map[string]int) // physical id => cpu cores
+	physicalId := ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "processor":
+			cpu.Threads++
+			physicalId = ""
+		case "model name":
+			if cpu.Model == "" {
+				cpu.Model = strings.Join(strings.Fields(value), " ")
+			}
+		case "cpu MHz":
+			if cpu.MHz == 0 {
+				cpu.MHz, _ = strconv.ParseFloat(value, 64)
+			}
+		case "physical id":
+			physicalId = value
+			if _, ok := cores[physicalId]; !ok {
+				cores[physicalId] = 0
+			}
+		case "cpu cores":
+			n, _ := strconv.Atoi(value)
+			cores[physicalId] = n
+		}
+	}
+	cpu.Sockets = len(cores)
+	for _, n := range cores {
+		cpu.Cores += n
+	}
+	// Virtual machines often don't report topology.
+	if cpu.Sockets == 0 && cpu.Threads > 0 {
+		cpu.Sockets = 1
+	}
+	if cpu.Cores == 0 {
+		cpu.Cores = cpu.Threads
+	}
+	return cpu
+}
+
+// ParseMemInfo returns the memory sizes in bytes from /proc/meminfo content.
+func ParseMemInfo(content []byte) Memory {
+	mem := Memory{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// MemTotal:        8046892 kB
+		f := strings.Fields(scanner.Text())
+		if len(f) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(f) > 2 && f[2] == "kB" {
+			n *= 1024
+		}
+		switch strings.TrimSuffix(f[0], ":") {
+		case "MemTotal":
+			mem.Total = n
+		case "MemFree":
+			mem.Free = n
+		case "MemAvailable":
+			mem.Available = n
+		case "Buffers":
+			mem.Buffers = n
+		case "Cached":
+			mem.Cached = n
+		case "SwapTotal":
+			mem.SwapTotal = n
+		case "SwapFree":
+			mem.SwapFree = n
+		}
+	}
+	return mem
+}
+
+// ParseMounts returns the block device mounts in /proc/mounts content, i.e.
+// not pseudo filesystems like proc and tmpfs.  Size, Used, and Free are not set.
+func ParseMounts(content []byte) []Mount {
+	mounts := []Mount{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// /dev/sda1 /boot xfs rw,relatime,attr2,inode64,noquota 0 0
+		f := strings.Fields(scanner.Text())
+		if len(f) < 4 || !strings.HasPrefix(f[0], "/") {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Device:  f[0],
+			Path:    strings.Replace(f[1], "\\040", " ", -1),
+			Type:    f[2],
+			Options: f[3],
+		})
+	}
+	return mounts
+}
+
+// Disks returns the block devices in /sys/block, except loop and ram devices.
+func Disks() []Disk {
+	disks := []Disk{}
+	dirs, _ := filepath.Glob("/sys/block/*")
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		disk := Disk{Name: name}
+		// size is always in 512-byte sectors regardless of the sector size.
+		if v, err := readSysValue(filepath.Join(dir, "size")); err == nil {
+			sectors, _ := strconv.ParseUint(v, 10, 64)
+			disk.Size = sectors * 512
+		}
+		if v, err := readSysValue(filepath.Join(dir, "queue", "rotational")); err == nil {
+			disk.Rotational = v == "1"
+		}
+		if v, err := readSysValue(filepath.Join(dir, "queue", "scheduler")); err == nil {
+			disk.Scheduler = pct.SelectedValue(v)
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+// Network returns the network interfaces except loopback.
+func Network() []Interface {
+	ifaces := []Interface{}
+	all, err := net.Interfaces()
+	if err != nil {
+		return ifaces
+	}
+	for _, i := range all {
+		if i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		iface := Interface{
+			Name:  i.Name,
+			MAC:   i.HardwareAddr.String(),
+			MTU:   i.MTU,
+			Addrs: []string{},
+		}
+		if addrs, err := i.Addrs(); err == nil {
+			for _, a := range addrs {
+				iface.Addrs = append(iface.Addrs, a.String())
+			}
+		}
+		ifaces = append(ifaces, iface)
+	}
+	return ifaces
+}
+
+func readSysValue(file string) (string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
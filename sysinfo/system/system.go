@@ -31,6 +31,7 @@ const (
 
 type System struct {
 	CmdName string
+	Native  bool // summarize natively, run CmdName only if that fails; Raw is empty if not
 	logger  *pct.Logger
 }
 
@@ -46,6 +47,14 @@ func NewSystem(logger *pct.Logger) *System {
 /////////////////////////////////////////////////////////////////////////////
 
 func (s *System) Handle(protoCmd *proto.Cmd) *proto.Reply {
+	if s.Native {
+		summary, err := Summarize()
+		if err == nil {
+			return protoCmd.Reply(&Result{System: summary})
+		}
+		s.logger.Warn(fmt.Sprintf("Native summary failed, running %s: %s", s.CmdName, err))
+	}
+
 	args := []string{
 		"--sleep", PT_SLEEP_SECONDS,
 	}
@@ -55,8 +64,10 @@ func (s *System) Handle(protoCmd *proto.Cmd) *proto.Reply {
 		s.logger.Error(fmt.Sprintf("%s: %s", s.CmdName, err))
 	}
 
-	result := &proto.SysinfoResult{
-		Raw: output,
+	result := &Result{
+		SysinfoResult: proto.SysinfoResult{
+			Raw: output,
+		},
 	}
 
 	return protoCmd.Reply(result, err)
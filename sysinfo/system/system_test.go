@@ -22,6 +22,7 @@ import (
 	"github.com/percona/cloud-protocol/proto/v1"
 	"github.com/percona/percona-agent/pct"
 	"github.com/percona/percona-agent/sysinfo/system"
+	"github.com/percona/percona-agent/test"
 	. "github.com/percona/percona-agent/test/checkers"
 	"github.com/percona/percona-agent/test/mock"
 	. "gopkg.in/check.v1"
@@ -144,3 +145,76 @@ func (s *TestSuite) TestExecutableNotFound(t *C) {
 	// changing this string means breaking contract between agent/api and web-app
 	t.Assert(gotReply.Error, Equals, "Executable file not found in $PATH")
 }
+
+func (s *TestSuite) TestNative(t *C) {
+	service := system.NewSystem(s.logger)
+	service.Native = true
+	// Native summary doesn't need pt-summary.
+	service.CmdName = "unknown-executable"
+
+	cmd := &proto.Cmd{
+		Service: "Summary",
+		Cmd:     "system",
+	}
+
+	gotReply := service.Handle(cmd)
+	t.Assert(gotReply, NotNil)
+	t.Assert(gotReply.Error, Equals, "")
+
+	result := &system.Result{}
+	err := json.Unmarshal(gotReply.Data, result)
+	t.Assert(err, IsNil)
+	t.Check(result.Raw, Equals, "")
+	t.Assert(result.System, NotNil)
+	t.Check(result.System.Hostname, Not(Equals), "")
+	t.Check(result.System.CPU.Threads > 0, Equals, true)
+	t.Check(result.System.Memory.Total > 0, Equals, true)
+}
+
+func (s *TestSuite) TestParseCPUInfo(t *C) {
+	content, err := ioutil.ReadFile(test.RootDir + "/sysinfo/system/cpuinfo001.txt")
+	t.Assert(err, IsNil)
+	got := system.ParseCPUInfo(content)
+	expect := system.CPU{
+		Model:   "Intel(R) Xeon(R) CPU E5-2620 0 @ 2.00GHz",
+		Sockets: 2,
+		Cores:   2,
+		Threads: 4,
+		MHz:     1999.998,
+	}
+	t.Check(got, DeepEquals, expect)
+}
+
+func (s *TestSuite) TestParseMemInfo(t *C) {
+	content, err := ioutil.ReadFile(test.RootDir + "/mm/proc/meminfo001.txt")
+	t.Assert(err, IsNil)
+	got := system.ParseMemInfo(content)
+	expect := system.Memory{
+		Total:     8046892 * 1024,
+		Free:      5273644 * 1024,
+		Buffers:   300684 * 1024,
+		Cached:    946852 * 1024,
+		SwapTotal: 8253436 * 1024,
+		SwapFree:  8253436 * 1024,
+	}
+	t.Check(got, DeepEquals, expect)
+}
+
+func (s *TestSuite) TestParseMounts(t *C) {
+	content, err := ioutil.ReadFile(test.RootDir + "/mm/proc/mounts001.txt")
+	t.Assert(err, IsNil)
+	got := system.ParseMounts(content)
+	expect := []system.Mount{
+		{Device: "/dev/mapper/centos-root", Path: "/", Type: "xfs", Options: "rw,relatime,attr2,inode64,noquota"},
+		{Device: "/dev/sda1", Path: "/boot", Type: "xfs", Options: "rw,relatime,attr2,inode64,noquota"},
+		{Device: "/dev/sdb1", Path: "/var/lib/mysql", Type: "xfs", Options: "rw,noatime,attr2,inode64,noquota"},
+		{Device: "/dev/sdc1", Path: "/var/lib/mysql/binlogs", Type: "ext4", Options: "rw,noatime,data=ordered"},
+		{Device: "/dev/sdd1", Path: "/mnt/slow logs", Type: "ext4", Options: "rw,relatime,data=ordered"},
+	}
+	t.Check(got, DeepEquals, expect)
+}
+
+func (s *TestSuite) TestParseOsRelease(t *C) {
+	content := []byte("NAME=\"CentOS Linux\"\nVERSION=\"7 (Core)\"\nPRETTY_NAME=\"CentOS Linux 7 (Core)\"\n")
+	t.Check(system.ParseOsRelease(content), Equals, "CentOS Linux 7 (Core)")
+}
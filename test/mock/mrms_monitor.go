@@ -19,26 +19,25 @@ package mock
 
 import (
 	"time"
+
+	"github.com/percona/percona-agent/mrms"
 )
 
 type MrmsMonitor struct {
-	c          chan bool
-	globalChan chan string
+	c chan *mrms.Event
 }
 
 func NewMrmsMonitor() *MrmsMonitor {
-	m := &MrmsMonitor{
-		globalChan: make(chan string, 100),
-	}
+	m := &MrmsMonitor{}
 	return m
 }
 
-func (m *MrmsMonitor) Add(dsn string) (<-chan bool, error) {
-	m.c = make(chan bool, 10)
-	return m.c, nil
+func (m *MrmsMonitor) Subscribe(dsn string, c chan *mrms.Event) error {
+	m.c = c
+	return nil
 }
 
-func (m *MrmsMonitor) Remove(dsn string, c <-chan bool) {
+func (m *MrmsMonitor) Unsubscribe(dsn string, c chan *mrms.Event) {
 }
 
 func (m *MrmsMonitor) Check() {
@@ -58,14 +57,12 @@ func (m *MrmsMonitor) Status() (status map[string]string) {
 	}
 }
 
-// The restartChan in the real MrmsMonitor is read only.
-// To be consistent with that, instead of returning the channel just for
-// testing purposes, we have this method to simulate a MySQL restart
+// The real MrmsMonitor sends events when it checks MySQL, so this method
+// simulates a MySQL restart by sending an event to the last subscriber.
 func (m *MrmsMonitor) SimulateMySQLRestart() {
-	m.c <- true
+	m.SimulateEvent(mrms.NewEvent("", time.Now().UTC(), []mrms.Change{{Type: mrms.CHANGE_RESTART}}))
 }
 
-func (m *MrmsMonitor) GlobalSubscribe() (chan string, error) {
-	return m.globalChan, nil
-
+func (m *MrmsMonitor) SimulateEvent(e *mrms.Event) {
+	m.c <- e
 }
@@ -20,6 +20,7 @@ package mock
 import (
 	"time"
 
+	"github.com/percona/percona-agent/mrms"
 	"github.com/percona/percona-agent/mysql"
 	"github.com/percona/percona-agent/qan"
 )
@@ -95,7 +96,7 @@ type AnalyzerArgs struct {
 	Config      qan.Config
 	Name        string
 	MysqlConn   mysql.Connector
-	RestartChan <-chan bool
+	RestartChan <-chan *mrms.Event
 	TickChan    chan time.Time
 }
 
@@ -117,7 +118,7 @@ func (f *QanAnalyzerFactory) Make(
 	config qan.Config,
 	name string,
 	mysqlConn mysql.Connector,
-	restartChan <-chan bool,
+	restartChan <-chan *mrms.Event,
 	tickChan chan time.Time,
 ) qan.Analyzer {
 	if f.n < len(f.analyzers) {
@@ -0,0 +1,46 @@
+/*
+   Copyright (c) 2014-2015, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package mock
+
+import (
+	"github.com/percona/percona-agent/mysql"
+	"github.com/percona/percona-agent/qan"
+)
+
+type QanBackfiller struct {
+	ConfigChan chan qan.BackfillConfig
+	ErrorChan  chan error
+}
+
+func NewQanBackfiller() *QanBackfiller {
+	b := &QanBackfiller{
+		ConfigChan: make(chan qan.BackfillConfig, 1),
+		ErrorChan:  make(chan error, 1),
+	}
+	return b
+}
+
+func (b *QanBackfiller) Backfill(config qan.BackfillConfig, mysqlConn mysql.Connector, stopChan <-chan bool) error {
+	b.ConfigChan <- config
+	select {
+	case err := <-b.ErrorChan:
+		return err
+	default:
+	}
+	return nil
+}
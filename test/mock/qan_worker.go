@@ -32,6 +32,7 @@ type QanWorker struct {
 	CleanupCrashChan chan bool
 	Interval         *qan.Interval
 	Result           *qan.Result
+	Config           qan.Config
 }
 
 func NewQanWorker() *QanWorker {
@@ -75,6 +76,10 @@ func (w *QanWorker) Status() map[string]string {
 	}
 }
 
+func (w *QanWorker) SetConfig(config qan.Config) {
+	w.Config = config
+}
+
 // --------------------------------------------------------------------------
 
 func (w *QanWorker) crashOrError() error {
@@ -56,10 +56,11 @@ func (f *SysconfigMonitorFactory) Set(monitors []sysconfig.Monitor) {
 // --------------------------------------------------------------------------
 
 type SysconfigMonitor struct {
-	tickChan  chan time.Time
-	ReadyChan chan bool
-	running   bool
-	config    interface{}
+	tickChan   chan time.Time
+	reportChan chan *sysconfig.Report
+	ReadyChan  chan bool
+	running    bool
+	config     interface{}
 }
 
 func NewSysconfigMonitor() *SysconfigMonitor {
@@ -71,6 +72,7 @@ func (m *SysconfigMonitor) Start(tickChan chan time.Time, reportChan chan *sysco
 	if m.ReadyChan != nil {
 		<-m.ReadyChan
 	}
+	m.reportChan = reportChan
 	m.running = true
 	return nil
 }
@@ -101,3 +103,7 @@ func (m *SysconfigMonitor) Config() interface{} {
 func (m *SysconfigMonitor) SetConfig(v interface{}) {
 	m.config = v
 }
+
+func (m *SysconfigMonitor) SendReport(r *sysconfig.Report) {
+	m.reportChan <- r
+}